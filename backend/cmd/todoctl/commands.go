@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/config"
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/handlers"
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/logging"
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/services"
+)
+
+// tool runs the user and todo commands through the same services as the
+// server, so the same validation and quotas apply.
+type tool struct {
+	stores   handlers.Stores
+	users    *services.UserService
+	todos    *services.TodoService
+	sessions *services.SessionService
+	stdin    *bufio.Reader
+	out      *printer
+}
+
+func newTool(cfg config.Config, stores handlers.Stores, stdin io.Reader, out *printer) *tool {
+	users := services.NewUserService(stores.Users, services.WithChallengeStore(stores.Challenges))
+	return &tool{
+		stores: stores,
+		users:  users,
+		todos: services.NewTodoService(stores.Todos, time.Now,
+			services.WithLocationResolver(users),
+			services.WithTodoQuota(cfg.TodoQuota),
+		),
+		sessions: services.NewSessionService(stores.Sessions, services.DefaultSessionTTL, time.Now),
+		stdin:    bufio.NewReader(stdin),
+		out:      out,
+	}
+}
+
+// exec dispatches args, which start with the command name.
+func (t *tool) exec(ctx context.Context, args []string) error {
+	command := strings.Join(args[:min(2, len(args))], " ")
+	switch {
+	case command == "users list" && len(args) == 2:
+		return t.listUsers(ctx)
+	case command == "users create" && len(args) == 3:
+		return t.createUser(ctx, args[2])
+	case command == "users disable" && len(args) == 3:
+		return t.setDisabled(ctx, args[2], true)
+	case command == "users enable" && len(args) == 3:
+		return t.setDisabled(ctx, args[2], false)
+	case command == "users reset-password" && len(args) == 3:
+		return t.resetPassword(ctx, args[2])
+	case command == "todos list" && len(args) == 3:
+		return t.listTodos(ctx, args[2])
+	case command == "todos export" && (len(args) == 3 || len(args) == 4):
+		return t.exportTodos(ctx, args[2], args[3:])
+	case command == "todos import" && (len(args) == 3 || len(args) == 4):
+		return t.importTodos(ctx, args[2], args[3:])
+	case command == "todos purge" && len(args) == 3:
+		return t.purgeTodos(ctx, args[2])
+	case args[0] == "stats" && len(args) == 1:
+		return t.stats(ctx)
+	default:
+		return errUsage
+	}
+}
+
+// action is the output of the commands that change data.
+type action struct {
+	Email  string `json:"email"`
+	Action string `json:"action"`
+	Count  *int64 `json:"count,omitempty"`
+}
+
+func (t *tool) done(email, verb string, count *int64) error {
+	result := action{Email: services.NormalizeEmail(email), Action: verb, Count: count}
+	return t.out.print(result, func(w *table) {
+		if count != nil {
+			w.row(fmt.Sprintf("%s %d todos of %s", verb, *count, result.Email))
+			return
+		}
+		w.row(fmt.Sprintf("%s %s", verb, result.Email))
+	})
+}
+
+func (t *tool) listUsers(ctx context.Context) error {
+	users, err := t.users.List(ctx)
+	if err != nil {
+		return err
+	}
+	return t.out.print(users, func(w *table) {
+		w.row("EMAIL", "NAME", "TIME ZONE", "STATUS")
+		for _, user := range users {
+			status := "active"
+			if user.Disabled {
+				status = "disabled"
+			}
+			w.row(user.Email, user.DisplayName, user.TimeZone, status)
+		}
+	})
+}
+
+func (t *tool) createUser(ctx context.Context, email string) error {
+	pass, err := t.password()
+	if err != nil {
+		return err
+	}
+	if err := t.users.Register(ctx, services.User{Email: email, Password: pass}); err != nil {
+		return err
+	}
+	return t.done(email, "created", nil)
+}
+
+// setDisabled also ends the sessions of a disabled user. Those todoctl
+// cannot reach are refused by the server, which checks the user on every
+// request.
+func (t *tool) setDisabled(ctx context.Context, email string, disabled bool) error {
+	if err := t.users.SetDisabled(ctx, email, disabled); err != nil {
+		return err
+	}
+	if !disabled {
+		return t.done(email, "enabled", nil)
+	}
+	if t.stores.Sessions != nil {
+		if err := t.sessions.RevokeAll(ctx, email); err != nil {
+			return err
+		}
+	}
+	return t.done(email, "disabled", nil)
+}
+
+// resetPassword also ends the sessions opened with the old password.
+func (t *tool) resetPassword(ctx context.Context, email string) error {
+	pass, err := t.password()
+	if err != nil {
+		return err
+	}
+	if err := t.users.ResetPassword(ctx, email, pass); err != nil {
+		return err
+	}
+	if t.stores.Sessions == nil {
+		// The bolt driver keeps sessions in the memory of the server process.
+		logging.FromContext(ctx).Warn("sessions could not be ended; restart the server to end them",
+			slog.String("email", services.NormalizeEmail(email)))
+	} else if err := t.sessions.RevokeAll(ctx, email); err != nil {
+		return err
+	}
+	return t.done(email, "password reset", nil)
+}
+
+// password returns the first line of stdin.
+func (t *tool) password() (string, error) {
+	line, err := t.stdin.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (t *tool) listTodos(ctx context.Context, email string) error {
+	todos, err := t.todos.List(ctx, email)
+	if err != nil {
+		return err
+	}
+	return t.out.print(todos, func(w *table) {
+		w.row("ID", "TITLE", "DONE", "DUE", "CREATED")
+		for _, todo := range todos {
+			due := ""
+			if todo.DueAt != nil {
+				due = todo.DueAt.Format(time.RFC3339)
+			}
+			w.row(todo.ID, todo.Title, strconv.FormatBool(todo.Completed), due, todo.CreatedAt.Format(time.RFC3339))
+		}
+	})
+}
+
+// exportTodos writes the todos in the given format, JSON by default, which
+// importTodos reads back.
+func (t *tool) exportTodos(ctx context.Context, email string, format []string) error {
+	if len(format) == 0 {
+		format = []string{services.TodoFormatJSON}
+	}
+	return t.todos.Export(ctx, email, format[0], t.out.out)
+}
+
+// importTodos creates todos from an export, read from file or stdin. The
+// file extension selects the format; stdin is read as JSON. Rejected todos
+// do not stop the others, but make the command fail after reporting them.
+func (t *tool) importTodos(ctx context.Context, email string, file []string) error {
+	email = services.NormalizeEmail(email)
+	if _, err := t.stores.Users.FindByEmail(ctx, email); err != nil {
+		return fmt.Errorf("user %s: %w", email, err)
+	}
+
+	in, format := io.Reader(t.stdin), services.TodoFormatJSON
+	if len(file) > 0 {
+		f, err := os.Open(file[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+		if ext := strings.TrimPrefix(filepath.Ext(file[0]), "."); ext != "" {
+			format = strings.ToLower(ext)
+		}
+	}
+	result, err := t.todos.Import(ctx, email, in, format, false)
+	if err != nil {
+		return fmt.Errorf("reading todos: %w", err)
+	}
+
+	imported := int64(len(result.Todos))
+	if err := t.done(email, "imported", &imported); err != nil {
+		return err
+	}
+	if len(result.Errors) == 0 {
+		return nil
+	}
+	rejected := make([]error, len(result.Errors))
+	for i, rowErr := range result.Errors {
+		rejected[i] = rowErr
+	}
+	return fmt.Errorf("rejected %d todos:\n%w", len(rejected), errors.Join(rejected...))
+}
+
+func (t *tool) purgeTodos(ctx context.Context, email string) error {
+	// An empty email would clear the todos of every user.
+	if services.NormalizeEmail(email) == "" {
+		return errUsage
+	}
+	usage, err := t.todos.Usage(ctx, email)
+	if err != nil {
+		return err
+	}
+	if err := t.todos.Clear(ctx, email); err != nil {
+		return err
+	}
+	return t.done(email, "purged", &usage.Todos.Used)
+}
+
+// stats summarises the stored data.
+type stats struct {
+	Users           int `json:"users"`
+	DisabledUsers   int `json:"disabledUsers"`
+	PendingDeletion int `json:"pendingDeletion"`
+	Todos           int `json:"todos"`
+	CompletedTodos  int `json:"completedTodos"`
+	OverdueTodos    int `json:"overdueTodos"`
+}
+
+func (t *tool) stats(ctx context.Context) error {
+	users, err := t.stores.Users.List(ctx)
+	if err != nil {
+		return err
+	}
+	todos, err := t.stores.Todos.List(ctx, "")
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	s := stats{Users: len(users), Todos: len(todos)}
+	for _, user := range users {
+		if user.Disabled {
+			s.DisabledUsers++
+		}
+		if !user.DeleteAfter.IsZero() {
+			s.PendingDeletion++
+		}
+	}
+	for _, todo := range todos {
+		switch {
+		case todo.Completed:
+			s.CompletedTodos++
+		case todo.DueAt != nil && todo.DueAt.Before(now):
+			s.OverdueTodos++
+		}
+	}
+
+	return t.out.print(s, func(w *table) {
+		w.row("users", strconv.Itoa(s.Users))
+		w.row("disabled users", strconv.Itoa(s.DisabledUsers))
+		w.row("pending deletion", strconv.Itoa(s.PendingDeletion))
+		w.row("todos", strconv.Itoa(s.Todos))
+		w.row("completed todos", strconv.Itoa(s.CompletedTodos))
+		w.row("overdue todos", strconv.Itoa(s.OverdueTodos))
+	})
+}
@@ -0,0 +1,124 @@
+// Command todoctl administers users and todos without going through the
+// HTTP API or a database shell. It reads the same environment variables as
+// the server (see config.Load), so it works on the data the server uses.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/config"
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/handlers"
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/logging"
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/migrate"
+
+	// Embebe la base de zonas horarias para contenedores sin tzdata
+	_ "time/tzdata"
+)
+
+const usage = `usage: todoctl [-o table|json] <command> [arguments]
+
+commands:
+  users list
+  users create <email>
+  users disable <email>              block logins and end every session
+  users enable <email>
+  users reset-password <email>
+  todos list <email>
+  todos export <email> [format]      print the todos as json (default), csv,
+                                     md (a Markdown checklist) or ics
+                                     (iCalendar VTODOs)
+  todos import <email> [file]        create todos from an export, read from
+                                     file or stdin; the file extension gives
+                                     the format, stdin is read as json
+  todos purge <email>                delete every todo of the user
+  migrate list|up|down [flags]       run "todoctl migrate" for details
+  stats
+
+Passwords are read from the first line of stdin, never from arguments, so
+they stay out of the shell history and the process list.
+Commands work on the mongo and bolt storage drivers; the memory driver keeps
+no data outside the server process.
+The bolt driver keeps sessions in the server process too, so reset-password
+cannot end them there; the server refuses those of disabled users.
+Logs go to stderr; the output format applies to stdout.`
+
+var (
+	// errUsage is returned for invalid arguments; usage explains them.
+	errUsage = errors.New("invalid arguments")
+	// errMemoryDriver is returned when configured for the memory driver,
+	// whose data only lives in the server process.
+	errMemoryDriver = errors.New("the memory storage driver keeps no data to administer; use mongo or bolt")
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	err := run(ctx, os.Args[1:], os.LookupEnv, os.Stdin, os.Stdout, os.Stderr)
+	stop()
+
+	switch {
+	case errors.Is(err, errUsage):
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	case errors.Is(err, migrate.ErrUsage):
+		fmt.Fprintln(os.Stderr, migrate.Usage)
+		os.Exit(2)
+	case err != nil:
+		fmt.Fprintln(os.Stderr, "todoctl:", err)
+		os.Exit(1)
+	}
+}
+
+// run executes the command in args. lookup reads the configuration, as
+// os.LookupEnv does for the server.
+func run(ctx context.Context, args []string, lookup func(string) (string, bool), stdin io.Reader, stdout, stderr io.Writer) (err error) {
+	flags := flag.NewFlagSet("todoctl", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	format := flags.String("o", formatTable, "output format, table or json")
+	if err := flags.Parse(args); err != nil || flags.NArg() == 0 {
+		return errUsage
+	}
+	if *format != formatTable && *format != formatJSON {
+		return errUsage
+	}
+	args = flags.Args()
+
+	cfg, err := config.Load(lookup)
+	if err != nil {
+		return err
+	}
+	logger, err := logging.New(stderr, cfg.LogLevel, cfg.LogFormat)
+	if err != nil {
+		return err
+	}
+	ctx = logging.WithContext(ctx, logger)
+
+	if args[0] == "migrate" {
+		if *format == formatJSON {
+			args = append(args, "-json")
+		}
+		return migrate.Run(ctx, cfg, args[1:], stdout)
+	}
+
+	if cfg.StorageDriver == config.StorageMemory {
+		return errMemoryDriver
+	}
+
+	// Migrations only run when asked for with "todoctl migrate up".
+	cfg.MigrateOnStart = false
+	stores, lifecycle, err := handlers.OpenStores(ctx, cfg, handlers.WithLogger(logger))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, lifecycle.Close(context.WithoutCancel(ctx)))
+	}()
+
+	return newTool(cfg, stores, stdin, &printer{out: stdout, format: *format}).exec(ctx, args)
+}
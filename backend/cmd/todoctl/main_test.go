@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/services"
+)
+
+// todoctl runs commands against a bolt file, so data persists between them
+// like it would against the server's database.
+type todoctl struct {
+	t      *testing.T
+	env    map[string]string
+	stderr bytes.Buffer
+}
+
+func newTodoctl(t *testing.T) *todoctl {
+	return &todoctl{t: t, env: map[string]string{
+		"STORAGE_DRIVER":  "bolt",
+		"BOLT_PATH":       filepath.Join(t.TempDir(), "todo.db"),
+		"QUOTA_MAX_TODOS": "3",
+		"LOG_LEVEL":       "error",
+	}}
+}
+
+func (c *todoctl) run(stdin string, args ...string) (string, error) {
+	c.t.Helper()
+
+	lookup := func(key string) (string, bool) {
+		v, ok := c.env[key]
+		return v, ok
+	}
+	var stdout bytes.Buffer
+	err := run(context.Background(), args, lookup, strings.NewReader(stdin), &stdout, &c.stderr)
+	return stdout.String(), err
+}
+
+func (c *todoctl) mustRun(stdin string, args ...string) string {
+	c.t.Helper()
+
+	out, err := c.run(stdin, args...)
+	if err != nil {
+		c.t.Fatalf("todoctl %s: %v", strings.Join(args, " "), err)
+	}
+	return out
+}
+
+func TestUsersCommands(t *testing.T) {
+	c := newTodoctl(t)
+
+	if out := c.mustRun("secret\n", "users", "create", "Ana@Example.com"); out != "created ana@example.com\n" {
+		t.Errorf("unexpected create output %q", out)
+	}
+	c.mustRun("s3cret\n", "users", "create", "bob@example.com")
+	if _, err := c.run("x\n", "users", "create", "ana@example.com"); !errors.Is(err, services.ErrUserAlreadyExists) {
+		t.Errorf("expected ErrUserAlreadyExists, got %v", err)
+	}
+
+	c.mustRun("", "users", "disable", "bob@example.com")
+	var users []services.PublicUser
+	if err := json.Unmarshal([]byte(c.mustRun("", "-o", "json", "users", "list")), &users); err != nil {
+		t.Fatalf("decoding users: %v", err)
+	}
+	if len(users) != 2 || users[0].Disabled || !users[1].Disabled {
+		t.Errorf("unexpected users %+v", users)
+	}
+	if out := c.mustRun("", "users", "list"); !strings.Contains(out, "bob@example.com") || !strings.Contains(out, "disabled") {
+		t.Errorf("unexpected table %q", out)
+	}
+
+	c.env["LOG_LEVEL"] = "warn"
+	out := c.mustRun("changed\n", "-o", "json", "users", "reset-password", "bob@example.com")
+	if !strings.Contains(out, `"action": "password reset"`) {
+		t.Errorf("unexpected reset output %q", out)
+	}
+	if !strings.Contains(c.stderr.String(), "sessions could not be ended") {
+		t.Errorf("expected a warning that bolt sessions were not ended, got %q", c.stderr.String())
+	}
+	c.mustRun("", "users", "enable", "bob@example.com")
+	if _, err := c.run("", "users", "disable", "nobody@example.com"); !errors.Is(err, services.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	// The changes are visible to the services the server uses.
+	db, err := services.OpenBolt(c.env["BOLT_PATH"])
+	if err != nil {
+		t.Fatalf("open bolt: %v", err)
+	}
+	defer db.Close()
+	if err := services.NewUserService(services.NewBoltUserRepository(db)).Login(context.Background(), "bob@example.com", "changed"); err != nil {
+		t.Errorf("expected bob to log in with the new password, got %v", err)
+	}
+}
+
+func TestTodosCommands(t *testing.T) {
+	c := newTodoctl(t)
+	c.mustRun("secret\n", "users", "create", "ana@example.com")
+
+	input := `[
+		{"title": "buy milk", "completed": true},
+		{"title": "call mom", "dueAt": "2025-01-02T15:00:00Z"}
+	]`
+	if out := c.mustRun(input, "todos", "import", "ana@example.com"); out != "imported 2 todos of ana@example.com\n" {
+		t.Errorf("unexpected import output %q", out)
+	}
+
+	exported := c.mustRun("", "todos", "export", "ana@example.com")
+	var todos []services.TodoResponse
+	if err := json.Unmarshal([]byte(exported), &todos); err != nil {
+		t.Fatalf("decoding export: %v", err)
+	}
+	if len(todos) != 2 || !todos[0].Completed || todos[1].DueAt == nil {
+		t.Fatalf("unexpected export %+v", todos)
+	}
+	if out := c.mustRun("", "todos", "list", "ana@example.com"); !strings.Contains(out, "call mom") || !strings.Contains(out, "2025-01-02T15:00:00Z") {
+		t.Errorf("unexpected table %q", out)
+	}
+
+	if out := c.mustRun("", "todos", "export", "ana@example.com", "md"); out != "- [x] buy milk\n- [ ] call mom\n" {
+		t.Errorf("unexpected markdown export %q", out)
+	}
+
+	// Importing the export again reaches the quota of three todos after its
+	// first todo; the second is rejected.
+	file := filepath.Join(t.TempDir(), "todos.csv")
+	if err := os.WriteFile(file, []byte(c.mustRun("", "todos", "export", "ana@example.com", "csv")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	out, err := c.run("", "todos", "import", "ana@example.com", file)
+	if !errors.Is(err, services.ErrQuotaExceeded) || !strings.Contains(err.Error(), "row 3") {
+		t.Errorf("expected row 3 to exceed the quota, got %v", err)
+	}
+	if out != "imported 1 todos of ana@example.com\n" {
+		t.Errorf("unexpected import output %q", out)
+	}
+	if _, err := c.run("[]", "todos", "import", "nobody@example.com"); !errors.Is(err, services.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for an unknown user, got %v", err)
+	}
+
+	out = c.mustRun("", "-o", "json", "stats")
+	var s stats
+	if err := json.Unmarshal([]byte(out), &s); err != nil {
+		t.Fatalf("decoding stats: %v", err)
+	}
+	if s.Users != 1 || s.Todos != 3 || s.CompletedTodos != 2 || s.OverdueTodos != 1 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+
+	if out := c.mustRun("", "todos", "purge", "ana@example.com"); out != "purged 3 todos of ana@example.com\n" {
+		t.Errorf("unexpected purge output %q", out)
+	}
+	if out := c.mustRun("", "-o", "json", "todos", "list", "ana@example.com"); strings.TrimSpace(out) != "[]" {
+		t.Errorf("expected no todos, got %q", out)
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	c := newTodoctl(t)
+
+	for _, args := range [][]string{
+		nil,
+		{"-o", "yaml", "stats"},
+		{"users"},
+		{"users", "list", "extra"},
+		{"users", "create", "ana@example.com", "secret"},
+		{"users", "reset-password", "ana@example.com", "secret"},
+		{"todos", "purge", " "},
+		{"todos", "export", "ana@example.com", "csv", "extra"},
+		{"unknown"},
+	} {
+		if _, err := c.run("", args...); !errors.Is(err, errUsage) {
+			t.Errorf("%v: expected errUsage, got %v", args, err)
+		}
+	}
+
+	c.env["STORAGE_DRIVER"] = "memory"
+	if _, err := c.run("", "stats"); !errors.Is(err, errMemoryDriver) {
+		t.Errorf("expected the memory driver to be rejected, got %v", err)
+	}
+	if _, err := c.run("", "migrate", "list"); err == nil || !strings.Contains(err.Error(), "mongo") {
+		t.Errorf("expected migrations to require mongo, got %v", err)
+	}
+}
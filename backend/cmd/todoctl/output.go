@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// Output formats selected with -o.
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+)
+
+// printer writes command results in the selected format.
+type printer struct {
+	out    io.Writer
+	format string
+}
+
+// print writes v as JSON, or calls fill to lay it out as a table.
+func (p *printer) print(v any, fill func(w *table)) error {
+	if p.format == formatJSON {
+		return writeJSON(p.out, v)
+	}
+	w := &table{tw: tabwriter.NewWriter(p.out, 0, 4, 2, ' ', 0)}
+	fill(w)
+	return w.tw.Flush()
+}
+
+// table aligns rows in columns.
+type table struct {
+	tw *tabwriter.Writer
+}
+
+func (t *table) row(cells ...string) {
+	fmt.Fprintln(t.tw, strings.Join(cells, "\t"))
+}
+
+func writeJSON(out io.Writer, v any) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
@@ -0,0 +1,412 @@
+// Package config holds the typed server configuration and loads it from the
+// environment.
+package config
+
+import (
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/services"
+)
+
+const (
+	// DefaultMongoURI is used when MONGO_URI is not set.
+	DefaultMongoURI = "mongodb://localhost:27017"
+	// DefaultDatabaseName is used when MONGO_DB is not set.
+	DefaultDatabaseName = services.DefaultDatabaseName
+	// DefaultPort is used when PORT is not set.
+	DefaultPort = "8080"
+	// DefaultShutdownTimeout bounds how long in-flight requests may take to
+	// finish once shutdown starts.
+	DefaultShutdownTimeout = 15 * time.Second
+	// DefaultMaxBodyBytes caps request bodies when MAX_BODY_BYTES is not set.
+	DefaultMaxBodyBytes = 1 << 20
+	// DefaultBoltPath is the database file of the bolt driver when BOLT_PATH
+	// is not set.
+	DefaultBoltPath = "todo.db"
+)
+
+// Storage drivers selectable with STORAGE_DRIVER.
+const (
+	StorageMongo  = "mongo"
+	StorageMemory = "memory"
+	StorageBolt   = "bolt"
+)
+
+// DefaultLegacySunset is announced in the Sunset header of the unversioned
+// routes when LEGACY_SUNSET is not set.
+var DefaultLegacySunset = time.Date(2027, time.June, 30, 0, 0, 0, 0, time.UTC)
+
+// defaultTrustedProxies are the loopback and private ranges where reverse
+// proxies and ingress controllers usually run.
+var defaultTrustedProxies = []string{
+	"127.0.0.0/8",
+	"::1/128",
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"fc00::/7",
+}
+
+// defaultOrigins are the local frontends that are always allowed by CORS.
+var defaultOrigins = []string{
+	"http://localhost:3000",
+	"http://localhost:5173",
+	"http://127.0.0.1:3000",
+	"http://127.0.0.1:5173",
+}
+
+// Config is everything needed to build and run the server.
+type Config struct {
+	// StorageDriver selects where users and todos live: "mongo", "memory"
+	// (lost on restart) or "bolt" (an embedded file at BoltPath).
+	StorageDriver string
+	MongoURI      string
+	DatabaseName  string
+	BoltPath      string
+	// MigrateOnStart applies pending data migrations when the server starts
+	// with the mongo driver.
+	MigrateOnStart bool
+	Port           string
+	// ShutdownTimeout bounds connection draining on SIGINT/SIGTERM.
+	ShutdownTimeout time.Duration
+	// AllowedOrigins lists the CORS origins; empty disables the CORS middleware.
+	AllowedOrigins []string
+	// AccountDeletionGrace delays account deletion; zero deletes immediately.
+	AccountDeletionGrace time.Duration
+	// MaxBodyBytes rejects larger request bodies with 413; zero disables the limit.
+	MaxBodyBytes int64
+	// LegacySunset is when the unversioned route aliases will be removed.
+	LegacySunset time.Time
+	// RateLimitStore keeps the rate limit buckets: "memory" limits each
+	// replica on its own, "mongo" shares the buckets between replicas.
+	RateLimitStore string
+	// RateLimits are the per route group limits; zero limits disable them.
+	RateLimits services.RateLimits
+	// IdempotencyTTL is how long responses are kept for Idempotency-Key
+	// replays.
+	IdempotencyTTL time.Duration
+	// TodoQuota limits what each user may store.
+	TodoQuota services.TodoQuota
+	// TrustedProxies lists the proxy addresses or CIDRs whose
+	// X-Forwarded-For header is believed when resolving the client IP.
+	TrustedProxies []string
+	// LogLevel is debug, info, warn or error.
+	LogLevel string
+	// LogFormat is json or text.
+	LogFormat string
+	// TracingExporter selects where spans go: "none", "stdout" or "otlp".
+	TracingExporter string
+	OIDC            OIDC
+	Features        Features
+}
+
+// OIDC configures single sign-on. It is disabled when IssuerURL is empty.
+type OIDC struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+}
+
+// Enabled reports whether an identity provider is configured.
+func (o OIDC) Enabled() bool {
+	return o.IssuerURL != ""
+}
+
+// Features toggles optional parts of the API.
+type Features struct {
+	// UserAdmin exposes GET and DELETE /users.
+	UserAdmin bool
+	// Account exposes the /me self-service routes.
+	Account bool
+	// Metrics records Prometheus metrics and serves them at /metrics. It is
+	// off by default because /metrics is not authenticated; enable it only
+	// where the route is not reachable from the internet.
+	Metrics bool
+	// LegacyRoutes keeps the deprecated unversioned aliases of the /v1 routes.
+	LegacyRoutes bool
+}
+
+// Default returns the configuration used when no environment is set.
+func Default() Config {
+	return Config{
+		StorageDriver:   StorageMongo,
+		MongoURI:        DefaultMongoURI,
+		DatabaseName:    DefaultDatabaseName,
+		BoltPath:        DefaultBoltPath,
+		MigrateOnStart:  true,
+		Port:            DefaultPort,
+		ShutdownTimeout: DefaultShutdownTimeout,
+		MaxBodyBytes:    DefaultMaxBodyBytes,
+		LegacySunset:    DefaultLegacySunset,
+		RateLimitStore:  "memory",
+		RateLimits:      services.DefaultRateLimits,
+		TodoQuota:       services.DefaultTodoQuota,
+		IdempotencyTTL:  services.DefaultIdempotencyTTL,
+		TrustedProxies:  append([]string(nil), defaultTrustedProxies...),
+		LogLevel:        "info",
+		LogFormat:       "json",
+		TracingExporter: "none",
+		AllowedOrigins:  append([]string(nil), defaultOrigins...),
+		Features: Features{
+			UserAdmin:    true,
+			Account:      true,
+			LegacyRoutes: true,
+		},
+	}
+}
+
+// FromEnv loads the configuration from the process environment.
+func FromEnv() (Config, error) {
+	return Load(os.LookupEnv)
+}
+
+// Load builds a Config on top of Default using lookup to read variables:
+//
+//	STORAGE_DRIVER           mongo, memory or bolt
+//	MONGO_URI, MONGO_DB, PORT
+//	BOLT_PATH                database file of the bolt driver
+//	MIGRATE_ON_START         boolean, apply data migrations at startup
+//	FRONT_ORIGINS            comma-separated origins added to the defaults
+//	ACCOUNT_DELETION_GRACE   duration such as "72h"
+//	SHUTDOWN_TIMEOUT         duration such as "30s"
+//	MAX_BODY_BYTES           request body limit in bytes, 0 disables it
+//	LEGACY_SUNSET            removal date of unversioned routes, e.g. "2027-06-30"
+//	RATE_LIMIT_STORE         memory or mongo
+//	RATE_LIMIT_AUTH, RATE_LIMIT_READ,
+//	RATE_LIMIT_WRITE         "<burst>/<period>" such as "20/1m", "off" disables
+//	IDEMPOTENCY_TTL          duration responses are replayed for, e.g. "24h"
+//	QUOTA_MAX_TODOS          todos per user, 0 means unlimited
+//	QUOTA_MAX_TITLE_LENGTH   title characters, at most 200
+//	QUOTA_MAX_BYTES          title bytes per user, 0 means unlimited
+//	TRUSTED_PROXIES          comma-separated IPs or CIDRs, "none" trusts none
+//	LOG_LEVEL                debug, info, warn or error
+//	LOG_FORMAT               json or text
+//	TRACING_EXPORTER         none, stdout or otlp (OTEL_EXPORTER_OTLP_* apply)
+//	OIDC_ISSUER, OIDC_CLIENT_ID, OIDC_CLIENT_SECRET, OIDC_REDIRECT_URL
+//	FEATURE_USER_ADMIN, FEATURE_ACCOUNT, FEATURE_METRICS,
+//	FEATURE_LEGACY_ROUTES    booleans
+func Load(lookup func(string) (string, bool)) (Config, error) {
+	cfg := Default()
+	get := func(key string) string {
+		value, _ := lookup(key)
+		return strings.TrimSpace(value)
+	}
+
+	switch v := strings.ToLower(get("STORAGE_DRIVER")); v {
+	case "":
+	case StorageMongo, StorageMemory, StorageBolt:
+		cfg.StorageDriver = v
+	default:
+		return Config{}, fmt.Errorf("config: invalid STORAGE_DRIVER %q", v)
+	}
+	if v := get("MONGO_URI"); v != "" {
+		cfg.MongoURI = v
+	}
+	if v := get("MONGO_DB"); v != "" {
+		cfg.DatabaseName = v
+	}
+	if v := get("BOLT_PATH"); v != "" {
+		cfg.BoltPath = v
+	}
+	if v := get("PORT"); v != "" {
+		cfg.Port = v
+	}
+	cfg.AllowedOrigins = mergeOrigins(cfg.AllowedOrigins, strings.Split(get("FRONT_ORIGINS"), ","))
+
+	if v := get("ACCOUNT_DELETION_GRACE"); v != "" {
+		grace, err := time.ParseDuration(v)
+		if err != nil || grace < 0 {
+			return Config{}, fmt.Errorf("config: invalid ACCOUNT_DELETION_GRACE %q", v)
+		}
+		cfg.AccountDeletionGrace = grace
+	}
+
+	if v := get("SHUTDOWN_TIMEOUT"); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil || timeout <= 0 {
+			return Config{}, fmt.Errorf("config: invalid SHUTDOWN_TIMEOUT %q", v)
+		}
+		cfg.ShutdownTimeout = timeout
+	}
+
+	if v := get("MAX_BODY_BYTES"); v != "" {
+		limit, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || limit < 0 {
+			return Config{}, fmt.Errorf("config: invalid MAX_BODY_BYTES %q", v)
+		}
+		cfg.MaxBodyBytes = limit
+	}
+
+	if v := get("LEGACY_SUNSET"); v != "" {
+		sunset, err := time.Parse(time.DateOnly, v)
+		if err != nil {
+			return Config{}, fmt.Errorf("config: invalid LEGACY_SUNSET %q", v)
+		}
+		cfg.LegacySunset = sunset
+	}
+
+	switch v := strings.ToLower(get("RATE_LIMIT_STORE")); v {
+	case "":
+	case "memory", "mongo":
+		cfg.RateLimitStore = v
+	default:
+		return Config{}, fmt.Errorf("config: invalid RATE_LIMIT_STORE %q", v)
+	}
+	limits := []struct {
+		key   string
+		value *services.RateLimit
+	}{
+		{"RATE_LIMIT_AUTH", &cfg.RateLimits.Auth},
+		{"RATE_LIMIT_READ", &cfg.RateLimits.Read},
+		{"RATE_LIMIT_WRITE", &cfg.RateLimits.Write},
+	}
+	for _, limit := range limits {
+		v := get(limit.key)
+		if v == "" {
+			continue
+		}
+		parsed, err := services.ParseRateLimit(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("config: invalid %s %q", limit.key, v)
+		}
+		*limit.value = parsed
+	}
+
+	if v := get("IDEMPOTENCY_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil || ttl <= 0 {
+			return Config{}, fmt.Errorf("config: invalid IDEMPOTENCY_TTL %q", v)
+		}
+		cfg.IdempotencyTTL = ttl
+	}
+
+	quotas := []struct {
+		key   string
+		value *int
+		max   int
+	}{
+		{"QUOTA_MAX_TODOS", &cfg.TodoQuota.MaxTodos, math.MaxInt},
+		{"QUOTA_MAX_TITLE_LENGTH", &cfg.TodoQuota.MaxTitleLength, services.MaxTitleLength},
+		{"QUOTA_MAX_BYTES", &cfg.TodoQuota.MaxBytes, math.MaxInt},
+	}
+	for _, quota := range quotas {
+		v := get(quota.key)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > quota.max {
+			return Config{}, fmt.Errorf("config: invalid %s %q", quota.key, v)
+		}
+		*quota.value = n
+	}
+
+	if v := get("TRUSTED_PROXIES"); v != "" {
+		proxies, err := parseTrustedProxies(v)
+		if err != nil {
+			return Config{}, err
+		}
+		cfg.TrustedProxies = proxies
+	}
+
+	switch v := strings.ToLower(get("LOG_LEVEL")); v {
+	case "":
+	case "debug", "info", "warn", "error":
+		cfg.LogLevel = v
+	default:
+		return Config{}, fmt.Errorf("config: invalid LOG_LEVEL %q", v)
+	}
+	switch v := strings.ToLower(get("LOG_FORMAT")); v {
+	case "":
+	case "json", "text":
+		cfg.LogFormat = v
+	default:
+		return Config{}, fmt.Errorf("config: invalid LOG_FORMAT %q", v)
+	}
+
+	switch v := get("TRACING_EXPORTER"); v {
+	case "":
+	case "none", "stdout", "otlp":
+		cfg.TracingExporter = v
+	default:
+		return Config{}, fmt.Errorf("config: invalid TRACING_EXPORTER %q", v)
+	}
+
+	cfg.OIDC = OIDC{
+		IssuerURL:    get("OIDC_ISSUER"),
+		ClientID:     get("OIDC_CLIENT_ID"),
+		ClientSecret: get("OIDC_CLIENT_SECRET"),
+		RedirectURL:  get("OIDC_REDIRECT_URL"),
+	}
+
+	toggles := []struct {
+		key   string
+		value *bool
+	}{
+		{"MIGRATE_ON_START", &cfg.MigrateOnStart},
+		{"FEATURE_USER_ADMIN", &cfg.Features.UserAdmin},
+		{"FEATURE_ACCOUNT", &cfg.Features.Account},
+		{"FEATURE_METRICS", &cfg.Features.Metrics},
+		{"FEATURE_LEGACY_ROUTES", &cfg.Features.LegacyRoutes},
+	}
+	for _, toggle := range toggles {
+		v := get(toggle.key)
+		if v == "" {
+			continue
+		}
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("config: invalid %s %q", toggle.key, v)
+		}
+		*toggle.value = enabled
+	}
+
+	return cfg, nil
+}
+
+// parseTrustedProxies splits a comma-separated list of IPs and CIDRs. "none"
+// yields an empty list, so forwarded headers are never believed.
+func parseTrustedProxies(v string) ([]string, error) {
+	proxies := []string{}
+	if strings.EqualFold(v, "none") {
+		return proxies, nil
+	}
+	for _, proxy := range strings.Split(v, ",") {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if _, err := netip.ParsePrefix(proxy); err != nil {
+			if _, err := netip.ParseAddr(proxy); err != nil {
+				return nil, fmt.Errorf("config: invalid TRUSTED_PROXIES entry %q", proxy)
+			}
+		}
+		proxies = append(proxies, proxy)
+	}
+	return proxies, nil
+}
+
+// mergeOrigins appends extra to base, dropping blanks and duplicates.
+func mergeOrigins(base, extra []string) []string {
+	out := make([]string, 0, len(base)+len(extra))
+	seen := make(map[string]struct{})
+	for _, origin := range append(base, extra...) {
+		origin = strings.TrimSpace(origin)
+		if origin == "" {
+			continue
+		}
+		if _, ok := seen[origin]; ok {
+			continue
+		}
+		seen[origin] = struct{}{}
+		out = append(out, origin)
+	}
+	return out
+}
@@ -0,0 +1,160 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/services"
+)
+
+func lookupFrom(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load(lookupFrom(nil))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if !reflect.DeepEqual(cfg, Default()) {
+		t.Errorf("expected defaults, got %+v", cfg)
+	}
+	if cfg.OIDC.Enabled() {
+		t.Errorf("expected OIDC to be disabled by default")
+	}
+	if cfg.Features.Metrics {
+		t.Errorf("expected metrics to be disabled by default")
+	}
+}
+
+func TestLoadOverrides(t *testing.T) {
+	cfg, err := Load(lookupFrom(map[string]string{
+		"STORAGE_DRIVER":         "Bolt",
+		"BOLT_PATH":              "/var/lib/todo/todo.db",
+		"MIGRATE_ON_START":       "false",
+		"MONGO_URI":              "mongodb://db:27017",
+		"MONGO_DB":               "todos",
+		"PORT":                   "9000",
+		"FRONT_ORIGINS":          " https://app.example.com ,http://localhost:3000,",
+		"ACCOUNT_DELETION_GRACE": "72h",
+		"SHUTDOWN_TIMEOUT":       "30s",
+		"MAX_BODY_BYTES":         "2048",
+		"LEGACY_SUNSET":          "2026-12-31",
+		"FEATURE_LEGACY_ROUTES":  "false",
+		"RATE_LIMIT_STORE":       "Mongo",
+		"RATE_LIMIT_AUTH":        "5/30s",
+		"RATE_LIMIT_WRITE":       "off",
+		"TRUSTED_PROXIES":        "10.1.0.0/16, 203.0.113.7",
+		"QUOTA_MAX_TODOS":        "0",
+		"IDEMPOTENCY_TTL":        "1h",
+		"QUOTA_MAX_TITLE_LENGTH": "80",
+		"QUOTA_MAX_BYTES":        "4096",
+		"TRACING_EXPORTER":       "otlp",
+		"LOG_LEVEL":              "DEBUG",
+		"LOG_FORMAT":             "text",
+		"OIDC_ISSUER":            "https://idp.example.com",
+		"FEATURE_USER_ADMIN":     "false",
+		"FEATURE_METRICS":        "true",
+	}))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	if cfg.StorageDriver != StorageBolt || cfg.BoltPath != "/var/lib/todo/todo.db" {
+		t.Errorf("unexpected storage settings %q %q", cfg.StorageDriver, cfg.BoltPath)
+	}
+	if cfg.MigrateOnStart {
+		t.Errorf("expected migrations on start to be disabled")
+	}
+	if cfg.MongoURI != "mongodb://db:27017" || cfg.DatabaseName != "todos" || cfg.Port != "9000" {
+		t.Errorf("unexpected connection settings: %+v", cfg)
+	}
+	if got := cfg.AllowedOrigins[len(cfg.AllowedOrigins)-1]; got != "https://app.example.com" {
+		t.Errorf("expected extra origin to be appended, got %v", cfg.AllowedOrigins)
+	}
+	if len(cfg.AllowedOrigins) != len(defaultOrigins)+1 {
+		t.Errorf("expected duplicates and blanks to be dropped, got %v", cfg.AllowedOrigins)
+	}
+	if cfg.AccountDeletionGrace != 72*time.Hour {
+		t.Errorf("unexpected grace %v", cfg.AccountDeletionGrace)
+	}
+	if cfg.ShutdownTimeout != 30*time.Second {
+		t.Errorf("unexpected shutdown timeout %v", cfg.ShutdownTimeout)
+	}
+	if cfg.MaxBodyBytes != 2048 {
+		t.Errorf("unexpected body limit %d", cfg.MaxBodyBytes)
+	}
+	if want := time.Date(2026, time.December, 31, 0, 0, 0, 0, time.UTC); !cfg.LegacySunset.Equal(want) {
+		t.Errorf("unexpected legacy sunset %v", cfg.LegacySunset)
+	}
+	if cfg.RateLimitStore != "mongo" {
+		t.Errorf("unexpected rate limit store %q", cfg.RateLimitStore)
+	}
+	wantLimits := services.RateLimits{
+		Auth: services.RateLimit{Burst: 5, Period: 30 * time.Second},
+		Read: services.DefaultRateLimits.Read,
+	}
+	if cfg.RateLimits != wantLimits {
+		t.Errorf("unexpected rate limits %+v", cfg.RateLimits)
+	}
+	if !reflect.DeepEqual(cfg.TrustedProxies, []string{"10.1.0.0/16", "203.0.113.7"}) {
+		t.Errorf("unexpected trusted proxies %v", cfg.TrustedProxies)
+	}
+	if cfg.IdempotencyTTL != time.Hour {
+		t.Errorf("unexpected idempotency ttl %v", cfg.IdempotencyTTL)
+	}
+	if cfg.TodoQuota != (services.TodoQuota{MaxTitleLength: 80, MaxBytes: 4096}) {
+		t.Errorf("unexpected todo quota %+v", cfg.TodoQuota)
+	}
+	if cfg.LogLevel != "debug" || cfg.LogFormat != "text" {
+		t.Errorf("unexpected logging settings %q %q", cfg.LogLevel, cfg.LogFormat)
+	}
+	if cfg.TracingExporter != "otlp" {
+		t.Errorf("unexpected tracing exporter %q", cfg.TracingExporter)
+	}
+	if !cfg.OIDC.Enabled() {
+		t.Errorf("expected OIDC to be enabled")
+	}
+	if cfg.Features.UserAdmin || cfg.Features.LegacyRoutes || !cfg.Features.Account || !cfg.Features.Metrics {
+		t.Errorf("unexpected features %+v", cfg.Features)
+	}
+}
+
+func TestLoadRejectsInvalidValues(t *testing.T) {
+	for key, value := range map[string]string{
+		"STORAGE_DRIVER":         "sqlite",
+		"ACCOUNT_DELETION_GRACE": "soon",
+		"FEATURE_ACCOUNT":        "maybe",
+		"SHUTDOWN_TIMEOUT":       "0s",
+		"MAX_BODY_BYTES":         "-1",
+		"LEGACY_SUNSET":          "next year",
+		"RATE_LIMIT_STORE":       "redis",
+		"RATE_LIMIT_READ":        "100",
+		"TRUSTED_PROXIES":        "10.0.0.0/33",
+		"QUOTA_MAX_TODOS":        "-1",
+		"IDEMPOTENCY_TTL":        "0s",
+		"QUOTA_MAX_TITLE_LENGTH": "500",
+		"QUOTA_MAX_BYTES":        "many",
+		"TRACING_EXPORTER":       "jaeger",
+		"LOG_LEVEL":              "verbose",
+		"LOG_FORMAT":             "xml",
+	} {
+		if _, err := Load(lookupFrom(map[string]string{key: value})); err == nil {
+			t.Errorf("expected error for %s=%q", key, value)
+		}
+	}
+}
+
+func TestLoadTrustedProxiesNone(t *testing.T) {
+	cfg, err := Load(lookupFrom(map[string]string{"TRUSTED_PROXIES": "none"}))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.TrustedProxies == nil || len(cfg.TrustedProxies) != 0 {
+		t.Errorf("expected an empty proxy list, got %#v", cfg.TrustedProxies)
+	}
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/services"
+)
+
+// AccountHandler exposes self-service endpoints for the authenticated user.
+type AccountHandler struct {
+	accounts *services.AccountService
+	users    *services.UserService
+	todos    *services.TodoService
+}
+
+// NewAccountHandler builds a new AccountHandler instance.
+func NewAccountHandler(accounts *services.AccountService, users *services.UserService, todos *services.TodoService) *AccountHandler {
+	return &AccountHandler{accounts: accounts, users: users, todos: todos}
+}
+
+// GetMe returns the profile and preferences of the session user.
+func (h *AccountHandler) GetMe(c *gin.Context) {
+	user, err := h.users.GetProfile(c.Request.Context(), sessionEmail(c))
+	if err != nil {
+		respondError(c, err, on(services.ErrNotFound, CodeUserNotFound))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": user})
+}
+
+// GetUsage reports the usage of the session user against their quotas.
+func (h *AccountHandler) GetUsage(c *gin.Context) {
+	usage, err := h.todos.Usage(c.Request.Context(), sessionEmail(c))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"usage": usage})
+}
+
+type preferencesRequest struct {
+	DefaultSort   *string `json:"defaultSort"`
+	HideCompleted *bool   `json:"hideCompleted"`
+}
+
+type updateProfileRequest struct {
+	DisplayName *string             `json:"displayName" binding:"omitempty,max=80"`
+	TimeZone    *string             `json:"timeZone" binding:"omitempty,max=64"`
+	Locale      *string             `json:"locale" binding:"omitempty,max=35"`
+	Preferences *preferencesRequest `json:"preferences"`
+}
+
+// UpdateMe applies a partial update to the profile of the session user.
+func (h *AccountHandler) UpdateMe(c *gin.Context) {
+	var payload updateProfileRequest
+	if !bindJSON(c, &payload) {
+		return
+	}
+
+	update := services.ProfileUpdate{
+		DisplayName: payload.DisplayName,
+		TimeZone:    payload.TimeZone,
+		Locale:      payload.Locale,
+	}
+	if payload.Preferences != nil {
+		update.DefaultSort = payload.Preferences.DefaultSort
+		update.HideCompleted = payload.Preferences.HideCompleted
+	}
+
+	user, err := h.users.UpdateProfile(c.Request.Context(), sessionEmail(c), update)
+	if err != nil {
+		respondError(c, err, on(services.ErrNotFound, CodeUserNotFound))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": user})
+}
+
+// DeleteMe deletes the account of the session user and all of its todos,
+// or schedules the deletion when a grace period is configured.
+func (h *AccountHandler) DeleteMe(c *gin.Context) {
+	deleteAfter, err := h.accounts.Delete(c.Request.Context(), sessionEmail(c))
+	switch {
+	case err == nil && deleteAfter.IsZero():
+		c.JSON(http.StatusOK, gin.H{"message": "cuenta eliminada"})
+	case err == nil:
+		c.JSON(http.StatusAccepted, gin.H{
+			"message":     "eliminacion de cuenta programada",
+			"deleteAfter": deleteAfter,
+		})
+	default:
+		respondError(c, err, on(services.ErrNotFound, CodeUserNotFound))
+	}
+}
+
+// attachmentWriter sends the download headers right before the first byte,
+// so errors raised before any output can still be reported as JSON.
+type attachmentWriter struct {
+	c           *gin.Context
+	contentType string
+	filename    string
+	started     bool
+}
+
+func (w *attachmentWriter) Write(p []byte) (int, error) {
+	w.start()
+	return w.c.Writer.Write(p)
+}
+
+// start sends the download headers unless they were sent already, e.g. to
+// answer with an empty file.
+func (w *attachmentWriter) start() {
+	if w.started {
+		return
+	}
+	w.started = true
+	w.c.Header("Content-Type", w.contentType)
+	w.c.Header("Content-Disposition", `attachment; filename="`+w.filename+`"`)
+	w.c.Status(http.StatusOK)
+}
+
+// ExportMe streams a ZIP archive with the profile and todos of the session user.
+func (h *AccountHandler) ExportMe(c *gin.Context) {
+	w := &attachmentWriter{c: c, contentType: "application/zip", filename: "export.zip"}
+	err := h.accounts.Export(c.Request.Context(), sessionEmail(c), w)
+	switch {
+	case err == nil:
+	case w.started:
+		// Headers are already sent; abort the stream so the client sees a
+		// broken download rather than a silently truncated archive.
+		_ = c.Error(err)
+		c.Abort()
+	default:
+		respondError(c, err, on(services.ErrNotFound, CodeUserNotFound))
+	}
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/config"
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/services"
+)
+
+func TestLoginReturnsSessionToken(t *testing.T) {
+	app := newTestApp()
+
+	postJSON(t, app, "/register", map[string]string{"email": "user@example.com", "password": "secret"})
+	rec, resp := postJSON(t, app, "/login", map[string]string{"email": "user@example.com", "password": "secret"})
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	token, _ := resp["token"].(string)
+	require.NotEmpty(t, token)
+
+	email, err := app.sessions.Resolve(context.Background(), token)
+	require.NoError(t, err)
+	require.Equal(t, "user@example.com", email)
+
+	req := httptest.NewRequest(http.MethodPost, "/logout", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec = httptest.NewRecorder()
+	app.router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	_, err = app.sessions.Resolve(context.Background(), token)
+	require.ErrorIs(t, err, services.ErrInvalidSession)
+}
+
+func TestMeRoutesRequireSession(t *testing.T) {
+	app := newTestApp()
+
+	rec := httptest.NewRecorder()
+	app.router.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/me", nil))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/me/export", nil)
+	req.Header.Set("Authorization", "Bearer not-a-session")
+	rec = httptest.NewRecorder()
+	app.router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestDeleteMeRemovesUserAndTodos(t *testing.T) {
+	app := newTestApp()
+	ctx := context.Background()
+
+	require.NoError(t, app.users.Insert(ctx, services.User{Email: "alice@example.com", Password: "secret"}))
+	_, err := app.todos.Create(ctx, services.Todo{Email: "alice@example.com", Title: "Mine"})
+	require.NoError(t, err)
+	_, err = app.todos.Create(ctx, services.Todo{Email: "bob@example.com", Title: "Other"})
+	require.NoError(t, err)
+
+	token := app.login(t, "alice@example.com")
+	req := httptest.NewRequest(http.MethodDelete, "/me", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	app.router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	_, err = app.users.FindByEmail(ctx, "alice@example.com")
+	require.ErrorIs(t, err, services.ErrNotFound)
+	remaining, err := app.todos.List(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, remaining, 1)
+	require.Equal(t, "bob@example.com", remaining[0].Email)
+
+	rec = httptest.NewRecorder()
+	app.router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestExportMeStreamsZip(t *testing.T) {
+	app := newTestApp()
+	ctx := context.Background()
+
+	require.NoError(t, app.users.Insert(ctx, services.User{Email: "alice@example.com", Password: "secret"}))
+	_, err := app.todos.Create(ctx, services.Todo{Email: "alice@example.com", Title: "Mine", CreatedAt: fixedTime})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/me/export", nil)
+	req.Header.Set("Authorization", "Bearer "+app.login(t, "alice@example.com"))
+	rec := httptest.NewRecorder()
+	app.router.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "application/zip", rec.Header().Get("Content-Type"))
+	require.Contains(t, rec.Header().Get("Content-Disposition"), "export.zip")
+
+	archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	require.NoError(t, err)
+	names := make([]string, 0, len(archive.File))
+	for _, f := range archive.File {
+		names = append(names, f.Name)
+	}
+	require.ElementsMatch(t, []string{"profile.json", "todos.json", "todos.csv"}, names)
+
+	req = httptest.NewRequest(http.MethodGet, "/me/export", nil)
+	req.Header.Set("Authorization", "Bearer "+app.login(t, "ghost@example.com"))
+	rec = httptest.NewRecorder()
+	app.router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestGetAndPatchMeProfile(t *testing.T) {
+	app := newTestApp()
+	ctx := context.Background()
+
+	require.NoError(t, app.users.Insert(ctx, services.User{Email: "alice@example.com", Password: "secret"}))
+	token := app.login(t, "alice@example.com")
+
+	send := func(method string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/me", bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		app.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := send(http.MethodGet, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"user":{"email":"alice@example.com"}}`, rec.Body.String())
+
+	rec = send(http.MethodPatch, `{"displayName":"Alice","timeZone":"Europe/Madrid","preferences":{"defaultSort":"title","hideCompleted":true}}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"user":{"email":"alice@example.com","displayName":"Alice","timeZone":"Europe/Madrid","preferences":{"defaultSort":"title","hideCompleted":true}}}`, rec.Body.String())
+
+	rec = send(http.MethodPatch, `{"timeZone":"Nowhere/City"}`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	stored, err := app.users.FindByEmail(ctx, "alice@example.com")
+	require.NoError(t, err)
+	require.Equal(t, "Europe/Madrid", stored.TimeZone)
+}
+
+func TestTodoQuotaAndUsage(t *testing.T) {
+	app := newTestApp(func(cfg *config.Config) {
+		cfg.TodoQuota = services.TodoQuota{MaxTodos: 1, MaxTitleLength: 20, MaxBytes: 1024}
+	})
+	token := app.login(t, "alice@example.com")
+
+	rec, resp := sendRaw(t, app, http.MethodPost, "/v1/todos", `{"email":"alice@example.com","title":"`+strings.Repeat("a", 21)+`"}`)
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	require.Equal(t, CodeQuotaExceeded, resp.Code)
+	require.Equal(t, []FieldError{
+		{Field: "title", Code: CodeFieldTooLong, Param: "20", Message: "maximo 20 caracteres"},
+	}, resp.Fields)
+
+	rec, _ = sendRaw(t, app, http.MethodPost, "/v1/todos", `{"email":"alice@example.com","title":"first"}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	rec, resp = sendRaw(t, app, http.MethodPost, "/v1/todos", `{"email":"alice@example.com","title":"second"}`)
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	require.Equal(t, CodeQuotaExceeded, resp.Code)
+	require.Empty(t, resp.Fields)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/me/usage", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec = httptest.NewRecorder()
+	app.router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"usage":{"todos":{"used":1,"limit":1},"bytes":{"used":5,"limit":1024},"maxTitleLength":20}}`, rec.Body.String())
+}
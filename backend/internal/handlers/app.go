@@ -0,0 +1,411 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/config"
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/logging"
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/metrics"
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/migrate"
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/oidc"
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/services"
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/telemetry"
+)
+
+// accountPurgeInterval is how often accounts past their grace period are purged.
+const accountPurgeInterval = time.Hour
+
+// corsExposedHeaders are the response headers browsers let the frontend read.
+var corsExposedHeaders = []string{
+	"Content-Length", "Retry-After", RequestIDHeader, APIVersionHeader,
+	"Deprecation", "Sunset", "Link", IdempotentReplayedHeader,
+	"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy",
+}
+
+// Stores groups the persistence backends used by the application. The
+// memory and bolt drivers only provide Users and Todos; the other stores then
+// stay in process memory, which suits a single replica.
+type Stores struct {
+	Users         services.UserRepository
+	Todos         services.TodoRepository
+	Challenges    services.ChallengeStore
+	LoginAttempts services.LoginAttemptStore
+	Sessions      services.SessionStore
+	// RateLimits shares rate limit buckets between replicas. It is used
+	// when the rate limit store is "mongo"; otherwise, or when nil, buckets
+	// stay in memory.
+	RateLimits services.RateLimitStore
+	// Idempotency keeps responses for Idempotency-Key replays; nil keeps
+	// them in memory.
+	Idempotency services.IdempotencyStore
+	// OIDCLogins keeps single sign-on logins in progress; nil keeps them in
+	// memory.
+	OIDCLogins oidc.StateStore
+}
+
+// AppOption customises NewApp.
+type AppOption func(*appOptions)
+
+type appOptions struct {
+	stores         *Stores
+	now            func() time.Time
+	tracerProvider *sdktrace.TracerProvider
+	logger         *slog.Logger
+}
+
+// WithStores replaces the storage selected by cfg.StorageDriver, e.g. with
+// in-memory stores in tests. No database is opened when it is used.
+func WithStores(stores Stores) AppOption {
+	return func(o *appOptions) {
+		o.stores = &stores
+	}
+}
+
+// WithClock overrides the clock used by every service.
+func WithClock(now func() time.Time) AppOption {
+	return func(o *appOptions) {
+		o.now = now
+	}
+}
+
+// WithLogger sets the logger used for access logs and background workers.
+func WithLogger(logger *slog.Logger) AppOption {
+	return func(o *appOptions) {
+		o.logger = logger
+	}
+}
+
+// WithTracerProvider installs provider as the global tracer provider and
+// enables request tracing regardless of cfg.TracingExporter, e.g. to record
+// spans in memory during tests.
+func WithTracerProvider(provider *sdktrace.TracerProvider) AppOption {
+	return func(o *appOptions) {
+		o.tracerProvider = provider
+	}
+}
+
+// Lifecycle owns the resources and background workers behind a router built
+// by NewApp.
+type Lifecycle struct {
+	client *mongo.Client
+	// closers release embedded databases.
+	closers []io.Closer
+	workers []func(ctx context.Context)
+	// flushTraces exports pending spans; it runs last so that the spans of
+	// the shutdown itself are kept.
+	flushTraces func(ctx context.Context) error
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// Start launches the background workers. It is a no-op when already started.
+func (l *Lifecycle) Start() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.cancel != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	l.cancel = cancel
+	for _, worker := range l.workers {
+		l.wg.Add(1)
+		go func(worker func(context.Context)) {
+			defer l.wg.Done()
+			worker(ctx)
+		}(worker)
+	}
+}
+
+// Close stops the background workers, disconnects from MongoDB, closes
+// embedded databases and finally flushes pending traces.
+func (l *Lifecycle) Close(ctx context.Context) error {
+	l.mu.Lock()
+	if l.cancel != nil {
+		l.cancel()
+	}
+	l.mu.Unlock()
+	l.wg.Wait()
+
+	var err error
+	if l.client != nil {
+		err = l.client.Disconnect(ctx)
+	}
+	for _, closer := range l.closers {
+		err = errors.Join(err, closer.Close())
+	}
+	if l.flushTraces != nil {
+		err = errors.Join(err, l.flushTraces(ctx))
+	}
+	return err
+}
+
+// NewApp builds the complete application described by cfg: storage, services,
+// handlers and the router. The returned Lifecycle must be started to run
+// background workers and closed to release the database connection.
+func NewApp(ctx context.Context, cfg config.Config, opts ...AppOption) (*gin.Engine, *Lifecycle, error) {
+	options := appOptions{now: time.Now, logger: slog.Default()}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	logger := options.logger
+	now := options.now
+	lifecycle := &Lifecycle{}
+
+	tracing := options.tracerProvider != nil
+	if tracing {
+		telemetry.Install(options.tracerProvider)
+	} else if cfg.TracingExporter != telemetry.ExporterNone {
+		flush, err := telemetry.Setup(ctx, cfg.TracingExporter)
+		if err != nil {
+			return nil, nil, err
+		}
+		lifecycle.flushTraces = flush
+		tracing = true
+	}
+
+	stores := options.stores
+	var healthChecks []HealthCheck
+	if stores == nil {
+		var err error
+		if stores, healthChecks, err = openStores(ctx, cfg, lifecycle, now, logger); err != nil {
+			_ = lifecycle.Close(ctx)
+			return nil, nil, err
+		}
+	}
+
+	var appMetrics *metrics.Metrics
+	if cfg.Features.Metrics {
+		appMetrics = metrics.New()
+		instrumented := *stores
+		instrumented.Users = metrics.InstrumentUserRepository(stores.Users, appMetrics)
+		instrumented.Todos = metrics.InstrumentTodoRepository(stores.Todos, appMetrics)
+		stores = &instrumented
+	}
+
+	userService := services.NewUserService(stores.Users,
+		services.WithChallengeStore(stores.Challenges),
+		services.WithUserClock(now),
+	)
+	todoService := services.NewTodoService(stores.Todos, now,
+		services.WithLocationResolver(userService),
+		services.WithTodoQuota(cfg.TodoQuota),
+	)
+	sessionService := services.NewSessionService(stores.Sessions, services.DefaultSessionTTL, now,
+		services.WithSessionUsers(stores.Users),
+	)
+
+	guard := services.NewLoginGuard(
+		stores.LoginAttempts,
+		services.DefaultAccountLockoutPolicy,
+		services.DefaultIPLockoutPolicy,
+		now,
+	)
+
+	var rateLimitStore services.RateLimitStore
+	if cfg.RateLimitStore == "mongo" {
+		rateLimitStore = stores.RateLimits
+	}
+
+	authHandler := NewAuthHandler(userService, guard, sessionService)
+	todoHandler := NewTodoHandler(todoService)
+
+	routerCfg := RouterConfig{
+		Logger:              logger,
+		DisableUserAdmin:    !cfg.Features.UserAdmin,
+		Health:              NewHealthHandler(healthChecks...),
+		Metrics:             appMetrics,
+		MaxBodyBytes:        cfg.MaxBodyBytes,
+		DisableLegacyRoutes: !cfg.Features.LegacyRoutes,
+		LegacySunset:        cfg.LegacySunset,
+		RateLimiter:         services.NewRateLimiter(rateLimitStore, now),
+		RateLimits:          cfg.RateLimits,
+		Idempotency:         services.NewIdempotencyService(stores.Idempotency, cfg.IdempotencyTTL, now),
+		TrustedProxies:      cfg.TrustedProxies,
+	}
+	if tracing {
+		routerCfg.Middlewares = append(routerCfg.Middlewares, otelgin.Middleware(telemetry.ServiceName))
+	}
+	if len(cfg.AllowedOrigins) > 0 {
+		routerCfg.Middlewares = append(routerCfg.Middlewares, cors.New(cors.Config{
+			AllowOrigins:     cfg.AllowedOrigins,
+			AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+			AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", RequestIDHeader, APIVersionHeader, IdempotencyKeyHeader},
+			ExposeHeaders:    corsExposedHeaders,
+			AllowCredentials: true,
+			MaxAge:           12 * time.Hour,
+		}))
+	}
+
+	if cfg.Features.Account {
+		accountService := services.NewAccountService(stores.Users, stores.Todos, sessionService, cfg.AccountDeletionGrace, now)
+		routerCfg.Account = NewAccountHandler(accountService, userService, todoService)
+		if cfg.AccountDeletionGrace > 0 {
+			lifecycle.workers = append(lifecycle.workers, purgeAccountsWorker(accountService, logger))
+		}
+	}
+
+	if cfg.OIDC.Enabled() {
+		provider, err := oidc.NewProvider(ctx, oidc.Config{
+			IssuerURL:    cfg.OIDC.IssuerURL,
+			ClientID:     cfg.OIDC.ClientID,
+			ClientSecret: cfg.OIDC.ClientSecret,
+			RedirectURL:  cfg.OIDC.RedirectURL,
+			Now:          now,
+			Store:        stores.OIDCLogins,
+		})
+		if err != nil {
+			_ = lifecycle.Close(ctx)
+			return nil, nil, err
+		}
+		routerCfg.OIDC = NewOIDCHandler(provider, userService, sessionService)
+	}
+
+	return SetupRouter(authHandler, todoHandler, routerCfg), lifecycle, nil
+}
+
+// OpenStores opens the storage selected by cfg.StorageDriver the way NewApp
+// does, so that tools work on the same data as the server. Closing the
+// returned Lifecycle releases the database.
+func OpenStores(ctx context.Context, cfg config.Config, opts ...AppOption) (Stores, *Lifecycle, error) {
+	options := appOptions{now: time.Now, logger: slog.Default()}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	lifecycle := &Lifecycle{}
+	stores, _, err := openStores(ctx, cfg, lifecycle, options.now, options.logger)
+	if err != nil {
+		_ = lifecycle.Close(ctx)
+		return Stores{}, nil, err
+	}
+	return *stores, lifecycle, nil
+}
+
+// openStores opens the storage selected by cfg.StorageDriver and registers
+// what must be released on lifecycle. With MongoDB it also applies pending
+// migrations when cfg.MigrateOnStart is set, and returns the health checks.
+func openStores(ctx context.Context, cfg config.Config, lifecycle *Lifecycle, now func() time.Time, logger *slog.Logger) (*Stores, []HealthCheck, error) {
+	switch cfg.StorageDriver {
+	case config.StorageMemory:
+		return &Stores{
+			Users: services.NewMemoryUserRepository(),
+			Todos: services.NewMemoryTodoRepository(),
+		}, nil, nil
+	case config.StorageBolt:
+		db, err := services.OpenBolt(cfg.BoltPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("opening %s: %w", cfg.BoltPath, err)
+		}
+		lifecycle.closers = append(lifecycle.closers, db)
+		return &Stores{
+			Users: services.NewBoltUserRepository(db),
+			Todos: services.NewBoltTodoRepository(db),
+		}, nil, nil
+	default:
+		client, err := services.ConnectMongo(ctx, cfg.MongoURI)
+		if err != nil {
+			return nil, nil, fmt.Errorf("connecting to mongo: %w", err)
+		}
+		lifecycle.client = client
+
+		db := client.Database(cfg.DatabaseName)
+		if cfg.MigrateOnStart {
+			if err := runMigrations(ctx, db, now, logger); err != nil {
+				return nil, nil, err
+			}
+		}
+		stores, err := mongoStores(ctx, db)
+		if err != nil {
+			return nil, nil, err
+		}
+		return stores, mongoHealthChecks(client, db), nil
+	}
+}
+
+// runMigrations applies the pending data migrations. They run before the
+// schema is applied, so that they can fix documents a new index or validator
+// would reject.
+func runMigrations(ctx context.Context, db *mongo.Database, now func() time.Time, logger *slog.Logger) error {
+	runner, err := migrate.New(db, migrate.Migrations, migrate.WithClock(now), migrate.WithLogger(logger))
+	if err != nil {
+		return err
+	}
+	if _, err := runner.Up(ctx, 0, false); err != nil {
+		return fmt.Errorf("running migrations: %w", err)
+	}
+	return nil
+}
+
+// mongoStores builds the MongoDB-backed stores after applying the indexes
+// and validators of services.Schemas.
+func mongoStores(ctx context.Context, db *mongo.Database) (*Stores, error) {
+	if err := services.EnsureSchema(ctx, db, services.Schemas); err != nil {
+		return nil, err
+	}
+
+	return &Stores{
+		Users:         services.NewMongoUserRepository(db.Collection("users")),
+		Todos:         services.NewMongoTodoRepository(db.Collection("todos")),
+		Challenges:    services.NewMongoChallengeStore(db.Collection("login_challenges")),
+		LoginAttempts: services.NewMongoLoginAttemptStore(db.Collection("login_attempts")),
+		Sessions:      services.NewMongoSessionStore(db.Collection("sessions")),
+		RateLimits:    services.NewMongoRateLimitStore(db.Collection("rate_limits")),
+		Idempotency:   services.NewMongoIdempotencyStore(db.Collection("idempotency_keys")),
+		OIDCLogins:    oidc.NewMongoStateStore(db.Collection("oidc_logins"), nil),
+	}, nil
+}
+
+// mongoHealthChecks verifies that MongoDB answers and has the indexes the
+// stores rely on.
+func mongoHealthChecks(client *mongo.Client, db *mongo.Database) []HealthCheck {
+	return []HealthCheck{
+		{
+			Name: "mongo",
+			Check: func(ctx context.Context) error {
+				return client.Ping(ctx, readpref.Primary())
+			},
+		},
+		{
+			Name: "mongo_indexes",
+			Check: func(ctx context.Context) error {
+				return services.CheckIndexes(ctx, db, services.RequiredIndexes)
+			},
+		},
+	}
+}
+
+func purgeAccountsWorker(accounts *services.AccountService, logger *slog.Logger) func(context.Context) {
+	logger = logger.With(slog.String("worker", "account_purge"))
+	return func(ctx context.Context) {
+		ctx = logging.WithContext(ctx, logger)
+		ticker := time.NewTicker(accountPurgeInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if n, err := accounts.PurgeDue(ctx); err != nil {
+					logger.Error("purging accounts failed", slog.Any("error", err))
+				} else if n > 0 {
+					logger.Info("purged accounts", slog.Int("count", n))
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/config"
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/services"
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/telemetry"
+)
+
+func newMemoryApp(t *testing.T, cfg config.Config) (http.Handler, *Lifecycle) {
+	t.Helper()
+
+	router, lifecycle, err := NewApp(context.Background(), cfg,
+		WithStores(Stores{Users: services.NewMemoryUserRepository(), Todos: services.NewMemoryTodoRepository()}),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, lifecycle.Close(context.Background())) })
+	return router, lifecycle
+}
+
+func TestNewAppServesEveryRouteAndCORS(t *testing.T) {
+	router, _ := newMemoryApp(t, config.Default())
+
+	for _, path := range []string{"/healthz", "/users", "/todos"} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, http.StatusOK, rec.Code, path)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/me", nil))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	req := httptest.NewRequest(http.MethodOptions, "/todos", nil)
+	req.Header.Set("Origin", "http://localhost:3000")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPatch)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	require.Equal(t, "http://localhost:3000", rec.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestNewAppFeatureToggles(t *testing.T) {
+	cfg := config.Default()
+	cfg.Features = config.Features{}
+	router, _ := newMemoryApp(t, cfg)
+
+	for _, path := range []string{"/users", "/me"} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, http.StatusNotFound, rec.Code, path)
+	}
+}
+
+func TestLifecycleStopsWorkersOnClose(t *testing.T) {
+	cfg := config.Default()
+	cfg.AccountDeletionGrace = time.Hour
+	_, lifecycle := newMemoryApp(t, cfg)
+	require.Len(t, lifecycle.workers, 1)
+
+	lifecycle.Start()
+	lifecycle.Start()
+
+	done := make(chan error, 1)
+	go func() { done <- lifecycle.Close(context.Background()) }()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("lifecycle did not stop its workers")
+	}
+}
+
+func TestNewAppBoltDriverPersistsAcrossRestarts(t *testing.T) {
+	cfg := config.Default()
+	cfg.StorageDriver = config.StorageBolt
+	cfg.BoltPath = filepath.Join(t.TempDir(), "todo.db")
+
+	router, lifecycle, err := NewApp(context.Background(), cfg)
+	require.NoError(t, err)
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/register", strings.NewReader(`{"email":"bolt@example.com","password":"Secret123!"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	require.NoError(t, lifecycle.Close(context.Background()))
+
+	router, lifecycle, err = NewApp(context.Background(), cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, lifecycle.Close(context.Background())) })
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/users", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), "bolt@example.com")
+}
+
+func TestNewAppExposesMetrics(t *testing.T) {
+	router, _ := newMemoryApp(t, config.Default())
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code, "metrics must be opt-in")
+
+	cfg := config.Default()
+	cfg.Features.Metrics = true
+	router, _ = newMemoryApp(t, cfg)
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/todos?email=a@example.com", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `todoapp_http_requests_total{method="GET",route="/todos",status="200"} 1`)
+	require.Contains(t, rec.Body.String(), `todoapp_repository_operations_total{method="List",outcome="ok",repository="todos"} 1`)
+}
+
+func TestNewAppPropagatesTraceContext(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	previous := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	router, lifecycle, err := NewApp(context.Background(), config.Default(),
+		WithStores(Stores{Users: services.NewMemoryUserRepository(), Todos: services.NewMemoryTodoRepository()}),
+		WithTracerProvider(telemetry.NewProvider(sdktrace.WithSyncer(exporter))),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, lifecycle.Close(context.Background())) })
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodPost, "/todos", strings.NewReader(`{"email":"a@example.com","title":"Traced"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	spans := map[string]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	server, ok := spans["/todos"]
+	require.True(t, ok, "expected a server span named after the route, got %v", spans)
+	require.Equal(t, traceID, server.SpanContext.TraceID().String())
+	require.Equal(t, "00f067aa0ba902b7", server.Parent.SpanID().String())
+
+	create, ok := spans["TodoService.CreateFrom"]
+	require.True(t, ok)
+	require.Equal(t, server.SpanContext.SpanID(), create.Parent.SpanID())
+}
@@ -2,7 +2,10 @@ package handlers
 
 import (
 	"errors"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
@@ -11,12 +14,31 @@ import (
 
 // AuthHandler exposes HTTP handlers related to authentication.
 type AuthHandler struct {
-	users *services.UserService
+	users    *services.UserService
+	guard    *services.LoginGuard
+	sessions *services.SessionService
 }
 
-// NewAuthHandler constructs an AuthHandler instance.
-func NewAuthHandler(users *services.UserService) *AuthHandler {
-	return &AuthHandler{users: users}
+// NewAuthHandler constructs an AuthHandler instance. When guard or sessions
+// are nil, in-memory implementations with default settings are used.
+func NewAuthHandler(users *services.UserService, guard *services.LoginGuard, sessions *services.SessionService) *AuthHandler {
+	if guard == nil {
+		guard = services.NewLoginGuard(nil, services.LockoutPolicy{}, services.LockoutPolicy{}, nil)
+	}
+	if sessions == nil {
+		sessions = services.NewSessionService(nil, 0, nil)
+	}
+	return &AuthHandler{users: users, guard: guard, sessions: sessions}
+}
+
+// setRetryAfter sets the Retry-After header rounded up to whole seconds.
+func setRetryAfter(c *gin.Context, wait time.Duration) int {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	return seconds
 }
 
 func ensureCORSHeaders(c *gin.Context) {
@@ -28,16 +50,15 @@ func ensureCORSHeaders(c *gin.Context) {
 }
 
 type registerRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string `json:"email" binding:"required,email,max=254"`
+	Password string `json:"password" binding:"required,max=72"`
 }
 
 // Register handles user registration.
 func (h *AuthHandler) Register(c *gin.Context) {
 	var payload registerRequest
-	if err := c.ShouldBindJSON(&payload); err != nil {
-		ensureCORSHeaders(c)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "datos invalidos"})
+	ensureCORSHeaders(c)
+	if !bindJSON(c, &payload) {
 		return
 	}
 
@@ -45,48 +66,120 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		Email:    payload.Email,
 		Password: payload.Password,
 	})
-	switch {
-	case err == nil:
-		ensureCORSHeaders(c)
-		c.JSON(http.StatusCreated, gin.H{"message": "usuario registrado con exito"})
-	case errors.Is(err, services.ErrInvalidUserInput):
-		ensureCORSHeaders(c)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "email y clave son requeridos"})
-	case errors.Is(err, services.ErrUserAlreadyExists):
-		ensureCORSHeaders(c)
-		c.JSON(http.StatusConflict, gin.H{"error": "usuario ya existe"})
-	default:
+	if err != nil {
 		ensureCORSHeaders(c)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "error al registrar usuario"})
+		respondError(c, err)
+		return
 	}
+
+	ensureCORSHeaders(c)
+	c.JSON(http.StatusCreated, gin.H{"message": "usuario registrado con exito"})
 }
 
 type loginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string `json:"email" binding:"required,max=254"`
+	Password string `json:"password" binding:"required,max=72"`
 }
 
 // Login handles user authentication.
 func (h *AuthHandler) Login(c *gin.Context) {
 	var payload loginRequest
-	if err := c.ShouldBindJSON(&payload); err != nil {
+	ensureCORSHeaders(c)
+	if !bindJSON(c, &payload) {
+		return
+	}
+
+	err := h.guarded(c, payload.Email, func() error {
+		return h.users.Login(c.Request.Context(), payload.Email, payload.Password)
+	})
+	if err != nil {
+		h.respondLoginError(c, err)
+		return
+	}
+
+	respondSession(c, h.sessions, payload.Email)
+}
+
+// respondSession starts a session for email and returns its bearer token.
+func respondSession(c *gin.Context, sessions *services.SessionService, email string) {
+	token, expiresAt, err := sessions.Create(c.Request.Context(), email)
+	if err != nil {
+		ensureCORSHeaders(c)
+		respondError(c, err)
+		return
+	}
+
+	ensureCORSHeaders(c)
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "login exitoso",
+		"token":     token,
+		"expiresAt": expiresAt,
+	})
+}
+
+// Logout revokes the session of the bearer token.
+func (h *AuthHandler) Logout(c *gin.Context) {
+	if err := h.sessions.Revoke(c.Request.Context(), bearerToken(c)); err != nil {
 		ensureCORSHeaders(c)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "datos invalidos"})
+		respondError(c, err)
 		return
 	}
 
-	err := h.users.Login(c.Request.Context(), payload.Email, payload.Password)
+	ensureCORSHeaders(c)
+	c.JSON(http.StatusOK, gin.H{"message": "sesion cerrada"})
+}
+
+// guarded runs a credential check under the login guard: the attempt is
+// counted as a failure before check runs, so that concurrent attempts
+// cannot outrun the lockout. It is refused while the account or client IP
+// is locked out, kept for wrong passwords and codes, and taken back
+// otherwise; a success also clears the account counter.
+func (h *AuthHandler) guarded(c *gin.Context, email string, check func() error) error {
+	ctx := c.Request.Context()
+
+	reservation, err := h.guard.Reserve(ctx, email, c.ClientIP())
+	if err != nil {
+		return err
+	}
+
+	err = check()
 	switch {
 	case err == nil:
-		ensureCORSHeaders(c)
-		c.JSON(http.StatusOK, gin.H{"message": "login exitoso"})
-	case errors.Is(err, services.ErrInvalidCredentials):
-		ensureCORSHeaders(c)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "credenciales invalidas"})
+		return reservation.Succeed(ctx)
+	case errors.Is(err, services.ErrInvalidCredentials), errors.Is(err, services.ErrInvalidTwoFactorCode):
+		if wait := reservation.Fail(); wait > 0 {
+			setRetryAfter(c, wait)
+		}
+		return err
 	default:
+		if cancelErr := reservation.Cancel(ctx); cancelErr != nil {
+			return errors.Join(err, cancelErr)
+		}
+		return err
+	}
+}
+
+func (h *AuthHandler) respondLoginError(c *gin.Context, err error) {
+	var challenge *services.TwoFactorRequiredError
+	if errors.As(err, &challenge) {
 		ensureCORSHeaders(c)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "error al autenticar"})
+		respondChallenge(c, challenge)
+		return
 	}
+
+	ensureCORSHeaders(c)
+	respondError(c, err)
+}
+
+// respondChallenge asks for the second factor of a login, to be completed
+// with POST /login/2fa.
+func respondChallenge(c *gin.Context, challenge *services.TwoFactorRequiredError) {
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":           "se requiere segundo factor",
+		"twoFactorRequired": true,
+		"challenge":         challenge.Challenge,
+		"expiresAt":         challenge.ExpiresAt,
+	})
 }
 
 // ListUsers returns every registered user in its public form.
@@ -94,7 +187,7 @@ func (h *AuthHandler) ListUsers(c *gin.Context) {
 	users, err := h.users.List(c.Request.Context())
 	if err != nil {
 		ensureCORSHeaders(c)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "error al obtener usuarios"})
+		respondError(c, err)
 		return
 	}
 	ensureCORSHeaders(c)
@@ -105,7 +198,7 @@ func (h *AuthHandler) ListUsers(c *gin.Context) {
 func (h *AuthHandler) ClearUsers(c *gin.Context) {
 	if err := h.users.Clear(c.Request.Context()); err != nil {
 		ensureCORSHeaders(c)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "error al limpiar usuarios"})
+		respondError(c, err)
 		return
 	}
 
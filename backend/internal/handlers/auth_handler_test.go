@@ -2,12 +2,17 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/require"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/services"
 )
 
 func TestRegisterAndLoginFlow(t *testing.T) {
@@ -107,6 +112,38 @@ func TestLoginInvalidCredentials(t *testing.T) {
 	require.Equal(t, http.StatusUnauthorized, rec.Code)
 }
 
+func TestLoginRejectsDisabledUsers(t *testing.T) {
+	app := newTestApp()
+	require.NoError(t, app.users.Insert(context.Background(), services.User{Email: "user@example.com", Password: "secret", Disabled: true}))
+
+	body, err := json.Marshal(map[string]string{"email": "user@example.com", "password": "secret"})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	app.router.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	require.Contains(t, rec.Body.String(), string(CodeAccountDisabled))
+}
+
+func TestSessionsOfDisabledUsersAreRejected(t *testing.T) {
+	app := newTestApp()
+	ctx := context.Background()
+	require.NoError(t, app.users.Insert(ctx, services.User{Email: "user@example.com", Password: "secret"}))
+	token := app.login(t, "user@example.com")
+	require.NoError(t, app.users.SetDisabled(ctx, "user@example.com", true))
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/me", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	app.router.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	require.Contains(t, rec.Body.String(), string(CodeAccountDisabled))
+}
+
 func TestClearUsersEndpoint(t *testing.T) {
 	app := newTestApp()
 
@@ -116,3 +153,44 @@ func TestClearUsersEndpoint(t *testing.T) {
 
 	require.Equal(t, http.StatusOK, rec.Code)
 }
+
+func TestLoginLocksAccountAfterRepeatedFailures(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	userService := services.NewUserService(services.NewMemoryUserRepository())
+	require.NoError(t, userService.Register(context.Background(), services.User{Email: "user@example.com", Password: "secret"}))
+
+	policy := services.LockoutPolicy{FreeAttempts: 2, BaseDelay: 30 * time.Second, Window: time.Hour}
+	guard := services.NewLoginGuard(nil, policy, services.DefaultIPLockoutPolicy, func() time.Time { return fixedTime })
+	todoHandler := NewTodoHandler(services.NewTodoService(services.NewMemoryTodoRepository(), nil))
+	router := SetupRouter(NewAuthHandler(userService, guard, nil), todoHandler, RouterConfig{})
+
+	login := func(password string) *httptest.ResponseRecorder {
+		body, err := json.Marshal(map[string]string{"email": "user@example.com", "password": password})
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := 0; i < 2; i++ {
+		rec := login("wrong")
+		require.Equal(t, http.StatusUnauthorized, rec.Code)
+		require.Empty(t, rec.Header().Get("Retry-After"))
+	}
+
+	rec := login("wrong")
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Equal(t, "30", rec.Header().Get("Retry-After"))
+
+	rec = login("secret")
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+	require.Equal(t, "30", rec.Header().Get("Retry-After"))
+
+	var resp map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Equal(t, float64(30), resp["retryAfter"])
+	require.NotEmpty(t, resp["error"])
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/services"
+)
+
+// calendarFeedPath serves the iCalendar feed. The token goes in the query
+// string, which unlike the path is kept out of access logs and traces.
+const calendarFeedPath = "/calendar.ics"
+
+// RotateCalendarToken issues a new calendar feed URL for the session user;
+// the previous URL stops working.
+func (h *AccountHandler) RotateCalendarToken(c *gin.Context) {
+	token, err := h.users.RotateCalendarToken(c.Request.Context(), sessionEmail(c))
+	if err != nil {
+		respondError(c, err, on(services.ErrNotFound, CodeUserNotFound))
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"token": token, "url": calendarFeedURL(c, token)})
+}
+
+// RevokeCalendarToken turns the calendar feed of the session user off.
+func (h *AccountHandler) RevokeCalendarToken(c *gin.Context) {
+	if err := h.users.RevokeCalendarToken(c.Request.Context(), sessionEmail(c)); err != nil {
+		respondError(c, err, on(services.ErrNotFound, CodeUserNotFound))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "calendario desactivado"})
+}
+
+// CalendarFeed serves the todos of the owner of ?token as an iCalendar
+// feed. Calendar clients poll it without a session, so the token is the
+// only credential.
+func (h *AccountHandler) CalendarFeed(c *gin.Context) {
+	email, err := h.users.CalendarOwner(c.Request.Context(), c.Query("token"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	var buf bytes.Buffer
+	err = h.todos.Export(c.Request.Context(), email, services.TodoFormatICS, &buf, services.WithCalendarDomain(calendarDomain(c)))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.Header("Cache-Control", "private, no-cache")
+	c.Data(http.StatusOK, todoFormatTypes[services.TodoFormatICS]+"; charset=utf-8", buf.Bytes())
+}
+
+// calendarFeedURL is the absolute feed URL of token on the host the request
+// was sent to.
+func calendarFeedURL(c *gin.Context, token string) string {
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	u := url.URL{
+		Scheme:   scheme,
+		Host:     c.Request.Host,
+		Path:     "/v1" + calendarFeedPath,
+		RawQuery: url.Values{"token": {token}}.Encode(),
+	}
+	return u.String()
+}
+
+// calendarDomain is the host the request was sent to, without its port,
+// which qualifies the UIDs of iCalendar exports.
+func calendarDomain(c *gin.Context) string {
+	if host, _, err := net.SplitHostPort(c.Request.Host); err == nil {
+		return host
+	}
+	return c.Request.Host
+}
+
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/services"
+)
+
+func TestCalendarFeedLifecycle(t *testing.T) {
+	app := newTestApp()
+	ctx := context.Background()
+
+	require.NoError(t, app.users.Insert(ctx, services.User{Email: "alice@example.com", Password: "secret"}))
+	due := time.Date(2025, time.January, 3, 9, 0, 0, 0, time.UTC)
+	_, err := app.todos.Create(ctx, services.Todo{Email: "alice@example.com", Title: "Pay rent", CreatedAt: fixedTime, DueAt: &due})
+	require.NoError(t, err)
+	_, err = app.todos.Create(ctx, services.Todo{Email: "alice@example.com", Title: "Buy milk", Completed: true, CreatedAt: fixedTime})
+	require.NoError(t, err)
+	session := app.login(t, "alice@example.com")
+
+	calendarToken := func(method string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/v1/me/calendar-token", nil)
+		req.Header.Set("Authorization", "Bearer "+session)
+		rec := httptest.NewRecorder()
+		app.router.ServeHTTP(rec, req)
+		return rec
+	}
+	feed := func(token string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		app.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/calendar.ics?token="+url.QueryEscape(token), nil))
+		return rec
+	}
+
+	rec := calendarToken(http.MethodPost)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var issued struct {
+		Token string `json:"token"`
+		URL   string `json:"url"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &issued))
+	require.NotEmpty(t, issued.Token)
+	require.Equal(t, "http://example.com/v1/calendar.ics?token="+issued.Token, issued.URL)
+
+	rec = feed(issued.Token)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "text/calendar; charset=utf-8", rec.Header().Get("Content-Type"))
+	body := rec.Body.String()
+	require.True(t, strings.HasPrefix(body, "BEGIN:VCALENDAR\r\n"))
+	require.Equal(t, 2, strings.Count(body, "BEGIN:VTODO\r\n"))
+	require.Contains(t, body, "SUMMARY:Pay rent\r\nSTATUS:NEEDS-ACTION\r\nDUE:20250103T090000Z\r\n")
+	require.Contains(t, body, "SUMMARY:Buy milk\r\nSTATUS:COMPLETED\r\n")
+	require.Contains(t, body, "CREATED:20250101T100000Z\r\n")
+	require.Regexp(t, "UID:[0-9a-f]{24}@example.com\r\n", body)
+
+	// Rotating invalidates the previous URL.
+	rec = calendarToken(http.MethodPost)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.Equal(t, http.StatusNotFound, feed(issued.Token).Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &issued))
+	require.Equal(t, http.StatusOK, feed(issued.Token).Code)
+
+	require.Equal(t, http.StatusOK, calendarToken(http.MethodDelete).Code)
+	require.Equal(t, http.StatusNotFound, feed(issued.Token).Code)
+	require.Equal(t, http.StatusNotFound, feed("").Code)
+
+	rec = httptest.NewRecorder()
+	app.router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/me/calendar-token", nil))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestImportTodosFromICalendar(t *testing.T) {
+	app := newTestApp()
+
+	body := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"BEGIN:VTODO",
+		"SUMMARY:File taxes",
+		"DUE;VALUE=DATE:20250415",
+		"STATUS:NEEDS-ACTION",
+		"END:VTODO",
+		"BEGIN:VTODO",
+		"DUE:soon",
+		"END:VTODO",
+		"END:VCALENDAR",
+	}, "\r\n")
+	req := httptest.NewRequest(http.MethodPost, "/todos/import?email=ana@example.com", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "text/calendar; charset=utf-8")
+	rec := httptest.NewRecorder()
+	app.router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var resp struct {
+		Todos  []services.TodoResponse `json:"todos"`
+		Errors []importRowError        `json:"errors"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Len(t, resp.Todos, 1)
+	require.Equal(t, "File taxes", resp.Todos[0].Title)
+	require.NotNil(t, resp.Todos[0].DueAt)
+	require.True(t, resp.Todos[0].DueAt.Equal(time.Date(2025, time.April, 15, 0, 0, 0, 0, time.UTC)))
+	require.Len(t, resp.Errors, 1)
+	require.Equal(t, 2, resp.Errors[0].Row)
+	require.Equal(t, "dueAt", resp.Errors[0].Field)
+}
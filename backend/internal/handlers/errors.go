@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/language"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/oidc"
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/services"
+)
+
+// ErrorCode is a stable, machine-readable identifier of an API error.
+// Clients should branch on it rather than on the localized message.
+type ErrorCode string
+
+// Error codes returned in ErrorResponse.Code.
+const (
+	CodeInvalidRequest          ErrorCode = "INVALID_REQUEST"
+	CodeValidationFailed        ErrorCode = "VALIDATION_FAILED"
+	CodePayloadTooLarge         ErrorCode = "PAYLOAD_TOO_LARGE"
+	CodeUnsupportedAPIVersion   ErrorCode = "UNSUPPORTED_API_VERSION"
+	CodeRateLimited             ErrorCode = "RATE_LIMITED"
+	CodeInvalidIdempotencyKey   ErrorCode = "INVALID_IDEMPOTENCY_KEY"
+	CodeIdempotencyKeyReused    ErrorCode = "IDEMPOTENCY_KEY_REUSED"
+	CodeIdempotencyInProgress   ErrorCode = "IDEMPOTENCY_IN_PROGRESS"
+	CodeInvalidUserInput        ErrorCode = "INVALID_USER_INPUT"
+	CodeUserAlreadyExists       ErrorCode = "USER_ALREADY_EXISTS"
+	CodeUserNotFound            ErrorCode = "USER_NOT_FOUND"
+	CodeInvalidCredentials      ErrorCode = "INVALID_CREDENTIALS"
+	CodeAccountLocked           ErrorCode = "ACCOUNT_LOCKED"
+	CodeAccountDisabled         ErrorCode = "ACCOUNT_DISABLED"
+	CodeInvalidSession          ErrorCode = "INVALID_SESSION"
+	CodeInvalidChallenge        ErrorCode = "INVALID_CHALLENGE"
+	CodeInvalidTwoFactorCode    ErrorCode = "INVALID_TWO_FACTOR_CODE"
+	CodeTwoFactorAlreadyEnabled ErrorCode = "TWO_FACTOR_ALREADY_ENABLED"
+	CodeTwoFactorNotEnabled     ErrorCode = "TWO_FACTOR_NOT_ENABLED"
+	CodeInvalidTodoInput        ErrorCode = "INVALID_TODO_INPUT"
+	CodeInvalidTodoID           ErrorCode = "INVALID_TODO_ID"
+	CodeInvalidDueFilter        ErrorCode = "INVALID_DUE_FILTER"
+	CodeNothingToUpdate         ErrorCode = "NOTHING_TO_UPDATE"
+	CodeTodoNotFound            ErrorCode = "TODO_NOT_FOUND"
+	CodeQuotaExceeded           ErrorCode = "QUOTA_EXCEEDED"
+	CodeUnsupportedFormat       ErrorCode = "UNSUPPORTED_FORMAT"
+	CodeNotFound                ErrorCode = "NOT_FOUND"
+	CodeSSORejected             ErrorCode = "SSO_REJECTED"
+	CodeSSOInvalidState         ErrorCode = "SSO_INVALID_STATE"
+	CodeSSOInvalidToken         ErrorCode = "SSO_INVALID_TOKEN"
+	CodeSSOProviderError        ErrorCode = "SSO_PROVIDER_ERROR"
+	CodeInternal                ErrorCode = "INTERNAL_ERROR"
+)
+
+// Field error codes returned in FieldError.Code.
+const (
+	CodeFieldRequired     ErrorCode = "REQUIRED"
+	CodeFieldInvalid      ErrorCode = "INVALID"
+	CodeFieldInvalidEmail ErrorCode = "INVALID_EMAIL"
+	CodeFieldTooLong      ErrorCode = "TOO_LONG"
+	CodeFieldTooShort     ErrorCode = "TOO_SHORT"
+	CodeFieldUnknown      ErrorCode = "UNKNOWN_FIELD"
+)
+
+// FieldError reports a problem with a single request field. Param carries
+// the rule argument, such as the maximum length for TOO_LONG.
+type FieldError struct {
+	Field   string    `json:"field"`
+	Code    ErrorCode `json:"code"`
+	Param   string    `json:"param,omitempty"`
+	Message string    `json:"message"`
+}
+
+// ErrorResponse is the body of every error response. Message is serialised
+// as "error" so clients that only display that key keep working.
+type ErrorResponse struct {
+	Code       ErrorCode    `json:"code"`
+	Status     int          `json:"status"`
+	Message    string       `json:"error"`
+	Fields     []FieldError `json:"fields,omitempty"`
+	RetryAfter int          `json:"retryAfter,omitempty"`
+}
+
+// catalogEntry holds the HTTP status and the localized messages of a code.
+// Field codes have no status of their own and may embed {param}.
+type catalogEntry struct {
+	status int
+	es, en string
+}
+
+var errorCatalog = map[ErrorCode]catalogEntry{
+	CodeInvalidRequest:          {http.StatusBadRequest, "datos invalidos", "invalid request"},
+	CodeValidationFailed:        {http.StatusBadRequest, "la solicitud tiene campos invalidos", "the request has invalid fields"},
+	CodePayloadTooLarge:         {http.StatusRequestEntityTooLarge, "cuerpo de la solicitud demasiado grande", "request body too large"},
+	CodeUnsupportedAPIVersion:   {http.StatusBadRequest, "version de API no soportada", "unsupported API version"},
+	CodeRateLimited:             {http.StatusTooManyRequests, "demasiadas solicitudes, intente mas tarde", "too many requests, try again later"},
+	CodeInvalidIdempotencyKey:   {http.StatusBadRequest, "clave de idempotencia invalida", "invalid idempotency key"},
+	CodeIdempotencyKeyReused:    {http.StatusUnprocessableEntity, "clave de idempotencia usada con otra solicitud", "idempotency key used with a different request"},
+	CodeIdempotencyInProgress:   {http.StatusConflict, "la solicitud original aun se esta procesando", "the original request is still being processed"},
+	CodeInvalidUserInput:        {http.StatusBadRequest, "datos de usuario invalidos", "invalid user data"},
+	CodeUserAlreadyExists:       {http.StatusConflict, "usuario ya existe", "user already exists"},
+	CodeUserNotFound:            {http.StatusNotFound, "usuario no encontrado", "user not found"},
+	CodeInvalidCredentials:      {http.StatusUnauthorized, "credenciales invalidas", "invalid credentials"},
+	CodeAccountLocked:           {http.StatusTooManyRequests, "cuenta bloqueada temporalmente", "account temporarily locked"},
+	CodeAccountDisabled:         {http.StatusForbidden, "cuenta deshabilitada", "account disabled"},
+	CodeInvalidSession:          {http.StatusUnauthorized, "sesion invalida", "invalid session"},
+	CodeInvalidChallenge:        {http.StatusUnauthorized, "desafio invalido o expirado", "invalid or expired challenge"},
+	CodeInvalidTwoFactorCode:    {http.StatusUnauthorized, "codigo invalido", "invalid code"},
+	CodeTwoFactorAlreadyEnabled: {http.StatusConflict, "segundo factor ya activado", "two-factor authentication already enabled"},
+	CodeTwoFactorNotEnabled:     {http.StatusConflict, "segundo factor no activado", "two-factor authentication not enabled"},
+	CodeInvalidTodoInput:        {http.StatusBadRequest, "datos de tarea invalidos", "invalid todo data"},
+	CodeInvalidTodoID:           {http.StatusBadRequest, "id invalido", "invalid id"},
+	CodeInvalidDueFilter:        {http.StatusBadRequest, "filtro de vencimiento invalido", "invalid due filter"},
+	CodeNothingToUpdate:         {http.StatusBadRequest, "nada para actualizar", "nothing to update"},
+	CodeTodoNotFound:            {http.StatusNotFound, "tarea no encontrada", "todo not found"},
+	CodeQuotaExceeded:           {http.StatusForbidden, "cuota excedida", "quota exceeded"},
+	CodeUnsupportedFormat:       {http.StatusBadRequest, "formato no soportado", "unsupported format"},
+	CodeNotFound:                {http.StatusNotFound, "recurso no encontrado", "resource not found"},
+	CodeSSORejected:             {http.StatusUnauthorized, "sso rechazado", "sso rejected"},
+	CodeSSOInvalidState:         {http.StatusBadRequest, "estado sso invalido o expirado", "invalid or expired sso state"},
+	CodeSSOInvalidToken:         {http.StatusUnauthorized, "token sso invalido", "invalid sso token"},
+	CodeSSOProviderError:        {http.StatusBadGateway, "error al contactar proveedor sso", "could not reach the sso provider"},
+	CodeInternal:                {http.StatusInternalServerError, "error interno", "internal error"},
+
+	CodeFieldRequired:     {0, "campo requerido", "field is required"},
+	CodeFieldInvalid:      {0, "valor invalido", "invalid value"},
+	CodeFieldInvalidEmail: {0, "email invalido", "invalid email"},
+	CodeFieldTooLong:      {0, "maximo {param} caracteres", "at most {param} characters"},
+	CodeFieldTooShort:     {0, "minimo {param} caracteres", "at least {param} characters"},
+	CodeFieldUnknown:      {0, "campo desconocido", "unknown field"},
+}
+
+// errorCodes maps domain errors to codes. The first entry matched with
+// errors.Is wins, so more specific errors must come first.
+var errorCodes = []struct {
+	err  error
+	code ErrorCode
+}{
+	{services.ErrInvalidSession, CodeInvalidSession},
+	{services.ErrInvalidCredentials, CodeInvalidCredentials},
+	{services.ErrUserDisabled, CodeAccountDisabled},
+	{services.ErrInvalidChallenge, CodeInvalidChallenge},
+	{services.ErrInvalidTwoFactorCode, CodeInvalidTwoFactorCode},
+	{services.ErrTwoFactorAlreadyEnabled, CodeTwoFactorAlreadyEnabled},
+	{services.ErrTwoFactorNotEnrolled, CodeTwoFactorNotEnabled},
+	{services.ErrTwoFactorNotEnabled, CodeTwoFactorNotEnabled},
+	{services.ErrUserAlreadyExists, CodeUserAlreadyExists},
+	{services.ErrInvalidUserInput, CodeInvalidUserInput},
+	{services.ErrInvalidTodoInput, CodeInvalidTodoInput},
+	{services.ErrInvalidTodoID, CodeInvalidTodoID},
+	{services.ErrInvalidDueFilter, CodeInvalidDueFilter},
+	{services.ErrUnsupportedFormat, CodeUnsupportedFormat},
+	{services.ErrIdempotencyKeyReused, CodeIdempotencyKeyReused},
+	{services.ErrIdempotencyInProgress, CodeIdempotencyInProgress},
+	{services.ErrNotFound, CodeNotFound},
+	{oidc.ErrInvalidState, CodeSSOInvalidState},
+	{oidc.ErrInvalidToken, CodeSSOInvalidToken},
+	{oidc.ErrEmailNotVerified, CodeSSOInvalidToken},
+}
+
+// errorOverride refines the code of a generic domain error for one handler,
+// e.g. services.ErrNotFound becomes TODO_NOT_FOUND on todo routes.
+type errorOverride struct {
+	err  error
+	code ErrorCode
+}
+
+func on(err error, code ErrorCode) errorOverride {
+	return errorOverride{err: err, code: code}
+}
+
+// errorCode returns the code mapped to err, or ok=false if err is unknown.
+func errorCode(err error, overrides ...errorOverride) (code ErrorCode, ok bool) {
+	for _, o := range overrides {
+		if errors.Is(err, o.err) {
+			return o.code, true
+		}
+	}
+	for _, m := range errorCodes {
+		if errors.Is(err, m.err) {
+			return m.code, true
+		}
+	}
+	return "", false
+}
+
+// respondError writes the error envelope for err. Unknown errors become
+// INTERNAL_ERROR and are attached to the context so the request logger
+// records the cause.
+func respondError(c *gin.Context, err error, overrides ...errorOverride) {
+	var locked *services.LockedError
+	if errors.As(err, &locked) {
+		seconds := setRetryAfter(c, locked.RetryAfter)
+		resp := newErrorResponse(c, CodeAccountLocked)
+		resp.RetryAfter = seconds
+		c.AbortWithStatusJSON(resp.Status, resp)
+		return
+	}
+
+	var quota *services.QuotaError
+	if errors.As(err, &quota) {
+		var fields []FieldError
+		if quota.Quota == services.QuotaTitleLength {
+			fields = append(fields, fieldError(c, "title", CodeFieldTooLong, strconv.Itoa(quota.Limit)))
+		}
+		writeError(c, CodeQuotaExceeded, fields...)
+		return
+	}
+
+	code, ok := errorCode(err, overrides...)
+	if !ok {
+		_ = c.Error(err)
+		code = CodeInternal
+	}
+	writeError(c, code)
+}
+
+// writeError writes the envelope for code with optional field errors.
+func writeError(c *gin.Context, code ErrorCode, fields ...FieldError) {
+	resp := newErrorResponse(c, code)
+	resp.Fields = fields
+	c.AbortWithStatusJSON(resp.Status, resp)
+}
+
+func newErrorResponse(c *gin.Context, code ErrorCode) ErrorResponse {
+	lang := requestLanguage(c)
+	entry, ok := errorCatalog[code]
+	if !ok {
+		code, entry = CodeInternal, errorCatalog[CodeInternal]
+	}
+	return ErrorResponse{Code: code, Status: entry.status, Message: entry.message(lang)}
+}
+
+// fieldError builds a FieldError localized for the request.
+func fieldError(c *gin.Context, field string, code ErrorCode, param string) FieldError {
+	message := errorCatalog[code].message(requestLanguage(c))
+	return FieldError{
+		Field:   field,
+		Code:    code,
+		Param:   param,
+		Message: strings.ReplaceAll(message, "{param}", param),
+	}
+}
+
+func (e catalogEntry) message(lang string) string {
+	if lang == "en" {
+		return e.en
+	}
+	return e.es
+}
+
+// supportedLanguages lists the message languages; the first is the default.
+var supportedLanguages = language.NewMatcher([]language.Tag{language.Spanish, language.English})
+
+// requestLanguage picks "es" or "en" from the Accept-Language header.
+func requestLanguage(c *gin.Context) string {
+	tag, _ := language.MatchStrings(supportedLanguages, c.GetHeader("Accept-Language"))
+	base, _ := tag.Base()
+	return base.String()
+}
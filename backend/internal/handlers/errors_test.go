@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/services"
+)
+
+func TestErrorCodeMapping(t *testing.T) {
+	cases := []struct {
+		err       error
+		overrides []errorOverride
+		want      ErrorCode
+		ok        bool
+	}{
+		{err: services.ErrInvalidCredentials, want: CodeInvalidCredentials, ok: true},
+		{err: services.ErrUnsupportedFormat, want: CodeUnsupportedFormat, ok: true},
+		{err: services.ErrUserDisabled, want: CodeAccountDisabled, ok: true},
+		{err: fmt.Errorf("wrapped: %w", services.ErrUserAlreadyExists), want: CodeUserAlreadyExists, ok: true},
+		{err: services.ErrNotFound, want: CodeNotFound, ok: true},
+		{err: services.ErrNotFound, overrides: []errorOverride{on(services.ErrNotFound, CodeTodoNotFound)}, want: CodeTodoNotFound, ok: true},
+		{err: errors.New("boom"), ok: false},
+	}
+
+	for _, tc := range cases {
+		code, ok := errorCode(tc.err, tc.overrides...)
+		require.Equal(t, tc.ok, ok, tc.err.Error())
+		require.Equal(t, tc.want, code, tc.err.Error())
+	}
+}
+
+func TestErrorCatalogCoversMappedCodes(t *testing.T) {
+	for _, m := range errorCodes {
+		entry, ok := errorCatalog[m.code]
+		require.True(t, ok, "missing catalog entry for %s", m.code)
+		require.NotZero(t, entry.status, m.code)
+		require.NotEmpty(t, entry.es, m.code)
+		require.NotEmpty(t, entry.en, m.code)
+	}
+}
+
+func TestErrorEnvelopeIsLocalized(t *testing.T) {
+	app := newTestApp()
+	path := "/todos/" + primitive.NewObjectID().Hex()
+
+	cases := []struct {
+		acceptLanguage string
+		message        string
+	}{
+		{"", "tarea no encontrada"},
+		{"en-US,en;q=0.9", "todo not found"},
+		{"fr-FR, es;q=0.5", "tarea no encontrada"},
+	}
+
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodDelete, path, nil)
+		if tc.acceptLanguage != "" {
+			req.Header.Set("Accept-Language", tc.acceptLanguage)
+		}
+		rec := httptest.NewRecorder()
+		app.router.ServeHTTP(rec, req)
+
+		require.Equal(t, http.StatusNotFound, rec.Code)
+		var resp ErrorResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		require.Equal(t, CodeTodoNotFound, resp.Code)
+		require.Equal(t, http.StatusNotFound, resp.Status)
+		require.Equal(t, tc.message, resp.Message, tc.acceptLanguage)
+	}
+}
+
+func TestErrorEnvelopeForInvalidCredentials(t *testing.T) {
+	app := newTestApp()
+
+	rec, resp := postJSON(t, app, "/login", map[string]string{"email": "nobody@example.com", "password": "secret"})
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Equal(t, string(CodeInvalidCredentials), resp["code"])
+	require.Equal(t, float64(http.StatusUnauthorized), resp["status"])
+	require.Equal(t, "credenciales invalidas", resp["error"])
+	require.NotContains(t, resp, "fields")
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/logging"
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/version"
+)
+
+// defaultCheckTimeout bounds each readiness check so that a hung dependency
+// cannot stall the probe.
+const defaultCheckTimeout = 2 * time.Second
+
+// HealthCheck is a readiness probe for a single dependency.
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// HealthHandler serves the liveness and readiness probes.
+type HealthHandler struct {
+	checks  []HealthCheck
+	timeout time.Duration
+}
+
+// NewHealthHandler builds a HealthHandler running checks on readiness probes.
+func NewHealthHandler(checks ...HealthCheck) *HealthHandler {
+	return &HealthHandler{checks: checks, timeout: defaultCheckTimeout}
+}
+
+// Statuses of a readiness check. Probes are unauthenticated, so the error
+// behind a failure is only logged.
+const (
+	checkOK      = "ok"
+	checkError   = "error"
+	checkTimeout = "timeout"
+)
+
+type checkResult struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latencyMs"`
+}
+
+// Live reports that the process is up. It never touches dependencies, so a
+// database outage does not get the process restarted.
+func (h *HealthHandler) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "ok",
+		"version": version.Version,
+		"commit":  version.Commit,
+	})
+}
+
+// Ready runs every check concurrently and answers 503 when any of them fails.
+func (h *HealthHandler) Ready(c *gin.Context) {
+	results := make(map[string]checkResult, len(h.checks))
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, check := range h.checks {
+		wg.Add(1)
+		go func(check HealthCheck) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(c.Request.Context(), h.timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check.Check(ctx)
+			result := checkResult{
+				Status:    checkOK,
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				result.Status = checkError
+				if errors.Is(err, context.DeadlineExceeded) {
+					result.Status = checkTimeout
+				}
+				logging.FromContext(ctx).Warn("readiness check failed",
+					slog.String("check", check.Name), slog.Any("error", err))
+			}
+
+			mu.Lock()
+			results[check.Name] = result
+			mu.Unlock()
+		}(check)
+	}
+	wg.Wait()
+
+	status, code := "ok", http.StatusOK
+	for _, result := range results {
+		if result.Status != checkOK {
+			status, code = "unavailable", http.StatusServiceUnavailable
+			break
+		}
+	}
+
+	c.JSON(code, gin.H{
+		"status": status,
+		"checks": results,
+		"build": gin.H{
+			"version": version.Version,
+			"commit":  version.Commit,
+		},
+	})
+}
@@ -1,12 +1,20 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/require"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/logging"
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/version"
 )
 
 func TestHealthEndpoint(t *testing.T) {
@@ -23,3 +31,52 @@ func TestHealthEndpoint(t *testing.T) {
 	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
 	require.Equal(t, "ok", body["status"])
 }
+
+func TestReadinessReportsFailingDependency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var logs bytes.Buffer
+	logger, err := logging.New(&logs, "info", logging.FormatJSON)
+	require.NoError(t, err)
+	health := NewHealthHandler(
+		HealthCheck{Name: "mongo", Check: func(context.Context) error { return nil }},
+		HealthCheck{Name: "mongo_indexes", Check: func(context.Context) error { return errors.New("missing indexes: sessions.email") }},
+	)
+	router := SetupRouter(NewAuthHandler(nil, nil, nil), NewTodoHandler(nil), RouterConfig{Health: health, Logger: logger})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	var body struct {
+		Status string                 `json:"status"`
+		Checks map[string]checkResult `json:"checks"`
+		Build  map[string]string      `json:"build"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Equal(t, "unavailable", body.Status)
+	require.Equal(t, "ok", body.Checks["mongo"].Status)
+	require.Equal(t, "error", body.Checks["mongo_indexes"].Status)
+	require.NotContains(t, rec.Body.String(), "sessions.email")
+	require.Contains(t, logs.String(), "sessions.email")
+	require.Equal(t, version.Version, body.Build["version"])
+
+	// Liveness must not depend on the failing check.
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestReadinessTimesOutSlowChecks(t *testing.T) {
+	health := NewHealthHandler(HealthCheck{Name: "slow", Check: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+	health.timeout = 10 * time.Millisecond
+	router := SetupRouter(NewAuthHandler(nil, nil, nil), NewTodoHandler(nil), RouterConfig{Health: health})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	require.Contains(t, rec.Body.String(), `"status":"timeout"`)
+	require.NotContains(t, rec.Body.String(), "deadline exceeded")
+}
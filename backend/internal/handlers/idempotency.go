@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/logging"
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/services"
+)
+
+const (
+	// IdempotencyKeyHeader carries the client-chosen key of a retryable request.
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set on responses replayed for a retry.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	// maxIdempotencyKeyLength bounds the keys clients may send.
+	maxIdempotencyKeyLength = 255
+)
+
+// Idempotent replays the stored response when a POST, PUT, PATCH or DELETE
+// request is retried with the same Idempotency-Key. Keys are scoped as
+// described in idempotencyScope, and reusing one for a different request is
+// rejected with 422. Requests without the header, and 5xx responses, are
+// never stored.
+func (h *AuthHandler) Idempotent(idempotency *services.IdempotencyService) gin.HandlerFunc {
+	if idempotency == nil {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" || !isMutating(c.Request.Method) {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			ensureCORSHeaders(c)
+			writeError(c, CodeInvalidIdempotencyKey)
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			ensureCORSHeaders(c)
+			respondDecodeError(c, err)
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		ctx := c.Request.Context()
+		key = h.idempotencyScope(c, body) + ":" + key
+		hash := requestHash(c, body)
+		stored, err := idempotency.Begin(ctx, key, hash)
+		if err != nil {
+			ensureCORSHeaders(c)
+			respondError(c, err)
+			return
+		}
+		if stored != nil {
+			c.Header(IdempotentReplayedHeader, "true")
+			c.Data(stored.Status, stored.ContentType, stored.Body)
+			c.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		completed := false
+		defer func() {
+			// Free the key when the handler failed, even by panicking, so the
+			// client can retry.
+			if !completed {
+				if err := idempotency.Release(context.WithoutCancel(ctx), key); err != nil {
+					logging.FromContext(ctx).Warn("releasing idempotency key failed", slog.Any("error", err))
+				}
+			}
+		}()
+
+		c.Next()
+
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			return
+		}
+		err = idempotency.Complete(context.WithoutCancel(ctx), key, hash, status, recorder.Header().Get("Content-Type"), recorder.body.Bytes())
+		if err != nil {
+			logging.FromContext(ctx).Warn("storing idempotent response failed", slog.Any("error", err))
+			return
+		}
+		completed = true
+	}
+}
+
+// idempotencyScope names the namespace of the keys of a request: the session
+// user, or for anonymous requests the client IP together with the email the
+// request acts on, taken from the query or the JSON body. Anonymous clients
+// thus cannot replay, or block with 422, each other's requests.
+func (h *AuthHandler) idempotencyScope(c *gin.Context, body []byte) string {
+	if email := h.callerEmail(c); email != "" {
+		return "user:" + email
+	}
+	email := c.Query("email")
+	if email == "" {
+		var target struct {
+			Email string `json:"email"`
+		}
+		_ = json.Unmarshal(body, &target)
+		email = target.Email
+	}
+	return "anonymous:" + c.ClientIP() + "/" + services.NormalizeEmail(email)
+}
+
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// requestHash identifies a request by method, path without the version
+// prefix, query and body, so retries through /v1 and the legacy aliases match.
+func requestHash(c *gin.Context, body []byte) string {
+	sum := sha256.New()
+	sum.Write([]byte(c.Request.Method + " " + strings.TrimPrefix(c.Request.URL.Path, "/v1") + "?" + c.Request.URL.RawQuery + "\n"))
+	sum.Write(body)
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+// responseRecorder keeps a copy of the response body while writing it.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
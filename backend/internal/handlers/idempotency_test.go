@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/services"
+)
+
+func sendIdempotent(t *testing.T, app *testApp, method, path, key, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(IdempotencyKeyHeader, key)
+	rec := httptest.NewRecorder()
+	app.router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestIdempotencyKeyReplaysCreate(t *testing.T) {
+	app := newTestApp()
+	body := `{"email":"user@example.com","title":"Buy milk"}`
+
+	first := sendIdempotent(t, app, http.MethodPost, "/v1/todos", "create-1", body)
+	require.Equal(t, http.StatusCreated, first.Code)
+	require.Empty(t, first.Header().Get(IdempotentReplayedHeader))
+
+	// Retries through the legacy alias match the /v1 request.
+	retry := sendIdempotent(t, app, http.MethodPost, "/todos", "create-1", body)
+	require.Equal(t, http.StatusCreated, retry.Code)
+	require.Equal(t, "true", retry.Header().Get(IdempotentReplayedHeader))
+	require.JSONEq(t, first.Body.String(), retry.Body.String())
+	require.Equal(t, int64(1), app.countTodos(t, "user@example.com"))
+
+	rec := sendIdempotent(t, app, http.MethodPost, "/v1/todos", "create-1", `{"email":"user@example.com","title":"Buy bread"}`)
+	require.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	var resp ErrorResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Equal(t, CodeIdempotencyKeyReused, resp.Code)
+
+	// Without a key every request is processed.
+	rec, _ = sendRaw(t, app, http.MethodPost, "/v1/todos", body)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.Equal(t, int64(2), app.countTodos(t, "user@example.com"))
+}
+
+func TestAnonymousIdempotencyKeysAreScopedToOwnerAndAddress(t *testing.T) {
+	app := newTestApp()
+
+	send := func(ip, email string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/todos", strings.NewReader(`{"email":"`+email+`","title":"Buy milk"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(IdempotencyKeyHeader, "create-1")
+		req.RemoteAddr = ip + ":1234"
+		rec := httptest.NewRecorder()
+		app.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	require.Equal(t, http.StatusCreated, send("192.0.2.1", "alice@example.com").Code)
+
+	// Another owner reusing the key from the same address gets their own todo.
+	rec := send("192.0.2.1", "bob@example.com")
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.Empty(t, rec.Header().Get(IdempotentReplayedHeader))
+	require.Contains(t, rec.Body.String(), `"email":"bob@example.com"`)
+	require.Equal(t, int64(1), app.countTodos(t, "bob@example.com"))
+
+	// The same owner from another address does not see the stored response.
+	rec = send("198.51.100.7", "alice@example.com")
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.Empty(t, rec.Header().Get(IdempotentReplayedHeader))
+
+	retry := send("192.0.2.1", "alice@example.com")
+	require.Equal(t, http.StatusCreated, retry.Code)
+	require.Equal(t, "true", retry.Header().Get(IdempotentReplayedHeader))
+	require.Equal(t, int64(2), app.countTodos(t, "alice@example.com"))
+}
+
+func TestIdempotencyKeysAreScopedToTheCaller(t *testing.T) {
+	app := newTestApp()
+	for _, email := range []string{"alice@example.com", "bob@example.com"} {
+		require.NoError(t, app.users.Insert(context.Background(), services.User{Email: email, Password: "secret"}))
+	}
+	alice := app.login(t, "alice@example.com")
+	bob := app.login(t, "bob@example.com")
+
+	patch := func(token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, "/v1/me", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set(IdempotencyKeyHeader, "same-key")
+		rec := httptest.NewRecorder()
+		app.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	require.Equal(t, http.StatusOK, patch(alice, `{"displayName":"Alice"}`).Code)
+	rec := patch(bob, `{"displayName":"Bob"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Empty(t, rec.Header().Get(IdempotentReplayedHeader))
+	require.Contains(t, rec.Body.String(), `"displayName":"Bob"`)
+
+	replay := patch(alice, `{"displayName":"Alice"}`)
+	require.Equal(t, "true", replay.Header().Get(IdempotentReplayedHeader))
+}
+
+func TestIdempotencyKeyValidation(t *testing.T) {
+	app := newTestApp()
+
+	rec := sendIdempotent(t, app, http.MethodPost, "/v1/todos", strings.Repeat("k", 256), `{"email":"user@example.com","title":"x"}`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	var resp ErrorResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Equal(t, CodeInvalidIdempotencyKey, resp.Code)
+	require.Zero(t, app.countTodos(t, "user@example.com"))
+}
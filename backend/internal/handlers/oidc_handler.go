@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/oidc"
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/services"
+)
+
+// oidcStateCookie binds a login to the browser that started it: the callback
+// is only accepted with the state this cookie holds, so an attacker cannot
+// complete their own login in a victim's browser.
+const oidcStateCookie = "oidc_state"
+
+// OIDCHandler exposes single sign-on through an OpenID Connect provider.
+type OIDCHandler struct {
+	provider *oidc.Provider
+	users    *services.UserService
+	sessions *services.SessionService
+}
+
+// NewOIDCHandler builds a new OIDCHandler instance.
+func NewOIDCHandler(provider *oidc.Provider, users *services.UserService, sessions *services.SessionService) *OIDCHandler {
+	return &OIDCHandler{provider: provider, users: users, sessions: sessions}
+}
+
+// Login redirects the browser to the identity provider.
+func (h *OIDCHandler) Login(c *gin.Context) {
+	target, state, err := h.provider.AuthCodeURL(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	setStateCookie(c, state, int(oidc.StateTTL.Seconds()))
+	c.Redirect(http.StatusFound, target)
+}
+
+// Callback receives the authorization code, validates the ID token and
+// provisions the user on first login. The state must match the cookie set by
+// Login.
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	cookie, _ := c.Cookie(oidcStateCookie)
+	setStateCookie(c, "", -1)
+
+	if providerErr := c.Query("error"); providerErr != "" {
+		writeError(c, CodeSSORejected)
+		return
+	}
+
+	state := c.Query("state")
+	if cookie == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(state)) != 1 {
+		respondError(c, oidc.ErrInvalidState)
+		return
+	}
+
+	claims, err := h.provider.Exchange(c.Request.Context(), c.Query("code"), state)
+	if err != nil {
+		if _, known := errorCode(err); !known {
+			_ = c.Error(err)
+			writeError(c, CodeSSOProviderError)
+			return
+		}
+		respondError(c, err)
+		return
+	}
+
+	user, err := h.users.ProvisionExternalUser(c.Request.Context(), claims.Email)
+	if err != nil {
+		var challenge *services.TwoFactorRequiredError
+		if errors.As(err, &challenge) {
+			respondChallenge(c, challenge)
+			return
+		}
+		respondError(c, err)
+		return
+	}
+
+	token, expiresAt, err := h.sessions.Create(c.Request.Context(), user.Email)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "login exitoso",
+		"user":      user,
+		"token":     token,
+		"expiresAt": expiresAt,
+	})
+}
+
+// setStateCookie stores state in the state cookie for maxAge seconds; a
+// negative maxAge deletes it. SameSite=Lax still sends it on the redirect
+// back from the provider.
+func setStateCookie(c *gin.Context, state string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, maxAge, "/", "", secureRequest(c), true)
+}
+
+// secureRequest reports whether the client reached the server over HTTPS,
+// directly or through a proxy.
+func secureRequest(c *gin.Context) bool {
+	return c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/oidc"
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/oidc/oidctest"
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/services"
+)
+
+func TestOIDCLoginProvisionsUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	idp, err := oidctest.NewProvider("todo-app", "s3cret")
+	require.NoError(t, err)
+	defer idp.Close()
+	idp.SetIdentity(oidctest.Identity{Subject: "7", Email: "SSO@Example.com", EmailVerified: true})
+
+	provider, err := oidc.NewProvider(context.Background(), oidc.Config{
+		IssuerURL:    idp.Issuer(),
+		ClientID:     "todo-app",
+		ClientSecret: "s3cret",
+		RedirectURL:  "http://localhost:8080/auth/oidc/callback",
+	})
+	require.NoError(t, err)
+
+	users := services.NewMemoryUserRepository()
+	userService := services.NewUserService(users)
+	router := SetupRouter(
+		NewAuthHandler(userService, nil, nil),
+		NewTodoHandler(services.NewTodoService(services.NewMemoryTodoRepository(), nil)),
+		RouterConfig{OIDC: NewOIDCHandler(provider, userService, services.NewSessionService(nil, 0, nil))},
+	)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/oidc/login", nil))
+	require.Equal(t, http.StatusFound, rec.Code)
+	cookies := rec.Result().Cookies()
+	require.Len(t, cookies, 1)
+	require.Equal(t, oidcStateCookie, cookies[0].Name)
+	require.True(t, cookies[0].HttpOnly)
+	require.Equal(t, http.SameSiteLaxMode, cookies[0].SameSite)
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(rec.Header().Get("Location"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	require.Equal(t, "/auth/oidc/callback", callback.Path)
+
+	// A browser that did not start the login, such as a victim the callback
+	// URL was sent to, is rejected.
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, callback.RequestURI(), nil))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	req := httptest.NewRequest(http.MethodGet, callback.RequestURI(), nil)
+	req.AddCookie(cookies[0])
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var body struct {
+		Message string              `json:"message"`
+		User    services.PublicUser `json:"user"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Equal(t, "login exitoso", body.Message)
+	require.Equal(t, "sso@example.com", body.User.Email)
+
+	stored, err := users.FindByEmail(context.Background(), "sso@example.com")
+	require.NoError(t, err)
+	require.Empty(t, stored.Password)
+
+	req = httptest.NewRequest(http.MethodGet, callback.RequestURI(), nil)
+	req.AddCookie(cookies[0])
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+// oidcCallback starts a single sign-on through router and returns the
+// callback request the browser sends back, carrying the state cookie.
+func oidcCallback(t *testing.T, router http.Handler) *http.Request {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/oidc/login", nil))
+	require.Equal(t, http.StatusFound, rec.Code)
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(rec.Header().Get("Location"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, callback.RequestURI(), nil)
+	for _, cookie := range rec.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	return req
+}
+
+func TestOIDCLoginRequiresSecondFactor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	idp, err := oidctest.NewProvider("todo-app", "s3cret")
+	require.NoError(t, err)
+	defer idp.Close()
+	idp.SetIdentity(oidctest.Identity{Subject: "8", Email: "admin@example.com", EmailVerified: true})
+
+	provider, err := oidc.NewProvider(ctx, oidc.Config{
+		IssuerURL:    idp.Issuer(),
+		ClientID:     "todo-app",
+		ClientSecret: "s3cret",
+		RedirectURL:  "http://localhost:8080/auth/oidc/callback",
+	})
+	require.NoError(t, err)
+
+	userService := services.NewUserService(services.NewMemoryUserRepository())
+	require.NoError(t, userService.Register(ctx, services.User{Email: "admin@example.com", Password: "secret"}))
+	enrollment, err := userService.EnrollTwoFactor(ctx, "admin@example.com", "secret")
+	require.NoError(t, err)
+	code, err := services.TOTPCode(enrollment.Secret, time.Now().Add(-30*time.Second))
+	require.NoError(t, err)
+	_, err = userService.ConfirmTwoFactor(ctx, "admin@example.com", code)
+	require.NoError(t, err)
+
+	router := SetupRouter(
+		NewAuthHandler(userService, nil, nil),
+		NewTodoHandler(services.NewTodoService(services.NewMemoryTodoRepository(), nil)),
+		RouterConfig{OIDC: NewOIDCHandler(provider, userService, services.NewSessionService(nil, 0, nil))},
+	)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, oidcCallback(t, router))
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	var body struct {
+		TwoFactorRequired bool   `json:"twoFactorRequired"`
+		Challenge         string `json:"challenge"`
+		Token             string `json:"token"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.True(t, body.TwoFactorRequired)
+	require.NotEmpty(t, body.Challenge)
+	require.Empty(t, body.Token)
+
+	code, err = services.TOTPCode(enrollment.Secret, time.Now())
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, "/login/2fa", strings.NewReader(`{"challenge":"`+body.Challenge+`","code":"`+code+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `"token"`)
+}
@@ -0,0 +1,363 @@
+package handlers
+
+import (
+	_ "embed"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/openapi"
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/services"
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/version"
+)
+
+// docsPage renders /openapi.json with Swagger UI.
+//
+//go:embed docs.html
+var docsPage []byte
+
+// serveSpec returns the handlers for /openapi.json and /docs.
+func serveSpec(doc openapi.Document) (spec, docs gin.HandlerFunc) {
+	spec = func(c *gin.Context) {
+		c.JSON(http.StatusOK, doc)
+	}
+	docs = func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", docsPage)
+	}
+	return spec, docs
+}
+
+// apiSpec describes every route SetupRouter registers for cfg. Keep it in
+// sync with SetupRouter; TestSpecCoversRoutes fails on any drift.
+func apiSpec(cfg RouterConfig) openapi.Document {
+	b := openapi.New("Todo API", version.Version)
+	b.UseBearerAuth()
+
+	errorSchema := b.Schema(ErrorResponse{})
+	withErrors := func(op *openapi.Operation, statuses ...int) *openapi.Operation {
+		statuses = append(statuses, http.StatusInternalServerError)
+		for _, status := range statuses {
+			op.Responses[strconv.Itoa(status)] = &openapi.Response{
+				Description: http.StatusText(status),
+				Content:     openapi.JSON(errorSchema),
+			}
+		}
+		return op
+	}
+	ok := func(description string, schema *openapi.Schema) map[string]*openapi.Response {
+		return map[string]*openapi.Response{
+			"200": {Description: description, Content: openapi.JSON(schema)},
+		}
+	}
+	dateTime := b.Schema(time.Time{})
+	message := openapi.Object(map[string]*openapi.Schema{"message": openapi.String()})
+	session := openapi.Object(map[string]*openapi.Schema{
+		"message":   openapi.String(),
+		"token":     openapi.String(),
+		"expiresAt": dateTime,
+	})
+	todo := openapi.Object(map[string]*openapi.Schema{"todo": b.Schema(services.TodoResponse{})})
+	user := openapi.Object(map[string]*openapi.Schema{"user": b.Schema(services.PublicUser{})})
+	bearer := []map[string][]string{{openapi.BearerAuth: {}}}
+	todoID := openapi.Parameter{Name: "id", In: "path", Required: true, Schema: openapi.String()}
+	versionHeader := openapi.Parameter{
+		Name: APIVersionHeader, In: "header", Description: "API version to serve; defaults to 1.",
+		Schema: openapi.String(),
+	}
+	idempotencyKey := openapi.Parameter{
+		Name: IdempotencyKeyHeader, In: "header", Schema: openapi.String(),
+		Description: "Replays the stored response when the request is retried with the same key.",
+	}
+	// idempotent documents the Idempotency-Key header of a mutation.
+	idempotent := func(op *openapi.Operation) *openapi.Operation {
+		if cfg.Idempotency == nil {
+			return op
+		}
+		op.Parameters = append(op.Parameters, idempotencyKey)
+		return withErrors(op, http.StatusBadRequest, http.StatusConflict, http.StatusUnprocessableEntity)
+	}
+	emailQuery := openapi.Parameter{Name: "email", In: "query", Description: "Filters by owner email.", Schema: openapi.String()}
+
+	if cfg.Metrics != nil {
+		b.Add(http.MethodGet, "/metrics", &openapi.Operation{
+			Summary: "Prometheus metrics", Tags: []string{"ops"},
+			Responses: map[string]*openapi.Response{"200": {Description: "Metrics in the Prometheus text format."}},
+		})
+	}
+	b.Add(http.MethodGet, "/openapi.json", &openapi.Operation{
+		Summary: "This OpenAPI document", Tags: []string{"ops"},
+		Responses: map[string]*openapi.Response{"200": {Description: "OpenAPI 3 document."}},
+	})
+	b.Add(http.MethodGet, "/docs", &openapi.Operation{
+		Summary: "Interactive API documentation", Tags: []string{"ops"},
+		Responses: map[string]*openapi.Response{"200": {Description: "Swagger UI page."}},
+	})
+
+	live := openapi.Object(map[string]*openapi.Schema{
+		"status":  openapi.String(),
+		"version": openapi.String(),
+		"commit":  openapi.String(),
+	})
+	b.Add(http.MethodGet, "/livez", &openapi.Operation{
+		Summary: "Liveness probe", Tags: []string{"ops"}, Responses: ok("Process is up.", live),
+	})
+	b.Add(http.MethodGet, "/healthz", &openapi.Operation{
+		Summary: "Alias of /livez", Tags: []string{"ops"}, Responses: ok("Process is up.", live),
+	})
+	ready := openapi.Object(map[string]*openapi.Schema{
+		"status": openapi.String(),
+		"checks": b.Schema(map[string]checkResult{}),
+		"build": openapi.Object(map[string]*openapi.Schema{
+			"version": openapi.String(),
+			"commit":  openapi.String(),
+		}),
+	})
+	b.Add(http.MethodGet, "/readyz", &openapi.Operation{
+		Summary: "Readiness probe", Tags: []string{"ops"},
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "Every dependency is available.", Content: openapi.JSON(ready)},
+			"503": {Description: "A dependency is unavailable.", Content: openapi.JSON(ready)},
+		},
+	})
+
+	// api documents a versioned route under /v1 and, unless disabled, its
+	// deprecated unversioned alias.
+	api := func(method, path string, op *openapi.Operation) {
+		if cfg.RateLimiter != nil {
+			withErrors(op, http.StatusTooManyRequests)
+		}
+		if path == "/me" || strings.HasPrefix(path, "/me/") {
+			// RequireSession refuses the sessions of disabled users.
+			withErrors(op, http.StatusForbidden)
+		}
+		b.Add(method, "/v1"+path, op)
+		if cfg.DisableLegacyRoutes {
+			return
+		}
+		legacy := *op
+		legacy.Deprecated = true
+		legacy.Parameters = append(append([]openapi.Parameter(nil), op.Parameters...), versionHeader)
+		b.Add(method, path, &legacy)
+	}
+
+	api(http.MethodPost, "/register", withErrors(&openapi.Operation{
+		Summary: "Register a user", Tags: []string{"auth"},
+		RequestBody: b.Body(registerRequest{}),
+		Responses: map[string]*openapi.Response{
+			"201": {Description: "User registered.", Content: openapi.JSON(message)},
+		},
+	}, http.StatusBadRequest, http.StatusConflict))
+
+	challenge := openapi.Object(map[string]*openapi.Schema{
+		"message":           openapi.String(),
+		"twoFactorRequired": &openapi.Schema{Type: "boolean"},
+		"challenge":         openapi.String(),
+		"expiresAt":         dateTime,
+	})
+	api(http.MethodPost, "/login", withErrors(&openapi.Operation{
+		Summary: "Log in with email and password", Tags: []string{"auth"},
+		RequestBody: b.Body(loginRequest{}),
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "Session started.", Content: openapi.JSON(session)},
+			"202": {Description: "A second factor is required; complete it with POST /login/2fa.", Content: openapi.JSON(challenge)},
+		},
+	}, http.StatusBadRequest, http.StatusUnauthorized, http.StatusTooManyRequests))
+	api(http.MethodPost, "/login/2fa", withErrors(&openapi.Operation{
+		Summary: "Complete a two-factor login", Tags: []string{"auth"},
+		RequestBody: b.Body(twoFactorLoginRequest{}),
+		Responses:   ok("Session started.", session),
+	}, http.StatusBadRequest, http.StatusUnauthorized, http.StatusTooManyRequests))
+	api(http.MethodPost, "/2fa/enroll", withErrors(&openapi.Operation{
+		Summary: "Start two-factor enrolment", Tags: []string{"auth"},
+		RequestBody: b.Body(twoFactorEnrollRequest{}),
+		Responses: ok("Pending TOTP secret.", openapi.Object(map[string]*openapi.Schema{
+			"secret": openapi.String(),
+			"uri":    openapi.String(),
+		})),
+	}, http.StatusBadRequest, http.StatusUnauthorized, http.StatusConflict, http.StatusTooManyRequests))
+	api(http.MethodPost, "/2fa/confirm", withErrors(&openapi.Operation{
+		Summary: "Confirm two-factor enrolment", Tags: []string{"auth"},
+		RequestBody: b.Body(twoFactorConfirmRequest{}),
+		Responses: ok("Two-factor enabled; recovery codes are shown once.", openapi.Object(map[string]*openapi.Schema{
+			"message":       openapi.String(),
+			"recoveryCodes": openapi.ArrayOf(openapi.String()),
+		})),
+	}, http.StatusBadRequest, http.StatusUnauthorized, http.StatusConflict, http.StatusTooManyRequests))
+	api(http.MethodPost, "/2fa/disable", withErrors(&openapi.Operation{
+		Summary: "Disable two-factor authentication", Tags: []string{"auth"},
+		RequestBody: b.Body(twoFactorDisableRequest{}),
+		Responses:   ok("Two-factor disabled.", message),
+	}, http.StatusBadRequest, http.StatusUnauthorized, http.StatusConflict, http.StatusTooManyRequests))
+	if cfg.OIDC != nil {
+		api(http.MethodGet, "/auth/oidc/login", withErrors(&openapi.Operation{
+			Summary: "Redirect to the identity provider", Tags: []string{"auth"},
+			Responses: map[string]*openapi.Response{"302": {Description: "Redirect to the provider."}},
+		}))
+		api(http.MethodGet, "/auth/oidc/callback", withErrors(&openapi.Operation{
+			Summary: "Finish single sign-on", Tags: []string{"auth"},
+			Parameters: []openapi.Parameter{
+				{Name: "code", In: "query", Schema: openapi.String()},
+				{Name: "state", In: "query", Schema: openapi.String()},
+			},
+			Responses: map[string]*openapi.Response{
+				"200": {Description: "Session started.", Content: openapi.JSON(openapi.Object(map[string]*openapi.Schema{
+					"message":   openapi.String(),
+					"user":      b.Schema(services.PublicUser{}),
+					"token":     openapi.String(),
+					"expiresAt": dateTime,
+				}))},
+				"202": {Description: "The account has two-factor authentication; complete it with POST /login/2fa.", Content: openapi.JSON(challenge)},
+			},
+		}, http.StatusBadRequest, http.StatusUnauthorized, http.StatusBadGateway))
+	}
+	api(http.MethodPost, "/logout", withErrors(&openapi.Operation{
+		Summary: "Revoke the current session", Tags: []string{"auth"}, Security: bearer,
+		Responses: ok("Session revoked.", message),
+	}))
+
+	if cfg.Account != nil {
+		api(http.MethodGet, "/me", withErrors(&openapi.Operation{
+			Summary: "Get the profile of the session user", Tags: []string{"account"}, Security: bearer,
+			Responses: ok("Profile.", user),
+		}, http.StatusUnauthorized, http.StatusNotFound))
+		api(http.MethodPatch, "/me", idempotent(withErrors(&openapi.Operation{
+			Summary: "Update the profile of the session user", Tags: []string{"account"}, Security: bearer,
+			RequestBody: b.Body(updateProfileRequest{}),
+			Responses:   ok("Updated profile.", user),
+		}, http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound)))
+		api(http.MethodDelete, "/me", idempotent(withErrors(&openapi.Operation{
+			Summary: "Delete the account of the session user", Tags: []string{"account"}, Security: bearer,
+			Responses: map[string]*openapi.Response{
+				"200": {Description: "Account deleted.", Content: openapi.JSON(message)},
+				"202": {Description: "Deletion scheduled after the grace period.", Content: openapi.JSON(openapi.Object(map[string]*openapi.Schema{
+					"message":     openapi.String(),
+					"deleteAfter": dateTime,
+				}))},
+			},
+		}, http.StatusUnauthorized, http.StatusNotFound)))
+		api(http.MethodGet, "/me/export", withErrors(&openapi.Operation{
+			Summary: "Download the data of the session user", Tags: []string{"account"}, Security: bearer,
+			Responses: map[string]*openapi.Response{
+				"200": {Description: "ZIP archive.", Content: map[string]*openapi.MediaType{
+					"application/zip": {Schema: &openapi.Schema{Type: "string", Format: "binary"}},
+				}},
+			},
+		}, http.StatusUnauthorized, http.StatusNotFound))
+		api(http.MethodGet, "/me/usage", withErrors(&openapi.Operation{
+			Summary: "Get the usage of the session user against their quotas", Tags: []string{"account"}, Security: bearer,
+			Responses: ok("Usage; a zero limit means unlimited.", openapi.Object(map[string]*openapi.Schema{
+				"usage": b.Schema(services.TodoUsage{}),
+			})),
+		}, http.StatusUnauthorized))
+		api(http.MethodPost, "/me/calendar-token", withErrors(&openapi.Operation{
+			Summary: "Issue the calendar feed URL of the session user", Tags: []string{"account"}, Security: bearer,
+			Responses: map[string]*openapi.Response{
+				"201": {Description: "Feed token and URL; the previous URL stops working and the token cannot be retrieved again.", Content: openapi.JSON(openapi.Object(map[string]*openapi.Schema{
+					"token": openapi.String(),
+					"url":   openapi.String(),
+				}))},
+			},
+		}, http.StatusUnauthorized, http.StatusNotFound))
+		api(http.MethodDelete, "/me/calendar-token", idempotent(withErrors(&openapi.Operation{
+			Summary: "Turn the calendar feed of the session user off", Tags: []string{"account"}, Security: bearer,
+			Responses: ok("Feed turned off.", message),
+		}, http.StatusUnauthorized, http.StatusNotFound)))
+		api(http.MethodGet, calendarFeedPath, withErrors(&openapi.Operation{
+			Summary: "Get the todos of a user as an iCalendar feed", Tags: []string{"account"},
+			Parameters: []openapi.Parameter{
+				{Name: "token", In: "query", Required: true, Description: "Feed token from POST /me/calendar-token.", Schema: openapi.String()},
+			},
+			Responses: map[string]*openapi.Response{
+				"200": {Description: "RFC 5545 calendar with one VTODO per todo.", Content: map[string]*openapi.MediaType{
+					todoFormatTypes[services.TodoFormatICS]: {Schema: &openapi.Schema{Type: "string"}},
+				}},
+			},
+		}, http.StatusNotFound))
+	}
+
+	if !cfg.DisableUserAdmin {
+		api(http.MethodGet, "/users", withErrors(&openapi.Operation{
+			Summary: "List users", Tags: []string{"users"},
+			Responses: ok("Users.", openapi.Object(map[string]*openapi.Schema{
+				"users": b.Schema([]services.PublicUser{}),
+			})),
+		}))
+		api(http.MethodDelete, "/users", idempotent(withErrors(&openapi.Operation{
+			Summary: "Delete every user", Tags: []string{"users"},
+			Responses: ok("Users deleted.", message),
+		})))
+	}
+
+	api(http.MethodGet, "/todos", withErrors(&openapi.Operation{
+		Summary: "List todos", Tags: []string{"todos"},
+		Parameters: []openapi.Parameter{
+			emailQuery,
+			{Name: "due", In: "query", Description: "Only todos due today or overdue; requires email.",
+				Schema: &openapi.Schema{Type: "string", Enum: []string{services.DueToday, services.DueOverdue}}},
+		},
+		Responses: ok("Todos.", openapi.Object(map[string]*openapi.Schema{
+			"todos": b.Schema([]services.TodoResponse{}),
+		})),
+	}, http.StatusBadRequest, http.StatusNotFound))
+	api(http.MethodPost, "/todos", idempotent(withErrors(&openapi.Operation{
+		Summary: "Create a todo", Tags: []string{"todos"},
+		RequestBody: b.Body(createTodoRequest{}),
+		Responses: map[string]*openapi.Response{
+			"201": {Description: "Created todo.", Content: openapi.JSON(todo)},
+		},
+	}, http.StatusBadRequest, http.StatusForbidden)))
+	formats := []string{services.TodoFormatJSON, services.TodoFormatCSV, services.TodoFormatMarkdown, services.TodoFormatICS}
+	formatQuery := func(description string) openapi.Parameter {
+		return openapi.Parameter{Name: "format", In: "query", Description: description,
+			Schema: &openapi.Schema{Type: "string", Enum: formats}}
+	}
+	ownerQuery := openapi.Parameter{Name: "email", In: "query", Required: true, Description: "Owner email.", Schema: openapi.String()}
+	file := &openapi.Schema{Type: "string", Format: "binary"}
+	files := map[string]*openapi.MediaType{}
+	for _, format := range formats {
+		files[todoFormatTypes[format]] = &openapi.MediaType{Schema: file}
+	}
+	api(http.MethodGet, "/todos/export", withErrors(&openapi.Operation{
+		Summary: "Download the todos of a user", Tags: []string{"todos"},
+		Parameters: []openapi.Parameter{ownerQuery, formatQuery("File format; defaults to json. md is a Markdown checklist and ics an iCalendar file of VTODOs.")},
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "Todos as a file.", Content: files},
+		},
+	}, http.StatusBadRequest))
+	api(http.MethodPost, "/todos/import", idempotent(withErrors(&openapi.Operation{
+		Summary: "Create todos from a JSON, CSV, Markdown or iCalendar file", Tags: []string{"todos"},
+		Parameters: []openapi.Parameter{
+			ownerQuery,
+			formatQuery("File format; defaults to the one of the Content-Type, else json."),
+			{Name: "dryRun", In: "query", Description: "Only preview the import.", Schema: &openapi.Schema{Type: "boolean"}},
+		},
+		RequestBody: &openapi.RequestBody{Required: true, Content: files},
+		Responses: ok("Imported todos and rejected rows; valid rows are imported even when others are rejected. Rows that could not be stored are rejected with INTERNAL_ERROR and can be imported again.", openapi.Object(map[string]*openapi.Schema{
+			"dryRun":   &openapi.Schema{Type: "boolean"},
+			"imported": &openapi.Schema{Type: "integer"},
+			"todos":    b.Schema([]services.TodoResponse{}),
+			"errors":   b.Schema([]importRowError{}),
+		})),
+	}, http.StatusBadRequest, http.StatusRequestEntityTooLarge)))
+	api(http.MethodPut, "/todos/:id", idempotent(withErrors(&openapi.Operation{
+		Summary: "Update a todo", Tags: []string{"todos"},
+		Parameters:  []openapi.Parameter{todoID},
+		RequestBody: b.Body(updateTodoRequest{}),
+		Responses:   ok("Updated todo.", todo),
+	}, http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound)))
+	api(http.MethodDelete, "/todos/:id", idempotent(withErrors(&openapi.Operation{
+		Summary: "Delete a todo", Tags: []string{"todos"},
+		Parameters: []openapi.Parameter{todoID},
+		Responses:  ok("Todo deleted.", message),
+	}, http.StatusBadRequest, http.StatusNotFound)))
+	api(http.MethodDelete, "/todos", idempotent(withErrors(&openapi.Operation{
+		Summary: "Delete todos", Tags: []string{"todos"},
+		Parameters: []openapi.Parameter{emailQuery},
+		Responses:  ok("Todos deleted.", message),
+	})))
+
+	return b.Document()
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/metrics"
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/openapi"
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/services"
+)
+
+func TestSpecCoversRoutes(t *testing.T) {
+	auth := NewAuthHandler(services.NewUserService(services.NewMemoryUserRepository()), nil, nil)
+	todos := NewTodoHandler(services.NewTodoService(services.NewMemoryTodoRepository(), nil))
+
+	configs := map[string]RouterConfig{
+		"minimal": {DisableUserAdmin: true, DisableLegacyRoutes: true},
+		"full": {
+			OIDC:    &OIDCHandler{},
+			Account: &AccountHandler{},
+			Metrics: metrics.New(),
+		},
+	}
+	for name, cfg := range configs {
+		router := SetupRouter(auth, todos, cfg)
+		doc := apiSpec(cfg)
+
+		registered := make(map[string]bool)
+		for _, route := range router.Routes() {
+			// The OPTIONS catch-all only answers CORS preflights.
+			if route.Method == http.MethodOptions {
+				continue
+			}
+			path := openapi.PathFromGin(route.Path)
+			registered[route.Method+" "+path] = true
+			_, ok := doc.Paths[path][strings.ToLower(route.Method)]
+			require.True(t, ok, "%s: route %s %s has no OpenAPI entry", name, route.Method, route.Path)
+		}
+		for path, item := range doc.Paths {
+			for method := range item {
+				require.True(t, registered[strings.ToUpper(method)+" "+path], "%s: spec documents unregistered route %s %s", name, method, path)
+			}
+		}
+	}
+}
+
+func TestServeSpecAndDocs(t *testing.T) {
+	app := newTestApp()
+
+	rec := httptest.NewRecorder()
+	app.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var doc struct {
+		OpenAPI    string `json:"openapi"`
+		Components struct {
+			Schemas map[string]struct {
+				Required   []string `json:"required"`
+				Properties map[string]struct {
+					Format    string `json:"format"`
+					MaxLength int    `json:"maxLength"`
+				} `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &doc))
+	require.Equal(t, openapi.Version, doc.OpenAPI)
+	require.Contains(t, doc.Components.Schemas, "TodoResponse")
+	require.Contains(t, doc.Components.Schemas, "PublicUser")
+
+	create := doc.Components.Schemas["CreateTodoRequest"]
+	require.ElementsMatch(t, []string{"email", "title"}, create.Required)
+	require.Equal(t, "email", create.Properties["email"].Format)
+	require.Equal(t, services.MaxTitleLength, create.Properties["title"].MaxLength)
+
+	rec = httptest.NewRecorder()
+	app.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Header().Get("Content-Type"), "text/html")
+	require.Contains(t, rec.Body.String(), "openapi.json")
+}
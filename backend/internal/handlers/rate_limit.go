@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"log/slog"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/logging"
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/services"
+)
+
+// Rate limit groups; each keeps its own buckets.
+const (
+	rateGroupAuth  = "auth"
+	rateGroupRead  = "read"
+	rateGroupWrite = "write"
+)
+
+// RateLimit takes a token from the bucket of the caller in group and rejects
+// the request with 429 when it is empty. Callers with a valid session are
+// limited per user, everyone else per client IP as resolved by the router's
+// trusted proxies. A nil limiter or a disabled limit lets every request in.
+//
+// Responses carry the RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset
+// and RateLimit-Policy headers of the IETF RateLimit fields draft.
+func (h *AuthHandler) RateLimit(limiter *services.RateLimiter, group string, limit services.RateLimit) gin.HandlerFunc {
+	if limiter == nil || !limit.Enabled() {
+		return func(c *gin.Context) { c.Next() }
+	}
+	policy := strconv.Itoa(limit.Burst) + ";w=" + strconv.Itoa(ceilSeconds(limit.Period))
+
+	return func(c *gin.Context) {
+		decision, err := limiter.Allow(c.Request.Context(), group+":"+h.callerKey(c), limit)
+		if err != nil {
+			// Fail open: an unavailable store must not take the API down.
+			logging.FromContext(c.Request.Context()).Warn("rate limit store failed",
+				slog.String("group", group),
+				slog.Any("error", err),
+			)
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(decision.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(decision.Reset)))
+		c.Header("RateLimit-Policy", policy)
+		if !decision.Allowed {
+			ensureCORSHeaders(c)
+			resp := newErrorResponse(c, CodeRateLimited)
+			resp.RetryAfter = setRetryAfter(c, decision.RetryAfter)
+			c.AbortWithStatusJSON(resp.Status, resp)
+			return
+		}
+		c.Next()
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
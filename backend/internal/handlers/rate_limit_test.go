@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/config"
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/services"
+)
+
+func withRateLimits(limits services.RateLimits) func(*config.Config) {
+	return func(cfg *config.Config) {
+		cfg.RateLimits = limits
+	}
+}
+
+func TestRateLimitRejectsWithHeaders(t *testing.T) {
+	app := newTestApp(withRateLimits(services.RateLimits{
+		Auth: services.RateLimit{Burst: 2, Period: time.Minute},
+	}))
+	payload := map[string]string{"email": "user@example.com", "password": "secret"}
+
+	rec, _ := postJSON(t, app, "/v1/register", payload)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.Equal(t, "2", rec.Header().Get("RateLimit-Limit"))
+	require.Equal(t, "1", rec.Header().Get("RateLimit-Remaining"))
+	require.Equal(t, "30", rec.Header().Get("RateLimit-Reset"))
+	require.Equal(t, "2;w=60", rec.Header().Get("RateLimit-Policy"))
+
+	// The /v1 routes and their aliases share the bucket.
+	rec, _ = postJSON(t, app, "/login", payload)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "0", rec.Header().Get("RateLimit-Remaining"))
+
+	rec, resp := postJSON(t, app, "/v1/login", payload)
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+	require.Equal(t, string(CodeRateLimited), resp["code"])
+	require.Equal(t, "30", rec.Header().Get("Retry-After"))
+	require.EqualValues(t, 30, resp["retryAfter"])
+
+	// Other groups are limited separately.
+	rec, _ = sendRaw(t, app, http.MethodGet, "/v1/todos", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Empty(t, rec.Header().Get("RateLimit-Limit"))
+}
+
+func TestRateLimitKeysByUserThenClientIP(t *testing.T) {
+	app := newTestApp(
+		withRateLimits(services.RateLimits{Read: services.RateLimit{Burst: 1, Period: time.Minute}}),
+		func(cfg *config.Config) { cfg.TrustedProxies = []string{"192.0.2.1"} },
+	)
+	list := func(forwardedFor, token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/v1/todos", nil)
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		app.router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	require.Equal(t, http.StatusOK, list("203.0.113.1", ""))
+	require.Equal(t, http.StatusTooManyRequests, list("203.0.113.1", ""))
+	require.Equal(t, http.StatusOK, list("203.0.113.2", ""))
+
+	// Signed-in users get their own bucket wherever they connect from.
+	alice := app.login(t, "alice@example.com")
+	require.Equal(t, http.StatusOK, list("203.0.113.1", alice))
+	require.Equal(t, http.StatusTooManyRequests, list("203.0.113.3", alice))
+	require.Equal(t, http.StatusOK, list("203.0.113.1", app.login(t, "bob@example.com")))
+
+	// Unknown tokens fall back to the client IP.
+	require.Equal(t, http.StatusTooManyRequests, list("203.0.113.2", "forged"))
+}
+
+func TestRateLimitIgnoresUntrustedForwardedFor(t *testing.T) {
+	app := newTestApp(withRateLimits(services.RateLimits{
+		Read: services.RateLimit{Burst: 1, Period: time.Minute},
+	}))
+	list := func(forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodGet, "/v1/todos", nil)
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		rec := httptest.NewRecorder()
+		app.router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	require.Equal(t, http.StatusOK, list("203.0.113.1"))
+	require.Equal(t, http.StatusTooManyRequests, list("203.0.113.2"))
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/logging"
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/services"
+)
+
+func TestRequestLoggerPropagatesRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, "info", logging.FormatJSON)
+	require.NoError(t, err)
+
+	users := services.NewUserService(services.NewMemoryUserRepository())
+	router := SetupRouter(NewAuthHandler(users, nil, nil), NewTodoHandler(nil), RouterConfig{Logger: logger})
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/register?token=abc", strings.NewReader(`{"email":"log@example.com","password":"hunter2"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(RequestIDHeader, "req-123")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.Equal(t, "req-123", rec.Header().Get(RequestIDHeader))
+
+	var entries []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		entries = append(entries, entry)
+	}
+	require.Len(t, entries, 2)
+	require.Equal(t, "user registered", entries[0]["msg"])
+	require.Equal(t, "req-123", entries[0]["request_id"])
+	require.Equal(t, "http request", entries[1]["msg"])
+	require.Equal(t, "req-123", entries[1]["request_id"])
+	require.Equal(t, "/v1/register", entries[1]["route"])
+	require.EqualValues(t, http.StatusCreated, entries[1]["status"])
+	require.NotContains(t, buf.String(), "hunter2")
+	require.NotContains(t, buf.String(), "token=abc")
+}
+
+func TestRequestLoggerGeneratesIDForMissingOrInvalidHeader(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, "info", logging.FormatJSON)
+	require.NoError(t, err)
+	router := SetupRouter(NewAuthHandler(nil, nil, nil), NewTodoHandler(nil), RouterConfig{Logger: logger})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	generated := rec.Header().Get(RequestIDHeader)
+	require.Len(t, generated, 32)
+
+	req := httptest.NewRequest(http.MethodGet, "/livez", nil)
+	req.Header.Set(RequestIDHeader, "bad id\twith spaces")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Len(t, rec.Header().Get(RequestIDHeader), 32)
+	require.NotEqual(t, generated, rec.Header().Get(RequestIDHeader))
+}
+
+func TestRecoveryLogsPanicsWithRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, "info", logging.FormatJSON)
+	require.NoError(t, err)
+	router := SetupRouter(NewAuthHandler(nil, nil, nil), NewTodoHandler(nil), RouterConfig{
+		Logger: logger,
+		Middlewares: []gin.HandlerFunc{func(c *gin.Context) {
+			if c.Request.URL.Path == "/livez" {
+				panic("boom")
+			}
+		}},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/livez", nil)
+	req.Header.Set(RequestIDHeader, "req-panic")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+	require.Contains(t, buf.String(), `"msg":"panic recovered"`)
+	require.Contains(t, buf.String(), `"request_id":"req-panic"`)
+}
@@ -1,20 +1,68 @@
 package handlers
 
 import (
+	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/metrics"
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/services"
 )
 
 // RouterConfig allows customising router construction (handy for tests).
 type RouterConfig struct {
+	// Logger writes the access log; defaults to slog.Default.
+	Logger      *slog.Logger
 	Middlewares []gin.HandlerFunc
+	// OIDC enables single sign-on routes when set.
+	OIDC *OIDCHandler
+	// Account enables the /me self-service routes when set.
+	Account *AccountHandler
+	// DisableUserAdmin hides the GET and DELETE /users routes.
+	DisableUserAdmin bool
+	// Health serves the probes; without it readiness has no checks.
+	Health *HealthHandler
+	// Metrics records request metrics and serves /metrics when set.
+	Metrics *metrics.Metrics
+	// MaxBodyBytes rejects larger request bodies with 413; zero disables it.
+	MaxBodyBytes int64
+	// DisableLegacyRoutes drops the unversioned aliases of the /v1 routes.
+	DisableLegacyRoutes bool
+	// LegacySunset is announced in the Sunset header of the aliases.
+	LegacySunset time.Time
+	// RateLimiter enforces RateLimits when set.
+	RateLimiter *services.RateLimiter
+	RateLimits  services.RateLimits
+	// Idempotency replays responses of retried mutations when set.
+	Idempotency *services.IdempotencyService
+	// TrustedProxies are the proxies allowed to set X-Forwarded-For. Nil
+	// keeps gin's default of trusting every proxy.
+	TrustedProxies []string
 }
 
 // SetupRouter wires handlers with the HTTP routes.
 func SetupRouter(auth *AuthHandler, todos *TodoHandler, cfg RouterConfig) *gin.Engine {
 	router := gin.New()
-	router.Use(gin.Logger(), gin.Recovery())
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if cfg.TrustedProxies != nil {
+		if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+			logger.Error("invalid trusted proxies, trusting none", slog.Any("error", err))
+			_ = router.SetTrustedProxies(nil)
+		}
+	}
+	router.Use(RequestLogger(logger), Recovery())
+	if cfg.MaxBodyBytes > 0 {
+		router.Use(BodyLimit(cfg.MaxBodyBytes))
+	}
+	if cfg.Metrics != nil {
+		router.Use(cfg.Metrics.Middleware())
+		router.GET("/metrics", gin.WrapH(cfg.Metrics.Handler()))
+	}
 	if len(cfg.Middlewares) > 0 {
 		router.Use(cfg.Middlewares...)
 	}
@@ -25,20 +73,71 @@ func SetupRouter(auth *AuthHandler, todos *TodoHandler, cfg RouterConfig) *gin.E
 		c.Status(http.StatusOK)
 	})
 
-	router.GET("/healthz", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "ok"})
-	})
+	spec, docs := serveSpec(apiSpec(cfg))
+	router.GET("/openapi.json", spec)
+	router.GET("/docs", docs)
 
-	router.POST("/register", auth.Register)
-	router.POST("/login", auth.Login)
-	router.GET("/users", auth.ListUsers)
-	router.DELETE("/users", auth.ClearUsers)
+	health := cfg.Health
+	if health == nil {
+		health = NewHealthHandler()
+	}
+	router.GET("/livez", health.Live)
+	router.GET("/readyz", health.Ready)
+	// /healthz se mantiene por compatibilidad como alias de /livez
+	router.GET("/healthz", health.Live)
 
-	router.GET("/todos", todos.ListTodos)
-	router.POST("/todos", todos.CreateTodo)
-	router.PUT("/todos/:id", todos.UpdateTodo)
-	router.DELETE("/todos/:id", todos.DeleteTodo)
-	router.DELETE("/todos", todos.ClearTodos)
+	registerAPI(router.Group("/v1", pinAPIVersion(1)), auth, todos, cfg)
+	if !cfg.DisableLegacyRoutes {
+		registerAPI(router.Group("", deprecateLegacy(cfg.LegacySunset), negotiateAPIVersion()), auth, todos, cfg)
+	}
 
 	return router
 }
+
+// registerAPI mounts the versioned API routes on group. It is mounted once
+// under /v1 and once at the root for the deprecated unversioned aliases.
+func registerAPI(api *gin.RouterGroup, auth *AuthHandler, todos *TodoHandler, cfg RouterConfig) {
+	authLimit := auth.RateLimit(cfg.RateLimiter, rateGroupAuth, cfg.RateLimits.Auth)
+	readLimit := auth.RateLimit(cfg.RateLimiter, rateGroupRead, cfg.RateLimits.Read)
+	writeLimit := auth.RateLimit(cfg.RateLimiter, rateGroupWrite, cfg.RateLimits.Write)
+	// Auth routes are left out so session tokens are never stored for replay.
+	idempotent := auth.Idempotent(cfg.Idempotency)
+
+	api.POST("/register", authLimit, auth.Register)
+	api.POST("/login", authLimit, auth.Login)
+	api.POST("/login/2fa", authLimit, auth.CompleteTwoFactorLogin)
+	api.POST("/2fa/enroll", authLimit, auth.EnrollTwoFactor)
+	api.POST("/2fa/confirm", authLimit, auth.ConfirmTwoFactor)
+	api.POST("/2fa/disable", authLimit, auth.DisableTwoFactor)
+	if cfg.OIDC != nil {
+		api.GET("/auth/oidc/login", authLimit, cfg.OIDC.Login)
+		api.GET("/auth/oidc/callback", authLimit, cfg.OIDC.Callback)
+	}
+	api.POST("/logout", authLimit, auth.Logout)
+
+	if cfg.Account != nil {
+		me := api.Group("/me", auth.RequireSession())
+		me.GET("", readLimit, cfg.Account.GetMe)
+		me.PATCH("", writeLimit, idempotent, cfg.Account.UpdateMe)
+		me.DELETE("", writeLimit, idempotent, cfg.Account.DeleteMe)
+		me.GET("/export", readLimit, cfg.Account.ExportMe)
+		me.GET("/usage", readLimit, cfg.Account.GetUsage)
+		// Not idempotent: replays would store the feed token.
+		me.POST("/calendar-token", writeLimit, cfg.Account.RotateCalendarToken)
+		me.DELETE("/calendar-token", writeLimit, idempotent, cfg.Account.RevokeCalendarToken)
+		api.GET(calendarFeedPath, readLimit, cfg.Account.CalendarFeed)
+	}
+
+	if !cfg.DisableUserAdmin {
+		api.GET("/users", readLimit, auth.ListUsers)
+		api.DELETE("/users", writeLimit, idempotent, auth.ClearUsers)
+	}
+
+	api.GET("/todos", readLimit, todos.ListTodos)
+	api.POST("/todos", writeLimit, idempotent, todos.CreateTodo)
+	api.GET("/todos/export", readLimit, todos.ExportTodos)
+	api.POST("/todos/import", writeLimit, idempotent, todos.ImportTodos)
+	api.PUT("/todos/:id", writeLimit, idempotent, todos.UpdateTodo)
+	api.DELETE("/todos/:id", writeLimit, idempotent, todos.DeleteTodo)
+	api.DELETE("/todos", writeLimit, idempotent, todos.ClearTodos)
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sessionEmailKey is the gin context key holding the authenticated email.
+const sessionEmailKey = "sessionEmail"
+
+// bearerToken extracts the token from an "Authorization: Bearer" header.
+func bearerToken(c *gin.Context) string {
+	header := c.GetHeader("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(header[7:])
+}
+
+// RequireSession rejects requests without a valid bearer session and stores
+// the authenticated email in the gin context.
+func (h *AuthHandler) RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		email, err := h.sessions.Resolve(c.Request.Context(), bearerToken(c))
+		if err != nil {
+			ensureCORSHeaders(c)
+			respondError(c, err)
+			return
+		}
+		c.Set(sessionEmailKey, email)
+		c.Next()
+	}
+}
+
+// sessionEmail returns the email stored by RequireSession.
+func sessionEmail(c *gin.Context) string {
+	return c.GetString(sessionEmailKey)
+}
+
+// callerKey identifies the caller: the session user when the request
+// carries a valid bearer token, the client IP otherwise.
+func (h *AuthHandler) callerKey(c *gin.Context) string {
+	if email := h.callerEmail(c); email != "" {
+		return "user:" + email
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// callerEmail returns the session user of the request, or "" when it
+// carries no valid bearer token.
+func (h *AuthHandler) callerEmail(c *gin.Context) string {
+	if email := sessionEmail(c); email != "" {
+		return email
+	}
+	if token := bearerToken(c); token != "" {
+		email, _ := h.sessions.Resolve(c.Request.Context(), token)
+		return email
+	}
+	return ""
+}
@@ -2,170 +2,76 @@ package handlers
 
 import (
 	"context"
-	"sort"
-	"sync"
+	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/config"
 	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/services"
 )
 
-type memoryUserRepo struct {
-	mu    sync.Mutex
-	users map[string]services.User
+type testApp struct {
+	router   *gin.Engine
+	users    *services.MemoryUserRepository
+	todos    *services.MemoryTodoRepository
+	sessions *services.SessionService
 }
 
-func newMemoryUserRepo() *memoryUserRepo {
-	return &memoryUserRepo{users: make(map[string]services.User)}
-}
+// newTestApp builds the app on in-memory stores. configure may adjust the
+// default configuration first.
+func newTestApp(configure ...func(*config.Config)) *testApp {
+	gin.SetMode(gin.TestMode)
 
-func (m *memoryUserRepo) FindByEmail(_ context.Context, email string) (services.User, error) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	users := services.NewMemoryUserRepository()
+	todos := services.NewMemoryTodoRepository()
+	sessionStore := services.NewMemorySessionStore(clock)
 
-	user, ok := m.users[email]
-	if !ok {
-		return services.User{}, services.ErrNotFound
+	cfg := config.Default()
+	cfg.AllowedOrigins = nil
+	for _, fn := range configure {
+		fn(&cfg)
 	}
-	return user, nil
-}
-
-func (m *memoryUserRepo) Insert(_ context.Context, user services.User) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	m.users[user.Email] = user
-	return nil
-}
-
-func (m *memoryUserRepo) List(_ context.Context) ([]services.User, error) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	users := make([]services.User, 0, len(m.users))
-	for _, user := range m.users {
-		users = append(users, user)
+	router, _, err := NewApp(context.Background(), cfg,
+		WithStores(Stores{Users: users, Todos: todos, Sessions: sessionStore}),
+		WithClock(clock),
+	)
+	if err != nil {
+		panic(err)
 	}
 
-	sort.Slice(users, func(i, j int) bool {
-		return users[i].Email < users[j].Email
-	})
-	return users, nil
-}
-
-func (m *memoryUserRepo) Clear(_ context.Context) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	m.users = make(map[string]services.User)
-	return nil
-}
-
-type memoryTodoRepo struct {
-	mu    sync.Mutex
-	todos map[primitive.ObjectID]services.Todo
-}
-
-func newMemoryTodoRepo() *memoryTodoRepo {
-	return &memoryTodoRepo{todos: make(map[primitive.ObjectID]services.Todo)}
-}
-
-func (m *memoryTodoRepo) List(_ context.Context, email string) ([]services.Todo, error) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	todos := make([]services.Todo, 0, len(m.todos))
-	for _, todo := range m.todos {
-		if email == "" || todo.Email == email {
-			todos = append(todos, todo)
-		}
-	}
-
-	sort.Slice(todos, func(i, j int) bool {
-		return todos[i].CreatedAt.Before(todos[j].CreatedAt)
-	})
-	return todos, nil
-}
-
-func (m *memoryTodoRepo) Create(_ context.Context, todo services.Todo) (services.Todo, error) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	todo.ID = primitive.NewObjectID()
-	m.todos[todo.ID] = todo
-	return todo, nil
-}
-
-func (m *memoryTodoRepo) Update(_ context.Context, id primitive.ObjectID, update services.TodoUpdate) (services.Todo, error) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	todo, ok := m.todos[id]
-	if !ok {
-		return services.Todo{}, services.ErrNotFound
-	}
-
-	if update.Title != nil {
-		todo.Title = *update.Title
-	}
-	if update.Completed != nil {
-		todo.Completed = *update.Completed
+	return &testApp{
+		router:   router,
+		users:    users,
+		todos:    todos,
+		sessions: services.NewSessionService(sessionStore, 0, clock),
 	}
-
-	m.todos[id] = todo
-	return todo, nil
 }
 
-func (m *memoryTodoRepo) Delete(_ context.Context, id primitive.ObjectID) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+// login starts a session for email directly and returns its bearer token.
+func (a *testApp) login(t *testing.T, email string) string {
+	t.Helper()
 
-	if _, ok := m.todos[id]; !ok {
-		return services.ErrNotFound
+	token, _, err := a.sessions.Create(context.Background(), email)
+	if err != nil {
+		t.Fatalf("create session: %v", err)
 	}
-	delete(m.todos, id)
-	return nil
+	return token
 }
 
-func (m *memoryTodoRepo) Clear(_ context.Context, email string) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+// countTodos returns how many todos email owns in the store.
+func (a *testApp) countTodos(t *testing.T, email string) int64 {
+	t.Helper()
 
-	for id, todo := range m.todos {
-		if email == "" || todo.Email == email {
-			delete(m.todos, id)
-		}
+	count, err := a.todos.Count(context.Background(), email)
+	if err != nil {
+		t.Fatalf("count todos: %v", err)
 	}
-	return nil
-}
-
-type testApp struct {
-	router *gin.Engine
-	users  *memoryUserRepo
-	todos  *memoryTodoRepo
+	return count
 }
 
-func newTestApp() *testApp {
-	gin.SetMode(gin.TestMode)
-
-	users := newMemoryUserRepo()
-	todos := newMemoryTodoRepo()
-
-	userService := services.NewUserService(users)
-	todoService := services.NewTodoService(todos, func() time.Time { return fixedTime })
-
-	authHandler := NewAuthHandler(userService)
-	todoHandler := NewTodoHandler(todoService)
-
-	router := SetupRouter(authHandler, todoHandler, RouterConfig{})
+var fixedTime = time.Date(2025, time.January, 1, 10, 0, 0, 0, time.UTC)
 
-	return &testApp{
-		router: router,
-		users:  users,
-		todos:  todos,
-	}
+func clock() time.Time {
+	return fixedTime
 }
-
-var fixedTime = time.Date(2025, time.January, 1, 10, 0, 0, 0, time.UTC)
@@ -1,11 +1,16 @@
 package handlers
 
 import (
+	"encoding/json"
 	"errors"
+	"mime"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/openapi"
 	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/services"
 )
 
@@ -19,45 +24,115 @@ func NewTodoHandler(todos *services.TodoService) *TodoHandler {
 	return &TodoHandler{todos: todos}
 }
 
-// ListTodos retrieves todos filtered by email if provided.
+// todoPresenters renders a todo in the shape of each API version. A version
+// that changes the todo shape adds its presenter here, so older clients keep
+// receiving TodoResponse unchanged.
+var todoPresenters = map[int]func(services.TodoResponse) any{
+	1: func(todo services.TodoResponse) any { return todo },
+}
+
+func presentTodo(c *gin.Context, todo services.TodoResponse) any {
+	return todoPresenters[apiVersion(c)](todo)
+}
+
+func presentTodos(c *gin.Context, todos []services.TodoResponse) []any {
+	out := make([]any, len(todos))
+	for i, todo := range todos {
+		out[i] = presentTodo(c, todo)
+	}
+	return out
+}
+
+// ListTodos retrieves todos filtered by email if provided. With ?due=today or
+// ?due=overdue only the matching todos of that email are returned.
 func (h *TodoHandler) ListTodos(c *gin.Context) {
 	email := c.Query("email")
+	if due := c.Query("due"); due != "" {
+		h.listDue(c, email, due)
+		return
+	}
+
 	todos, err := h.todos.List(c.Request.Context(), email)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "error al obtener tareas"})
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"todos": presentTodos(c, todos)})
+}
+
+func (h *TodoHandler) listDue(c *gin.Context, email, due string) {
+	todos, err := h.todos.ListDue(c.Request.Context(), email, due)
+	if err != nil {
+		respondError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"todos": todos})
+	c.JSON(http.StatusOK, gin.H{"todos": presentTodos(c, todos)})
 }
 
+// Title limits mirror services.MaxTitleLength.
 type createTodoRequest struct {
-	Email string `json:"email"`
-	Title string `json:"title"`
+	Email string     `json:"email" binding:"required,email,max=254"`
+	Title string     `json:"title" binding:"required,max=200"`
+	DueAt *time.Time `json:"dueAt"`
 }
 
 // CreateTodo stores a new todo.
 func (h *TodoHandler) CreateTodo(c *gin.Context) {
 	var payload createTodoRequest
-	if err := c.ShouldBindJSON(&payload); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "datos invalidos"})
+	if !bindJSON(c, &payload) {
 		return
 	}
 
-	todo, err := h.todos.Create(c.Request.Context(), payload.Email, payload.Title)
-	switch {
-	case err == nil:
-		c.JSON(http.StatusCreated, gin.H{"todo": todo})
-	case errors.Is(err, services.ErrInvalidTodoInput):
-		c.JSON(http.StatusBadRequest, gin.H{"error": "email y titulo son requeridos"})
-	default:
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "error al crear tarea"})
+	todo, err := h.todos.CreateFrom(c.Request.Context(), services.TodoInput{
+		Email: payload.Email,
+		Title: payload.Title,
+		DueAt: payload.DueAt,
+	})
+	if err != nil {
+		respondError(c, err)
+		return
 	}
+
+	c.JSON(http.StatusCreated, gin.H{"todo": presentTodo(c, todo)})
 }
 
+// updateTodoRequest changes the fields that are sent; "dueAt": null removes
+// the due date.
 type updateTodoRequest struct {
-	Title     *string `json:"title"`
-	Completed *bool   `json:"completed"`
+	Title     *string      `json:"title" binding:"omitempty,min=1,max=200"`
+	Completed *bool        `json:"completed"`
+	DueAt     nullableTime `json:"dueAt"`
+}
+
+// nullableTime is an optional JSON time that tells an explicit null apart
+// from an absent field.
+type nullableTime struct {
+	Set  bool
+	Time *time.Time
+}
+
+// UnmarshalJSON records that the field was sent, and its time unless it is
+// null.
+func (n *nullableTime) UnmarshalJSON(data []byte) error {
+	n.Set = true
+	if string(data) == "null" {
+		n.Time = nil
+		return nil
+	}
+	var t time.Time
+	if err := json.Unmarshal(data, &t); err != nil {
+		return err
+	}
+	n.Time = &t
+	return nil
+}
+
+// OpenAPISchema describes nullableTime as the nullable date-time it is sent
+// as.
+func (nullableTime) OpenAPISchema() *openapi.Schema {
+	return &openapi.Schema{Type: "string", Format: "date-time", Nullable: true}
 }
 
 // UpdateTodo modifies an existing todo.
@@ -65,51 +140,149 @@ func (h *TodoHandler) UpdateTodo(c *gin.Context) {
 	id := c.Param("id")
 
 	var payload updateTodoRequest
-	if err := c.ShouldBindJSON(&payload); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "datos invalidos"})
+	if !bindJSON(c, &payload) {
 		return
 	}
 
 	todo, err := h.todos.Update(c.Request.Context(), id, services.TodoUpdate{
-		Title:     payload.Title,
-		Completed: payload.Completed,
+		Title:      payload.Title,
+		Completed:  payload.Completed,
+		DueAt:      payload.DueAt.Time,
+		ClearDueAt: payload.DueAt.Set && payload.DueAt.Time == nil,
 	})
+	if err != nil {
+		respondError(c, err,
+			on(services.ErrInvalidTodoInput, CodeNothingToUpdate),
+			on(services.ErrNotFound, CodeTodoNotFound),
+		)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"todo": presentTodo(c, todo)})
+}
+
+// todoFormatTypes maps the import and export formats to their media types.
+var todoFormatTypes = map[string]string{
+	services.TodoFormatJSON:     "application/json",
+	services.TodoFormatCSV:      "text/csv",
+	services.TodoFormatMarkdown: "text/markdown",
+	services.TodoFormatICS:      "text/calendar",
+}
+
+// ExportTodos downloads the todos of ?email in ?format: json (default), csv,
+// md, a Markdown checklist, or ics, an iCalendar file of VTODOs.
+func (h *TodoHandler) ExportTodos(c *gin.Context) {
+	format := c.DefaultQuery("format", services.TodoFormatJSON)
+	contentType, ok := todoFormatTypes[format]
+	if !ok {
+		writeError(c, CodeUnsupportedFormat)
+		return
+	}
+
+	w := &attachmentWriter{c: c, contentType: contentType + "; charset=utf-8", filename: "todos." + format}
+	err := h.todos.Export(c.Request.Context(), c.Query("email"), format, w, services.WithCalendarDomain(calendarDomain(c)))
 	switch {
 	case err == nil:
-		c.JSON(http.StatusOK, gin.H{"todo": todo})
-	case errors.Is(err, services.ErrInvalidTodoInput):
-		c.JSON(http.StatusBadRequest, gin.H{"error": "nada para actualizar"})
-	case errors.Is(err, services.ErrInvalidTodoID):
-		c.JSON(http.StatusBadRequest, gin.H{"error": "id invalido"})
-	case errors.Is(err, services.ErrNotFound):
-		c.JSON(http.StatusNotFound, gin.H{"error": "tarea no encontrada"})
+		w.start()
+	case w.started:
+		_ = c.Error(err)
+		c.Abort()
 	default:
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "error al actualizar tarea"})
+		respondError(c, err)
+	}
+}
+
+// importRowError reports a rejected row of an import.
+type importRowError struct {
+	Row     int       `json:"row"`
+	Field   string    `json:"field,omitempty"`
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"error"`
+}
+
+// ImportTodos creates todos for ?email from the body, in ?format or else the
+// format of its Content-Type. With ?dryRun=true nothing is stored and the
+// response previews the import. Rejected rows do not stop the others; the
+// response lists them, including those left out because storing failed.
+func (h *TodoHandler) ImportTodos(c *gin.Context) {
+	format := c.Query("format")
+	if format == "" {
+		format = importFormat(c.ContentType())
+	}
+	dryRun := false
+	if v := c.Query("dryRun"); v != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			writeError(c, CodeValidationFailed, fieldError(c, "dryRun", CodeFieldInvalid, ""))
+			return
+		}
 	}
+
+	result, err := h.todos.Import(c.Request.Context(), c.Query("email"), c.Request.Body, format, dryRun)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(c, CodePayloadTooLarge)
+			return
+		}
+		respondError(c, err)
+		return
+	}
+
+	lang := requestLanguage(c)
+	rows := make([]importRowError, 0, len(result.Errors))
+	for _, rowErr := range result.Errors {
+		code, ok := errorCode(rowErr.Err,
+			on(services.ErrQuotaExceeded, CodeQuotaExceeded),
+			on(services.ErrTodoNotStored, CodeInternal),
+		)
+		if !ok {
+			code = CodeInvalidTodoInput
+		}
+		rows = append(rows, importRowError{
+			Row:     rowErr.Row,
+			Field:   rowErr.Field,
+			Code:    code,
+			Message: errorCatalog[code].message(lang),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"dryRun":   result.DryRun,
+		"imported": len(result.Todos),
+		"todos":    presentTodos(c, result.Todos),
+		"errors":   rows,
+	})
+}
+
+// importFormat returns the format of a media type, defaulting to JSON.
+func importFormat(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	for format, formatType := range todoFormatTypes {
+		if mediaType == formatType {
+			return format
+		}
+	}
+	return services.TodoFormatJSON
 }
 
 // DeleteTodo removes a todo by ID.
 func (h *TodoHandler) DeleteTodo(c *gin.Context) {
 	id := c.Param("id")
 
-	err := h.todos.Delete(c.Request.Context(), id)
-	switch {
-	case err == nil:
-		c.JSON(http.StatusOK, gin.H{"message": "tarea eliminada"})
-	case errors.Is(err, services.ErrInvalidTodoID):
-		c.JSON(http.StatusBadRequest, gin.H{"error": "id invalido"})
-	case errors.Is(err, services.ErrNotFound):
-		c.JSON(http.StatusNotFound, gin.H{"error": "tarea no encontrada"})
-	default:
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "error al eliminar tarea"})
+	if err := h.todos.Delete(c.Request.Context(), id); err != nil {
+		respondError(c, err, on(services.ErrNotFound, CodeTodoNotFound))
+		return
 	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "tarea eliminada"})
 }
 
 // ClearTodos removes todos optionally filtered by email.
 func (h *TodoHandler) ClearTodos(c *gin.Context) {
 	email := c.Query("email")
 	if err := h.todos.Clear(c.Request.Context(), email); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "error al limpiar tareas"})
+		respondError(c, err)
 		return
 	}
 
@@ -2,12 +2,18 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/config"
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/services"
 )
 
 func TestCreateListUpdateDeleteTodoFlow(t *testing.T) {
@@ -152,3 +158,175 @@ func TestClearTodosEndpoint(t *testing.T) {
 	app.router.ServeHTTP(clearRec, clearReq)
 	require.Equal(t, http.StatusOK, clearRec.Code)
 }
+
+func TestListTodosDueToday(t *testing.T) {
+	app := newTestApp()
+	ctx := context.Background()
+	require.NoError(t, app.users.Insert(ctx, services.User{Email: "tokyo@example.com", TimeZone: "Asia/Tokyo"}))
+
+	// fixedTime is 19:00 on Jan 1 in Tokyo, so the local day ends at 15:00 UTC.
+	for title, dueAt := range map[string]string{
+		"today":    "2025-01-01T14:00:00Z",
+		"tomorrow": "2025-01-01T16:00:00Z",
+	} {
+		body, err := json.Marshal(map[string]string{"email": "tokyo@example.com", "title": title, "dueAt": dueAt})
+		require.NoError(t, err)
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/todos", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		app.router.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusCreated, rec.Code)
+	}
+
+	rec := httptest.NewRecorder()
+	app.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/todos?email=tokyo@example.com&due=today", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var resp struct {
+		Todos []services.TodoResponse `json:"todos"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Len(t, resp.Todos, 1)
+	require.Equal(t, "today", resp.Todos[0].Title)
+
+	rec = httptest.NewRecorder()
+	app.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/todos?email=tokyo@example.com&due=later", nil))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestUpdateTodoClearsDueDate(t *testing.T) {
+	app := newTestApp()
+	due := fixedTime.Add(time.Hour)
+	todo, err := app.todos.Create(context.Background(), services.Todo{Email: "guest@example.com", Title: "Pay rent", CreatedAt: fixedTime, DueAt: &due})
+	require.NoError(t, err)
+
+	// The owner has no account, so its days are in UTC.
+	rec := httptest.NewRecorder()
+	app.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/todos?email=guest@example.com&due=today", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), "Pay rent")
+
+	update := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/todos/"+todo.ID.Hex(), bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		app.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec = update(`{"completed":true}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `"dueAt"`)
+
+	rec = update(`{"dueAt":null}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NotContains(t, rec.Body.String(), `"dueAt"`)
+
+	rec = update(`{"dueAt":"tomorrow"}`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), string(CodeInvalidRequest))
+}
+
+func TestExportTodosFormats(t *testing.T) {
+	app := newTestApp()
+	ctx := context.Background()
+	_, err := app.todos.Create(ctx, services.Todo{Email: "ana@example.com", Title: "Buy milk", Completed: true, CreatedAt: fixedTime})
+	require.NoError(t, err)
+
+	for format, want := range map[string]struct{ contentType, body string }{
+		"json": {"application/json; charset=utf-8", `"title": "Buy milk"`},
+		"csv":  {"text/csv; charset=utf-8", "id,title,completed,createdAt,dueAt\n"},
+		"md":   {"text/markdown; charset=utf-8", "- [x] Buy milk\n"},
+	} {
+		rec := httptest.NewRecorder()
+		app.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/todos/export?email=ana@example.com&format="+format, nil))
+		require.Equal(t, http.StatusOK, rec.Code, format)
+		require.Equal(t, want.contentType, rec.Header().Get("Content-Type"), format)
+		require.Contains(t, rec.Header().Get("Content-Disposition"), `filename="todos.`+format+`"`, format)
+		require.Contains(t, rec.Body.String(), want.body, format)
+	}
+
+	rec := httptest.NewRecorder()
+	app.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/todos/export?email=ana@example.com&format=xml", nil))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), string(CodeUnsupportedFormat))
+}
+
+func TestImportTodosReportsRows(t *testing.T) {
+	app := newTestApp()
+	body := "title,completed\nmilk,true\n,false\nbread,maybe\neggs,\n"
+
+	importTodos := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/todos/import?email=ana@example.com"+query, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "text/csv")
+		rec := httptest.NewRecorder()
+		app.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	var resp struct {
+		DryRun   bool                    `json:"dryRun"`
+		Imported int                     `json:"imported"`
+		Todos    []services.TodoResponse `json:"todos"`
+		Errors   []importRowError        `json:"errors"`
+	}
+	rec := importTodos("&dryRun=true")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.True(t, resp.DryRun)
+	require.Equal(t, 2, resp.Imported)
+	stored, err := app.todos.List(context.Background(), "ana@example.com")
+	require.NoError(t, err)
+	require.Empty(t, stored)
+
+	rec = importTodos("")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.False(t, resp.DryRun)
+	require.Len(t, resp.Todos, 2)
+	require.NotEmpty(t, resp.Todos[0].ID)
+	require.True(t, resp.Todos[0].Completed)
+	require.Equal(t, []importRowError{
+		{Row: 3, Field: "title", Code: CodeInvalidTodoInput, Message: errorCatalog[CodeInvalidTodoInput].message("es")},
+		{Row: 4, Field: "completed", Code: CodeInvalidTodoInput, Message: errorCatalog[CodeInvalidTodoInput].message("es")},
+	}, resp.Errors)
+
+	rec = importTodos("&dryRun=perhaps")
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = importTodos("&format=xml")
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), string(CodeUnsupportedFormat))
+}
+
+// unstoredTodoRepo fails to store any todo.
+type unstoredTodoRepo struct {
+	*services.MemoryTodoRepository
+}
+
+func (unstoredTodoRepo) Create(context.Context, services.Todo) (services.Todo, error) {
+	return services.Todo{}, errors.New("store down")
+}
+
+func TestImportTodosReportsStoreFailures(t *testing.T) {
+	router, _, err := NewApp(context.Background(), config.Default(),
+		WithStores(Stores{Users: services.NewMemoryUserRepository(), Todos: unstoredTodoRepo{services.NewMemoryTodoRepository()}}),
+	)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/todos/import?email=ana@example.com", bytes.NewBufferString("title\nmilk\nbread\n"))
+	req.Header.Set("Content-Type", "text/csv")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp struct {
+		Imported int              `json:"imported"`
+		Errors   []importRowError `json:"errors"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Zero(t, resp.Imported)
+	require.Equal(t, []importRowError{
+		{Row: 2, Code: CodeInternal, Message: errorCatalog[CodeInternal].message("es")},
+		{Row: 3, Code: CodeInternal, Message: errorCatalog[CodeInternal].message("es")},
+	}, resp.Errors)
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/services"
+)
+
+type twoFactorLoginRequest struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+}
+
+// CompleteTwoFactorLogin finishes a login started with POST /login when the
+// account has two-factor authentication enabled.
+func (h *AuthHandler) CompleteTwoFactorLogin(c *gin.Context) {
+	var payload twoFactorLoginRequest
+	ensureCORSHeaders(c)
+	if !bindJSON(c, &payload) {
+		return
+	}
+
+	email, err := h.users.ChallengeEmail(c.Request.Context(), payload.Challenge)
+	if err == nil {
+		err = h.guarded(c, email, func() error {
+			_, err := h.users.CompleteTwoFactor(c.Request.Context(), payload.Challenge, payload.Code)
+			return err
+		})
+	}
+	if err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+
+	respondSession(c, h.sessions, email)
+}
+
+type twoFactorEnrollRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// EnrollTwoFactor generates a pending TOTP secret and its otpauth:// URI.
+func (h *AuthHandler) EnrollTwoFactor(c *gin.Context) {
+	var payload twoFactorEnrollRequest
+	ensureCORSHeaders(c)
+	if !bindJSON(c, &payload) {
+		return
+	}
+
+	var enrollment services.TwoFactorEnrollment
+	err := h.guarded(c, payload.Email, func() error {
+		var err error
+		enrollment, err = h.users.EnrollTwoFactor(c.Request.Context(), payload.Email, payload.Password)
+		return err
+	})
+	if err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+
+	ensureCORSHeaders(c)
+	c.JSON(http.StatusOK, gin.H{"secret": enrollment.Secret, "uri": enrollment.URI})
+}
+
+type twoFactorConfirmRequest struct {
+	Email string `json:"email"`
+	Code  string `json:"code"`
+}
+
+// ConfirmTwoFactor enables two-factor authentication and returns the recovery
+// codes. They are shown only once.
+func (h *AuthHandler) ConfirmTwoFactor(c *gin.Context) {
+	var payload twoFactorConfirmRequest
+	ensureCORSHeaders(c)
+	if !bindJSON(c, &payload) {
+		return
+	}
+
+	var codes []string
+	err := h.guarded(c, payload.Email, func() error {
+		var err error
+		codes, err = h.users.ConfirmTwoFactor(c.Request.Context(), payload.Email, payload.Code)
+		return err
+	})
+	if err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+
+	ensureCORSHeaders(c)
+	c.JSON(http.StatusOK, gin.H{"message": "segundo factor activado", "recoveryCodes": codes})
+}
+
+type twoFactorDisableRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// DisableTwoFactor turns two-factor authentication off.
+func (h *AuthHandler) DisableTwoFactor(c *gin.Context) {
+	var payload twoFactorDisableRequest
+	ensureCORSHeaders(c)
+	if !bindJSON(c, &payload) {
+		return
+	}
+
+	err := h.guarded(c, payload.Email, func() error {
+		return h.users.DisableTwoFactor(c.Request.Context(), payload.Email, payload.Password, payload.Code)
+	})
+	if err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+
+	ensureCORSHeaders(c)
+	c.JSON(http.StatusOK, gin.H{"message": "segundo factor desactivado"})
+}
+
+func respondTwoFactorError(c *gin.Context, err error) {
+	ensureCORSHeaders(c)
+	respondError(c, err)
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/services"
+)
+
+func postJSON(t *testing.T, app *testApp, path string, payload any) (*httptest.ResponseRecorder, map[string]any) {
+	t.Helper()
+
+	body, err := json.Marshal(payload)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	app.router.ServeHTTP(rec, req)
+
+	var resp map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	return rec, resp
+}
+
+func TestTwoFactorEnrolmentAndLogin(t *testing.T) {
+	app := newTestApp()
+
+	rec, _ := postJSON(t, app, "/register", map[string]string{"email": "admin@example.com", "password": "secret"})
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	rec, enroll := postJSON(t, app, "/2fa/enroll", map[string]string{"email": "admin@example.com", "password": "secret"})
+	require.Equal(t, http.StatusOK, rec.Code)
+	secret := enroll["secret"].(string)
+	require.Contains(t, enroll["uri"], "otpauth://totp/")
+
+	code, err := services.TOTPCode(secret, fixedTime)
+	require.NoError(t, err)
+	rec, confirm := postJSON(t, app, "/2fa/confirm", map[string]string{"email": "admin@example.com", "code": code})
+	require.Equal(t, http.StatusOK, rec.Code)
+	recovery := confirm["recoveryCodes"].([]any)
+	require.NotEmpty(t, recovery)
+
+	rec, login := postJSON(t, app, "/login", map[string]string{"email": "admin@example.com", "password": "secret"})
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	require.Equal(t, true, login["twoFactorRequired"])
+	challenge := login["challenge"].(string)
+
+	rec, _ = postJSON(t, app, "/login/2fa", map[string]string{"challenge": challenge, "code": "not-a-code"})
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec, done := postJSON(t, app, "/login/2fa", map[string]string{"challenge": challenge, "code": recovery[0].(string)})
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "login exitoso", done["message"])
+
+	rec, _ = postJSON(t, app, "/login/2fa", map[string]string{"challenge": challenge, "code": recovery[1].(string)})
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestTwoFactorEnrolRejectsWrongPassword(t *testing.T) {
+	app := newTestApp()
+
+	postJSON(t, app, "/register", map[string]string{"email": "admin@example.com", "password": "secret"})
+
+	rec, _ := postJSON(t, app, "/2fa/enroll", map[string]string{"email": "admin@example.com", "password": "wrong"})
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec, _ = postJSON(t, app, "/2fa/disable", map[string]string{"email": "admin@example.com", "password": "secret", "code": "123456"})
+	require.Equal(t, http.StatusConflict, rec.Code)
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// validate checks the `binding` tags of request structs. Field errors are
+// reported with the JSON name of the field so clients can map them back.
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	v.SetTagName("binding")
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	return v
+}
+
+// bindJSON decodes the body into payload, rejecting unknown fields, and
+// validates it. On failure it writes the error envelope, listing every
+// offending field, and returns false.
+func bindJSON(c *gin.Context, payload any) bool {
+	if c.Request.Body == nil {
+		writeError(c, CodeInvalidRequest)
+		return false
+	}
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(payload); err != nil {
+		respondDecodeError(c, err)
+		return false
+	}
+	if decoder.More() {
+		writeError(c, CodeInvalidRequest)
+		return false
+	}
+
+	var violations validator.ValidationErrors
+	if err := validate.Struct(payload); errors.As(err, &violations) {
+		fields := make([]FieldError, 0, len(violations))
+		for _, v := range violations {
+			fields = append(fields, fieldError(c, fieldPath(v), fieldCode(v.Tag()), v.Param()))
+		}
+		writeError(c, CodeValidationFailed, fields...)
+		return false
+	} else if err != nil {
+		respondError(c, err)
+		return false
+	}
+	return true
+}
+
+func respondDecodeError(c *gin.Context, err error) {
+	var tooLarge *http.MaxBytesError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &tooLarge):
+		writeError(c, CodePayloadTooLarge)
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		writeError(c, CodeValidationFailed, fieldError(c, typeErr.Field, CodeFieldInvalid, ""))
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no typed error for unknown fields.
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		writeError(c, CodeValidationFailed, fieldError(c, field, CodeFieldUnknown, ""))
+	default:
+		writeError(c, CodeInvalidRequest)
+	}
+}
+
+// fieldPath drops the struct name from the validator namespace, so
+// "updateProfileRequest.preferences.defaultSort" becomes
+// "preferences.defaultSort".
+func fieldPath(v validator.FieldError) string {
+	_, path, found := strings.Cut(v.Namespace(), ".")
+	if !found {
+		return v.Field()
+	}
+	return path
+}
+
+func fieldCode(tag string) ErrorCode {
+	switch tag {
+	case "required":
+		return CodeFieldRequired
+	case "email":
+		return CodeFieldInvalidEmail
+	case "max":
+		return CodeFieldTooLong
+	case "min":
+		return CodeFieldTooShort
+	default:
+		return CodeFieldInvalid
+	}
+}
+
+// BodyLimit rejects request bodies larger than limit bytes with 413. Bodies
+// without a Content-Length are cut off while being read.
+func BodyLimit(limit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > limit {
+			writeError(c, CodePayloadTooLarge)
+			return
+		}
+		if c.Request.Body != nil {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func sendRaw(t *testing.T, app *testApp, method, path, body string) (*httptest.ResponseRecorder, ErrorResponse) {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	app.router.ServeHTTP(rec, req)
+
+	var resp ErrorResponse
+	if rec.Code >= http.StatusBadRequest {
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	}
+	return rec, resp
+}
+
+func TestValidationReportsFieldErrors(t *testing.T) {
+	app := newTestApp()
+
+	rec, resp := sendRaw(t, app, http.MethodPost, "/register", `{"email":"not-an-email"}`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Equal(t, CodeValidationFailed, resp.Code)
+	require.ElementsMatch(t, []FieldError{
+		{Field: "email", Code: CodeFieldInvalidEmail, Message: "email invalido"},
+		{Field: "password", Code: CodeFieldRequired, Message: "campo requerido"},
+	}, resp.Fields)
+
+	long := strings.Repeat("a", 201)
+	rec, resp = sendRaw(t, app, http.MethodPost, "/todos", `{"email":"user@example.com","title":"`+long+`"}`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Equal(t, []FieldError{
+		{Field: "title", Code: CodeFieldTooLong, Param: "200", Message: "maximo 200 caracteres"},
+	}, resp.Fields)
+
+	rec, resp = sendRaw(t, app, http.MethodPut, "/todos/"+primitive.NewObjectID().Hex(), `{"title":""}`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Equal(t, CodeFieldTooShort, resp.Fields[0].Code)
+}
+
+func TestValidationRejectsUnknownAndMistypedFields(t *testing.T) {
+	app := newTestApp()
+
+	rec, resp := sendRaw(t, app, http.MethodPost, "/todos", `{"email":"user@example.com","title":"x","priority":1}`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Equal(t, []FieldError{{Field: "priority", Code: CodeFieldUnknown, Message: "campo desconocido"}}, resp.Fields)
+
+	rec, resp = sendRaw(t, app, http.MethodPost, "/todos", `{"email":"user@example.com","title":42}`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Equal(t, []FieldError{{Field: "title", Code: CodeFieldInvalid, Message: "valor invalido"}}, resp.Fields)
+
+	rec, resp = sendRaw(t, app, http.MethodPost, "/todos", `{"email":`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Equal(t, CodeInvalidRequest, resp.Code)
+	require.Empty(t, resp.Fields)
+}
+
+func TestValidationMessagesFollowAcceptLanguage(t *testing.T) {
+	app := newTestApp()
+
+	req := httptest.NewRequest(http.MethodPost, "/todos", bytes.NewReader([]byte(`{"email":"user@example.com"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept-Language", "en")
+	rec := httptest.NewRecorder()
+	app.router.ServeHTTP(rec, req)
+
+	var resp ErrorResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Equal(t, "the request has invalid fields", resp.Message)
+	require.Equal(t, []FieldError{{Field: "title", Code: CodeFieldRequired, Message: "field is required"}}, resp.Fields)
+}
+
+func TestBodyLimit(t *testing.T) {
+	app := newTestApp()
+	body := `{"email":"user@example.com","title":"` + strings.Repeat("a", 2<<20) + `"}`
+
+	rec, resp := sendRaw(t, app, http.MethodPost, "/todos", body)
+	require.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	require.Equal(t, CodePayloadTooLarge, resp.Code)
+
+	// Without Content-Length the limit applies while the body is read.
+	req := httptest.NewRequest(http.MethodPost, "/todos", strings.NewReader(body))
+	req.ContentLength = -1
+	rec = httptest.NewRecorder()
+	app.router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/logging"
+)
+
+// APIVersionHeader reports the API version that served a response. Clients
+// of the unversioned routes may also send it to pick a version.
+const APIVersionHeader = "API-Version"
+
+// apiVersionKey is the gin context key holding the negotiated API version.
+const apiVersionKey = "apiVersion"
+
+// latestAPIVersion is the newest version mounted under /v<N>. The
+// unversioned aliases serve version 1 unless the client asks otherwise.
+const latestAPIVersion = 1
+
+// pinAPIVersion serves every request of a /v<N> group with version.
+func pinAPIVersion(version int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(apiVersionKey, version)
+		c.Header(APIVersionHeader, strconv.Itoa(version))
+		c.Next()
+	}
+}
+
+// negotiateAPIVersion resolves the version of an unversioned request from
+// the API-Version header ("1" or "v1"), defaulting to 1.
+func negotiateAPIVersion() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		version := 1
+		if requested := c.GetHeader(APIVersionHeader); requested != "" {
+			v, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(requested), "v"))
+			if err != nil || v < 1 || v > latestAPIVersion {
+				writeError(c, CodeUnsupportedAPIVersion)
+				return
+			}
+			version = v
+		}
+		c.Set(apiVersionKey, version)
+		c.Header(APIVersionHeader, strconv.Itoa(version))
+		c.Next()
+	}
+}
+
+// apiVersion returns the version negotiated for the request.
+func apiVersion(c *gin.Context) int {
+	if v, ok := c.Get(apiVersionKey); ok {
+		return v.(int)
+	}
+	return 1
+}
+
+// deprecateLegacy marks the unversioned aliases with Deprecation, Sunset and
+// a Link to the /v1 successor, and logs how often each alias is still used.
+func deprecateLegacy(sunset time.Time) gin.HandlerFunc {
+	var usage sync.Map // route -> *atomic.Int64
+	sunsetHeader := ""
+	if !sunset.IsZero() {
+		sunsetHeader = sunset.UTC().Format(http.TimeFormat)
+	}
+
+	return func(c *gin.Context) {
+		c.Header("Deprecation", "true")
+		if sunsetHeader != "" {
+			c.Header("Sunset", sunsetHeader)
+		}
+		c.Header("Link", `</v1`+c.Request.URL.Path+`>; rel="successor-version"`)
+
+		route := c.Request.Method + " " + c.FullPath()
+		counter, _ := usage.LoadOrStore(route, new(atomic.Int64))
+		logging.FromContext(c.Request.Context()).Info("deprecated route used",
+			slog.String("route", route),
+			slog.Int64("count", counter.(*atomic.Int64).Add(1)),
+		)
+		c.Next()
+	}
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/logging"
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/services"
+)
+
+func TestVersionedAndLegacyRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, "info", logging.FormatJSON)
+	require.NoError(t, err)
+
+	sunset := time.Date(2027, time.June, 30, 0, 0, 0, 0, time.UTC)
+	todos := NewTodoHandler(services.NewTodoService(services.NewMemoryTodoRepository(), nil))
+	router := SetupRouter(NewAuthHandler(services.NewUserService(services.NewMemoryUserRepository()), nil, nil), todos, RouterConfig{
+		Logger:       logger,
+		LegacySunset: sunset,
+	})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/todos", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "1", rec.Header().Get(APIVersionHeader))
+	require.Empty(t, rec.Header().Get("Deprecation"))
+
+	for i := 0; i < 2; i++ {
+		rec = httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/todos?email=a@example.com", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+	}
+	require.Equal(t, "1", rec.Header().Get(APIVersionHeader))
+	require.Equal(t, "true", rec.Header().Get("Deprecation"))
+	require.Equal(t, "Wed, 30 Jun 2027 00:00:00 GMT", rec.Header().Get("Sunset"))
+	require.Equal(t, `</v1/todos>; rel="successor-version"`, rec.Header().Get("Link"))
+
+	var usage []int64
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		var entry map[string]any
+		require.NoError(t, json.Unmarshal(line, &entry))
+		if entry["msg"] == "deprecated route used" {
+			require.Equal(t, "GET /todos", entry["route"])
+			require.Equal(t, slog.LevelInfo.String(), entry["level"])
+			usage = append(usage, int64(entry["count"].(float64)))
+		}
+	}
+	require.Equal(t, []int64{1, 2}, usage)
+}
+
+func TestLegacyRoutesNegotiateVersion(t *testing.T) {
+	app := newTestApp()
+
+	req := httptest.NewRequest(http.MethodGet, "/todos", nil)
+	req.Header.Set(APIVersionHeader, "v1")
+	rec := httptest.NewRecorder()
+	app.router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "1", rec.Header().Get(APIVersionHeader))
+
+	req = httptest.NewRequest(http.MethodGet, "/todos", nil)
+	req.Header.Set(APIVersionHeader, "2")
+	rec = httptest.NewRecorder()
+	app.router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	var resp ErrorResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Equal(t, CodeUnsupportedAPIVersion, resp.Code)
+}
+
+func TestLegacyRoutesCanBeDisabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	todos := NewTodoHandler(services.NewTodoService(services.NewMemoryTodoRepository(), nil))
+	router := SetupRouter(NewAuthHandler(nil, nil, nil), todos, RouterConfig{DisableLegacyRoutes: true})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/todos", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/todos", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+}
@@ -0,0 +1,72 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestNewRedactsSensitiveAttributes(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "info", FormatJSON)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	logger.Info("login",
+		slog.String("email", "user@example.com"),
+		slog.String("password", "hunter2"),
+		slog.String("Authorization", "Bearer abc"),
+		slog.Group("session", slog.String("token", "abc")),
+	)
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if entry["email"] != "user@example.com" {
+		t.Errorf("expected email to be kept, got %v", entry["email"])
+	}
+	if entry["password"] != redacted || entry["Authorization"] != redacted {
+		t.Errorf("expected credentials to be redacted, got %v", entry)
+	}
+	if session := entry["session"].(map[string]any); session["token"] != redacted {
+		t.Errorf("expected nested token to be redacted, got %v", session)
+	}
+	if strings.Contains(buf.String(), "hunter2") {
+		t.Errorf("password leaked: %s", buf.String())
+	}
+}
+
+func TestNewFiltersByLevelAndValidatesOptions(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "warn", FormatText)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	logger.Info("hidden")
+	logger.Warn("shown")
+	if strings.Contains(buf.String(), "hidden") || !strings.Contains(buf.String(), "msg=shown") {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+
+	if _, err := New(&buf, "loud", FormatJSON); err == nil {
+		t.Errorf("expected invalid level to be rejected")
+	}
+	if _, err := New(&buf, "info", "xml"); err == nil {
+		t.Errorf("expected invalid format to be rejected")
+	}
+}
+
+func TestFromContextFallsBackToDefault(t *testing.T) {
+	if FromContext(context.Background()) != slog.Default() {
+		t.Errorf("expected default logger")
+	}
+	logger := slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))
+	if FromContext(WithContext(context.Background(), logger)) != logger {
+		t.Errorf("expected logger from context")
+	}
+}
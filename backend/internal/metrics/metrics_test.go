@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/services"
+)
+
+// stubTodoRepo answers every call with err.
+type stubTodoRepo struct {
+	err error
+}
+
+func (s stubTodoRepo) List(context.Context, string) ([]services.Todo, error) { return nil, s.err }
+func (s stubTodoRepo) Create(_ context.Context, todo services.Todo) (services.Todo, error) {
+	return todo, s.err
+}
+func (s stubTodoRepo) Update(context.Context, primitive.ObjectID, services.TodoUpdate) (services.Todo, error) {
+	return services.Todo{}, s.err
+}
+func (s stubTodoRepo) Delete(context.Context, primitive.ObjectID) error { return s.err }
+func (s stubTodoRepo) Clear(context.Context, string) error              { return s.err }
+func (s stubTodoRepo) Count(context.Context, string) (int64, error)     { return 0, s.err }
+func (s stubTodoRepo) TitleBytes(context.Context, string) (int64, error) {
+	return 0, s.err
+}
+
+func TestInstrumentTodoRepositoryCountsOutcomes(t *testing.T) {
+	m := New()
+	ctx := context.Background()
+
+	ok := InstrumentTodoRepository(stubTodoRepo{}, m)
+	if _, err := ok.List(ctx, "a@example.com"); err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if _, err := ok.List(ctx, "a@example.com"); err != nil {
+		t.Fatalf("list: %v", err)
+	}
+
+	missing := InstrumentTodoRepository(stubTodoRepo{err: services.ErrNotFound}, m)
+	if err := missing.Delete(ctx, primitive.NewObjectID()); !errors.Is(err, services.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound to pass through, got %v", err)
+	}
+
+	broken := InstrumentTodoRepository(stubTodoRepo{err: errors.New("boom")}, m)
+	_ = broken.Clear(ctx, "")
+
+	cases := []struct {
+		method, outcome string
+		want            float64
+	}{
+		{"List", "ok", 2},
+		{"Delete", "not_found", 1},
+		{"Clear", "error", 1},
+	}
+	for _, tc := range cases {
+		got := testutil.ToFloat64(m.repoCalls.WithLabelValues("todos", tc.method, tc.outcome))
+		if got != tc.want {
+			t.Errorf("%s/%s: expected %v calls, got %v", tc.method, tc.outcome, tc.want, got)
+		}
+	}
+	if n := testutil.CollectAndCount(m.repoDuration); n != 3 {
+		t.Errorf("expected a latency series per method, got %d", n)
+	}
+}
+
+func TestMiddlewareLabelsByRouteTemplate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := New()
+	router := gin.New()
+	router.Use(m.Middleware())
+	router.GET("/todos/:id", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	router.GET("/metrics", gin.WrapH(m.Handler()))
+
+	for _, path := range []string{"/todos/1", "/todos/2", "/nope"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if got := testutil.ToFloat64(m.httpRequests.WithLabelValues("GET", "/todos/:id", "204")); got != 2 {
+		t.Errorf("expected 2 requests for the route template, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.httpRequests.WithLabelValues("GET", unmatchedRoute, "404")); got != 1 {
+		t.Errorf("expected unmatched request to be counted, got %v", got)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		`todoapp_http_requests_total{method="GET",route="/todos/:id",status="204"} 2`,
+		`todoapp_http_request_duration_seconds_bucket{method="GET",route="/todos/:id",status="204",le="+Inf"} 2`,
+		"go_goroutines",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected exposition to contain %q", want)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/services"
+)
+
+// userRepository decorates a services.UserRepository with metrics.
+type userRepository struct {
+	next    services.UserRepository
+	metrics *Metrics
+}
+
+// InstrumentUserRepository wraps repo so that every call is counted and timed.
+func InstrumentUserRepository(repo services.UserRepository, m *Metrics) services.UserRepository {
+	return &userRepository{next: repo, metrics: m}
+}
+
+func (r *userRepository) observe(method string, start time.Time, err error) {
+	r.metrics.observe("users", method, start, err)
+}
+
+func (r *userRepository) FindByEmail(ctx context.Context, email string) (services.User, error) {
+	start := time.Now()
+	user, err := r.next.FindByEmail(ctx, email)
+	r.observe("FindByEmail", start, err)
+	return user, err
+}
+
+func (r *userRepository) Insert(ctx context.Context, user services.User) error {
+	start := time.Now()
+	err := r.next.Insert(ctx, user)
+	r.observe("Insert", start, err)
+	return err
+}
+
+func (r *userRepository) List(ctx context.Context) ([]services.User, error) {
+	start := time.Now()
+	users, err := r.next.List(ctx)
+	r.observe("List", start, err)
+	return users, err
+}
+
+func (r *userRepository) Clear(ctx context.Context) error {
+	start := time.Now()
+	err := r.next.Clear(ctx)
+	r.observe("Clear", start, err)
+	return err
+}
+
+func (r *userRepository) UpdateTwoFactor(ctx context.Context, email string, twoFactor services.TwoFactor) error {
+	start := time.Now()
+	err := r.next.UpdateTwoFactor(ctx, email, twoFactor)
+	r.observe("UpdateTwoFactor", start, err)
+	return err
+}
+
+func (r *userRepository) SwapTwoFactor(ctx context.Context, email string, old, twoFactor services.TwoFactor) error {
+	start := time.Now()
+	err := r.next.SwapTwoFactor(ctx, email, old, twoFactor)
+	r.observe("SwapTwoFactor", start, err)
+	return err
+}
+
+func (r *userRepository) UpdateProfile(ctx context.Context, email string, profile services.Profile) error {
+	start := time.Now()
+	err := r.next.UpdateProfile(ctx, email, profile)
+	r.observe("UpdateProfile", start, err)
+	return err
+}
+
+func (r *userRepository) UpdatePassword(ctx context.Context, email, password string) error {
+	start := time.Now()
+	err := r.next.UpdatePassword(ctx, email, password)
+	r.observe("UpdatePassword", start, err)
+	return err
+}
+
+func (r *userRepository) SetDisabled(ctx context.Context, email string, disabled bool) error {
+	start := time.Now()
+	err := r.next.SetDisabled(ctx, email, disabled)
+	r.observe("SetDisabled", start, err)
+	return err
+}
+
+func (r *userRepository) SetCalendarToken(ctx context.Context, email, hash string) error {
+	start := time.Now()
+	err := r.next.SetCalendarToken(ctx, email, hash)
+	r.observe("SetCalendarToken", start, err)
+	return err
+}
+
+func (r *userRepository) FindByCalendarToken(ctx context.Context, hash string) (services.User, error) {
+	start := time.Now()
+	user, err := r.next.FindByCalendarToken(ctx, hash)
+	r.observe("FindByCalendarToken", start, err)
+	return user, err
+}
+
+func (r *userRepository) Delete(ctx context.Context, email string) error {
+	start := time.Now()
+	err := r.next.Delete(ctx, email)
+	r.observe("Delete", start, err)
+	return err
+}
+
+func (r *userRepository) ScheduleDeletion(ctx context.Context, email string, at time.Time) error {
+	start := time.Now()
+	err := r.next.ScheduleDeletion(ctx, email, at)
+	r.observe("ScheduleDeletion", start, err)
+	return err
+}
+
+func (r *userRepository) ListDueForDeletion(ctx context.Context, before time.Time) ([]services.User, error) {
+	start := time.Now()
+	users, err := r.next.ListDueForDeletion(ctx, before)
+	r.observe("ListDueForDeletion", start, err)
+	return users, err
+}
+
+// todoRepository decorates a services.TodoRepository with metrics.
+type todoRepository struct {
+	next    services.TodoRepository
+	metrics *Metrics
+}
+
+// InstrumentTodoRepository wraps repo so that every call is counted and timed.
+func InstrumentTodoRepository(repo services.TodoRepository, m *Metrics) services.TodoRepository {
+	return &todoRepository{next: repo, metrics: m}
+}
+
+func (r *todoRepository) observe(method string, start time.Time, err error) {
+	r.metrics.observe("todos", method, start, err)
+}
+
+func (r *todoRepository) List(ctx context.Context, email string) ([]services.Todo, error) {
+	start := time.Now()
+	todos, err := r.next.List(ctx, email)
+	r.observe("List", start, err)
+	return todos, err
+}
+
+func (r *todoRepository) Create(ctx context.Context, todo services.Todo) (services.Todo, error) {
+	start := time.Now()
+	created, err := r.next.Create(ctx, todo)
+	r.observe("Create", start, err)
+	return created, err
+}
+
+func (r *todoRepository) Update(ctx context.Context, id primitive.ObjectID, update services.TodoUpdate) (services.Todo, error) {
+	start := time.Now()
+	todo, err := r.next.Update(ctx, id, update)
+	r.observe("Update", start, err)
+	return todo, err
+}
+
+func (r *todoRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	start := time.Now()
+	err := r.next.Delete(ctx, id)
+	r.observe("Delete", start, err)
+	return err
+}
+
+func (r *todoRepository) Clear(ctx context.Context, email string) error {
+	start := time.Now()
+	err := r.next.Clear(ctx, email)
+	r.observe("Clear", start, err)
+	return err
+}
+
+func (r *todoRepository) Count(ctx context.Context, email string) (int64, error) {
+	start := time.Now()
+	count, err := r.next.Count(ctx, email)
+	r.observe("Count", start, err)
+	return count, err
+}
+
+func (r *todoRepository) TitleBytes(ctx context.Context, email string) (int64, error) {
+	start := time.Now()
+	total, err := r.next.TitleBytes(ctx, email)
+	r.observe("TitleBytes", start, err)
+	return total, err
+}
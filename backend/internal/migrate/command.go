@@ -0,0 +1,171 @@
+package migrate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/config"
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/logging"
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/services"
+)
+
+// Usage describes the arguments accepted by Command.
+const Usage = `usage: migrate <command> [flags]
+
+commands:
+  list                       show every migration and whether it is applied
+  up   [-to N] [-dry-run]    apply pending migrations, up to version N
+  down [-to N] [-dry-run]    roll back migrations above version N; without
+                             -to only the latest applied one
+
+-dry-run reports how many documents each migration would change and -json
+prints the result as JSON instead of a table.`
+
+// ErrUsage is returned for invalid arguments; Usage explains them.
+var ErrUsage = errors.New("invalid migrate arguments")
+
+// Run connects to the database configured in cfg and runs Command against
+// it with Migrations. It backs the migrate subcommand of the server and of
+// todoctl.
+func Run(ctx context.Context, cfg config.Config, args []string, out io.Writer) error {
+	if cfg.StorageDriver != config.StorageMongo {
+		return fmt.Errorf("migrations only apply to the mongo storage driver, not %q", cfg.StorageDriver)
+	}
+	client, err := services.ConnectMongo(ctx, cfg.MongoURI)
+	if err != nil {
+		return fmt.Errorf("connecting to mongo: %w", err)
+	}
+	defer func() { _ = client.Disconnect(context.WithoutCancel(ctx)) }()
+
+	runner, err := New(client.Database(cfg.DatabaseName), Migrations,
+		WithLogger(logging.FromContext(ctx)),
+	)
+	if err != nil {
+		return err
+	}
+	return Command(ctx, runner, args, out)
+}
+
+// Command runs the migrate subcommand described by Usage and prints its
+// result to out as a table, or as JSON with -json.
+func Command(ctx context.Context, runner *Runner, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return ErrUsage
+	}
+
+	flags := flag.NewFlagSet("migrate "+args[0], flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	to := flags.Int("to", -1, "target version")
+	dryRun := flags.Bool("dry-run", false, "only count the affected documents")
+	asJSON := flags.Bool("json", false, "print JSON")
+	if err := flags.Parse(args[1:]); err != nil || flags.NArg() > 0 {
+		return ErrUsage
+	}
+
+	switch args[0] {
+	case "list":
+		statuses, err := runner.Status(ctx)
+		if err != nil {
+			return err
+		}
+		if *asJSON {
+			return printJSON(out, statuses)
+		}
+		return printStatuses(out, statuses)
+	case "up":
+		if *to < 0 {
+			*to = 0
+		}
+		results, err := runner.Up(ctx, *to, *dryRun)
+		if perr := printResults(out, results, *dryRun, *asJSON); err == nil {
+			err = perr
+		}
+		return err
+	case "down":
+		if *to < 0 {
+			previous, err := previousVersion(ctx, runner)
+			if err != nil {
+				return err
+			}
+			*to = previous
+		}
+		results, err := runner.Down(ctx, *to, *dryRun)
+		if perr := printResults(out, results, *dryRun, *asJSON); err == nil {
+			err = perr
+		}
+		return err
+	default:
+		return ErrUsage
+	}
+}
+
+// previousVersion returns the applied version before the latest one, or zero.
+func previousVersion(ctx context.Context, runner *Runner) (int, error) {
+	statuses, err := runner.Status(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var applied []int
+	for _, status := range statuses {
+		if status.Applied {
+			applied = append(applied, status.Version)
+		}
+	}
+	if len(applied) < 2 {
+		return 0, nil
+	}
+	return applied[len(applied)-2], nil
+}
+
+func printStatuses(out io.Writer, statuses []Status) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tDESCRIPTION\tAPPLIED AT")
+	for _, status := range statuses {
+		appliedAt := "pending"
+		if status.Applied {
+			appliedAt = status.AppliedAt.UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, status.Description, appliedAt)
+	}
+	return w.Flush()
+}
+
+func printResults(out io.Writer, results []Result, dryRun, asJSON bool) error {
+	if asJSON {
+		if results == nil {
+			results = []Result{}
+		}
+		return printJSON(out, results)
+	}
+	if len(results) == 0 {
+		_, err := fmt.Fprintln(out, "nothing to do")
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tDESCRIPTION\tAFFECTED")
+	for _, result := range results {
+		affected := strconv.FormatInt(result.Affected, 10)
+		if result.Affected < 0 {
+			affected = "unknown"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", result.Version, result.Description, affected)
+	}
+	if dryRun {
+		fmt.Fprintln(w, "dry run: nothing was changed")
+	}
+	return w.Flush()
+}
+
+func printJSON(out io.Writer, v any) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
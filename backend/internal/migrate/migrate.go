@@ -0,0 +1,400 @@
+// Package migrate runs versioned data migrations against the MongoDB
+// database. Applied versions are recorded in the schema_migrations
+// collection, and every run holds a lease-based lock so that replicas
+// starting together apply each migration once.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// DefaultLockTTL is how long a run may hold the lock before another
+	// process considers its holder dead and takes over.
+	DefaultLockTTL = 10 * time.Minute
+	// DefaultLockRetry is how often a waiting process retries the lock.
+	DefaultLockRetry = time.Second
+)
+
+var (
+	// ErrIrreversible is returned when rolling back a migration without Down.
+	ErrIrreversible = errors.New("migration cannot be rolled back")
+	// ErrUnknownMigration is returned when rolling back a version that was
+	// applied by a newer build and is not known to this one.
+	ErrUnknownMigration = errors.New("unknown migration")
+	// ErrLockLost is returned when another process took the migration lock
+	// over during a run, e.g. after the lease could not be renewed in time.
+	ErrLockLost = errors.New("migration lock lost")
+)
+
+// Step changes documents in one direction.
+type Step struct {
+	// Apply performs the change and returns how many documents it modified.
+	// It must be idempotent: a run interrupted before the version is
+	// recorded applies it again.
+	Apply func(ctx context.Context, db *mongo.Database) (int64, error)
+	// Count returns how many documents Apply would modify, for dry runs.
+	Count func(ctx context.Context, db *mongo.Database) (int64, error)
+}
+
+// Migration is one versioned change to the stored data.
+type Migration struct {
+	// Version orders migrations; it must be positive and unique.
+	Version     int
+	Description string
+	Up          Step
+	// Down reverts Up; a nil Apply makes the migration irreversible.
+	Down Step
+}
+
+// Status is the state of one migration.
+type Status struct {
+	Version     int       `json:"version"`
+	Description string    `json:"description"`
+	Applied     bool      `json:"applied"`
+	AppliedAt   time.Time `json:"appliedAt,omitempty"`
+}
+
+// Result reports one migration applied or rolled back by a run. Affected is
+// -1 when a dry run cannot count the documents.
+type Result struct {
+	Version     int    `json:"version"`
+	Description string `json:"description"`
+	Affected    int64  `json:"affected"`
+	DryRun      bool   `json:"dryRun"`
+}
+
+// Runner applies and rolls back migrations.
+type Runner struct {
+	db         *mongo.Database
+	store      Store
+	migrations []Migration
+	now        func() time.Time
+	lockTTL    time.Duration
+	lockRetry  time.Duration
+	logger     *slog.Logger
+}
+
+// Option customises a Runner.
+type Option func(*Runner)
+
+// WithStore replaces where applied versions and the lock are kept, which
+// defaults to the schema_migrations and migration_lock collections of db.
+func WithStore(store Store) Option {
+	return func(r *Runner) {
+		r.store = store
+	}
+}
+
+// WithClock overrides the clock used for lock leases and applied times.
+func WithClock(now func() time.Time) Option {
+	return func(r *Runner) {
+		r.now = now
+	}
+}
+
+// WithLock overrides the lock lease and retry interval.
+func WithLock(ttl, retry time.Duration) Option {
+	return func(r *Runner) {
+		r.lockTTL = ttl
+		r.lockRetry = retry
+	}
+}
+
+// WithLogger sets the logger that reports applied migrations.
+func WithLogger(logger *slog.Logger) Option {
+	return func(r *Runner) {
+		r.logger = logger
+	}
+}
+
+// New builds a Runner for migrations on db. It rejects non-positive and
+// duplicate versions.
+func New(db *mongo.Database, migrations []Migration, opts ...Option) (*Runner, error) {
+	sorted := append([]Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	for i, m := range sorted {
+		if m.Version <= 0 || m.Up.Apply == nil {
+			return nil, fmt.Errorf("migrate: invalid migration %d %q", m.Version, m.Description)
+		}
+		if i > 0 && sorted[i-1].Version == m.Version {
+			return nil, fmt.Errorf("migrate: duplicate migration version %d", m.Version)
+		}
+	}
+
+	r := &Runner{
+		db:         db,
+		migrations: sorted,
+		now:        time.Now,
+		lockTTL:    DefaultLockTTL,
+		lockRetry:  DefaultLockRetry,
+		logger:     slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.store == nil {
+		r.store = NewMongoStore(db)
+	}
+	return r, nil
+}
+
+// Status lists every known migration in version order, followed by applied
+// versions this build does not know.
+func (r *Runner) Status(ctx context.Context) ([]Status, error) {
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(r.migrations))
+	for _, m := range r.migrations {
+		status := Status{Version: m.Version, Description: m.Description}
+		if record, ok := applied[m.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = record.AppliedAt
+			delete(applied, m.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for _, record := range applied {
+		statuses = append(statuses, Status{
+			Version:     record.Version,
+			Description: record.Description,
+			Applied:     true,
+			AppliedAt:   record.AppliedAt,
+		})
+	}
+	sort.SliceStable(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// Up applies every pending migration up to and including version to, or all
+// of them when to is zero. A dry run only counts the affected documents.
+func (r *Runner) Up(ctx context.Context, to int, dryRun bool) ([]Result, error) {
+	return r.run(ctx, dryRun, func(applied map[int]Record) ([]Migration, error) {
+		var pending []Migration
+		for _, m := range r.migrations {
+			if _, ok := applied[m.Version]; !ok && (to == 0 || m.Version <= to) {
+				pending = append(pending, m)
+			}
+		}
+		return pending, nil
+	}, func(m Migration) (Step, error) {
+		return m.Up, nil
+	}, r.store.Record)
+}
+
+// Down rolls back every applied migration above version to, newest first.
+// A dry run only counts the affected documents.
+func (r *Runner) Down(ctx context.Context, to int, dryRun bool) ([]Result, error) {
+	known := make(map[int]Migration, len(r.migrations))
+	for _, m := range r.migrations {
+		known[m.Version] = m
+	}
+
+	return r.run(ctx, dryRun, func(applied map[int]Record) ([]Migration, error) {
+		var rollback []Migration
+		for version, record := range applied {
+			if version <= to {
+				continue
+			}
+			m, ok := known[version]
+			if !ok {
+				return nil, fmt.Errorf("%w %d %q", ErrUnknownMigration, version, record.Description)
+			}
+			rollback = append(rollback, m)
+		}
+		sort.Slice(rollback, func(i, j int) bool { return rollback[i].Version > rollback[j].Version })
+		return rollback, nil
+	}, func(m Migration) (Step, error) {
+		if m.Down.Apply == nil {
+			return Step{}, fmt.Errorf("%w: %d %q", ErrIrreversible, m.Version, m.Description)
+		}
+		return m.Down, nil
+	}, func(ctx context.Context, record Record) error {
+		return r.store.Remove(ctx, record.Version)
+	})
+}
+
+// run selects migrations under the lock and runs the chosen step of each,
+// calling done after every success. Every step is checked before anything
+// runs, so an irreversible migration stops a rollback before it starts.
+//
+// The lease is renewed while the steps run, and confirmed before each done;
+// when it is lost, the running step is cancelled and the run fails with
+// ErrLockLost without recording it.
+func (r *Runner) run(
+	ctx context.Context,
+	dryRun bool,
+	selectMigrations func(applied map[int]Record) ([]Migration, error),
+	stepOf func(Migration) (Step, error),
+	done func(ctx context.Context, record Record) error,
+) ([]Result, error) {
+	var held *lease
+	if !dryRun {
+		var err error
+		if held, err = r.lock(ctx); err != nil {
+			return nil, err
+		}
+		defer held.release()
+		ctx = held.ctx
+	}
+
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	selected, err := selectMigrations(applied)
+	if err != nil {
+		return nil, err
+	}
+	steps := make([]Step, len(selected))
+	for i, m := range selected {
+		if steps[i], err = stepOf(m); err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]Result, 0, len(selected))
+	for i, m := range selected {
+		result := Result{Version: m.Version, Description: m.Description, DryRun: dryRun}
+		if dryRun {
+			result.Affected = -1
+			if steps[i].Count != nil {
+				if result.Affected, err = steps[i].Count(ctx, r.db); err != nil {
+					return results, fmt.Errorf("migration %d: %w", m.Version, err)
+				}
+			}
+			results = append(results, result)
+			continue
+		}
+
+		if result.Affected, err = steps[i].Apply(ctx, r.db); err != nil {
+			if cause := context.Cause(ctx); errors.Is(cause, ErrLockLost) {
+				err = cause
+			}
+			return results, fmt.Errorf("migration %d: %w", m.Version, err)
+		}
+		if err := held.confirm(ctx); err != nil {
+			return results, fmt.Errorf("migration %d: %w", m.Version, err)
+		}
+		record := Record{Version: m.Version, Description: m.Description, AppliedAt: r.now()}
+		if err := done(ctx, record); err != nil {
+			return results, fmt.Errorf("recording migration %d: %w", m.Version, err)
+		}
+		r.logger.Info("migration applied",
+			slog.Int("version", m.Version),
+			slog.String("description", m.Description),
+			slog.Int64("affected", result.Affected),
+		)
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func (r *Runner) applied(ctx context.Context) (map[int]Record, error) {
+	records, err := r.store.Applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	applied := make(map[int]Record, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+// lock waits until the migration lock is acquired and returns the lease,
+// which is renewed in the background until released.
+func (r *Runner) lock(ctx context.Context) (*lease, error) {
+	owner := primitive.NewObjectID().Hex()
+	for {
+		acquired, err := r.store.Lock(ctx, owner, r.now(), r.lockTTL)
+		if err != nil {
+			return nil, fmt.Errorf("acquiring migration lock: %w", err)
+		}
+		if acquired {
+			break
+		}
+		r.logger.Info("waiting for the migration lock")
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(r.lockRetry):
+		}
+	}
+
+	leaseCtx, cancel := context.WithCancelCause(ctx)
+	l := &lease{runner: r, owner: owner, ctx: leaseCtx, cancel: cancel, stopped: make(chan struct{})}
+	go l.renew()
+	return l, nil
+}
+
+// lease is a held migration lock. Its ctx is cancelled with ErrLockLost
+// when another process takes the lock over.
+type lease struct {
+	runner  *Runner
+	owner   string
+	ctx     context.Context
+	cancel  context.CancelCauseFunc
+	stopped chan struct{}
+}
+
+// renew extends the lease every third of its TTL. Renewal errors are only
+// logged, as the next attempt may still be in time; confirm catches a lease
+// that expired meanwhile.
+func (l *lease) renew() {
+	defer close(l.stopped)
+	ticker := time.NewTicker(l.runner.lockTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.ctx.Done():
+			return
+		case <-ticker.C:
+			err := l.confirm(l.ctx)
+			switch {
+			case errors.Is(err, ErrLockLost):
+				l.runner.logger.Error("migration lock lost")
+				l.cancel(ErrLockLost)
+				return
+			case err != nil && l.ctx.Err() == nil:
+				l.runner.logger.Warn("renewing migration lock failed", slog.Any("error", err))
+			}
+		}
+	}
+}
+
+// confirm extends the lease, or returns ErrLockLost when another process
+// holds the lock. A nil lease, as in dry runs, is always confirmed.
+func (l *lease) confirm(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	held, err := l.runner.store.Lock(ctx, l.owner, l.runner.now(), l.runner.lockTTL)
+	if err != nil {
+		return fmt.Errorf("renewing migration lock: %w", err)
+	}
+	if !held {
+		return ErrLockLost
+	}
+	return nil
+}
+
+// release stops the renewal and unlocks, unless the lock was lost.
+func (l *lease) release() {
+	l.cancel(nil)
+	<-l.stopped
+	if err := l.runner.store.Unlock(context.WithoutCancel(l.ctx), l.owner); err != nil {
+		l.runner.logger.Warn("releasing migration lock failed", slog.Any("error", err))
+	}
+}
@@ -0,0 +1,386 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/services"
+)
+
+var fixedTime = time.Date(2025, time.January, 1, 10, 0, 0, 0, time.UTC)
+
+func fixedNow() time.Time {
+	return fixedTime
+}
+
+// fakeMigrations records which steps ran; their Count reports version*10.
+type fakeMigrations struct {
+	mu  sync.Mutex
+	ran []string
+}
+
+func (f *fakeMigrations) step(name string, affected int64) Step {
+	return Step{
+		Apply: func(context.Context, *mongo.Database) (int64, error) {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			f.ran = append(f.ran, name)
+			return affected, nil
+		},
+		Count: func(context.Context, *mongo.Database) (int64, error) {
+			return affected * 10, nil
+		},
+	}
+}
+
+func (f *fakeMigrations) list() []Migration {
+	return []Migration{
+		{Version: 2, Description: "second", Up: f.step("up2", 2), Down: f.step("down2", 2)},
+		{Version: 1, Description: "first", Up: f.step("up1", 1), Down: f.step("down1", 1)},
+		{Version: 3, Description: "third", Up: f.step("up3", 3)},
+	}
+}
+
+func newTestRunner(t *testing.T, migrations []Migration, store Store) *Runner {
+	t.Helper()
+
+	runner, err := New(nil, migrations, WithStore(store), WithClock(fixedNow), WithLock(time.Minute, time.Millisecond))
+	if err != nil {
+		t.Fatalf("new runner: %v", err)
+	}
+	return runner
+}
+
+func TestNewRejectsInvalidMigrations(t *testing.T) {
+	apply := Step{Apply: func(context.Context, *mongo.Database) (int64, error) { return 0, nil }}
+	for name, migrations := range map[string][]Migration{
+		"duplicate": {{Version: 1, Up: apply}, {Version: 1, Up: apply}},
+		"zero":      {{Version: 0, Up: apply}},
+		"no up":     {{Version: 1}},
+	} {
+		if _, err := New(nil, migrations, WithStore(NewMemoryStore())); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestRunnerAppliesPendingMigrationsInOrder(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeMigrations{}
+	store := NewMemoryStore()
+	runner := newTestRunner(t, fake.list(), store)
+
+	results, err := runner.Up(ctx, 2, false)
+	if err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	if len(results) != 2 || results[0].Version != 1 || results[1].Affected != 2 {
+		t.Errorf("unexpected results %+v", results)
+	}
+
+	results, err = runner.Up(ctx, 0, false)
+	if err != nil || len(results) != 1 || results[0].Version != 3 {
+		t.Fatalf("expected only the third migration to run, got %+v (%v)", results, err)
+	}
+	if got := strings.Join(fake.ran, ","); got != "up1,up2,up3" {
+		t.Errorf("unexpected steps %s", got)
+	}
+
+	statuses, err := runner.Status(ctx)
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	for _, status := range statuses {
+		if !status.Applied || !status.AppliedAt.Equal(fixedTime) {
+			t.Errorf("expected %d to be applied, got %+v", status.Version, status)
+		}
+	}
+
+	if results, err := runner.Up(ctx, 0, false); err != nil || len(results) != 0 {
+		t.Errorf("expected a second run to do nothing, got %+v (%v)", results, err)
+	}
+}
+
+func TestRunnerDryRunCountsWithoutApplying(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeMigrations{}
+	store := NewMemoryStore()
+	runner := newTestRunner(t, fake.list(), store)
+
+	results, err := runner.Up(ctx, 0, true)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if len(results) != 3 || results[2].Affected != 30 || !results[2].DryRun {
+		t.Errorf("unexpected results %+v", results)
+	}
+	if len(fake.ran) != 0 {
+		t.Errorf("expected nothing to run, got %v", fake.ran)
+	}
+	if applied, _ := store.Applied(ctx); len(applied) != 0 {
+		t.Errorf("expected nothing to be recorded, got %+v", applied)
+	}
+}
+
+func TestRunnerRollsBackNewestFirst(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeMigrations{}
+	store := NewMemoryStore()
+	runner := newTestRunner(t, fake.list(), store)
+	if _, err := runner.Up(ctx, 2, false); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+
+	results, err := runner.Down(ctx, 0, true)
+	if err != nil || len(results) != 2 || results[0].Version != 2 || results[0].Affected != 20 {
+		t.Fatalf("unexpected dry run %+v (%v)", results, err)
+	}
+
+	if _, err := runner.Down(ctx, 0, false); err != nil {
+		t.Fatalf("down: %v", err)
+	}
+	if got := strings.Join(fake.ran, ","); got != "up1,up2,down2,down1" {
+		t.Errorf("unexpected steps %s", got)
+	}
+	if applied, _ := store.Applied(ctx); len(applied) != 0 {
+		t.Errorf("expected every migration to be rolled back, got %+v", applied)
+	}
+}
+
+func TestRunnerRefusesIrreversibleAndUnknownRollbacks(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeMigrations{}
+	store := NewMemoryStore()
+	runner := newTestRunner(t, fake.list(), store)
+	if _, err := runner.Up(ctx, 0, false); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+
+	if _, err := runner.Down(ctx, 0, false); !errors.Is(err, ErrIrreversible) {
+		t.Errorf("expected ErrIrreversible, got %v", err)
+	}
+	if got := strings.Join(fake.ran, ","); got != "up1,up2,up3" {
+		t.Errorf("expected nothing to be rolled back, got %s", got)
+	}
+
+	_ = store.Record(ctx, Record{Version: 9, Description: "from a newer build"})
+	if _, err := runner.Down(ctx, 3, false); !errors.Is(err, ErrUnknownMigration) {
+		t.Errorf("expected ErrUnknownMigration, got %v", err)
+	}
+	statuses, _ := runner.Status(ctx)
+	if last := statuses[len(statuses)-1]; last.Version != 9 || !last.Applied {
+		t.Errorf("expected the unknown version to be listed, got %+v", last)
+	}
+}
+
+func TestRunnerWaitsForTheLock(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeMigrations{}
+	store := NewMemoryStore()
+	runner := newTestRunner(t, fake.list(), store)
+
+	if ok, _ := store.Lock(ctx, "other replica", fixedTime, time.Minute); !ok {
+		t.Fatalf("expected to take the lock")
+	}
+	timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := runner.Up(timeout, 0, false); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected to wait for the lock, got %v", err)
+	}
+	if len(fake.ran) != 0 {
+		t.Errorf("expected nothing to run while locked, got %v", fake.ran)
+	}
+
+	_ = store.Unlock(ctx, "other replica")
+	if _, err := runner.Up(ctx, 0, false); err != nil {
+		t.Fatalf("up after unlock: %v", err)
+	}
+	if ok, _ := store.Lock(ctx, "other replica", fixedTime, time.Minute); !ok {
+		t.Errorf("expected the runner to release the lock")
+	}
+}
+
+func TestRunnerRenewsTheLock(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	var stolen bool
+	slow := Step{Apply: func(context.Context, *mongo.Database) (int64, error) {
+		time.Sleep(100 * time.Millisecond)
+		stolen, _ = store.Lock(ctx, "other replica", time.Now(), time.Minute)
+		return 0, nil
+	}}
+	runner, err := New(nil, []Migration{{Version: 1, Description: "slow", Up: slow}},
+		WithStore(store), WithLock(30*time.Millisecond, time.Millisecond))
+	if err != nil {
+		t.Fatalf("new runner: %v", err)
+	}
+
+	if _, err := runner.Up(ctx, 0, false); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	if stolen {
+		t.Errorf("expected the lease to be renewed past its TTL")
+	}
+}
+
+func TestRunnerAbortsWhenTheLockIsLost(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		wait bool
+	}{
+		{name: "after the step"},
+		{name: "during the step", wait: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := NewMemoryStore()
+			steal := Step{Apply: func(ctx context.Context, _ *mongo.Database) (int64, error) {
+				_, _ = store.Lock(ctx, "other replica", time.Now().Add(time.Hour), time.Hour)
+				if !tc.wait {
+					return 0, nil
+				}
+				select {
+				case <-ctx.Done():
+					return 0, ctx.Err()
+				case <-time.After(time.Second):
+					return 0, errors.New("expected the step to be cancelled")
+				}
+			}}
+			runner, err := New(nil, []Migration{{Version: 1, Description: "steal", Up: steal}},
+				WithStore(store), WithLock(30*time.Millisecond, time.Millisecond))
+			if err != nil {
+				t.Fatalf("new runner: %v", err)
+			}
+
+			if _, err := runner.Up(ctx, 0, false); !errors.Is(err, ErrLockLost) {
+				t.Fatalf("expected ErrLockLost, got %v", err)
+			}
+			if applied, _ := store.Applied(ctx); len(applied) != 0 {
+				t.Errorf("expected nothing recorded, got %+v", applied)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreLockExpires(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	if ok, _ := store.Lock(ctx, "a", fixedTime, time.Minute); !ok {
+		t.Fatalf("expected a to take the lock")
+	}
+	if ok, _ := store.Lock(ctx, "b", fixedTime.Add(30*time.Second), time.Minute); ok {
+		t.Errorf("expected b to wait while a's lease is valid")
+	}
+	if ok, _ := store.Lock(ctx, "b", fixedTime.Add(time.Minute), time.Minute); !ok {
+		t.Errorf("expected b to take over the expired lease")
+	}
+}
+
+func TestMongoStoreLock(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock).CreateCollection(false))
+
+	lockResponse := func(owner string) bson.D {
+		return mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.D{
+			{Key: "_id", Value: lockID},
+			{Key: "owner", Value: owner},
+			{Key: "expiresAt", Value: fixedTime.Add(time.Minute)},
+		}})
+	}
+
+	mt.Run("acquired", func(mt *mtest.T) {
+		store := NewMongoStore(mt.DB)
+		mt.AddMockResponses(lockResponse("me"))
+		if ok, err := store.Lock(context.Background(), "me", fixedTime, time.Minute); err != nil || !ok {
+			mt.Fatalf("expected the lock, got %v (%v)", ok, err)
+		}
+	})
+
+	mt.Run("held by another owner", func(mt *mtest.T) {
+		store := NewMongoStore(mt.DB)
+		mt.AddMockResponses(lockResponse("other"))
+		if ok, err := store.Lock(context.Background(), "me", fixedTime, time.Minute); err != nil || ok {
+			mt.Fatalf("expected the lock to be held, got %v (%v)", ok, err)
+		}
+	})
+}
+
+func TestCommand(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeMigrations{}
+	runner := newTestRunner(t, fake.list(), NewMemoryStore())
+
+	run := func(args ...string) (string, error) {
+		var out bytes.Buffer
+		err := Command(ctx, runner, args, &out)
+		return out.String(), err
+	}
+
+	out, err := run("up", "-to", "2", "-dry-run")
+	if err != nil || !strings.Contains(out, "dry run") || !strings.Contains(out, "20") {
+		t.Errorf("unexpected dry run output %q (%v)", out, err)
+	}
+	if _, err := run("up"); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	out, err = run("list")
+	if err != nil || strings.Contains(out, "pending") || !strings.Contains(out, "2025-01-01T10:00:00Z") {
+		t.Errorf("unexpected list output %q (%v)", out, err)
+	}
+
+	out, err = run("list", "-json")
+	if err != nil || !strings.Contains(out, `"version": 3`) || !strings.Contains(out, `"applied": true`) {
+		t.Errorf("unexpected JSON list output %q (%v)", out, err)
+	}
+	if out, err := run("up", "-json"); err != nil || strings.TrimSpace(out) != "[]" {
+		t.Errorf("unexpected JSON up output %q (%v)", out, err)
+	}
+
+	// Without -to, down only rolls back the latest migration, which is
+	// irreversible here.
+	if _, err := run("down"); !errors.Is(err, ErrIrreversible) {
+		t.Errorf("expected ErrIrreversible, got %v", err)
+	}
+	if out, err := run("down", "-to", "1"); !errors.Is(err, ErrIrreversible) || out != "nothing to do\n" {
+		t.Errorf("unexpected down output %q (%v)", out, err)
+	}
+
+	for _, args := range [][]string{nil, {"sideways"}, {"up", "-to", "x"}, {"list", "extra"}} {
+		if _, err := run(args...); !errors.Is(err, ErrUsage) {
+			t.Errorf("%v: expected ErrUsage, got %v", args, err)
+		}
+	}
+}
+
+// TestCheckDuplicateEmails ensures the migration names the shared emails and
+// passes when there are none.
+func TestCheckDuplicateEmails(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock).CreateCollection(false))
+
+	mt.Run("duplicates", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, mt.DB.Name()+".users", mtest.FirstBatch,
+			bson.D{{Key: "_id", Value: "ana@example.com"}, {Key: "count", Value: 2}},
+		))
+		_, err := checkDuplicateEmails(context.Background(), mt.DB)
+		var duplicates *services.DuplicateEmailsError
+		if !errors.As(err, &duplicates) || len(duplicates.Emails) != 1 || duplicates.Emails[0] != "ana@example.com" {
+			mt.Fatalf("expected ana@example.com to be reported, got %v", err)
+		}
+	})
+
+	mt.Run("none", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, mt.DB.Name()+".users", mtest.FirstBatch))
+		if _, err := checkDuplicateEmails(context.Background(), mt.DB); err != nil {
+			mt.Fatalf("expected no error, got %v", err)
+		}
+	})
+}
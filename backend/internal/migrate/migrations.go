@@ -0,0 +1,90 @@
+package migrate
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/services"
+)
+
+// Migrations are the data migrations of the application, in version order.
+// Append new ones with the next version; never renumber or edit applied ones.
+var Migrations = []Migration{
+	{
+		Version:     1,
+		Description: "backfill completed and createdAt on todos",
+		Up: Step{
+			Apply: backfillTodos,
+			Count: func(ctx context.Context, db *mongo.Database) (int64, error) {
+				return countMissing(ctx, db.Collection("todos"), "completed", "createdAt")
+			},
+		},
+	},
+	{
+		Version:     2,
+		Description: "check that no two users share an email",
+		Up: Step{
+			Apply: checkDuplicateEmails,
+			Count: checkDuplicateEmails,
+		},
+		// Nothing was changed, so there is nothing to revert.
+		Down: Step{Apply: noop, Count: noop},
+	},
+}
+
+// checkDuplicateEmails fails with a *services.DuplicateEmailsError naming the
+// emails shared by several users, which would keep the unique email index
+// from being built. Migrations run before the schema is applied, so the
+// problem is reported before the server fails to start on it. It changes no
+// documents: only their owners can tell which account to keep.
+func checkDuplicateEmails(ctx context.Context, db *mongo.Database) (int64, error) {
+	emails, err := services.FindDuplicateEmails(ctx, db.Collection("users"))
+	if err != nil {
+		return 0, err
+	}
+	if len(emails) > 0 {
+		return 0, &services.DuplicateEmailsError{Emails: emails}
+	}
+	return 0, nil
+}
+
+func noop(context.Context, *mongo.Database) (int64, error) {
+	return 0, nil
+}
+
+// backfillTodos sets completed to false and createdAt to the creation time
+// of the ObjectID on todos written before those fields were required.
+func backfillTodos(ctx context.Context, db *mongo.Database) (int64, error) {
+	todos := db.Collection("todos")
+	completed, err := todos.UpdateMany(ctx,
+		bson.M{"completed": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"completed": false}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	createdAt, err := todos.UpdateMany(ctx,
+		bson.M{"createdAt": bson.M{"$exists": false}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"createdAt": bson.M{"$toDate": "$_id"}}}}},
+	)
+	if err != nil {
+		return completed.ModifiedCount, err
+	}
+	return completed.ModifiedCount + createdAt.ModifiedCount, nil
+}
+
+// countMissing counts, field by field, the documents without each field, as
+// the backfill updates them one field at a time.
+func countMissing(ctx context.Context, collection *mongo.Collection, fields ...string) (int64, error) {
+	var total int64
+	for _, field := range fields {
+		n, err := collection.CountDocuments(ctx, bson.M{field: bson.M{"$exists": false}})
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
+}
@@ -0,0 +1,186 @@
+package migrate
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// lockID is the _id of the single migration lock document.
+const lockID = "schema_migrations"
+
+// Record is an applied migration as stored in schema_migrations.
+type Record struct {
+	Version     int       `bson:"_id"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"appliedAt"`
+}
+
+// Store keeps the applied versions and the lock that serialises runs.
+type Store interface {
+	// Applied returns every applied migration.
+	Applied(ctx context.Context) ([]Record, error)
+	// Record marks a migration as applied.
+	Record(ctx context.Context, record Record) error
+	// Remove marks a migration as rolled back.
+	Remove(ctx context.Context, version int) error
+	// Lock takes the lock for owner until now+ttl, unless another owner
+	// holds an unexpired lease. It reports whether owner holds the lock;
+	// when owner already held it, the lease is extended.
+	Lock(ctx context.Context, owner string, now time.Time, ttl time.Duration) (bool, error)
+	// Unlock releases the lock if owner holds it.
+	Unlock(ctx context.Context, owner string) error
+}
+
+// MemoryStore keeps migration state in process memory, for tests.
+type MemoryStore struct {
+	mu        sync.Mutex
+	records   map[int]Record
+	owner     string
+	expiresAt time.Time
+}
+
+// NewMemoryStore creates an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[int]Record)}
+}
+
+// Applied returns every applied migration sorted by version.
+func (m *MemoryStore) Applied(_ context.Context) ([]Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	records := make([]Record, 0, len(m.records))
+	for _, record := range m.records {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Version < records[j].Version })
+	return records, nil
+}
+
+// Record marks a migration as applied.
+func (m *MemoryStore) Record(_ context.Context, record Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.records[record.Version] = record
+	return nil
+}
+
+// Remove marks a migration as rolled back.
+func (m *MemoryStore) Remove(_ context.Context, version int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.records, version)
+	return nil
+}
+
+// Lock takes the lock unless another owner holds an unexpired lease.
+func (m *MemoryStore) Lock(_ context.Context, owner string, now time.Time, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.owner != "" && m.owner != owner && now.Before(m.expiresAt) {
+		return false, nil
+	}
+	m.owner = owner
+	m.expiresAt = now.Add(ttl)
+	return true, nil
+}
+
+// Unlock releases the lock if owner holds it.
+func (m *MemoryStore) Unlock(_ context.Context, owner string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.owner == owner {
+		m.owner = ""
+	}
+	return nil
+}
+
+// MongoStore keeps applied versions in schema_migrations and the lock in
+// migration_lock.
+type MongoStore struct {
+	migrations *mongo.Collection
+	lock       *mongo.Collection
+}
+
+// NewMongoStore creates a store on db.
+func NewMongoStore(db *mongo.Database) *MongoStore {
+	return &MongoStore{
+		migrations: db.Collection("schema_migrations"),
+		lock:       db.Collection("migration_lock"),
+	}
+}
+
+// Applied returns every applied migration sorted by version.
+func (m *MongoStore) Applied(ctx context.Context) ([]Record, error) {
+	cursor, err := m.migrations.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var records []Record
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// Record marks a migration as applied.
+func (m *MongoStore) Record(ctx context.Context, record Record) error {
+	_, err := m.migrations.ReplaceOne(ctx, bson.M{"_id": record.Version}, record, options.Replace().SetUpsert(true))
+	return err
+}
+
+// Remove marks a migration as rolled back.
+func (m *MongoStore) Remove(ctx context.Context, version int) error {
+	_, err := m.migrations.DeleteOne(ctx, bson.M{"_id": version})
+	return err
+}
+
+// Lock takes over the lock document in a single upsert when it is missing,
+// its lease expired or owner holds it, so two processes cannot both acquire
+// it.
+func (m *MongoStore) Lock(ctx context.Context, owner string, now time.Time, ttl time.Duration) (bool, error) {
+	fresh := bson.D{
+		{Key: "_id", Value: lockID},
+		{Key: "owner", Value: owner},
+		{Key: "expiresAt", Value: now.Add(ttl)},
+	}
+	res := m.lock.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": lockID},
+		mongo.Pipeline{
+			{{Key: "$replaceWith", Value: bson.D{{Key: "$cond", Value: bson.A{
+				bson.D{{Key: "$and", Value: bson.A{
+					bson.D{{Key: "$gt", Value: bson.A{"$expiresAt", now}}},
+					bson.D{{Key: "$ne", Value: bson.A{"$owner", owner}}},
+				}}},
+				"$$ROOT",
+				bson.D{{Key: "$literal", Value: fresh}},
+			}}}}},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	)
+
+	var holder struct {
+		Owner string `bson:"owner"`
+	}
+	if err := res.Decode(&holder); err != nil {
+		return false, err
+	}
+	return holder.Owner == owner, nil
+}
+
+// Unlock releases the lock if owner holds it.
+func (m *MongoStore) Unlock(ctx context.Context, owner string) error {
+	_, err := m.lock.DeleteOne(ctx, bson.M{"_id": lockID, "owner": owner})
+	return err
+}
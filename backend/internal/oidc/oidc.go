@@ -0,0 +1,340 @@
+// Package oidc implements the OpenID Connect authorization-code flow with PKCE
+// and ID-token validation against the provider's JWKS.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidState indicates an unknown, reused or expired state parameter.
+	ErrInvalidState = errors.New("invalid oidc state")
+	// ErrInvalidToken indicates the ID token failed validation.
+	ErrInvalidToken = errors.New("invalid id token")
+	// ErrEmailNotVerified is returned when the provider reports an unverified email.
+	ErrEmailNotVerified = errors.New("email not verified by identity provider")
+)
+
+const (
+	// StateTTL bounds how long a user can take to authenticate at the provider.
+	StateTTL = 10 * time.Minute
+	// clockLeeway tolerates small clock differences with the provider.
+	clockLeeway = time.Minute
+)
+
+// Config holds the client registration at the identity provider.
+type Config struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// Scopes defaults to openid, email and profile.
+	Scopes []string
+	// HTTPClient defaults to a client with a 10s timeout.
+	HTTPClient *http.Client
+	// Now defaults to time.Now.
+	Now func() time.Time
+	// Store keeps the logins in progress; it defaults to a MemoryStateStore,
+	// which only works with a single replica.
+	Store StateStore
+}
+
+// Claims are the validated ID-token claims the application relies on.
+type Claims struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider is a relying-party client for a single OpenID provider.
+type Provider struct {
+	cfg  Config
+	meta metadata
+	keys *keySet
+}
+
+// NewProvider discovers the provider configuration from
+// <issuer>/.well-known/openid-configuration.
+func NewProvider(ctx context.Context, cfg Config) (*Provider, error) {
+	if cfg.IssuerURL == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return nil, errors.New("oidc: issuer, client id and redirect url are required")
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	if cfg.Store == nil {
+		cfg.Store = NewMemoryStateStore(cfg.Now)
+	}
+
+	discoveryURL := strings.TrimSuffix(cfg.IssuerURL, "/") + "/.well-known/openid-configuration"
+	var meta metadata
+	if err := getJSON(ctx, cfg.HTTPClient, discoveryURL, &meta); err != nil {
+		return nil, fmt.Errorf("oidc: discovery: %w", err)
+	}
+	if strings.TrimSuffix(meta.Issuer, "/") != strings.TrimSuffix(cfg.IssuerURL, "/") {
+		return nil, fmt.Errorf("oidc: issuer mismatch: got %q want %q", meta.Issuer, cfg.IssuerURL)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, errors.New("oidc: incomplete provider metadata")
+	}
+
+	return &Provider{
+		cfg:  cfg,
+		meta: meta,
+		keys: newKeySet(cfg.HTTPClient, meta.JWKSURI),
+	}, nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, url)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out)
+}
+
+func randomString(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// CodeChallenge derives the S256 PKCE challenge from a verifier.
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL starts a login: it stores a fresh nonce and PKCE verifier
+// under a new state and returns the provider URL the browser must be sent to,
+// and the state. The caller must bind the state to the browser, e.g. in a
+// cookie, and only pass it to Exchange when the callback comes from there.
+func (p *Provider) AuthCodeURL(ctx context.Context) (authURL, state string, err error) {
+	if state, err = randomString(16); err != nil {
+		return "", "", err
+	}
+	nonce, err := randomString(16)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := randomString(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	login := PendingLogin{
+		StateHash: hashState(state),
+		Nonce:     nonce,
+		Verifier:  verifier,
+		ExpiresAt: p.cfg.Now().Add(StateTTL),
+	}
+	if err := p.cfg.Store.Save(ctx, login); err != nil {
+		return "", "", fmt.Errorf("oidc: saving state: %w", err)
+	}
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.cfg.ClientID)
+	params.Set("redirect_uri", p.cfg.RedirectURL)
+	params.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", CodeChallenge(verifier))
+	params.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(p.meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.meta.AuthorizationEndpoint + sep + params.Encode(), state, nil
+}
+
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	AccessToken      string `json:"access_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Exchange completes a login: it redeems the authorization code with the PKCE
+// verifier and returns the validated ID-token claims.
+func (p *Provider) Exchange(ctx context.Context, code, state string) (Claims, error) {
+	if state == "" {
+		return Claims{}, ErrInvalidState
+	}
+	login, err := p.cfg.Store.Take(ctx, hashState(state))
+	if err != nil {
+		return Claims{}, err
+	}
+	if code == "" {
+		return Claims{}, ErrInvalidState
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("client_id", p.cfg.ClientID)
+	form.Set("code_verifier", login.Verifier)
+	if p.cfg.ClientSecret != "" {
+		form.Set("client_secret", p.cfg.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Claims{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return Claims{}, fmt.Errorf("oidc: token exchange: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var token tokenResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&token); err != nil {
+		return Claims{}, fmt.Errorf("oidc: token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || token.Error != "" {
+		return Claims{}, fmt.Errorf("oidc: token exchange failed: %s %s", token.Error, token.ErrorDescription)
+	}
+
+	return p.Verify(ctx, token.IDToken, login.Nonce)
+}
+
+// Verify validates an ID token signature, issuer, audience, expiry and nonce.
+func (p *Provider) Verify(ctx context.Context, rawIDToken, nonce string) (Claims, error) {
+	payload, err := p.keys.verify(ctx, rawIDToken)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	var claims struct {
+		Issuer        string          `json:"iss"`
+		Subject       string          `json:"sub"`
+		Audience      audience        `json:"aud"`
+		Expiry        int64           `json:"exp"`
+		IssuedAt      int64           `json:"iat"`
+		Nonce         string          `json:"nonce"`
+		Email         string          `json:"email"`
+		EmailVerified json.RawMessage `json:"email_verified"`
+		Name          string          `json:"name"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return Claims{}, fmt.Errorf("%w: malformed claims", ErrInvalidToken)
+	}
+
+	now := p.cfg.Now()
+	switch {
+	case claims.Issuer != p.meta.Issuer:
+		return Claims{}, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, claims.Issuer)
+	case !claims.Audience.contains(p.cfg.ClientID):
+		return Claims{}, fmt.Errorf("%w: unexpected audience", ErrInvalidToken)
+	case claims.Expiry == 0 || now.After(time.Unix(claims.Expiry, 0).Add(clockLeeway)):
+		return Claims{}, fmt.Errorf("%w: token expired", ErrInvalidToken)
+	case claims.IssuedAt != 0 && time.Unix(claims.IssuedAt, 0).After(now.Add(clockLeeway)):
+		return Claims{}, fmt.Errorf("%w: token issued in the future", ErrInvalidToken)
+	case nonce != "" && claims.Nonce != nonce:
+		return Claims{}, fmt.Errorf("%w: nonce mismatch", ErrInvalidToken)
+	case claims.Subject == "":
+		return Claims{}, fmt.Errorf("%w: missing subject", ErrInvalidToken)
+	}
+
+	verified, err := parseBool(claims.EmailVerified)
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: malformed email_verified", ErrInvalidToken)
+	}
+	if claims.Email == "" || !verified {
+		return Claims{}, ErrEmailNotVerified
+	}
+
+	return Claims{
+		Issuer:        claims.Issuer,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: verified,
+		Name:          claims.Name,
+	}, nil
+}
+
+// parseBool accepts booleans and the "true"/"false" strings some providers send.
+func parseBool(raw json.RawMessage) (bool, error) {
+	if len(raw) == 0 {
+		return false, nil
+	}
+	var b bool
+	if err := json.Unmarshal(raw, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return false, err
+	}
+	return s == "true", nil
+}
+
+// audience decodes the aud claim, which may be a string or an array.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+func (a audience) contains(value string) bool {
+	for _, v := range a {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
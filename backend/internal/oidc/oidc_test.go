@@ -0,0 +1,145 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/oidc"
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/oidc/oidctest"
+)
+
+const redirectURL = "http://app.local/auth/oidc/callback"
+
+func newProvider(t *testing.T) (*oidctest.Provider, *oidc.Provider) {
+	t.Helper()
+
+	idp, err := oidctest.NewProvider("todo-app", "s3cret")
+	if err != nil {
+		t.Fatalf("start provider: %v", err)
+	}
+	t.Cleanup(idp.Close)
+
+	rp, err := oidc.NewProvider(context.Background(), oidc.Config{
+		IssuerURL:    idp.Issuer(),
+		ClientID:     "todo-app",
+		ClientSecret: "s3cret",
+		RedirectURL:  redirectURL,
+	})
+	if err != nil {
+		t.Fatalf("discovery failed: %v", err)
+	}
+	return idp, rp
+}
+
+// authorize follows the provider redirect and returns the callback parameters.
+func authorize(t *testing.T, authURL string) (code, state string) {
+	t.Helper()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("authorize request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("expected redirect from authorize, got %d", resp.StatusCode)
+	}
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("bad redirect: %v", err)
+	}
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+// TestAuthorizationCodeFlowWithPKCE runs the full flow against the mock provider.
+func TestAuthorizationCodeFlowWithPKCE(t *testing.T) {
+	idp, rp := newProvider(t)
+	idp.SetIdentity(oidctest.Identity{Subject: "42", Email: "Alice@Example.com", EmailVerified: true})
+
+	authURL, _, err := rp.AuthCodeURL(context.Background())
+	if err != nil {
+		t.Fatalf("auth url: %v", err)
+	}
+	parsed, _ := url.Parse(authURL)
+	if parsed.Query().Get("code_challenge_method") != "S256" || parsed.Query().Get("code_challenge") == "" {
+		t.Fatalf("expected PKCE parameters in %s", authURL)
+	}
+
+	code, state := authorize(t, authURL)
+	claims, err := rp.Exchange(context.Background(), code, state)
+	if err != nil {
+		t.Fatalf("exchange failed: %v", err)
+	}
+	if claims.Email != "Alice@Example.com" || claims.Subject != "42" || claims.Issuer != idp.Issuer() {
+		t.Fatalf("unexpected claims: %+v", claims)
+	}
+
+	if _, err := rp.Exchange(context.Background(), code, state); !errors.Is(err, oidc.ErrInvalidState) {
+		t.Fatalf("expected reused state to fail, got %v", err)
+	}
+}
+
+// TestExchangeRejectsInvalidTokens covers the ID-token validation rules.
+func TestExchangeRejectsInvalidTokens(t *testing.T) {
+	cases := map[string]struct {
+		tamper func(map[string]any)
+		want   error
+	}{
+		"wrong audience": {func(c map[string]any) { c["aud"] = "other-client" }, oidc.ErrInvalidToken},
+		"wrong issuer":   {func(c map[string]any) { c["iss"] = "https://evil.example.com" }, oidc.ErrInvalidToken},
+		"expired":        {func(c map[string]any) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, oidc.ErrInvalidToken},
+		"nonce mismatch": {func(c map[string]any) { c["nonce"] = "replayed" }, oidc.ErrInvalidToken},
+		"unverified":     {func(c map[string]any) { c["email_verified"] = false }, oidc.ErrEmailNotVerified},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			idp, rp := newProvider(t)
+			idp.Tamper(tc.tamper)
+
+			authURL, _, _ := rp.AuthCodeURL(context.Background())
+			code, state := authorize(t, authURL)
+			if _, err := rp.Exchange(context.Background(), code, state); !errors.Is(err, tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+// TestVerifyRejectsForeignSignature ensures tokens signed by another key fail.
+func TestVerifyRejectsForeignSignature(t *testing.T) {
+	_, rp := newProvider(t)
+	other, err := oidctest.NewProvider("todo-app", "s3cret")
+	if err != nil {
+		t.Fatalf("start provider: %v", err)
+	}
+	defer other.Close()
+
+	token, err := other.SignIDToken(map[string]any{
+		"iss": "irrelevant",
+		"sub": "1",
+		"aud": "todo-app",
+		"exp": time.Now().Add(time.Minute).Unix(),
+	})
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if _, err := rp.Verify(context.Background(), token, ""); !errors.Is(err, oidc.ErrInvalidToken) {
+		t.Fatalf("expected ErrInvalidToken, got %v", err)
+	}
+}
+
+// TestExchangeRejectsUnknownState ensures callbacks must match a started login.
+func TestExchangeRejectsUnknownState(t *testing.T) {
+	_, rp := newProvider(t)
+	if _, err := rp.Exchange(context.Background(), "code", "forged"); !errors.Is(err, oidc.ErrInvalidState) {
+		t.Fatalf("expected ErrInvalidState, got %v", err)
+	}
+}
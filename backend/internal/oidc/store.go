@@ -0,0 +1,120 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// PendingLogin is a login sent to the provider and not completed yet. It is
+// stored under a hash of its state, so the store never holds the value the
+// browser presents.
+type PendingLogin struct {
+	StateHash string    `bson:"_id"`
+	Nonce     string    `bson:"nonce"`
+	Verifier  string    `bson:"verifier"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
+
+// StateStore keeps pending logins, so that the callback can be served by
+// another replica than the one that started the login.
+type StateStore interface {
+	Save(ctx context.Context, login PendingLogin) error
+	// Take removes and returns the login stored under stateHash, or returns
+	// ErrInvalidState when it is unknown or expired.
+	Take(ctx context.Context, stateHash string) (PendingLogin, error)
+}
+
+// hashState derives the key a login is stored under from its state.
+func hashState(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(sum[:])
+}
+
+// MemoryStateStore keeps pending logins in process memory, which suits a
+// single replica.
+type MemoryStateStore struct {
+	mu      sync.Mutex
+	pending map[string]PendingLogin
+	now     func() time.Time
+}
+
+// NewMemoryStateStore creates an empty in-memory state store.
+func NewMemoryStateStore(now func() time.Time) *MemoryStateStore {
+	if now == nil {
+		now = time.Now
+	}
+	return &MemoryStateStore{pending: make(map[string]PendingLogin), now: now}
+}
+
+// Save stores a login, dropping the expired ones.
+func (m *MemoryStateStore) Save(_ context.Context, login PendingLogin) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	for key, pending := range m.pending {
+		if now.After(pending.ExpiresAt) {
+			delete(m.pending, key)
+		}
+	}
+	m.pending[login.StateHash] = login
+	return nil
+}
+
+// Take removes and returns a non-expired login.
+func (m *MemoryStateStore) Take(_ context.Context, stateHash string) (PendingLogin, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	login, ok := m.pending[stateHash]
+	if !ok {
+		return PendingLogin{}, ErrInvalidState
+	}
+	delete(m.pending, stateHash)
+	if m.now().After(login.ExpiresAt) {
+		return PendingLogin{}, ErrInvalidState
+	}
+	return login, nil
+}
+
+// MongoStateStore persists pending logins in MongoDB. The collection needs a
+// TTL index on expiresAt to drop logins that were never completed.
+type MongoStateStore struct {
+	collection *mongo.Collection
+	now        func() time.Time
+}
+
+// NewMongoStateStore creates a new store wrapper around a Mongo collection.
+func NewMongoStateStore(collection *mongo.Collection, now func() time.Time) *MongoStateStore {
+	if now == nil {
+		now = time.Now
+	}
+	return &MongoStateStore{collection: collection, now: now}
+}
+
+// Save stores a login.
+func (m *MongoStateStore) Save(ctx context.Context, login PendingLogin) error {
+	_, err := m.collection.InsertOne(ctx, login)
+	return err
+}
+
+// Take removes and returns a non-expired login. The delete is atomic, so a
+// state can only be redeemed once across replicas.
+func (m *MongoStateStore) Take(ctx context.Context, stateHash string) (PendingLogin, error) {
+	var login PendingLogin
+	err := m.collection.FindOneAndDelete(ctx, bson.M{
+		"_id":       stateHash,
+		"expiresAt": bson.M{"$gt": m.now()},
+	}).Decode(&login)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return PendingLogin{}, ErrInvalidState
+	}
+	return login, err
+}
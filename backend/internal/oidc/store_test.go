@@ -0,0 +1,106 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/oidc"
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/oidc/oidctest"
+)
+
+// TestMemoryStateStore ensures logins are taken once and expire.
+func TestMemoryStateStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	store := oidc.NewMemoryStateStore(func() time.Time { return now })
+
+	_ = store.Save(ctx, oidc.PendingLogin{StateHash: "a", Nonce: "n", ExpiresAt: now.Add(time.Minute)})
+	_ = store.Save(ctx, oidc.PendingLogin{StateHash: "b", ExpiresAt: now.Add(time.Minute)})
+	if login, err := store.Take(ctx, "a"); err != nil || login.Nonce != "n" {
+		t.Fatalf("expected the login, got %+v %v", login, err)
+	}
+	if _, err := store.Take(ctx, "a"); !errors.Is(err, oidc.ErrInvalidState) {
+		t.Fatalf("expected a taken login to be gone, got %v", err)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, err := store.Take(ctx, "b"); !errors.Is(err, oidc.ErrInvalidState) {
+		t.Fatalf("expected an expired login to fail, got %v", err)
+	}
+}
+
+// TestLoginCompletesOnAnotherProvider ensures a login started by one replica
+// can be completed by another sharing the store.
+func TestLoginCompletesOnAnotherProvider(t *testing.T) {
+	idp, err := oidctest.NewProvider("todo-app", "s3cret")
+	if err != nil {
+		t.Fatalf("start provider: %v", err)
+	}
+	defer idp.Close()
+	idp.SetIdentity(oidctest.Identity{Subject: "42", Email: "alice@example.com", EmailVerified: true})
+
+	store := oidc.NewMemoryStateStore(nil)
+	replica := func() *oidc.Provider {
+		rp, err := oidc.NewProvider(context.Background(), oidc.Config{
+			IssuerURL:    idp.Issuer(),
+			ClientID:     "todo-app",
+			ClientSecret: "s3cret",
+			RedirectURL:  redirectURL,
+			Store:        store,
+		})
+		if err != nil {
+			t.Fatalf("discovery failed: %v", err)
+		}
+		return rp
+	}
+
+	authURL, _, err := replica().AuthCodeURL(context.Background())
+	if err != nil {
+		t.Fatalf("auth url: %v", err)
+	}
+	code, state := authorize(t, authURL)
+	if _, err := replica().Exchange(context.Background(), code, state); err != nil {
+		t.Fatalf("exchange failed: %v", err)
+	}
+}
+
+// TestMongoStateStore covers the Mongo-backed store with mock responses.
+func TestMongoStateStore(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock).CreateCollection(false))
+
+	mt.Run("take pending login", func(mt *mtest.T) {
+		store := oidc.NewMongoStateStore(mt.Coll, nil)
+		doc := bson.D{
+			{Key: "_id", Value: "hash"},
+			{Key: "nonce", Value: "n"},
+			{Key: "verifier", Value: "v"},
+			{Key: "expiresAt", Value: time.Now().Add(time.Minute)},
+		}
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: doc}),
+		)
+
+		if err := store.Save(context.Background(), oidc.PendingLogin{StateHash: "hash"}); err != nil {
+			mt.Fatalf("save failed: %v", err)
+		}
+		login, err := store.Take(context.Background(), "hash")
+		if err != nil || login.Verifier != "v" {
+			mt.Fatalf("expected the login, got %+v %v", login, err)
+		}
+	})
+
+	mt.Run("unknown state", func(mt *mtest.T) {
+		store := oidc.NewMongoStateStore(mt.Coll, nil)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}))
+
+		if _, err := store.Take(context.Background(), "hash"); !errors.Is(err, oidc.ErrInvalidState) {
+			mt.Fatalf("expected ErrInvalidState, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,82 @@
+package openapi
+
+import (
+	"testing"
+	"time"
+)
+
+type base struct {
+	ID string `json:"id"`
+}
+
+type custom struct {
+	Set bool
+}
+
+func (custom) OpenAPISchema() *Schema {
+	return &Schema{Type: "string", Format: "date"}
+}
+
+type sample struct {
+	base
+	Custom  custom     `json:"custom"`
+	Title   string     `json:"title" binding:"required,min=1,max=20"`
+	Email   string     `json:"email" binding:"email"`
+	DueAt   *time.Time `json:"dueAt,omitempty"`
+	Tags    []string   `json:"tags"`
+	Next    *sample    `json:"next,omitempty"`
+	Ignored string     `json:"-"`
+	private string
+}
+
+func TestSchemaFromStruct(t *testing.T) {
+	b := New("test", "v1")
+
+	ref := b.Schema(sample{})
+	if ref.Ref != "#/components/schemas/Sample" {
+		t.Fatalf("expected a component reference, got %+v", ref)
+	}
+
+	s := b.Document().Components.Schemas["Sample"]
+	for _, name := range []string{"id", "title", "email", "dueAt", "tags", "next", "custom"} {
+		if _, ok := s.Properties[name]; !ok {
+			t.Errorf("missing property %q", name)
+		}
+	}
+	if len(s.Properties) != 7 {
+		t.Errorf("expected ignored and private fields to be skipped, got %d properties", len(s.Properties))
+	}
+	if len(s.Required) != 1 || s.Required[0] != "title" {
+		t.Errorf("unexpected required fields %v", s.Required)
+	}
+	if title := s.Properties["title"]; *title.MinLength != 1 || *title.MaxLength != 20 {
+		t.Errorf("unexpected title limits %+v", title)
+	}
+	if s.Properties["email"].Format != "email" {
+		t.Errorf("expected email format")
+	}
+	if due := s.Properties["dueAt"]; due.Format != "date-time" || !due.Nullable {
+		t.Errorf("unexpected dueAt schema %+v", due)
+	}
+	if s.Properties["custom"].Format != "date" {
+		t.Errorf("expected the schema of a Schemer, got %+v", s.Properties["custom"])
+	}
+	if s.Properties["tags"].Items.Type != "string" {
+		t.Errorf("unexpected tags schema %+v", s.Properties["tags"])
+	}
+	if s.Properties["next"].Ref != ref.Ref {
+		t.Errorf("expected recursive reference, got %+v", s.Properties["next"])
+	}
+}
+
+func TestPathFromGin(t *testing.T) {
+	for in, want := range map[string]string{
+		"/todos":           "/todos",
+		"/todos/:id":       "/todos/{id}",
+		"/files/*filepath": "/files/{filepath}",
+	} {
+		if got := PathFromGin(in); got != want {
+			t.Errorf("PathFromGin(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// Package server runs the HTTP server and shuts it down gracefully.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Closer releases resources once the HTTP server has drained, such as
+// background workers and the database client.
+type Closer interface {
+	Close(ctx context.Context) error
+}
+
+// Run listens on addr and serves handler until ctx is cancelled; see Serve.
+// resources is closed as well when addr cannot be listened on.
+func Run(ctx context.Context, addr string, handler http.Handler, drainTimeout time.Duration, resources Closer) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		if resources != nil {
+			_ = resources.Close(context.Background())
+		}
+		return err
+	}
+	return Serve(ctx, &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}, ln, drainTimeout, resources)
+}
+
+// Serve serves srv on ln until ctx is cancelled and then shuts down in order:
+// it stops accepting connections, waits up to drainTimeout for in-flight
+// requests, and only then closes resources. Requests still running when the
+// timeout expires are cut off. resources is closed even when serving fails.
+func Serve(ctx context.Context, srv *http.Server, ln net.Listener, drainTimeout time.Duration, resources Closer) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Serve(ln)
+	}()
+
+	var err error
+	select {
+	case err = <-serveErr:
+		// The server failed on its own; there is nothing left to drain.
+	case <-ctx.Done():
+		slog.Info("shutting down, draining in-flight requests", slog.Duration("timeout", drainTimeout))
+		err = shutdown(srv, drainTimeout)
+		if serr := <-serveErr; !errors.Is(serr, http.ErrServerClosed) && err == nil {
+			err = serr
+		}
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		err = nil
+	}
+
+	if resources != nil {
+		closeCtx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+		defer cancel()
+		if cerr := resources.Close(closeCtx); cerr != nil {
+			err = errors.Join(err, fmt.Errorf("closing resources: %w", cerr))
+		}
+	}
+	return err
+}
+
+func shutdown(srv *http.Server, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		// Drain timed out: drop the remaining connections.
+		_ = srv.Close()
+		return fmt.Errorf("draining connections: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder is a Closer that remembers when it was closed.
+type recorder struct {
+	mu     sync.Mutex
+	closed time.Time
+}
+
+func (r *recorder) Close(context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = time.Now()
+	return nil
+}
+
+func (r *recorder) closedAt() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.closed
+}
+
+func listen(t *testing.T) net.Listener {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	return ln
+}
+
+func TestServeDrainsSlowRequestBeforeClosingResources(t *testing.T) {
+	started := make(chan struct{})
+	var finished time.Time
+	handler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		finished = time.Now()
+		_, _ = io.WriteString(w, "done")
+	})
+
+	ln := listen(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	resources := &recorder{}
+	served := make(chan error, 1)
+	go func() {
+		served <- Serve(ctx, &http.Server{Handler: handler}, ln, 5*time.Second, resources)
+	}()
+
+	type result struct {
+		body string
+		err  error
+	}
+	responses := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			responses <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		responses <- result{body: string(body), err: err}
+	}()
+
+	<-started
+	cancel()
+
+	res := <-responses
+	if res.err != nil || res.body != "done" {
+		t.Fatalf("expected slow request to complete, got %q (%v)", res.body, res.err)
+	}
+	if err := <-served; err != nil {
+		t.Fatalf("serve: %v", err)
+	}
+	if closed := resources.closedAt(); closed.IsZero() || closed.Before(finished) {
+		t.Fatalf("expected resources to be closed after the request finished")
+	}
+
+	if _, err := http.Get("http://" + ln.Addr().String()); err == nil {
+		t.Fatalf("expected new connections to be refused after shutdown")
+	}
+}
+
+func TestServeCutsOffRequestsPastDrainTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		close(started)
+		<-release
+	})
+
+	ln := listen(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	resources := &recorder{}
+	served := make(chan error, 1)
+	go func() {
+		served <- Serve(ctx, &http.Server{Handler: handler}, ln, 50*time.Millisecond, resources)
+	}()
+	go func() {
+		if resp, err := http.Get("http://" + ln.Addr().String()); err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	<-started
+	cancel()
+
+	select {
+	case err := <-served:
+		if err == nil {
+			t.Fatalf("expected a drain timeout error")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("serve did not return after the drain timeout")
+	}
+	if resources.closedAt().IsZero() {
+		t.Fatalf("expected resources to be closed even after a drain timeout")
+	}
+}
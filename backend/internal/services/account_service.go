@@ -0,0 +1,150 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/logging"
+)
+
+// AccountService handles self-service operations spanning users and todos.
+type AccountService struct {
+	users    UserRepository
+	todos    TodoRepository
+	sessions *SessionService
+	grace    time.Duration
+	now      func() time.Time
+}
+
+// NewAccountService builds an AccountService. With a zero grace period
+// accounts are deleted immediately; otherwise deletion is scheduled and the
+// account can be restored by logging in before it is purged.
+func NewAccountService(users UserRepository, todos TodoRepository, sessions *SessionService, grace time.Duration, now func() time.Time) *AccountService {
+	if now == nil {
+		now = time.Now
+	}
+	if sessions == nil {
+		sessions = NewSessionService(nil, 0, now)
+	}
+	return &AccountService{users: users, todos: todos, sessions: sessions, grace: grace, now: now}
+}
+
+// Delete removes the account of email together with its todos, or schedules
+// the removal when a grace period is configured. It returns the time at which
+// the account will be purged, or the zero time if it was deleted right away.
+func (s *AccountService) Delete(ctx context.Context, email string) (time.Time, error) {
+	email = NormalizeEmail(email)
+	if email == "" {
+		return time.Time{}, ErrInvalidUserInput
+	}
+
+	if _, err := s.users.FindByEmail(ctx, email); err != nil {
+		return time.Time{}, err
+	}
+	if err := s.sessions.RevokeAll(ctx, email); err != nil {
+		return time.Time{}, err
+	}
+
+	if s.grace <= 0 {
+		return time.Time{}, s.purge(ctx, email)
+	}
+
+	deleteAfter := s.now().Add(s.grace)
+	if err := s.users.ScheduleDeletion(ctx, email, deleteAfter); err != nil {
+		return time.Time{}, err
+	}
+	logging.FromContext(ctx).Info("account deletion scheduled",
+		slog.String("email", email),
+		slog.Time("delete_after", deleteAfter),
+	)
+	return deleteAfter, nil
+}
+
+// purge cascades the deletion of a user to its todos. The email is never
+// empty here, since TodoRepository.Clear treats an empty email as "all todos".
+func (s *AccountService) purge(ctx context.Context, email string) error {
+	if email == "" {
+		return ErrInvalidUserInput
+	}
+	if err := s.todos.Clear(ctx, email); err != nil {
+		return err
+	}
+	if err := s.users.Delete(ctx, email); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	logging.FromContext(ctx).Info("account deleted", slog.String("email", email))
+	return nil
+}
+
+// PurgeDue deletes every account whose grace period has elapsed and returns
+// how many were removed.
+func (s *AccountService) PurgeDue(ctx context.Context) (int, error) {
+	due, err := s.users.ListDueForDeletion(ctx, s.now())
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, user := range due {
+		if err := s.purge(ctx, user.Email); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// Export writes a ZIP archive with the profile and todos of email to w. The
+// archive contains profile.json, todos.json and todos.csv. Data is loaded
+// before anything is written so that lookup errors can still be reported.
+func (s *AccountService) Export(ctx context.Context, email string, w io.Writer) error {
+	email = NormalizeEmail(email)
+	if email == "" {
+		return ErrInvalidUserInput
+	}
+
+	user, err := s.users.FindByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	todos, err := s.todos.List(ctx, email)
+	if err != nil {
+		return err
+	}
+
+	responses := make([]TodoResponse, 0, len(todos))
+	for _, todo := range todos {
+		responses = append(responses, todo.ToResponse())
+	}
+
+	archive := zip.NewWriter(w)
+	if err := writeZipJSON(archive, "profile.json", user.ToPublic()); err != nil {
+		return err
+	}
+	if err := writeZipJSON(archive, "todos.json", responses); err != nil {
+		return err
+	}
+	f, err := archive.Create("todos.csv")
+	if err != nil {
+		return err
+	}
+	if err := writeTodosCSV(f, responses, exportOptions{}); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+func writeZipJSON(archive *zip.Writer, name string, value any) error {
+	f, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(value)
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func readZipFile(t *testing.T, archive *zip.Reader, name string) []byte {
+	t.Helper()
+
+	f, err := archive.Open(name)
+	if err != nil {
+		t.Fatalf("open %s: %v", name, err)
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatalf("read %s: %v", name, err)
+	}
+	return data
+}
+
+// TestAccountServiceDeleteCascadesToTodos ensures only the owner's data is removed.
+func TestAccountServiceDeleteCascadesToTodos(t *testing.T) {
+	ctx := context.Background()
+	users := NewMemoryUserRepository()
+	todos := NewMemoryTodoRepository()
+	sessions := NewSessionService(nil, 0, fixedNow)
+	accounts := NewAccountService(users, todos, sessions, 0, fixedNow)
+
+	_ = users.Insert(ctx, User{Email: "alice@example.com", Password: "a"})
+	_ = users.Insert(ctx, User{Email: "bob@example.com", Password: "b"})
+	_, _ = todos.Create(ctx, Todo{Email: "alice@example.com", Title: "A"})
+	_, _ = todos.Create(ctx, Todo{Email: "bob@example.com", Title: "B"})
+	token, _, _ := sessions.Create(ctx, "alice@example.com")
+
+	deleteAfter, err := accounts.Delete(ctx, "Alice@Example.com")
+	if err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if !deleteAfter.IsZero() {
+		t.Fatalf("expected immediate deletion, got %v", deleteAfter)
+	}
+
+	if _, err := users.FindByEmail(ctx, "alice@example.com"); err != ErrNotFound {
+		t.Fatalf("expected alice to be deleted, got %v", err)
+	}
+	if remaining, _ := todos.List(ctx, ""); len(remaining) != 1 || remaining[0].Email != "bob@example.com" {
+		t.Fatalf("expected only bob's todo to remain, got %+v", remaining)
+	}
+	if _, err := sessions.Resolve(ctx, token); err != ErrInvalidSession {
+		t.Fatalf("expected sessions to be revoked, got %v", err)
+	}
+
+	if _, err := accounts.Delete(ctx, ""); err != ErrInvalidUserInput {
+		t.Fatalf("expected ErrInvalidUserInput for empty email, got %v", err)
+	}
+	if _, err := accounts.Delete(ctx, "alice@example.com"); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound for deleted user, got %v", err)
+	}
+}
+
+// TestAccountServiceGracePeriod verifies scheduling, restore on login and purge.
+func TestAccountServiceGracePeriod(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: fixedNow()}
+	users := NewMemoryUserRepository()
+	todos := NewMemoryTodoRepository()
+	accounts := NewAccountService(users, todos, nil, 48*time.Hour, clock.Now)
+	userService := NewUserService(users)
+
+	_ = users.Insert(ctx, User{Email: "alice@example.com", Password: "secret"})
+	_, _ = todos.Create(ctx, Todo{Email: "alice@example.com", Title: "A"})
+
+	deleteAfter, err := accounts.Delete(ctx, "alice@example.com")
+	if err != nil || !deleteAfter.Equal(clock.now.Add(48*time.Hour)) {
+		t.Fatalf("expected scheduled deletion, got %v %v", deleteAfter, err)
+	}
+
+	if n, _ := accounts.PurgeDue(ctx); n != 0 {
+		t.Fatalf("expected nothing to purge yet, got %d", n)
+	}
+
+	if err := userService.Login(ctx, "alice@example.com", "secret"); err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	clock.Advance(72 * time.Hour)
+	if n, _ := accounts.PurgeDue(ctx); n != 0 {
+		t.Fatalf("expected login to cancel the deletion, got %d purged", n)
+	}
+
+	_, _ = accounts.Delete(ctx, "alice@example.com")
+	clock.Advance(48 * time.Hour)
+	n, err := accounts.PurgeDue(ctx)
+	if err != nil || n != 1 {
+		t.Fatalf("expected one purged account, got %d %v", n, err)
+	}
+	if remaining, _ := todos.List(ctx, "alice@example.com"); len(remaining) != 0 {
+		t.Fatalf("expected todos to be purged, got %+v", remaining)
+	}
+}
+
+// TestAccountServiceGracePeriodNeedsSecondFactor ensures the password alone
+// does not cancel the deletion of an account protected by two-factor
+// authentication.
+func TestAccountServiceGracePeriodNeedsSecondFactor(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: fixedNow()}
+	users := NewMemoryUserRepository()
+	accounts := NewAccountService(users, NewMemoryTodoRepository(), nil, 48*time.Hour, clock.Now)
+	userService := NewUserService(users, WithUserClock(clock.Now))
+
+	_ = userService.Register(ctx, User{Email: "admin@example.com", Password: "secret"})
+	_, recovery := enrollAndConfirm(t, userService, clock)
+	_, _ = accounts.Delete(ctx, "admin@example.com")
+
+	var required *TwoFactorRequiredError
+	if err := userService.Login(ctx, "admin@example.com", "secret"); !errors.As(err, &required) {
+		t.Fatalf("expected a challenge, got %v", err)
+	}
+	if user, _ := users.FindByEmail(ctx, "admin@example.com"); user.DeleteAfter.IsZero() {
+		t.Fatal("expected the deletion to stay scheduled until the second factor")
+	}
+
+	if _, err := userService.CompleteTwoFactor(ctx, required.Challenge, recovery[0]); err != nil {
+		t.Fatalf("complete failed: %v", err)
+	}
+	if user, _ := users.FindByEmail(ctx, "admin@example.com"); !user.DeleteAfter.IsZero() {
+		t.Fatalf("expected the completed login to cancel the deletion, got %v", user.DeleteAfter)
+	}
+}
+
+// TestAccountServiceExportWritesZip checks the archive layout and contents.
+func TestAccountServiceExportWritesZip(t *testing.T) {
+	ctx := context.Background()
+	users := NewMemoryUserRepository()
+	todos := NewMemoryTodoRepository()
+	accounts := NewAccountService(users, todos, nil, 0, fixedNow)
+
+	_ = users.Insert(ctx, User{Email: "alice@example.com", Password: "secret"})
+	_, _ = todos.Create(ctx, Todo{Email: "alice@example.com", Title: "Comprar, pan", CreatedAt: fixedNow()})
+	_, _ = todos.Create(ctx, Todo{Email: "bob@example.com", Title: "Ajena", CreatedAt: fixedNow()})
+
+	var buf bytes.Buffer
+	if err := accounts.Export(ctx, "alice@example.com", &buf); err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("invalid zip: %v", err)
+	}
+
+	profile := readZipFile(t, archive, "profile.json")
+	if bytes.Contains(profile, []byte("secret")) {
+		t.Fatalf("profile must not contain the password: %s", profile)
+	}
+
+	var exported []TodoResponse
+	if err := json.Unmarshal(readZipFile(t, archive, "todos.json"), &exported); err != nil {
+		t.Fatalf("todos.json: %v", err)
+	}
+	if len(exported) != 1 || exported[0].Title != "Comprar, pan" {
+		t.Fatalf("unexpected exported todos: %+v", exported)
+	}
+
+	records, err := csv.NewReader(bytes.NewReader(readZipFile(t, archive, "todos.csv"))).ReadAll()
+	if err != nil {
+		t.Fatalf("todos.csv: %v", err)
+	}
+	if len(records) != 2 || records[1][1] != "Comprar, pan" || records[1][2] != "false" {
+		t.Fatalf("unexpected csv: %v", records)
+	}
+
+	if err := accounts.Export(ctx, "missing@example.com", io.Discard); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,419 @@
+package services
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Bolt buckets. Documents are stored BSON-encoded, like in MongoDB.
+var (
+	boltUsersBucket = []byte("users")
+	boltTodosBucket = []byte("todos")
+	// boltTodosByEmailBucket holds one nested bucket per email whose keys
+	// are createdAt+ID, so per-user listing is an ordered prefix-free scan.
+	boltTodosByEmailBucket = []byte("todos_by_email")
+)
+
+// OpenBolt opens or creates the embedded database file at path and its
+// buckets.
+func OpenBolt(path string) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltUsersBucket, boltTodosBucket, boltTodosByEmailBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// BoltUserRepository implements UserRepository on an embedded bbolt file,
+// for single-binary deployments without MongoDB.
+type BoltUserRepository struct {
+	db *bolt.DB
+}
+
+// NewBoltUserRepository creates a repository on a database opened with OpenBolt.
+func NewBoltUserRepository(db *bolt.DB) *BoltUserRepository {
+	return &BoltUserRepository{db: db}
+}
+
+// FindByEmail retrieves a user by email or returns ErrNotFound.
+func (b *BoltUserRepository) FindByEmail(_ context.Context, email string) (User, error) {
+	var user User
+	err := b.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(boltUsersBucket).Get([]byte(email))
+		if data == nil {
+			return ErrNotFound
+		}
+		return bson.Unmarshal(data, &user)
+	})
+	return user, err
+}
+
+// Insert stores user, or returns ErrUserAlreadyExists if the email is taken.
+func (b *BoltUserRepository) Insert(_ context.Context, user User) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltUsersBucket)
+		if bucket.Get([]byte(user.Email)) != nil {
+			return ErrUserAlreadyExists
+		}
+		return putBSON(bucket, []byte(user.Email), user)
+	})
+}
+
+// List returns every user sorted by email.
+func (b *BoltUserRepository) List(_ context.Context) ([]User, error) {
+	return b.filter(func(User) bool { return true })
+}
+
+// Clear removes every user.
+func (b *BoltUserRepository) Clear(_ context.Context) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return recreateBucket(tx, boltUsersBucket)
+	})
+}
+
+// UpdateTwoFactor replaces the second-factor state of a user.
+func (b *BoltUserRepository) UpdateTwoFactor(_ context.Context, email string, twoFactor TwoFactor) error {
+	return b.update(email, func(user *User) {
+		user.TwoFactor = twoFactor
+	})
+}
+
+// SwapTwoFactor replaces the second-factor state of a user if it still
+// matches old; see UserRepository.
+func (b *BoltUserRepository) SwapTwoFactor(_ context.Context, email string, old, twoFactor TwoFactor) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltUsersBucket)
+		data := bucket.Get([]byte(email))
+		if data == nil {
+			return ErrNotFound
+		}
+		var user User
+		if err := bson.Unmarshal(data, &user); err != nil {
+			return err
+		}
+		if !user.TwoFactor.sameUse(old) {
+			return ErrNotFound
+		}
+		user.TwoFactor = twoFactor
+		return putBSON(bucket, []byte(email), user)
+	})
+}
+
+// UpdateProfile replaces the profile fields and preferences of a user.
+func (b *BoltUserRepository) UpdateProfile(_ context.Context, email string, profile Profile) error {
+	return b.update(email, func(user *User) {
+		user.applyProfile(profile)
+	})
+}
+
+// UpdatePassword replaces the password of a user.
+func (b *BoltUserRepository) UpdatePassword(_ context.Context, email, password string) error {
+	return b.update(email, func(user *User) {
+		user.Password = password
+	})
+}
+
+// SetDisabled blocks or unblocks logins of a user.
+func (b *BoltUserRepository) SetDisabled(_ context.Context, email string, disabled bool) error {
+	return b.update(email, func(user *User) {
+		user.Disabled = disabled
+	})
+}
+
+// SetCalendarToken stores the calendar token hash of a user.
+func (b *BoltUserRepository) SetCalendarToken(_ context.Context, email, hash string) error {
+	return b.update(email, func(user *User) {
+		user.CalendarToken = hash
+	})
+}
+
+// FindByCalendarToken retrieves the user with the calendar token hash or
+// returns ErrNotFound. It scans every user, which suits the small
+// deployments the embedded driver is for.
+func (b *BoltUserRepository) FindByCalendarToken(_ context.Context, hash string) (User, error) {
+	users, err := b.filter(func(user User) bool { return hash != "" && user.CalendarToken == hash })
+	if err != nil {
+		return User{}, err
+	}
+	if len(users) == 0 {
+		return User{}, ErrNotFound
+	}
+	return users[0], nil
+}
+
+// Delete removes a user by email.
+func (b *BoltUserRepository) Delete(_ context.Context, email string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltUsersBucket)
+		if bucket.Get([]byte(email)) == nil {
+			return ErrNotFound
+		}
+		return bucket.Delete([]byte(email))
+	})
+}
+
+// ScheduleDeletion marks a user for deletion at the given time. A zero time
+// cancels a pending deletion.
+func (b *BoltUserRepository) ScheduleDeletion(_ context.Context, email string, at time.Time) error {
+	return b.update(email, func(user *User) {
+		user.DeleteAfter = at
+	})
+}
+
+// ListDueForDeletion returns users whose scheduled deletion time is not after before.
+func (b *BoltUserRepository) ListDueForDeletion(_ context.Context, before time.Time) ([]User, error) {
+	return b.filter(func(user User) bool { return user.dueForDeletion(before) })
+}
+
+// filter returns the users matching keep; keys are emails, so the result is
+// sorted by email.
+func (b *BoltUserRepository) filter(keep func(User) bool) ([]User, error) {
+	var users []User
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltUsersBucket).ForEach(func(_, data []byte) error {
+			var user User
+			if err := bson.Unmarshal(data, &user); err != nil {
+				return err
+			}
+			if keep(user) {
+				users = append(users, user)
+			}
+			return nil
+		})
+	})
+	return users, err
+}
+
+func (b *BoltUserRepository) update(email string, apply func(*User)) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltUsersBucket)
+		data := bucket.Get([]byte(email))
+		if data == nil {
+			return ErrNotFound
+		}
+		var user User
+		if err := bson.Unmarshal(data, &user); err != nil {
+			return err
+		}
+		apply(&user)
+		return putBSON(bucket, []byte(email), user)
+	})
+}
+
+// BoltTodoRepository implements TodoRepository on an embedded bbolt file.
+type BoltTodoRepository struct {
+	db *bolt.DB
+}
+
+// NewBoltTodoRepository creates a repository on a database opened with OpenBolt.
+func NewBoltTodoRepository(db *bolt.DB) *BoltTodoRepository {
+	return &BoltTodoRepository{db: db}
+}
+
+// List returns todos optionally filtered by email, oldest first.
+func (b *BoltTodoRepository) List(_ context.Context, email string) ([]Todo, error) {
+	var todos []Todo
+	err := b.db.View(func(tx *bolt.Tx) error {
+		records := tx.Bucket(boltTodosBucket)
+		if email == "" {
+			err := records.ForEach(func(_, data []byte) error {
+				var todo Todo
+				if err := bson.Unmarshal(data, &todo); err != nil {
+					return err
+				}
+				todos = append(todos, todo)
+				return nil
+			})
+			sortTodos(todos)
+			return err
+		}
+
+		index := tx.Bucket(boltTodosByEmailBucket).Bucket([]byte(email))
+		if index == nil {
+			return nil
+		}
+		return index.ForEach(func(key, _ []byte) error {
+			var todo Todo
+			if err := bson.Unmarshal(records.Get(todoIDFromIndexKey(key)), &todo); err != nil {
+				return err
+			}
+			todos = append(todos, todo)
+			return nil
+		})
+	})
+	return todos, err
+}
+
+// Create stores todo, assigning an ID when it has none.
+func (b *BoltTodoRepository) Create(_ context.Context, todo Todo) (Todo, error) {
+	if todo.ID.IsZero() {
+		todo.ID = primitive.NewObjectID()
+	}
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		if err := putBSON(tx.Bucket(boltTodosBucket), todo.ID[:], todo); err != nil {
+			return err
+		}
+		index, err := tx.Bucket(boltTodosByEmailBucket).CreateBucketIfNotExists([]byte(todo.Email))
+		if err != nil {
+			return err
+		}
+		return index.Put(todoIndexKey(todo), nil)
+	})
+	if err != nil {
+		return Todo{}, err
+	}
+	return todo, nil
+}
+
+// Update modifies a todo and returns the updated version. Email and
+// createdAt never change, so the index stays valid.
+func (b *BoltTodoRepository) Update(_ context.Context, id primitive.ObjectID, update TodoUpdate) (Todo, error) {
+	var todo Todo
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		records := tx.Bucket(boltTodosBucket)
+		data := records.Get(id[:])
+		if data == nil {
+			return ErrNotFound
+		}
+		if err := bson.Unmarshal(data, &todo); err != nil {
+			return err
+		}
+		todo.apply(update)
+		return putBSON(records, id[:], todo)
+	})
+	if err != nil {
+		return Todo{}, err
+	}
+	return todo, nil
+}
+
+// Delete removes a todo by ID.
+func (b *BoltTodoRepository) Delete(_ context.Context, id primitive.ObjectID) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		records := tx.Bucket(boltTodosBucket)
+		data := records.Get(id[:])
+		if data == nil {
+			return ErrNotFound
+		}
+		var todo Todo
+		if err := bson.Unmarshal(data, &todo); err != nil {
+			return err
+		}
+		if index := tx.Bucket(boltTodosByEmailBucket).Bucket([]byte(todo.Email)); index != nil {
+			if err := index.Delete(todoIndexKey(todo)); err != nil {
+				return err
+			}
+		}
+		return records.Delete(id[:])
+	})
+}
+
+// Clear removes todos optionally filtered by email.
+func (b *BoltTodoRepository) Clear(_ context.Context, email string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		if email == "" {
+			if err := recreateBucket(tx, boltTodosBucket); err != nil {
+				return err
+			}
+			return recreateBucket(tx, boltTodosByEmailBucket)
+		}
+
+		byEmail := tx.Bucket(boltTodosByEmailBucket)
+		index := byEmail.Bucket([]byte(email))
+		if index == nil {
+			return nil
+		}
+		records := tx.Bucket(boltTodosBucket)
+		err := index.ForEach(func(key, _ []byte) error {
+			return records.Delete(todoIDFromIndexKey(key))
+		})
+		if err != nil {
+			return err
+		}
+		return byEmail.DeleteBucket([]byte(email))
+	})
+}
+
+// Count returns the number of todos owned by email.
+func (b *BoltTodoRepository) Count(_ context.Context, email string) (int64, error) {
+	var count int64
+	err := b.db.View(func(tx *bolt.Tx) error {
+		if index := tx.Bucket(boltTodosByEmailBucket).Bucket([]byte(email)); index != nil {
+			count = int64(index.Stats().KeyN)
+		}
+		return nil
+	})
+	return count, err
+}
+
+// TitleBytes returns the total UTF-8 length of the titles of the todos
+// owned by email, decoding only the title of each record.
+func (b *BoltTodoRepository) TitleBytes(_ context.Context, email string) (int64, error) {
+	var total int64
+	err := b.db.View(func(tx *bolt.Tx) error {
+		index := tx.Bucket(boltTodosByEmailBucket).Bucket([]byte(email))
+		if index == nil {
+			return nil
+		}
+		records := tx.Bucket(boltTodosBucket)
+		return index.ForEach(func(key, _ []byte) error {
+			var todo struct {
+				Title string `bson:"title"`
+			}
+			if err := bson.Unmarshal(records.Get(todoIDFromIndexKey(key)), &todo); err != nil {
+				return err
+			}
+			total += int64(len(todo.Title))
+			return nil
+		})
+	})
+	return total, err
+}
+
+// todoIndexKey sorts by createdAt, then ID. It uses milliseconds, the
+// precision BSON keeps, so that the key derived from a stored todo is the one
+// it was indexed under. The sign bit is flipped so that times before 1970
+// sort first.
+func todoIndexKey(todo Todo) []byte {
+	key := make([]byte, 8, 8+len(todo.ID))
+	binary.BigEndian.PutUint64(key, uint64(todo.CreatedAt.UnixMilli())^(1<<63))
+	return append(key, todo.ID[:]...)
+}
+
+func todoIDFromIndexKey(key []byte) []byte {
+	return key[8:]
+}
+
+func putBSON(bucket *bolt.Bucket, key []byte, v any) error {
+	data, err := bson.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(key, data)
+}
+
+func recreateBucket(tx *bolt.Tx, name []byte) error {
+	if err := tx.DeleteBucket(name); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+		return err
+	}
+	_, err := tx.CreateBucket(name)
+	return err
+}
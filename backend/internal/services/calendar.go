@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/logging"
+)
+
+// RotateCalendarToken issues the secret token of the calendar feed of email,
+// replacing the previous one, whose feed URL stops working. Only a hash of
+// the token is stored, so it cannot be shown again later.
+func (s *UserService) RotateCalendarToken(ctx context.Context, email string) (_ string, err error) {
+	ctx, span := startSpan(ctx, "UserService.RotateCalendarToken")
+	defer func() { endSpan(span, err) }()
+
+	email = NormalizeEmail(email)
+	if email == "" {
+		return "", ErrInvalidUserInput
+	}
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	if err := s.repo.SetCalendarToken(ctx, email, hashSessionToken(token)); err != nil {
+		return "", err
+	}
+	logging.FromContext(ctx).Info("calendar token rotated", slog.String("email", email))
+	return token, nil
+}
+
+// RevokeCalendarToken turns the calendar feed of email off.
+func (s *UserService) RevokeCalendarToken(ctx context.Context, email string) (err error) {
+	ctx, span := startSpan(ctx, "UserService.RevokeCalendarToken")
+	defer func() { endSpan(span, err) }()
+
+	email = NormalizeEmail(email)
+	if email == "" {
+		return ErrInvalidUserInput
+	}
+	if err := s.repo.SetCalendarToken(ctx, email, ""); err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Info("calendar token revoked", slog.String("email", email))
+	return nil
+}
+
+// CalendarOwner returns the email of the user whose calendar feed token is
+// token. Unknown tokens and tokens of disabled users return ErrNotFound.
+func (s *UserService) CalendarOwner(ctx context.Context, token string) (_ string, err error) {
+	ctx, span := startSpan(ctx, "UserService.CalendarOwner")
+	defer func() { endSpan(span, err) }()
+
+	token = NormalizeText(token)
+	if token == "" {
+		return "", ErrNotFound
+	}
+	user, err := s.repo.FindByCalendarToken(ctx, hashSessionToken(token))
+	if err != nil {
+		return "", err
+	}
+	if user.Disabled {
+		return "", ErrNotFound
+	}
+	return user.Email, nil
+}
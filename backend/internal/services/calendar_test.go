@@ -0,0 +1,56 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestUserServiceCalendarTokens(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryUserRepository()
+	service := NewUserService(repo)
+	seedUsers(t, repo, User{Email: "user@example.com", Password: "secret"})
+
+	if _, err := service.RotateCalendarToken(ctx, "missing@example.com"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for an unknown user, got %v", err)
+	}
+
+	first, err := service.RotateCalendarToken(ctx, " User@Example.com ")
+	if err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	if owner, err := service.CalendarOwner(ctx, first); err != nil || owner != "user@example.com" {
+		t.Fatalf("expected the token to resolve to the user, got %q (%v)", owner, err)
+	}
+	if user, _ := repo.FindByEmail(ctx, "user@example.com"); user.CalendarToken == "" || user.CalendarToken == first {
+		t.Errorf("expected only a hash of the token to be stored, got %q", user.CalendarToken)
+	}
+
+	second, err := service.RotateCalendarToken(ctx, "user@example.com")
+	if err != nil || second == first {
+		t.Fatalf("expected a new token, got %q (%v)", second, err)
+	}
+	if _, err := service.CalendarOwner(ctx, first); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the rotated token to stop working, got %v", err)
+	}
+
+	if err := service.SetDisabled(ctx, "user@example.com", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.CalendarOwner(ctx, second); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the feed of a disabled user to be hidden, got %v", err)
+	}
+	if err := service.SetDisabled(ctx, "user@example.com", false); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := service.RevokeCalendarToken(ctx, "user@example.com"); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	for _, token := range []string{second, "", "  "} {
+		if _, err := service.CalendarOwner(ctx, token); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%q: expected ErrNotFound, got %v", token, err)
+		}
+	}
+}
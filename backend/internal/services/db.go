@@ -2,10 +2,14 @@ package services
 
 import (
 	"context"
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
 )
 
 const (
@@ -14,9 +18,10 @@ const (
 )
 
 // ConnectMongo initialises a MongoDB client with a timeout to avoid hanging
-// connections during startup.
+// connections during startup. Every command is traced as a child span of the
+// span found in its context.
 func ConnectMongo(ctx context.Context, uri string) (*mongo.Client, error) {
-	clientOpts := options.Client().ApplyURI(uri)
+	clientOpts := options.Client().ApplyURI(uri).SetMonitor(otelmongo.NewMonitor())
 	client, err := mongo.NewClient(clientOpts)
 	if err != nil {
 		return nil, err
@@ -36,3 +41,29 @@ func ConnectMongo(ctx context.Context, uri string) (*mongo.Client, error) {
 
 	return client, nil
 }
+
+// CheckIndexes returns an error naming every index of required that does not
+// exist in db.
+func CheckIndexes(ctx context.Context, db *mongo.Database, required map[string][]string) error {
+	var missing []string
+	for collection, names := range required {
+		specs, err := db.Collection(collection).Indexes().ListSpecifications(ctx)
+		if err != nil {
+			return err
+		}
+		existing := make(map[string]struct{}, len(specs))
+		for _, spec := range specs {
+			existing[spec.Name] = struct{}{}
+		}
+		for _, name := range names {
+			if _, ok := existing[name]; !ok {
+				missing = append(missing, collection+"."+name)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("missing indexes: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
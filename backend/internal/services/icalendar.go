@@ -0,0 +1,254 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// icsProductID identifies the application in the PRODID of exported
+// calendars.
+const icsProductID = "-//tp8ingsoft3//todos//EN"
+
+// icsDefaultDomain qualifies UIDs when Export is not given a domain.
+const icsDefaultDomain = "tp8ingsoft3"
+
+// iCalendar time formats: UTC and floating date-times, and dates.
+const (
+	icsUTCTime   = "20060102T150405Z"
+	icsLocalTime = "20060102T150405"
+	icsDate      = "20060102"
+)
+
+// icsMaxLineOctets is the longest content line before folding (RFC 5545,
+// section 3.1), not counting the line break.
+const icsMaxLineOctets = 75
+
+// writeTodosICS writes an RFC 5545 calendar with one VTODO per todo. UIDs
+// are the todo IDs qualified by the domain. STATUS follows the completed
+// state, DUE the due date and CREATED the creation time. Todos keep no
+// modification time, so DTSTAMP and LAST-MODIFIED are the generation time,
+// which makes clients refresh every todo of a polled feed.
+func writeTodosICS(w io.Writer, todos []TodoResponse, opts exportOptions) error {
+	stamp := opts.now.UTC().Format(icsUTCTime)
+	iw := &icsWriter{w: bufio.NewWriter(w)}
+	iw.line("BEGIN", "VCALENDAR")
+	iw.line("VERSION", "2.0")
+	iw.line("PRODID", icsProductID)
+	iw.line("CALSCALE", "GREGORIAN")
+	for _, todo := range todos {
+		status := "NEEDS-ACTION"
+		if todo.Completed {
+			status = "COMPLETED"
+		}
+		iw.line("BEGIN", "VTODO")
+		iw.line("UID", todo.ID+"@"+opts.domain)
+		iw.line("DTSTAMP", stamp)
+		iw.line("CREATED", todo.CreatedAt.UTC().Format(icsUTCTime))
+		iw.line("LAST-MODIFIED", stamp)
+		iw.line("SUMMARY", icsEscaper.Replace(todo.Title))
+		iw.line("STATUS", status)
+		if todo.DueAt != nil {
+			iw.line("DUE", todo.DueAt.UTC().Format(icsUTCTime))
+		}
+		iw.line("END", "VTODO")
+	}
+	iw.line("END", "VCALENDAR")
+	return iw.w.Flush()
+}
+
+// icsWriter writes folded CRLF content lines; write errors surface on Flush.
+type icsWriter struct {
+	w *bufio.Writer
+}
+
+func (iw *icsWriter) line(name, value string) {
+	line := name + ":" + value
+	// Continuation lines start with a space, so they carry one octet less.
+	// Lines are only split between UTF-8 sequences.
+	limit := icsMaxLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		iw.w.WriteString(line[:cut])
+		iw.w.WriteString("\r\n ")
+		line = line[cut:]
+		limit = icsMaxLineOctets - 1
+	}
+	iw.w.WriteString(line)
+	iw.w.WriteString("\r\n")
+}
+
+var (
+	icsEscaper   = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+	icsUnescaper = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+)
+
+// icsProperty is a content line: NAME;PARAM=value:value.
+type icsProperty struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// parseICSLine splits an unfolded content line. Names and parameter names
+// are case-insensitive, so they are upper-cased.
+func parseICSLine(line string) (icsProperty, bool) {
+	colon, quoted := -1, false
+	for i, r := range line {
+		if r == '"' {
+			quoted = !quoted
+		} else if r == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon <= 0 {
+		return icsProperty{}, false
+	}
+
+	parts := strings.Split(line[:colon], ";")
+	prop := icsProperty{name: strings.ToUpper(parts[0]), params: map[string]string{}, value: line[colon+1:]}
+	for _, param := range parts[1:] {
+		name, value, _ := strings.Cut(param, "=")
+		prop.params[strings.ToUpper(name)] = strings.Trim(value, `"`)
+	}
+	return prop, true
+}
+
+// unfoldICS reads the content lines of r, joining folded lines and skipping
+// blank ones. Bare LF line breaks are accepted as well as CRLF.
+func unfoldICS(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		switch {
+		case line == "":
+		case (line[0] == ' ' || line[0] == '\t') && len(lines) > 0:
+			lines[len(lines)-1] += line[1:]
+		default:
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// parseTodosICS reads the VTODO components of a calendar; other components,
+// such as events, are skipped, as are the properties of components nested
+// in a VTODO, such as alarms. Rows are numbered by VTODO.
+func parseTodosICS(r io.Reader) ([]TodoRecord, []TodoImportError, error) {
+	lines, err := unfoldICS(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(lines) == 0 || !strings.EqualFold(lines[0], "BEGIN:VCALENDAR") {
+		return nil, nil, fmt.Errorf("%w: not an iCalendar file", ErrInvalidTodoInput)
+	}
+
+	var records []TodoRecord
+	var rejected []TodoImportError
+	var stack []string
+	var todo []icsProperty
+	row := 0
+	for _, line := range lines {
+		prop, ok := parseICSLine(line)
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: invalid content line %q", ErrInvalidTodoInput, line)
+		}
+		switch prop.name {
+		case "BEGIN":
+			stack = append(stack, strings.ToUpper(prop.value))
+			if len(stack) == 2 && stack[1] == "VTODO" {
+				row++
+				todo = todo[:0]
+			}
+			continue
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1] != strings.ToUpper(prop.value) {
+				return nil, nil, fmt.Errorf("%w: unexpected END:%s", ErrInvalidTodoInput, prop.value)
+			}
+			if len(stack) == 2 && stack[1] == "VTODO" {
+				record, field, err := icsRecord(row, todo)
+				if err != nil {
+					rejected = append(rejected, TodoImportError{Row: row, Field: field, Err: err})
+				} else {
+					records = append(records, record)
+				}
+			}
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		if len(stack) == 2 && stack[1] == "VTODO" {
+			todo = append(todo, prop)
+		}
+	}
+	if len(stack) != 0 {
+		return nil, nil, fmt.Errorf("%w: BEGIN:%s is not closed", ErrInvalidTodoInput, stack[len(stack)-1])
+	}
+	return records, rejected, nil
+}
+
+// icsRecord builds the record of a VTODO; on error it names the field. A
+// todo is completed when its STATUS is COMPLETED or it has a COMPLETED time.
+func icsRecord(row int, props []icsProperty) (TodoRecord, string, error) {
+	record := TodoRecord{Row: row}
+	for _, prop := range props {
+		switch prop.name {
+		case "SUMMARY":
+			record.Title = icsUnescaper.Replace(prop.value)
+		case "STATUS":
+			record.Completed = record.Completed || strings.EqualFold(prop.value, "COMPLETED")
+		case "COMPLETED":
+			record.Completed = true
+		case "CREATED":
+			createdAt, err := parseICSTime(prop)
+			if err != nil {
+				return TodoRecord{}, "createdAt", err
+			}
+			record.CreatedAt = createdAt
+		case "DUE":
+			dueAt, err := parseICSTime(prop)
+			if err != nil {
+				return TodoRecord{}, "dueAt", err
+			}
+			record.DueAt = &dueAt
+		}
+	}
+	return record, "", nil
+}
+
+// parseICSTime reads a UTC, TZID or floating date-time, or a date. Floating
+// times, dates and unknown time zones are read as UTC, like the plain dates
+// of the other formats.
+func parseICSTime(prop icsProperty) (time.Time, error) {
+	value := strings.TrimSpace(prop.value)
+	var (
+		t   time.Time
+		err error
+	)
+	switch {
+	case strings.EqualFold(prop.params["VALUE"], "DATE") || len(value) == len(icsDate):
+		t, err = time.Parse(icsDate, value)
+	case strings.HasSuffix(value, "Z"):
+		t, err = time.Parse(icsUTCTime, value)
+	default:
+		loc := time.UTC
+		if tzid := prop.params["TZID"]; tzid != "" {
+			if l, err := time.LoadLocation(tzid); err == nil {
+				loc = l
+			}
+		}
+		t, err = time.ParseInLocation(icsLocalTime, value, loc)
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %q is not an iCalendar date or time", ErrInvalidTodoInput, value)
+	}
+	return t, nil
+}
@@ -0,0 +1,237 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// ErrIdempotencyKeyReused is returned when a key is sent again with a
+	// different request.
+	ErrIdempotencyKeyReused = errors.New("idempotency key reused with a different request")
+	// ErrIdempotencyInProgress is returned while the first request of a key
+	// is still being processed.
+	ErrIdempotencyInProgress = errors.New("idempotency key in use by a request in progress")
+)
+
+const (
+	// DefaultIdempotencyTTL is how long responses are kept for replay.
+	DefaultIdempotencyTTL = 24 * time.Hour
+	// idempotencyLockTTL bounds how long a request in progress holds its key,
+	// so a crashed replica does not block retries until the full TTL.
+	idempotencyLockTTL = time.Minute
+)
+
+// IdempotentResponse is a stored response. A record without Status is still
+// in progress.
+type IdempotentResponse struct {
+	Key         string    `bson:"_id"`
+	RequestHash string    `bson:"requestHash"`
+	Status      int       `bson:"status,omitempty"`
+	ContentType string    `bson:"contentType,omitempty"`
+	Body        []byte    `bson:"body,omitempty"`
+	CreatedAt   time.Time `bson:"createdAt"`
+	ExpiresAt   time.Time `bson:"expiresAt"`
+}
+
+// Completed reports whether the response was stored.
+func (r IdempotentResponse) Completed() bool {
+	return r.Status != 0
+}
+
+// IdempotencyStore persists idempotency records.
+type IdempotencyStore interface {
+	// Claim stores record unless an unexpired record with the same key
+	// exists, in which case that record is returned with claimed false.
+	Claim(ctx context.Context, record IdempotentResponse, now time.Time) (existing IdempotentResponse, claimed bool, err error)
+	// Complete stores the response of a claimed key.
+	Complete(ctx context.Context, record IdempotentResponse) error
+	// Release forgets a key so the request can be retried.
+	Release(ctx context.Context, key string) error
+}
+
+// IdempotencyService replays the first response sent for an idempotency key.
+type IdempotencyService struct {
+	store IdempotencyStore
+	ttl   time.Duration
+	now   func() time.Time
+}
+
+// NewIdempotencyService builds an IdempotencyService. A nil store keeps
+// records in memory and a non-positive ttl uses DefaultIdempotencyTTL.
+func NewIdempotencyService(store IdempotencyStore, ttl time.Duration, now func() time.Time) *IdempotencyService {
+	if now == nil {
+		now = time.Now
+	}
+	if store == nil {
+		store = NewMemoryIdempotencyStore()
+	}
+	if ttl <= 0 {
+		ttl = DefaultIdempotencyTTL
+	}
+	return &IdempotencyService{store: store, ttl: ttl, now: now}
+}
+
+// Begin claims key for a request identified by requestHash. It returns the
+// stored response when the request was already answered, nil when the caller
+// should process it, ErrIdempotencyKeyReused when the key belongs to another
+// request and ErrIdempotencyInProgress while the first request is running.
+func (s *IdempotencyService) Begin(ctx context.Context, key, requestHash string) (*IdempotentResponse, error) {
+	now := s.now()
+	existing, claimed, err := s.store.Claim(ctx, IdempotentResponse{
+		Key:         key,
+		RequestHash: requestHash,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(min(idempotencyLockTTL, s.ttl)),
+	}, now)
+	switch {
+	case err != nil:
+		return nil, err
+	case claimed:
+		return nil, nil
+	case existing.RequestHash != requestHash:
+		return nil, ErrIdempotencyKeyReused
+	case !existing.Completed():
+		return nil, ErrIdempotencyInProgress
+	}
+	return &existing, nil
+}
+
+// Complete stores the response of the request that claimed key.
+func (s *IdempotencyService) Complete(ctx context.Context, key, requestHash string, status int, contentType string, body []byte) error {
+	now := s.now()
+	return s.store.Complete(ctx, IdempotentResponse{
+		Key:         key,
+		RequestHash: requestHash,
+		Status:      status,
+		ContentType: contentType,
+		Body:        body,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(s.ttl),
+	})
+}
+
+// Release frees key after a failure so the client can retry.
+func (s *IdempotencyService) Release(ctx context.Context, key string) error {
+	return s.store.Release(ctx, key)
+}
+
+// MemoryIdempotencyStore keeps idempotency records in process memory.
+type MemoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]IdempotentResponse
+	swept   time.Time
+}
+
+// NewMemoryIdempotencyStore creates an empty in-memory store.
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{records: make(map[string]IdempotentResponse)}
+}
+
+// Claim stores record unless an unexpired record holds its key.
+func (m *MemoryIdempotencyStore) Claim(_ context.Context, record IdempotentResponse, now time.Time) (IdempotentResponse, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.Sub(m.swept) >= time.Minute {
+		m.swept = now
+		for key, existing := range m.records {
+			if !now.Before(existing.ExpiresAt) {
+				delete(m.records, key)
+			}
+		}
+	}
+	if existing, ok := m.records[record.Key]; ok && now.Before(existing.ExpiresAt) {
+		return existing, false, nil
+	}
+	m.records[record.Key] = record
+	return record, true, nil
+}
+
+// Complete stores the response of a claimed key.
+func (m *MemoryIdempotencyStore) Complete(_ context.Context, record IdempotentResponse) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.records[record.Key] = record
+	return nil
+}
+
+// Release forgets key.
+func (m *MemoryIdempotencyStore) Release(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.records, key)
+	return nil
+}
+
+// MongoIdempotencyStore persists idempotency records in MongoDB with a TTL
+// index.
+type MongoIdempotencyStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoIdempotencyStore creates a new store wrapper around a Mongo collection.
+func NewMongoIdempotencyStore(collection *mongo.Collection) *MongoIdempotencyStore {
+	return &MongoIdempotencyStore{collection: collection}
+}
+
+// EnsureIndexes creates the TTL index on expiresAt.
+func (m *MongoIdempotencyStore) EnsureIndexes(ctx context.Context) error {
+	return createIndexes(ctx, m.collection, expiresAtTTLIndexes)
+}
+
+// Claim upserts record in a single round trip. The document is only
+// replaced when missing or expired, so concurrent claims of a key cannot
+// both succeed.
+func (m *MongoIdempotencyStore) Claim(ctx context.Context, record IdempotentResponse, now time.Time) (IdempotentResponse, bool, error) {
+	fresh := bson.D{
+		{Key: "_id", Value: record.Key},
+		{Key: "requestHash", Value: record.RequestHash},
+		{Key: "createdAt", Value: record.CreatedAt},
+		{Key: "expiresAt", Value: record.ExpiresAt},
+	}
+	res := m.collection.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": record.Key},
+		mongo.Pipeline{
+			{{Key: "$replaceWith", Value: bson.D{{Key: "$cond", Value: bson.A{
+				bson.D{{Key: "$gt", Value: bson.A{"$expiresAt", now}}},
+				"$$ROOT",
+				bson.D{{Key: "$literal", Value: fresh}},
+			}}}}},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before),
+	)
+
+	var existing IdempotentResponse
+	if err := res.Decode(&existing); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return record, true, nil
+		}
+		return IdempotentResponse{}, false, err
+	}
+	if !now.Before(existing.ExpiresAt) {
+		return record, true, nil
+	}
+	return existing, false, nil
+}
+
+// Complete stores the response of a claimed key.
+func (m *MongoIdempotencyStore) Complete(ctx context.Context, record IdempotentResponse) error {
+	_, err := m.collection.ReplaceOne(ctx, bson.M{"_id": record.Key}, record, options.Replace().SetUpsert(true))
+	return err
+}
+
+// Release forgets key.
+func (m *MongoIdempotencyStore) Release(ctx context.Context, key string) error {
+	_, err := m.collection.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
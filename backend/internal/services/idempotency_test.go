@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// TestIdempotencyServiceReplaysFirstResponse covers claiming, replaying,
+// reuse with another request and expiry.
+func TestIdempotencyServiceReplaysFirstResponse(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: fixedNow()}
+	service := NewIdempotencyService(nil, time.Hour, clock.Now)
+
+	if stored, err := service.Begin(ctx, "user:a:key", "hash"); err != nil || stored != nil {
+		t.Fatalf("expected first request to be claimed, got %+v %v", stored, err)
+	}
+	if _, err := service.Begin(ctx, "user:a:key", "hash"); !errors.Is(err, ErrIdempotencyInProgress) {
+		t.Fatalf("expected in-progress error, got %v", err)
+	}
+
+	if err := service.Complete(ctx, "user:a:key", "hash", 201, "application/json", []byte(`{"ok":true}`)); err != nil {
+		t.Fatalf("complete failed: %v", err)
+	}
+	stored, err := service.Begin(ctx, "user:a:key", "hash")
+	if err != nil || stored == nil || stored.Status != 201 || string(stored.Body) != `{"ok":true}` {
+		t.Fatalf("expected stored response, got %+v %v", stored, err)
+	}
+	if _, err := service.Begin(ctx, "user:a:key", "other"); !errors.Is(err, ErrIdempotencyKeyReused) {
+		t.Fatalf("expected reuse error, got %v", err)
+	}
+
+	clock.Advance(time.Hour)
+	if stored, err := service.Begin(ctx, "user:a:key", "other"); err != nil || stored != nil {
+		t.Fatalf("expected expired key to be claimable, got %+v %v", stored, err)
+	}
+}
+
+// TestIdempotencyServiceRelease frees a key for a retry, and bounds how long
+// an unfinished request holds it.
+func TestIdempotencyServiceRelease(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: fixedNow()}
+	service := NewIdempotencyService(nil, 0, clock.Now)
+
+	_, _ = service.Begin(ctx, "key", "hash")
+	if err := service.Release(ctx, "key"); err != nil {
+		t.Fatalf("release failed: %v", err)
+	}
+	if stored, err := service.Begin(ctx, "key", "hash"); err != nil || stored != nil {
+		t.Fatalf("expected released key to be claimable, got %+v %v", stored, err)
+	}
+
+	clock.Advance(idempotencyLockTTL)
+	if stored, err := service.Begin(ctx, "key", "hash"); err != nil || stored != nil {
+		t.Fatalf("expected abandoned claim to lapse, got %+v %v", stored, err)
+	}
+}
+
+// TestMongoIdempotencyStore covers the Mongo-backed store with mock responses.
+func TestMongoIdempotencyStore(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock).CreateCollection(false))
+
+	mt.Run("claim new key", func(mt *mtest.T) {
+		service := NewIdempotencyService(NewMongoIdempotencyStore(mt.Coll), time.Hour, fixedNow)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}))
+
+		if stored, err := service.Begin(context.Background(), "key", "hash"); err != nil || stored != nil {
+			mt.Fatalf("expected claim, got %+v %v", stored, err)
+		}
+	})
+
+	mt.Run("replay completed key", func(mt *mtest.T) {
+		now := fixedNow()
+		service := NewIdempotencyService(NewMongoIdempotencyStore(mt.Coll), time.Hour, fixedNow)
+		doc := bson.D{
+			{Key: "_id", Value: "key"},
+			{Key: "requestHash", Value: "hash"},
+			{Key: "status", Value: 201},
+			{Key: "contentType", Value: "application/json"},
+			{Key: "body", Value: []byte(`{}`)},
+			{Key: "createdAt", Value: now},
+			{Key: "expiresAt", Value: now.Add(time.Hour)},
+		}
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: doc}))
+
+		stored, err := service.Begin(context.Background(), "key", "hash")
+		if err != nil || stored == nil || stored.Status != 201 {
+			mt.Fatalf("expected replay, got %+v %v", stored, err)
+		}
+	})
+
+	mt.Run("complete, release and ensure indexes", func(mt *mtest.T) {
+		store := NewMongoIdempotencyStore(mt.Coll)
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			mtest.CreateSuccessResponse(),
+		)
+
+		if err := store.Complete(context.Background(), IdempotentResponse{Key: "key", Status: 200}); err != nil {
+			mt.Fatalf("complete failed: %v", err)
+		}
+		if err := store.Release(context.Background(), "key"); err != nil {
+			mt.Fatalf("release failed: %v", err)
+		}
+		if err := store.EnsureIndexes(context.Background()); err != nil {
+			mt.Fatalf("ensure indexes failed: %v", err)
+		}
+	})
+}
@@ -0,0 +1,383 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrAccountLocked is returned while an account or client is temporarily locked
+// out after too many failed login attempts.
+var ErrAccountLocked = errors.New("account temporarily locked")
+
+// LockedError carries how long the caller has to wait before trying again.
+// It matches ErrAccountLocked through errors.Is.
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrAccountLocked, e.RetryAfter)
+}
+
+// Is reports whether target is ErrAccountLocked.
+func (e *LockedError) Is(target error) bool {
+	return target == ErrAccountLocked
+}
+
+// LoginAttempt tracks consecutive failed logins for a single key (account or IP).
+// Attempts are counted as failures as soon as they start; PreviousFailure
+// keeps the failure time the latest attempt replaced.
+type LoginAttempt struct {
+	Key             string    `bson:"_id"`
+	Failures        int       `bson:"failures"`
+	LastFailure     time.Time `bson:"lastFailure"`
+	PreviousFailure time.Time `bson:"previousFailure"`
+	ExpiresAt       time.Time `bson:"expiresAt"`
+}
+
+// previous returns the record as it was before the attempt that produced it.
+func (a LoginAttempt) previous() LoginAttempt {
+	return LoginAttempt{Key: a.Key, Failures: a.Failures - 1, LastFailure: a.PreviousFailure}
+}
+
+// LoginAttemptStore persists failed-attempt counters.
+type LoginAttemptStore interface {
+	// Reserve atomically counts an attempt for key as a failure at at and
+	// returns the updated record, which expires at expiresAt. The counter
+	// restarts at one when the previous record expired before at.
+	Reserve(ctx context.Context, key string, at, expiresAt time.Time) (LoginAttempt, error)
+	// Refund takes back the failure counted by the Reserve that returned
+	// attempt, restoring the previous failure time unless a later attempt
+	// replaced it.
+	Refund(ctx context.Context, attempt LoginAttempt) error
+	// Reset forgets every failure recorded for key.
+	Reset(ctx context.Context, key string) error
+}
+
+// LockoutPolicy describes how failures translate into lockout periods.
+type LockoutPolicy struct {
+	// FreeAttempts is the number of failures tolerated before delays apply.
+	FreeAttempts int
+	// BaseDelay is the lockout applied on the first failure past FreeAttempts;
+	// it doubles with every further failure.
+	BaseDelay time.Duration
+	// MaxDelay caps the exponential backoff.
+	MaxDelay time.Duration
+	// Window is how long failures are remembered after the last one.
+	Window time.Duration
+}
+
+// Delay returns the lockout period imposed after the given number of failures.
+func (p LockoutPolicy) Delay(failures int) time.Duration {
+	excess := failures - p.FreeAttempts
+	if excess <= 0 || p.BaseDelay <= 0 {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := 1; i < excess; i++ {
+		delay *= 2
+		if p.MaxDelay > 0 && delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		return p.MaxDelay
+	}
+	return delay
+}
+
+var (
+	// DefaultAccountLockoutPolicy protects a single account from password guessing.
+	DefaultAccountLockoutPolicy = LockoutPolicy{
+		FreeAttempts: 3,
+		BaseDelay:    time.Second,
+		MaxDelay:     15 * time.Minute,
+		Window:       time.Hour,
+	}
+	// DefaultIPLockoutPolicy is more lenient, since several users may share an IP.
+	DefaultIPLockoutPolicy = LockoutPolicy{
+		FreeAttempts: 20,
+		BaseDelay:    time.Second,
+		MaxDelay:     15 * time.Minute,
+		Window:       time.Hour,
+	}
+)
+
+// LoginGuard applies per-account and per-IP lockout policies on top of a store.
+type LoginGuard struct {
+	store   LoginAttemptStore
+	account LockoutPolicy
+	ip      LockoutPolicy
+	now     func() time.Time
+}
+
+// NewLoginGuard builds a LoginGuard. Zero policies fall back to the defaults.
+func NewLoginGuard(store LoginAttemptStore, account, ip LockoutPolicy, now func() time.Time) *LoginGuard {
+	if store == nil {
+		store = NewMemoryLoginAttemptStore()
+	}
+	if account == (LockoutPolicy{}) {
+		account = DefaultAccountLockoutPolicy
+	}
+	if ip == (LockoutPolicy{}) {
+		ip = DefaultIPLockoutPolicy
+	}
+	if now == nil {
+		now = time.Now
+	}
+	return &LoginGuard{store: store, account: account, ip: ip, now: now}
+}
+
+func accountKey(email string) string {
+	return "account:" + NormalizeEmail(email)
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+type guardedKey struct {
+	key    string
+	policy LockoutPolicy
+}
+
+func (g *LoginGuard) keys(email, ip string) []guardedKey {
+	keys := make([]guardedKey, 0, 2)
+	if email = NormalizeEmail(email); email != "" {
+		keys = append(keys, guardedKey{key: accountKey(email), policy: g.account})
+	}
+	if ip != "" {
+		keys = append(keys, guardedKey{key: ipKey(ip), policy: g.ip})
+	}
+	return keys
+}
+
+func (g *LoginGuard) retryAfter(attempt LoginAttempt, policy LockoutPolicy) time.Duration {
+	delay := policy.Delay(attempt.Failures)
+	if delay == 0 {
+		return 0
+	}
+	remaining := attempt.LastFailure.Add(delay).Sub(g.now())
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// LoginReservation is a login attempt counted as a failure before the
+// credentials are verified, so that concurrent attempts cannot all pass a
+// lockout check before any failure is recorded. It is settled with Succeed,
+// Fail or Cancel.
+type LoginReservation struct {
+	guard    *LoginGuard
+	email    string
+	attempts []reservedAttempt
+}
+
+type reservedAttempt struct {
+	guardedKey
+	attempt LoginAttempt
+}
+
+// Reserve counts an attempt for the account and the client IP. It returns a
+// *LockedError, and takes the attempt back, when either was locked out
+// before it.
+func (g *LoginGuard) Reserve(ctx context.Context, email, ip string) (*LoginReservation, error) {
+	now := g.now()
+	r := &LoginReservation{guard: g, email: email}
+	var wait time.Duration
+	for _, k := range g.keys(email, ip) {
+		attempt, err := g.store.Reserve(ctx, k.key, now, now.Add(k.policy.Window))
+		if err != nil {
+			if cancelErr := r.Cancel(ctx); cancelErr != nil {
+				return nil, errors.Join(err, cancelErr)
+			}
+			return nil, err
+		}
+		r.attempts = append(r.attempts, reservedAttempt{guardedKey: k, attempt: attempt})
+		if d := g.retryAfter(attempt.previous(), k.policy); d > wait {
+			wait = d
+		}
+	}
+	if wait > 0 {
+		if err := r.Cancel(ctx); err != nil {
+			return nil, err
+		}
+		return nil, &LockedError{RetryAfter: wait}
+	}
+	return r, nil
+}
+
+// Fail keeps the attempt as a failure and returns how long the caller must
+// now wait before trying again (zero if no lockout applies yet).
+func (r *LoginReservation) Fail() time.Duration {
+	var wait time.Duration
+	for _, a := range r.attempts {
+		if d := r.guard.retryAfter(a.attempt, a.policy); d > wait {
+			wait = d
+		}
+	}
+	return wait
+}
+
+// Succeed clears the failure counter of the account and refunds the attempt
+// of the IP. The rest of the IP counter is kept so that a valid login cannot
+// be used to reset an ongoing spraying attack.
+func (r *LoginReservation) Succeed(ctx context.Context) error {
+	var errs []error
+	for _, a := range r.attempts {
+		if a.key == accountKey(r.email) {
+			errs = append(errs, r.guard.store.Reset(ctx, a.key))
+			continue
+		}
+		errs = append(errs, r.guard.store.Refund(ctx, a.attempt))
+	}
+	return errors.Join(errs...)
+}
+
+// Cancel refunds the attempt, for checks that ended neither in a success
+// nor in wrong credentials.
+func (r *LoginReservation) Cancel(ctx context.Context) error {
+	var errs []error
+	for _, a := range r.attempts {
+		errs = append(errs, r.guard.store.Refund(ctx, a.attempt))
+	}
+	return errors.Join(errs...)
+}
+
+// MemoryLoginAttemptStore keeps login attempts in process memory.
+type MemoryLoginAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]LoginAttempt
+}
+
+// NewMemoryLoginAttemptStore creates an empty in-memory store.
+func NewMemoryLoginAttemptStore() *MemoryLoginAttemptStore {
+	return &MemoryLoginAttemptStore{attempts: make(map[string]LoginAttempt)}
+}
+
+// Reserve increments the failure counter for key.
+func (m *MemoryLoginAttemptStore) Reserve(_ context.Context, key string, at, expiresAt time.Time) (LoginAttempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	attempt, ok := m.attempts[key]
+	if !ok || !attempt.ExpiresAt.After(at) {
+		attempt = LoginAttempt{Key: key}
+	}
+	attempt.Failures++
+	attempt.PreviousFailure = attempt.LastFailure
+	attempt.LastFailure = at
+	attempt.ExpiresAt = expiresAt
+	m.attempts[key] = attempt
+	return attempt, nil
+}
+
+// Refund decrements the failure counter of the attempt's key.
+func (m *MemoryLoginAttemptStore) Refund(_ context.Context, attempt LoginAttempt) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current, ok := m.attempts[attempt.Key]
+	if !ok {
+		return nil
+	}
+	current.Failures = max(current.Failures-1, 0)
+	if current.LastFailure.Equal(attempt.LastFailure) {
+		current.LastFailure = attempt.PreviousFailure
+	}
+	m.attempts[attempt.Key] = current
+	return nil
+}
+
+// Reset removes the record for key.
+func (m *MemoryLoginAttemptStore) Reset(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.attempts, key)
+	return nil
+}
+
+// MongoLoginAttemptStore persists login attempts in MongoDB. Documents are
+// removed by a TTL index on expiresAt.
+type MongoLoginAttemptStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoLoginAttemptStore creates a new store wrapper around a Mongo collection.
+func NewMongoLoginAttemptStore(collection *mongo.Collection) *MongoLoginAttemptStore {
+	return &MongoLoginAttemptStore{collection: collection}
+}
+
+// EnsureIndexes creates the TTL index that expires stale attempt records.
+func (m *MongoLoginAttemptStore) EnsureIndexes(ctx context.Context) error {
+	return createIndexes(ctx, m.collection, expiresAtTTLIndexes)
+}
+
+// Reserve increments the failure counter for key with an upsert. The
+// counter restarts at one when the previous record already expired but was
+// not yet reaped by the TTL monitor.
+func (m *MongoLoginAttemptStore) Reserve(ctx context.Context, key string, at, expiresAt time.Time) (LoginAttempt, error) {
+	current := bson.D{{Key: "$gt", Value: bson.A{"$expiresAt", at}}}
+	failures := bson.D{{Key: "$cond", Value: bson.A{
+		current,
+		bson.D{{Key: "$add", Value: bson.A{"$failures", 1}}},
+		1,
+	}}}
+	previousFailure := bson.D{{Key: "$cond", Value: bson.A{current, "$lastFailure", time.Time{}}}}
+
+	res := m.collection.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": key},
+		mongo.Pipeline{{{Key: "$set", Value: bson.D{
+			{Key: "failures", Value: failures},
+			{Key: "previousFailure", Value: previousFailure},
+			{Key: "lastFailure", Value: at},
+			{Key: "expiresAt", Value: expiresAt},
+		}}}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	)
+
+	var attempt LoginAttempt
+	if err := res.Decode(&attempt); err != nil {
+		return LoginAttempt{}, err
+	}
+	return attempt, nil
+}
+
+// Refund decrements the failure counter of the attempt's key in a single
+// update, restoring the previous failure time only while the attempt is
+// still the latest one.
+func (m *MongoLoginAttemptStore) Refund(ctx context.Context, attempt LoginAttempt) error {
+	_, err := m.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": attempt.Key},
+		mongo.Pipeline{{{Key: "$set", Value: bson.D{
+			{Key: "failures", Value: bson.D{{Key: "$max", Value: bson.A{
+				bson.D{{Key: "$subtract", Value: bson.A{"$failures", 1}}},
+				0,
+			}}}},
+			{Key: "lastFailure", Value: bson.D{{Key: "$cond", Value: bson.A{
+				bson.D{{Key: "$eq", Value: bson.A{"$lastFailure", attempt.LastFailure}}},
+				attempt.PreviousFailure,
+				"$lastFailure",
+			}}}},
+		}}}},
+	)
+	return err
+}
+
+// Reset removes the record for key.
+func (m *MongoLoginAttemptStore) Reset(ctx context.Context, key string) error {
+	_, err := m.collection.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+// TestLockoutPolicyDelayBacksOffExponentially checks the backoff schedule and cap.
+func TestLockoutPolicyDelayBacksOffExponentially(t *testing.T) {
+	policy := LockoutPolicy{FreeAttempts: 2, BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+
+	expected := map[int]time.Duration{
+		0: 0,
+		2: 0,
+		3: time.Second,
+		4: 2 * time.Second,
+		5: 4 * time.Second,
+		6: 5 * time.Second,
+		9: 5 * time.Second,
+	}
+	for failures, want := range expected {
+		if got := policy.Delay(failures); got != want {
+			t.Errorf("Delay(%d) = %v, want %v", failures, got, want)
+		}
+	}
+}
+
+// failLogin reserves an attempt and settles it as a failure.
+func failLogin(t *testing.T, guard *LoginGuard, email, ip string) time.Duration {
+	t.Helper()
+
+	reservation, err := guard.Reserve(context.Background(), email, ip)
+	if err != nil {
+		t.Fatalf("reserve %s %s: %v", email, ip, err)
+	}
+	return reservation.Fail()
+}
+
+// TestLoginGuardLocksAccountAfterRepeatedFailures exercises lockout, expiry and reset.
+func TestLoginGuardLocksAccountAfterRepeatedFailures(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: fixedNow()}
+	policy := LockoutPolicy{FreeAttempts: 2, BaseDelay: 10 * time.Second, MaxDelay: time.Minute, Window: time.Hour}
+	guard := NewLoginGuard(NewMemoryLoginAttemptStore(), policy, policy, clock.Now)
+
+	for i := 0; i < 2; i++ {
+		if wait := failLogin(t, guard, "user@example.com", ""); wait != 0 {
+			t.Fatalf("expected free attempt %d, got wait=%v", i, wait)
+		}
+	}
+	if wait := failLogin(t, guard, " User@Example.com ", ""); wait != 10*time.Second {
+		t.Fatalf("expected 10s lockout, got %v", wait)
+	}
+
+	_, err := guard.Reserve(ctx, "user@example.com", "")
+	var locked *LockedError
+	if !errors.As(err, &locked) || !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("expected LockedError, got %v", err)
+	}
+	if errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("locked error must be distinct from ErrInvalidCredentials")
+	}
+	if locked.RetryAfter != 10*time.Second {
+		t.Fatalf("expected 10s retry, got %v", locked.RetryAfter)
+	}
+
+	// Refused attempts are taken back, so the lock still ends on time.
+	clock.Advance(10 * time.Second)
+	if wait := failLogin(t, guard, "user@example.com", ""); wait != 20*time.Second {
+		t.Fatalf("expected doubled lockout, got %v", wait)
+	}
+
+	clock.Advance(20 * time.Second)
+	reservation, err := guard.Reserve(ctx, "user@example.com", "")
+	if err != nil {
+		t.Fatalf("expected lock to expire, got %v", err)
+	}
+	if err := reservation.Succeed(ctx); err != nil {
+		t.Fatalf("succeed failed: %v", err)
+	}
+	if wait := failLogin(t, guard, "user@example.com", ""); wait != 0 {
+		t.Fatalf("expected reset account to be unlocked, got %v", wait)
+	}
+}
+
+// TestLoginGuardCountsConcurrentAttempts ensures attempts running at the
+// same time cannot all pass the lockout before any of them failed.
+func TestLoginGuardCountsConcurrentAttempts(t *testing.T) {
+	ctx := context.Background()
+	policy := LockoutPolicy{FreeAttempts: 2, BaseDelay: time.Minute, Window: time.Hour}
+	guard := NewLoginGuard(nil, policy, policy, fixedNow)
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		admitted int
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := guard.Reserve(ctx, "user@example.com", ""); err == nil {
+				mu.Lock()
+				admitted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if admitted != 3 {
+		t.Fatalf("expected the free attempts and one more to be admitted, got %d", admitted)
+	}
+}
+
+// TestLoginGuardTracksClientIPAcrossAccounts ensures per-IP counters survive account resets.
+func TestLoginGuardTracksClientIPAcrossAccounts(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: fixedNow()}
+	account := LockoutPolicy{FreeAttempts: 100, BaseDelay: time.Second, Window: time.Hour}
+	ip := LockoutPolicy{FreeAttempts: 2, BaseDelay: time.Minute, Window: time.Hour}
+	guard := NewLoginGuard(nil, account, ip, clock.Now)
+
+	failLogin(t, guard, "alice@example.com", "10.0.0.1")
+	failLogin(t, guard, "alice@example.com", "10.0.0.1")
+	reservation, err := guard.Reserve(ctx, "bob@example.com", "10.0.0.1")
+	if err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+	_ = reservation.Succeed(ctx)
+	if wait := failLogin(t, guard, "carol@example.com", "10.0.0.1"); wait != time.Minute {
+		t.Fatalf("expected the IP to stay counted after a success, got wait %v", wait)
+	}
+
+	if _, err := guard.Reserve(ctx, "dave@example.com", "10.0.0.1"); !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("expected IP lockout, got %v", err)
+	}
+	if _, err := guard.Reserve(ctx, "dave@example.com", "10.0.0.2"); err != nil {
+		t.Fatalf("expected other IP to be allowed, got %v", err)
+	}
+}
+
+// TestMemoryLoginAttemptStoreExpiresRecords verifies failures are forgotten
+// after the window and refunds restore the previous failure.
+func TestMemoryLoginAttemptStoreExpiresRecords(t *testing.T) {
+	ctx := context.Background()
+	now := fixedNow()
+	store := NewMemoryLoginAttemptStore()
+
+	if _, err := store.Reserve(ctx, "k", now, now.Add(time.Minute)); err != nil {
+		t.Fatalf("reserve failed: %v", err)
+	}
+	attempt, _ := store.Reserve(ctx, "k", now.Add(time.Second), now.Add(time.Minute))
+	if attempt.Failures != 2 || !attempt.PreviousFailure.Equal(now) {
+		t.Fatalf("expected 2 failures, got %+v", attempt)
+	}
+	if err := store.Refund(ctx, attempt); err != nil {
+		t.Fatalf("refund failed: %v", err)
+	}
+	attempt, _ = store.Reserve(ctx, "k", now.Add(2*time.Second), now.Add(time.Minute))
+	if attempt.Failures != 2 || !attempt.PreviousFailure.Equal(now) {
+		t.Fatalf("expected the refund to restore the first failure, got %+v", attempt)
+	}
+
+	attempt, _ = store.Reserve(ctx, "k", now.Add(time.Minute), now.Add(2*time.Minute))
+	if attempt.Failures != 1 || !attempt.PreviousFailure.IsZero() {
+		t.Fatalf("expected expired record to restart, got %+v", attempt)
+	}
+}
+
+// TestMongoLoginAttemptStore covers the Mongo-backed store with mock responses.
+func TestMongoLoginAttemptStore(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock).CreateCollection(false))
+
+	mt.Run("reserve returns updated document", func(mt *mtest.T) {
+		store := NewMongoLoginAttemptStore(mt.Coll)
+		now := fixedNow()
+		doc := bson.D{
+			{Key: "_id", Value: "account:user@example.com"},
+			{Key: "failures", Value: 4},
+			{Key: "lastFailure", Value: now},
+			{Key: "previousFailure", Value: now.Add(-time.Minute)},
+			{Key: "expiresAt", Value: now.Add(time.Hour)},
+		}
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: doc}))
+
+		attempt, err := store.Reserve(context.Background(), "account:user@example.com", now, now.Add(time.Hour))
+		if err != nil {
+			mt.Fatalf("reserve failed: %v", err)
+		}
+		if attempt.Failures != 4 || attempt.Key != "account:user@example.com" || !attempt.PreviousFailure.Equal(now.Add(-time.Minute)) {
+			mt.Fatalf("unexpected attempt: %+v", attempt)
+		}
+	})
+
+	mt.Run("ensure indexes, refund and reset", func(mt *mtest.T) {
+		store := NewMongoLoginAttemptStore(mt.Coll)
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+		)
+
+		if err := store.EnsureIndexes(context.Background()); err != nil {
+			mt.Fatalf("ensure indexes failed: %v", err)
+		}
+		if err := store.Refund(context.Background(), LoginAttempt{Key: "ip:10.0.0.1", Failures: 1}); err != nil {
+			mt.Fatalf("refund failed: %v", err)
+		}
+		if err := store.Reset(context.Background(), "ip:10.0.0.1"); err != nil {
+			mt.Fatalf("reset failed: %v", err)
+		}
+	})
+}
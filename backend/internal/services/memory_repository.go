@@ -0,0 +1,337 @@
+package services
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryUserRepository keeps users in process memory. Data is lost on
+// restart, which suits tests and demos.
+type MemoryUserRepository struct {
+	mu    sync.RWMutex
+	users map[string]User
+}
+
+// NewMemoryUserRepository creates an empty in-memory user repository.
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{users: make(map[string]User)}
+}
+
+// FindByEmail retrieves a user by email or returns ErrNotFound.
+func (m *MemoryUserRepository) FindByEmail(_ context.Context, email string) (User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[email]
+	if !ok {
+		return User{}, ErrNotFound
+	}
+	return user, nil
+}
+
+// Insert stores user, or returns ErrUserAlreadyExists if the email is taken.
+func (m *MemoryUserRepository) Insert(_ context.Context, user User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[user.Email]; ok {
+		return ErrUserAlreadyExists
+	}
+	m.users[user.Email] = user
+	return nil
+}
+
+// List returns every user sorted by email.
+func (m *MemoryUserRepository) List(_ context.Context) ([]User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	users := make([]User, 0, len(m.users))
+	for _, user := range m.users {
+		users = append(users, user)
+	}
+	sortUsers(users)
+	return users, nil
+}
+
+// Clear removes every user.
+func (m *MemoryUserRepository) Clear(_ context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.users = make(map[string]User)
+	return nil
+}
+
+// UpdateTwoFactor replaces the second-factor state of a user.
+func (m *MemoryUserRepository) UpdateTwoFactor(_ context.Context, email string, twoFactor TwoFactor) error {
+	return m.update(email, func(user *User) {
+		user.TwoFactor = twoFactor
+	})
+}
+
+// SwapTwoFactor replaces the second-factor state of a user if it still
+// matches old; see UserRepository.
+func (m *MemoryUserRepository) SwapTwoFactor(_ context.Context, email string, old, twoFactor TwoFactor) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[email]
+	if !ok || !user.TwoFactor.sameUse(old) {
+		return ErrNotFound
+	}
+	user.TwoFactor = twoFactor
+	m.users[email] = user
+	return nil
+}
+
+// UpdateProfile replaces the profile fields and preferences of a user.
+func (m *MemoryUserRepository) UpdateProfile(_ context.Context, email string, profile Profile) error {
+	return m.update(email, func(user *User) {
+		user.applyProfile(profile)
+	})
+}
+
+// UpdatePassword replaces the password of a user.
+func (m *MemoryUserRepository) UpdatePassword(_ context.Context, email, password string) error {
+	return m.update(email, func(user *User) {
+		user.Password = password
+	})
+}
+
+// SetDisabled blocks or unblocks logins of a user.
+func (m *MemoryUserRepository) SetDisabled(_ context.Context, email string, disabled bool) error {
+	return m.update(email, func(user *User) {
+		user.Disabled = disabled
+	})
+}
+
+// SetCalendarToken stores the calendar token hash of a user.
+func (m *MemoryUserRepository) SetCalendarToken(_ context.Context, email, hash string) error {
+	return m.update(email, func(user *User) {
+		user.CalendarToken = hash
+	})
+}
+
+// FindByCalendarToken retrieves the user with the calendar token hash or
+// returns ErrNotFound.
+func (m *MemoryUserRepository) FindByCalendarToken(_ context.Context, hash string) (User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, user := range m.users {
+		if hash != "" && user.CalendarToken == hash {
+			return user, nil
+		}
+	}
+	return User{}, ErrNotFound
+}
+
+// Delete removes a user by email.
+func (m *MemoryUserRepository) Delete(_ context.Context, email string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[email]; !ok {
+		return ErrNotFound
+	}
+	delete(m.users, email)
+	return nil
+}
+
+// ScheduleDeletion marks a user for deletion at the given time. A zero time
+// cancels a pending deletion.
+func (m *MemoryUserRepository) ScheduleDeletion(_ context.Context, email string, at time.Time) error {
+	return m.update(email, func(user *User) {
+		user.DeleteAfter = at
+	})
+}
+
+// ListDueForDeletion returns users whose scheduled deletion time is not after before.
+func (m *MemoryUserRepository) ListDueForDeletion(_ context.Context, before time.Time) ([]User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var due []User
+	for _, user := range m.users {
+		if user.dueForDeletion(before) {
+			due = append(due, user)
+		}
+	}
+	sortUsers(due)
+	return due, nil
+}
+
+func (m *MemoryUserRepository) update(email string, apply func(*User)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[email]
+	if !ok {
+		return ErrNotFound
+	}
+	apply(&user)
+	m.users[email] = user
+	return nil
+}
+
+// MemoryTodoRepository keeps todos in process memory.
+type MemoryTodoRepository struct {
+	mu    sync.RWMutex
+	todos map[primitive.ObjectID]Todo
+}
+
+// NewMemoryTodoRepository creates an empty in-memory todo repository.
+func NewMemoryTodoRepository() *MemoryTodoRepository {
+	return &MemoryTodoRepository{todos: make(map[primitive.ObjectID]Todo)}
+}
+
+// List returns todos optionally filtered by email, oldest first.
+func (m *MemoryTodoRepository) List(_ context.Context, email string) ([]Todo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var todos []Todo
+	for _, todo := range m.todos {
+		if email == "" || todo.Email == email {
+			todos = append(todos, todo)
+		}
+	}
+	sortTodos(todos)
+	return todos, nil
+}
+
+// Create stores todo, assigning an ID when it has none.
+func (m *MemoryTodoRepository) Create(_ context.Context, todo Todo) (Todo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if todo.ID.IsZero() {
+		todo.ID = primitive.NewObjectID()
+	}
+	m.todos[todo.ID] = todo
+	return todo, nil
+}
+
+// Update modifies a todo and returns the updated version.
+func (m *MemoryTodoRepository) Update(_ context.Context, id primitive.ObjectID, update TodoUpdate) (Todo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	todo, ok := m.todos[id]
+	if !ok {
+		return Todo{}, ErrNotFound
+	}
+	todo.apply(update)
+	m.todos[id] = todo
+	return todo, nil
+}
+
+// Delete removes a todo by ID.
+func (m *MemoryTodoRepository) Delete(_ context.Context, id primitive.ObjectID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.todos[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.todos, id)
+	return nil
+}
+
+// Clear removes todos optionally filtered by email.
+func (m *MemoryTodoRepository) Clear(_ context.Context, email string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, todo := range m.todos {
+		if email == "" || todo.Email == email {
+			delete(m.todos, id)
+		}
+	}
+	return nil
+}
+
+// Count returns the number of todos owned by email.
+func (m *MemoryTodoRepository) Count(_ context.Context, email string) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var count int64
+	for _, todo := range m.todos {
+		if todo.Email == email {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// TitleBytes returns the total UTF-8 length of the titles of the todos
+// owned by email.
+func (m *MemoryTodoRepository) TitleBytes(_ context.Context, email string) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var total int64
+	for _, todo := range m.todos {
+		if todo.Email == email {
+			total += int64(len(todo.Title))
+		}
+	}
+	return total, nil
+}
+
+// applyProfile copies profile onto the user.
+func (u *User) applyProfile(profile Profile) {
+	u.DisplayName = profile.DisplayName
+	u.TimeZone = profile.TimeZone
+	u.Locale = profile.Locale
+	u.Preferences = profile.Preferences
+}
+
+// sameUse reports whether no code was spent between old and t, the check
+// SwapTwoFactor makes.
+func (t TwoFactor) sameUse(old TwoFactor) bool {
+	return t.LastUsedStep == old.LastUsedStep && len(t.RecoveryCodes) == len(old.RecoveryCodes)
+}
+
+// dueForDeletion reports whether the user's scheduled deletion is not after before.
+func (u User) dueForDeletion(before time.Time) bool {
+	return !u.DeleteAfter.IsZero() && !u.DeleteAfter.After(before)
+}
+
+// apply copies the set fields of update onto the todo.
+func (t *Todo) apply(update TodoUpdate) {
+	if update.Title != nil {
+		t.Title = *update.Title
+	}
+	if update.Completed != nil {
+		t.Completed = *update.Completed
+	}
+	if update.ClearDueAt {
+		t.DueAt = nil
+	} else if update.DueAt != nil {
+		due := *update.DueAt
+		t.DueAt = &due
+	}
+}
+
+func sortUsers(users []User) {
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Email < users[j].Email
+	})
+}
+
+// sortTodos orders todos by creation time, breaking ties by ID.
+func sortTodos(todos []Todo) {
+	sort.Slice(todos, func(i, j int) bool {
+		if !todos[i].CreatedAt.Equal(todos[j].CreatedAt) {
+			return todos[i].CreatedAt.Before(todos[j].CreatedAt)
+		}
+		return todos[i].ID.Hex() < todos[j].ID.Hex()
+	})
+}
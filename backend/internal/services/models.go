@@ -8,18 +8,81 @@ import (
 
 // User represents a registered user in the system.
 type User struct {
-	Email    string `json:"email" bson:"email"`
-	Password string `json:"password,omitempty" bson:"password"`
+	Email       string      `json:"email" bson:"email"`
+	Password    string      `json:"password,omitempty" bson:"password"`
+	DisplayName string      `json:"displayName,omitempty" bson:"displayName,omitempty"`
+	TimeZone    string      `json:"timeZone,omitempty" bson:"timeZone,omitempty"`
+	Locale      string      `json:"locale,omitempty" bson:"locale,omitempty"`
+	Preferences Preferences `json:"preferences" bson:"preferences,omitempty"`
+	TwoFactor   TwoFactor   `json:"-" bson:"twoFactor,omitempty"`
+	// Disabled blocks every login of the user; an administrator sets it.
+	Disabled bool `json:"-" bson:"disabled,omitempty"`
+	// CalendarToken is the SHA-256 hash of the secret in the user's
+	// calendar feed URL; empty while the feed is off.
+	CalendarToken string `json:"-" bson:"calendarToken,omitempty"`
+	// DeleteAfter is set while an account deletion is pending; the account is
+	// purged once this time has passed.
+	DeleteAfter time.Time `json:"-" bson:"deleteAfter,omitempty"`
+}
+
+// Preferences stores UI settings chosen by the user.
+type Preferences struct {
+	// DefaultSort is one of the TodoSort* values.
+	DefaultSort   string `json:"defaultSort,omitempty" bson:"defaultSort,omitempty"`
+	HideCompleted bool   `json:"hideCompleted" bson:"hideCompleted"`
+}
+
+// Supported values for Preferences.DefaultSort.
+const (
+	TodoSortCreatedAsc  = "createdAt"
+	TodoSortCreatedDesc = "-createdAt"
+	TodoSortTitle       = "title"
+	TodoSortDueAt       = "dueAt"
+)
+
+// TwoFactor holds the TOTP second-factor state of a user.
+type TwoFactor struct {
+	// Enabled is set once the user confirmed enrolment with a valid code.
+	Enabled bool `bson:"enabled"`
+	// Secret is the base32 TOTP secret. While Enabled is false it holds the
+	// pending secret generated during enrolment.
+	Secret string `bson:"secret,omitempty"`
+	// RecoveryCodes stores the HMAC-SHA-256 hashes of the unused recovery
+	// codes, keyed with RecoverySalt.
+	RecoveryCodes []string `bson:"recoveryCodes,omitempty"`
+	// RecoverySalt is the random per-user key of the recovery code hashes, so
+	// a leaked users collection cannot be checked against one precomputed
+	// table.
+	RecoverySalt string `bson:"recoverySalt,omitempty"`
+	// LastUsedStep is the TOTP time step of the last accepted code, used to
+	// reject replays.
+	LastUsedStep int64 `bson:"lastUsedStep,omitempty"`
 }
 
 // PublicUser hides sensitive user data when returning it through the API.
 type PublicUser struct {
-	Email string `json:"email"`
+	Email       string       `json:"email"`
+	DisplayName string       `json:"displayName,omitempty"`
+	TimeZone    string       `json:"timeZone,omitempty"`
+	Locale      string       `json:"locale,omitempty"`
+	Preferences *Preferences `json:"preferences,omitempty"`
+	Disabled    bool         `json:"disabled,omitempty"`
 }
 
 // ToPublic converts the User into a PublicUser without exposing the password.
 func (u User) ToPublic() PublicUser {
-	return PublicUser{Email: u.Email}
+	public := PublicUser{
+		Email:       u.Email,
+		DisplayName: u.DisplayName,
+		TimeZone:    u.TimeZone,
+		Locale:      u.Locale,
+		Disabled:    u.Disabled,
+	}
+	if u.Preferences != (Preferences{}) {
+		prefs := u.Preferences
+		public.Preferences = &prefs
+	}
+	return public
 }
 
 // Todo models a task stored in MongoDB.
@@ -29,15 +92,17 @@ type Todo struct {
 	Title     string             `json:"title" bson:"title"`
 	Completed bool               `json:"completed" bson:"completed"`
 	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	DueAt     *time.Time         `json:"dueAt,omitempty" bson:"dueAt,omitempty"`
 }
 
 // TodoResponse is the representation exposed through the API.
 type TodoResponse struct {
-	ID        string    `json:"id"`
-	Email     string    `json:"email"`
-	Title     string    `json:"title"`
-	Completed bool      `json:"completed"`
-	CreatedAt time.Time `json:"createdAt"`
+	ID        string     `json:"id"`
+	Email     string     `json:"email"`
+	Title     string     `json:"title"`
+	Completed bool       `json:"completed"`
+	CreatedAt time.Time  `json:"createdAt"`
+	DueAt     *time.Time `json:"dueAt,omitempty"`
 }
 
 // ToResponse converts a Todo into an externally safe representation.
@@ -48,5 +113,6 @@ func (t Todo) ToResponse() TodoResponse {
 		Title:     t.Title,
 		Completed: t.Completed,
 		CreatedAt: t.CreatedAt,
+		DueAt:     t.DueAt,
 	}
 }
@@ -2,7 +2,9 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -70,6 +72,66 @@ func TestMongoUserRepositoryExercisesCRUD(t *testing.T) {
 		}
 	})
 
+	mt.Run("insert duplicate email", func(mt *mtest.T) {
+		repo := NewMongoUserRepository(mt.Coll)
+		mt.AddMockResponses(mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "duplicate key"}))
+
+		err := repo.Insert(context.Background(), User{Email: "alice@example.com"})
+		if err != ErrUserAlreadyExists {
+			mt.Fatalf("expected ErrUserAlreadyExists, got %v", err)
+		}
+	})
+
+	mt.Run("update two factor requires existing user", func(mt *mtest.T) {
+		repo := NewMongoUserRepository(mt.Coll)
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}),
+		)
+
+		if err := repo.UpdateTwoFactor(context.Background(), "alice@example.com", TwoFactor{Enabled: true, Secret: "ABC"}); err != nil {
+			mt.Fatalf("update two factor failed: %v", err)
+		}
+		if err := repo.UpdateTwoFactor(context.Background(), "missing@example.com", TwoFactor{}); err != ErrNotFound {
+			mt.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	})
+
+	mt.Run("swap two factor reports a lost race", func(mt *mtest.T) {
+		repo := NewMongoUserRepository(mt.Coll)
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}),
+		)
+
+		old := TwoFactor{Enabled: true, RecoveryCodes: []string{"a"}, LastUsedStep: 3}
+		if err := repo.SwapTwoFactor(context.Background(), "alice@example.com", old, TwoFactor{Enabled: true, LastUsedStep: 3}); err != nil {
+			mt.Fatalf("swap failed: %v", err)
+		}
+		if err := repo.SwapTwoFactor(context.Background(), "alice@example.com", old, TwoFactor{}); err != ErrNotFound {
+			mt.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	})
+
+	mt.Run("delete and schedule deletion", func(mt *mtest.T) {
+		repo := NewMongoUserRepository(mt.Coll)
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+		)
+
+		if err := repo.Delete(context.Background(), "alice@example.com"); err != nil {
+			mt.Fatalf("delete failed: %v", err)
+		}
+		if err := repo.Delete(context.Background(), "missing@example.com"); err != ErrNotFound {
+			mt.Fatalf("expected ErrNotFound, got %v", err)
+		}
+		if err := repo.ScheduleDeletion(context.Background(), "alice@example.com", time.Now()); err != nil {
+			mt.Fatalf("schedule deletion failed: %v", err)
+		}
+	})
+
 	mt.Run("clear users succeeds", func(mt *mtest.T) {
 		repo := NewMongoUserRepository(mt.Coll)
 		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 2}))
@@ -166,6 +228,42 @@ func TestMongoTodoRepositoryExercisesCRUD(t *testing.T) {
 			mt.Fatalf("clear failed: %v", err)
 		}
 	})
+
+	mt.Run("count todos by email and ensure indexes", func(mt *mtest.T) {
+		repo := NewMongoTodoRepository(mt.Coll)
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, collectionNamespace(mt), mtest.FirstBatch, bson.D{{Key: "n", Value: int32(7)}}),
+			mtest.CreateSuccessResponse(),
+		)
+
+		count, err := repo.Count(context.Background(), "user@example.com")
+		if err != nil || count != 7 {
+			mt.Fatalf("unexpected count %d: %v", count, err)
+		}
+		if err := repo.EnsureIndexes(context.Background()); err != nil {
+			mt.Fatalf("ensure indexes failed: %v", err)
+		}
+	})
+
+	mt.Run("title bytes are summed on the server", func(mt *mtest.T) {
+		repo := NewMongoTodoRepository(mt.Coll)
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, collectionNamespace(mt), mtest.FirstBatch, bson.D{{Key: "_id", Value: nil}, {Key: "bytes", Value: int32(42)}}),
+			mtest.CreateCursorResponse(0, collectionNamespace(mt), mtest.FirstBatch),
+		)
+
+		total, err := repo.TitleBytes(context.Background(), "user@example.com")
+		if err != nil || total != 42 {
+			mt.Fatalf("unexpected title bytes %d: %v", total, err)
+		}
+		if started := mt.GetStartedEvent(); started == nil || started.CommandName != "aggregate" {
+			mt.Fatalf("expected an aggregate command, got %+v", started)
+		}
+		total, err = repo.TitleBytes(context.Background(), "nobody@example.com")
+		if err != nil || total != 0 {
+			mt.Fatalf("expected no bytes for a user without todos, got %d: %v", total, err)
+		}
+	})
 }
 
 // TestConnectMongoCancelledContext ensures ConnectMongo respects context cancellation.
@@ -178,3 +276,108 @@ func TestConnectMongoCancelledContext(t *testing.T) {
 		t.Fatalf("expected error from cancelled context")
 	}
 }
+
+// TestCheckIndexesReportsMissingIndexes lists indexes through mocked cursors.
+func TestCheckIndexesReportsMissingIndexes(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock).CreateCollection(false))
+
+	indexes := func(mt *mtest.T, names ...string) {
+		docs := make([]bson.D, 0, len(names))
+		for _, name := range names {
+			docs = append(docs, bson.D{
+				{Key: "v", Value: 2},
+				{Key: "key", Value: bson.D{{Key: name, Value: 1}}},
+				{Key: "name", Value: name},
+			})
+		}
+		ns := mt.DB.Name() + ".sessions"
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, docs...))
+	}
+	required := map[string][]string{"sessions": {"expiresAt_ttl", "email"}}
+
+	mt.Run("all present", func(mt *mtest.T) {
+		indexes(mt, "_id_", "expiresAt_ttl", "email")
+		if err := CheckIndexes(context.Background(), mt.DB, required); err != nil {
+			mt.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	mt.Run("missing", func(mt *mtest.T) {
+		indexes(mt, "_id_", "expiresAt_ttl")
+		err := CheckIndexes(context.Background(), mt.DB, required)
+		if err == nil || err.Error() != "missing indexes: sessions.email" {
+			mt.Fatalf("expected missing email index, got %v", err)
+		}
+	})
+}
+
+// TestEnsureSchemaAppliesValidatorsAndIndexes walks both validator paths
+// with mocked responses.
+func TestEnsureSchemaAppliesValidatorsAndIndexes(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock).CreateCollection(false))
+	schemas := []CollectionSchema{{Collection: "users", Indexes: userIndexes, Validator: userValidator, Conflicts: duplicateEmailsConflict}}
+
+	mt.Run("existing collection", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse())
+		if err := EnsureSchema(context.Background(), mt.DB, schemas); err != nil {
+			mt.Fatalf("ensure schema failed: %v", err)
+		}
+		if cmd := mt.GetStartedEvent(); cmd.CommandName != "collMod" {
+			mt.Fatalf("expected collMod, got %s", cmd.CommandName)
+		}
+	})
+
+	mt.Run("missing collection is created", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 26, Name: "NamespaceNotFound", Message: "ns does not exist"}),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+		)
+		if err := EnsureSchema(context.Background(), mt.DB, schemas); err != nil {
+			mt.Fatalf("ensure schema failed: %v", err)
+		}
+		mt.GetStartedEvent()
+		if cmd := mt.GetStartedEvent(); cmd.CommandName != "create" {
+			mt.Fatalf("expected create, got %s", cmd.CommandName)
+		}
+	})
+
+	mt.Run("duplicate emails are named", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(),
+			mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 11000, Name: "DuplicateKey", Message: "E11000 duplicate key error"}),
+			mtest.CreateCursorResponse(0, mt.DB.Name()+".users", mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: "ana@example.com"}, {Key: "count", Value: 2}},
+				bson.D{{Key: "_id", Value: "bruno@example.com"}, {Key: "count", Value: 3}},
+			),
+		)
+		err := EnsureSchema(context.Background(), mt.DB, schemas)
+		var duplicates *DuplicateEmailsError
+		if !errors.As(err, &duplicates) {
+			mt.Fatalf("expected a DuplicateEmailsError, got %v", err)
+		}
+		if !strings.Contains(err.Error(), "ana@example.com, bruno@example.com") {
+			mt.Fatalf("expected the emails to be named, got %v", err)
+		}
+	})
+
+	mt.Run("other errors are returned", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 13, Name: "Unauthorized", Message: "not allowed"}))
+		if err := EnsureSchema(context.Background(), mt.DB, schemas); err == nil {
+			mt.Fatalf("expected an error")
+		}
+	})
+}
+
+// TestRequiredIndexesCoverSchemas keeps the health check in line with Schemas.
+func TestRequiredIndexesCoverSchemas(t *testing.T) {
+	if got := RequiredIndexes["users"]; len(got) != 2 || got[0] != "email_unique" || got[1] != "calendarToken_unique" {
+		t.Errorf("unexpected users indexes %v", got)
+	}
+	if got := RequiredIndexes["sessions"]; len(got) != 2 {
+		t.Errorf("unexpected sessions indexes %v", got)
+	}
+	if len(RequiredIndexes) != len(Schemas) {
+		t.Errorf("expected every collection to have indexes, got %v", RequiredIndexes)
+	}
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"regexp"
+	"time"
+	"unicode/utf8"
+)
+
+// maxDisplayNameLength bounds display names, counted in runes.
+const maxDisplayNameLength = 80
+
+// localePattern accepts BCP 47 style tags such as "es", "en-US" or "es-419".
+var localePattern = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+// Profile is the user-editable part of a User.
+type Profile struct {
+	DisplayName string
+	TimeZone    string
+	Locale      string
+	Preferences Preferences
+}
+
+// ProfileUpdate models a partial profile change; nil fields are left as is.
+type ProfileUpdate struct {
+	DisplayName   *string
+	TimeZone      *string
+	Locale        *string
+	DefaultSort   *string
+	HideCompleted *bool
+}
+
+func (u User) profile() Profile {
+	return Profile{
+		DisplayName: u.DisplayName,
+		TimeZone:    u.TimeZone,
+		Locale:      u.Locale,
+		Preferences: u.Preferences,
+	}
+}
+
+// GetProfile returns the public representation of the user identified by email.
+func (s *UserService) GetProfile(ctx context.Context, email string) (_ PublicUser, err error) {
+	ctx, span := startSpan(ctx, "UserService.GetProfile")
+	defer func() { endSpan(span, err) }()
+
+	email = NormalizeEmail(email)
+	if email == "" {
+		return PublicUser{}, ErrInvalidUserInput
+	}
+
+	user, err := s.repo.FindByEmail(ctx, email)
+	if err != nil {
+		return PublicUser{}, err
+	}
+	return user.ToPublic(), nil
+}
+
+// UpdateProfile validates and applies a partial profile change and returns
+// the updated user. Empty strings clear the corresponding field.
+func (s *UserService) UpdateProfile(ctx context.Context, email string, update ProfileUpdate) (_ PublicUser, err error) {
+	ctx, span := startSpan(ctx, "UserService.UpdateProfile")
+	defer func() { endSpan(span, err) }()
+
+	email = NormalizeEmail(email)
+	if email == "" {
+		return PublicUser{}, ErrInvalidUserInput
+	}
+
+	user, err := s.repo.FindByEmail(ctx, email)
+	if err != nil {
+		return PublicUser{}, err
+	}
+
+	profile := user.profile()
+	if update.DisplayName != nil {
+		profile.DisplayName = NormalizeText(*update.DisplayName)
+		if utf8.RuneCountInString(profile.DisplayName) > maxDisplayNameLength {
+			return PublicUser{}, ErrInvalidUserInput
+		}
+	}
+	if update.TimeZone != nil {
+		profile.TimeZone = NormalizeText(*update.TimeZone)
+		if profile.TimeZone != "" {
+			if _, err := time.LoadLocation(profile.TimeZone); err != nil {
+				return PublicUser{}, ErrInvalidUserInput
+			}
+		}
+	}
+	if update.Locale != nil {
+		profile.Locale = NormalizeText(*update.Locale)
+		if profile.Locale != "" && !localePattern.MatchString(profile.Locale) {
+			return PublicUser{}, ErrInvalidUserInput
+		}
+	}
+	if update.DefaultSort != nil {
+		profile.Preferences.DefaultSort = NormalizeText(*update.DefaultSort)
+		if !validTodoSort(profile.Preferences.DefaultSort) {
+			return PublicUser{}, ErrInvalidUserInput
+		}
+	}
+	if update.HideCompleted != nil {
+		profile.Preferences.HideCompleted = *update.HideCompleted
+	}
+
+	if err := s.repo.UpdateProfile(ctx, email, profile); err != nil {
+		return PublicUser{}, err
+	}
+
+	user.DisplayName = profile.DisplayName
+	user.TimeZone = profile.TimeZone
+	user.Locale = profile.Locale
+	user.Preferences = profile.Preferences
+	return user.ToPublic(), nil
+}
+
+// Location returns the time zone configured by the user, or UTC when none is
+// set. It makes UserService usable as a LocationResolver.
+func (s *UserService) Location(ctx context.Context, email string) (_ *time.Location, err error) {
+	ctx, span := startSpan(ctx, "UserService.Location")
+	defer func() { endSpan(span, err) }()
+
+	user, err := s.repo.FindByEmail(ctx, NormalizeEmail(email))
+	if err != nil {
+		return nil, err
+	}
+	if user.TimeZone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(user.TimeZone)
+}
+
+func validTodoSort(sort string) bool {
+	switch sort {
+	case "", TodoSortCreatedAsc, TodoSortCreatedDesc, TodoSortTitle, TodoSortDueAt:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestUserServiceUpdateProfileAppliesPartialChanges(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryUserRepository()
+	seedUsers(t, repo, User{Email: "ana@example.com", Password: "secret"})
+	service := NewUserService(repo)
+
+	user, err := service.UpdateProfile(ctx, "Ana@Example.com", ProfileUpdate{
+		DisplayName: strPtr(" Ana "),
+		TimeZone:    strPtr("America/Argentina/Cordoba"),
+		Locale:      strPtr("es-AR"),
+		DefaultSort: strPtr(TodoSortDueAt),
+	})
+	if err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if user.DisplayName != "Ana" || user.TimeZone != "America/Argentina/Cordoba" || user.Locale != "es-AR" {
+		t.Errorf("unexpected profile: %+v", user)
+	}
+	if user.Preferences == nil || user.Preferences.DefaultSort != TodoSortDueAt {
+		t.Errorf("expected default sort to be stored, got %+v", user.Preferences)
+	}
+
+	hide := true
+	if _, err := service.UpdateProfile(ctx, "ana@example.com", ProfileUpdate{HideCompleted: &hide}); err != nil {
+		t.Fatalf("second update failed: %v", err)
+	}
+	stored, _ := repo.FindByEmail(ctx, "ana@example.com")
+	if stored.DisplayName != "Ana" || stored.Preferences.DefaultSort != TodoSortDueAt || !stored.Preferences.HideCompleted {
+		t.Errorf("expected untouched fields to be kept, got %+v", stored)
+	}
+	if stored.Password != "secret" {
+		t.Errorf("expected password to be kept")
+	}
+}
+
+func TestUserServiceUpdateProfileValidatesInput(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryUserRepository()
+	seedUsers(t, repo, User{Email: "ana@example.com"})
+	service := NewUserService(repo)
+
+	cases := map[string]ProfileUpdate{
+		"time zone": {TimeZone: strPtr("Mars/Olympus_Mons")},
+		"locale":    {Locale: strPtr("not a locale")},
+		"sort":      {DefaultSort: strPtr("random")},
+	}
+	for name, update := range cases {
+		if _, err := service.UpdateProfile(ctx, "ana@example.com", update); !errors.Is(err, ErrInvalidUserInput) {
+			t.Errorf("%s: expected ErrInvalidUserInput, got %v", name, err)
+		}
+	}
+
+	if _, err := service.UpdateProfile(ctx, "missing@example.com", ProfileUpdate{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestUserServiceLocationDefaultsToUTC(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryUserRepository()
+	seedUsers(t, repo, User{Email: "ana@example.com"}, User{Email: "bob@example.com", TimeZone: "Asia/Tokyo"})
+	service := NewUserService(repo)
+
+	loc, err := service.Location(ctx, "ana@example.com")
+	if err != nil || loc != time.UTC {
+		t.Errorf("expected UTC, got %v (%v)", loc, err)
+	}
+	loc, err = service.Location(ctx, "bob@example.com")
+	if err != nil || loc.String() != "Asia/Tokyo" {
+		t.Errorf("expected Asia/Tokyo, got %v (%v)", loc, err)
+	}
+}
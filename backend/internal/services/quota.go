@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrQuotaExceeded is returned when a change would take a user past one of
+// the limits of their TodoQuota.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// Quotas reported in QuotaError.Quota.
+const (
+	QuotaTodos       = "todos"
+	QuotaTitleLength = "titleLength"
+	QuotaBytes       = "bytes"
+)
+
+// QuotaError names the exceeded quota and its limit. It matches
+// ErrQuotaExceeded through errors.Is.
+type QuotaError struct {
+	Quota string
+	Limit int
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s: %s limited to %d", ErrQuotaExceeded, e.Quota, e.Limit)
+}
+
+// Is reports whether target is ErrQuotaExceeded.
+func (e *QuotaError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+// TodoQuota limits what a single user may store.
+type TodoQuota struct {
+	// MaxTodos caps the number of todos per user; zero means unlimited.
+	MaxTodos int
+	// MaxTitleLength lowers the title limit below MaxTitleLength; zero
+	// keeps MaxTitleLength.
+	MaxTitleLength int
+	// MaxBytes caps the total UTF-8 length of the titles of a user's
+	// todos; zero means unlimited.
+	MaxBytes int
+}
+
+// DefaultTodoQuota keeps a single account from growing without bounds.
+var DefaultTodoQuota = TodoQuota{MaxTodos: 1000, MaxBytes: 1 << 20}
+
+// titleLimit is the effective maximum title length.
+func (q TodoQuota) titleLimit() int {
+	if q.MaxTitleLength > 0 && q.MaxTitleLength < MaxTitleLength {
+		return q.MaxTitleLength
+	}
+	return MaxTitleLength
+}
+
+// QuotaUsage reports how much of a quota is used. A zero Limit means
+// unlimited.
+type QuotaUsage struct {
+	Used  int64 `json:"used"`
+	Limit int   `json:"limit"`
+}
+
+// TodoUsage reports the usage of a user against their TodoQuota.
+type TodoUsage struct {
+	Todos          QuotaUsage `json:"todos"`
+	Bytes          QuotaUsage `json:"bytes"`
+	MaxTitleLength int        `json:"maxTitleLength"`
+}
+
+// WithTodoQuota enforces quota on every user.
+func WithTodoQuota(quota TodoQuota) TodoServiceOption {
+	return func(s *TodoService) {
+		s.quota = quota
+	}
+}
+
+// Usage reports the usage of email against the quota. It counts todos and
+// title bytes in the repository instead of loading them.
+func (s *TodoService) Usage(ctx context.Context, email string) (_ TodoUsage, err error) {
+	ctx, span := startSpan(ctx, "TodoService.Usage")
+	defer func() { endSpan(span, err) }()
+
+	email = NormalizeEmail(email)
+	if email == "" {
+		return TodoUsage{}, ErrInvalidTodoInput
+	}
+
+	count, err := s.repo.Count(ctx, email)
+	if err != nil {
+		return TodoUsage{}, err
+	}
+	bytes, err := s.repo.TitleBytes(ctx, email)
+	if err != nil {
+		return TodoUsage{}, err
+	}
+	return TodoUsage{
+		Todos:          QuotaUsage{Used: count, Limit: s.quota.MaxTodos},
+		Bytes:          QuotaUsage{Used: bytes, Limit: s.quota.MaxBytes},
+		MaxTitleLength: s.quota.titleLimit(),
+	}, nil
+}
+
+// reserveTodos fails when email cannot store n more todos holding bytes
+// more title bytes. Concurrent creations may overshoot the limits by the
+// requests in flight, and title updates are not checked: they can grow a
+// todo by at most the title limit.
+func (s *TodoService) reserveTodos(ctx context.Context, email string, n int, bytes int64) error {
+	todos, stored, err := s.remaining(ctx, email)
+	if err != nil {
+		return err
+	}
+	switch {
+	case todos >= 0 && int64(n) > todos:
+		return &QuotaError{Quota: QuotaTodos, Limit: s.quota.MaxTodos}
+	case stored >= 0 && bytes > stored:
+		return &QuotaError{Quota: QuotaBytes, Limit: s.quota.MaxBytes}
+	}
+	return nil
+}
+
+// remaining returns how many more todos and title bytes email may store; -1
+// means unlimited. Only the limits that are set are looked up.
+func (s *TodoService) remaining(ctx context.Context, email string) (todos, bytes int64, err error) {
+	todos, bytes = -1, -1
+	if s.quota.MaxTodos > 0 {
+		count, err := s.repo.Count(ctx, email)
+		if err != nil {
+			return 0, 0, err
+		}
+		todos = max(int64(s.quota.MaxTodos)-count, 0)
+	}
+	if s.quota.MaxBytes > 0 {
+		stored, err := s.repo.TitleBytes(ctx, email)
+		if err != nil {
+			return 0, 0, err
+		}
+		bytes = max(int64(s.quota.MaxBytes)-stored, 0)
+	}
+	return todos, bytes, nil
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestTodoServiceEnforcesTodoQuota rejects todos past MaxTodos per user.
+func TestTodoServiceEnforcesTodoQuota(t *testing.T) {
+	ctx := context.Background()
+	service := NewTodoService(NewMemoryTodoRepository(), fixedNow, WithTodoQuota(TodoQuota{MaxTodos: 2}))
+
+	for i := 0; i < 2; i++ {
+		if _, err := service.Create(ctx, "user@example.com", "task"); err != nil {
+			t.Fatalf("create failed: %v", err)
+		}
+	}
+
+	_, err := service.Create(ctx, "USER@example.com", "one too many")
+	var quota *QuotaError
+	if !errors.As(err, &quota) || quota.Quota != QuotaTodos || quota.Limit != 2 {
+		t.Fatalf("expected todos quota error, got %v", err)
+	}
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("expected QuotaError to match ErrQuotaExceeded")
+	}
+
+	if _, err := service.Create(ctx, "other@example.com", "task"); err != nil {
+		t.Errorf("expected other users to keep their own quota, got %v", err)
+	}
+
+	usage, err := service.Usage(ctx, "user@example.com")
+	if err != nil {
+		t.Fatalf("usage failed: %v", err)
+	}
+	want := TodoUsage{Todos: QuotaUsage{Used: 2, Limit: 2}, Bytes: QuotaUsage{Used: 8}, MaxTitleLength: MaxTitleLength}
+	if usage != want {
+		t.Errorf("unexpected usage %+v", usage)
+	}
+}
+
+// TestTodoServiceEnforcesByteQuota rejects todos whose title would take a
+// user past MaxBytes, counting bytes rather than characters.
+func TestTodoServiceEnforcesByteQuota(t *testing.T) {
+	ctx := context.Background()
+	service := NewTodoService(NewMemoryTodoRepository(), fixedNow, WithTodoQuota(TodoQuota{MaxBytes: 10}))
+
+	if _, err := service.Create(ctx, "user@example.com", "señal"); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	_, err := service.Create(ctx, "user@example.com", "aaaaa")
+	var quota *QuotaError
+	if !errors.As(err, &quota) || quota.Quota != QuotaBytes || quota.Limit != 10 {
+		t.Fatalf("expected bytes quota error, got %v", err)
+	}
+	if _, err := service.Create(ctx, "user@example.com", "aaaa"); err != nil {
+		t.Fatalf("expected a title filling the quota to be accepted, got %v", err)
+	}
+
+	usage, err := service.Usage(ctx, "user@example.com")
+	if err != nil {
+		t.Fatalf("usage failed: %v", err)
+	}
+	if usage.Bytes != (QuotaUsage{Used: 10, Limit: 10}) {
+		t.Errorf("unexpected bytes usage %+v", usage.Bytes)
+	}
+}
+
+// TestTodoServiceEnforcesTitleQuota applies the lower title limit on create
+// and update while keeping MaxTitleLength as the hard limit.
+func TestTodoServiceEnforcesTitleQuota(t *testing.T) {
+	ctx := context.Background()
+	service := NewTodoService(NewMemoryTodoRepository(), fixedNow, WithTodoQuota(TodoQuota{MaxTitleLength: 10}))
+
+	_, err := service.Create(ctx, "user@example.com", strings.Repeat("a", 11))
+	var quota *QuotaError
+	if !errors.As(err, &quota) || quota.Quota != QuotaTitleLength || quota.Limit != 10 {
+		t.Fatalf("expected title quota error, got %v", err)
+	}
+
+	created, err := service.Create(ctx, "user@example.com", strings.Repeat("a", 10))
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	long := strings.Repeat("b", 11)
+	if _, err := service.Update(ctx, created.ID, TodoUpdate{Title: &long}); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("expected update to respect the title quota, got %v", err)
+	}
+
+	unlimited := NewTodoService(NewMemoryTodoRepository(), fixedNow, WithTodoQuota(TodoQuota{MaxTitleLength: 500}))
+	if _, err := unlimited.Create(ctx, "user@example.com", strings.Repeat("a", MaxTitleLength+1)); !errors.Is(err, ErrInvalidTodoInput) {
+		t.Errorf("expected MaxTitleLength to stay the hard limit, got %v", err)
+	}
+}
@@ -0,0 +1,273 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RateLimit is a token bucket holding up to Burst tokens that refills
+// completely every Period. The zero value disables limiting.
+type RateLimit struct {
+	Burst  int
+	Period time.Duration
+}
+
+// ParseRateLimit parses "<burst>/<period>", e.g. "20/1m". "0" and "off"
+// disable limiting.
+func ParseRateLimit(s string) (RateLimit, error) {
+	s = strings.TrimSpace(s)
+	if s == "0" || strings.EqualFold(s, "off") {
+		return RateLimit{}, nil
+	}
+	burst, period, ok := strings.Cut(s, "/")
+	n, err := strconv.Atoi(burst)
+	if !ok || err != nil || n <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q", s)
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q", s)
+	}
+	return RateLimit{Burst: n, Period: d}, nil
+}
+
+// Enabled reports whether the limit restricts anything.
+func (l RateLimit) Enabled() bool {
+	return l.Burst > 0 && l.Period > 0
+}
+
+func (l RateLimit) String() string {
+	return fmt.Sprintf("%d/%s", l.Burst, l.Period)
+}
+
+// perSecond is the refill rate of the bucket.
+func (l RateLimit) perSecond() float64 {
+	return float64(l.Burst) / l.Period.Seconds()
+}
+
+// RateLimits are the limits of each route group.
+type RateLimits struct {
+	// Auth covers registration, login, two-factor and logout.
+	Auth RateLimit
+	// Read covers listing todos, users and the account.
+	Read RateLimit
+	// Write covers every other mutation.
+	Write RateLimit
+}
+
+// DefaultRateLimits keep auth routes strict and leave room for busy clients.
+var DefaultRateLimits = RateLimits{
+	Auth:  RateLimit{Burst: 20, Period: time.Minute},
+	Read:  RateLimit{Burst: 300, Period: time.Minute},
+	Write: RateLimit{Burst: 120, Period: time.Minute},
+}
+
+// RateBucket is the persisted state of a token bucket.
+type RateBucket struct {
+	Key       string    `bson:"_id"`
+	Tokens    float64   `bson:"tokens"`
+	UpdatedAt time.Time `bson:"updatedAt"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+	// Allowed reports whether the last Take consumed a token.
+	Allowed bool `bson:"allowed"`
+}
+
+// RateLimitStore refills and takes tokens from buckets atomically.
+type RateLimitStore interface {
+	// Take refills the bucket of key up to now and consumes one token if
+	// available, returning the updated bucket.
+	Take(ctx context.Context, key string, limit RateLimit, now time.Time) (RateBucket, error)
+}
+
+// RateDecision is the outcome of RateLimiter.Allow.
+type RateDecision struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long until the next token when Allowed is false.
+	RetryAfter time.Duration
+}
+
+// RateLimiter applies token-bucket limits on top of a store.
+type RateLimiter struct {
+	store RateLimitStore
+	now   func() time.Time
+}
+
+// NewRateLimiter builds a RateLimiter. A nil store keeps buckets in memory.
+func NewRateLimiter(store RateLimitStore, now func() time.Time) *RateLimiter {
+	if now == nil {
+		now = time.Now
+	}
+	if store == nil {
+		store = NewMemoryRateLimitStore()
+	}
+	return &RateLimiter{store: store, now: now}
+}
+
+// Allow takes a token for key under limit.
+func (r *RateLimiter) Allow(ctx context.Context, key string, limit RateLimit) (RateDecision, error) {
+	if !limit.Enabled() {
+		return RateDecision{Allowed: true}, nil
+	}
+
+	bucket, err := r.store.Take(ctx, key, limit, r.now())
+	if err != nil {
+		return RateDecision{}, err
+	}
+
+	rate := limit.perSecond()
+	decision := RateDecision{
+		Allowed:   bucket.Allowed,
+		Limit:     limit.Burst,
+		Remaining: int(math.Floor(bucket.Tokens)),
+		Reset:     secondsToDuration((float64(limit.Burst) - bucket.Tokens) / rate),
+	}
+	if !bucket.Allowed {
+		decision.RetryAfter = secondsToDuration((1 - bucket.Tokens) / rate)
+	}
+	return decision, nil
+}
+
+func secondsToDuration(s float64) time.Duration {
+	if s <= 0 {
+		return 0
+	}
+	return time.Duration(s * float64(time.Second))
+}
+
+// refill returns the tokens available at now in a bucket last updated at
+// updatedAt.
+func refill(tokens float64, updatedAt, now time.Time, limit RateLimit) float64 {
+	if elapsed := now.Sub(updatedAt); elapsed > 0 {
+		tokens += elapsed.Seconds() * limit.perSecond()
+	}
+	return math.Min(tokens, float64(limit.Burst))
+}
+
+// MemoryRateLimitStore keeps buckets in process memory. Each replica
+// limits on its own; use MongoRateLimitStore to share buckets.
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]RateBucket
+	swept   time.Time
+}
+
+// NewMemoryRateLimitStore creates an empty in-memory store.
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: make(map[string]RateBucket)}
+}
+
+// rateSweepInterval is how often full buckets are dropped from memory.
+const rateSweepInterval = time.Minute
+
+// Take refills and takes a token from the bucket of key.
+func (m *MemoryRateLimitStore) Take(_ context.Context, key string, limit RateLimit, now time.Time) (RateBucket, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sweep(now)
+
+	bucket, ok := m.buckets[key]
+	if !ok || !now.Before(bucket.ExpiresAt) {
+		bucket = RateBucket{Key: key, Tokens: float64(limit.Burst), UpdatedAt: now}
+	}
+	bucket.Tokens = refill(bucket.Tokens, bucket.UpdatedAt, now, limit)
+	bucket.Allowed = bucket.Tokens >= 1
+	if bucket.Allowed {
+		bucket.Tokens--
+	}
+	bucket.UpdatedAt = now
+	bucket.ExpiresAt = now.Add(limit.Period)
+	m.buckets[key] = bucket
+	return bucket, nil
+}
+
+// sweep drops buckets that refilled completely, bounding memory use.
+func (m *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(m.swept) < rateSweepInterval {
+		return
+	}
+	m.swept = now
+	for key, bucket := range m.buckets {
+		if !now.Before(bucket.ExpiresAt) {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+// MongoRateLimitStore shares buckets between replicas through MongoDB.
+// Documents are removed by a TTL index on expiresAt once they refilled.
+type MongoRateLimitStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoRateLimitStore creates a new store wrapper around a Mongo collection.
+func NewMongoRateLimitStore(collection *mongo.Collection) *MongoRateLimitStore {
+	return &MongoRateLimitStore{collection: collection}
+}
+
+// EnsureIndexes creates the TTL index that expires refilled buckets.
+func (m *MongoRateLimitStore) EnsureIndexes(ctx context.Context) error {
+	return createIndexes(ctx, m.collection, expiresAtTTLIndexes)
+}
+
+// Take refills and takes a token in a single upsert, so concurrent requests
+// on different replicas cannot overspend the bucket.
+func (m *MongoRateLimitStore) Take(ctx context.Context, key string, limit RateLimit, now time.Time) (RateBucket, error) {
+	burst := float64(limit.Burst)
+	// Buckets past expiresAt are full again, even if not yet reaped.
+	current := bson.D{{Key: "$cond", Value: bson.A{
+		bson.D{{Key: "$gt", Value: bson.A{"$expiresAt", now}}},
+		"$tokens",
+		burst,
+	}}}
+	elapsedMs := bson.D{{Key: "$max", Value: bson.A{
+		0,
+		bson.D{{Key: "$subtract", Value: bson.A{now, bson.D{{Key: "$ifNull", Value: bson.A{"$updatedAt", now}}}}}},
+	}}}
+	refilled := bson.D{{Key: "$min", Value: bson.A{
+		burst,
+		bson.D{{Key: "$add", Value: bson.A{
+			current,
+			bson.D{{Key: "$multiply", Value: bson.A{elapsedMs, limit.perSecond() / 1000}}},
+		}}},
+	}}}
+	allowed := bson.D{{Key: "$gte", Value: bson.A{"$tokens", 1}}}
+
+	res := m.collection.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": key},
+		mongo.Pipeline{
+			{{Key: "$set", Value: bson.D{{Key: "tokens", Value: refilled}}}},
+			{{Key: "$set", Value: bson.D{
+				{Key: "allowed", Value: allowed},
+				{Key: "tokens", Value: bson.D{{Key: "$cond", Value: bson.A{
+					allowed,
+					bson.D{{Key: "$subtract", Value: bson.A{"$tokens", 1}}},
+					"$tokens",
+				}}}},
+				{Key: "updatedAt", Value: now},
+				{Key: "expiresAt", Value: now.Add(limit.Period)},
+			}}},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	)
+
+	var bucket RateBucket
+	if err := res.Decode(&bucket); err != nil {
+		return RateBucket{}, err
+	}
+	return bucket, nil
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// TestParseRateLimit covers the "<burst>/<period>" format.
+func TestParseRateLimit(t *testing.T) {
+	limit, err := ParseRateLimit(" 20/1m ")
+	if err != nil || limit != (RateLimit{Burst: 20, Period: time.Minute}) {
+		t.Errorf("unexpected limit %v %v", limit, err)
+	}
+	for _, off := range []string{"0", "off", "OFF"} {
+		if limit, err := ParseRateLimit(off); err != nil || limit.Enabled() {
+			t.Errorf("expected %q to disable limiting, got %v %v", off, limit, err)
+		}
+	}
+	for _, invalid := range []string{"20", "x/1m", "-1/1m", "20/soon", "20/0s"} {
+		if _, err := ParseRateLimit(invalid); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
+
+// TestRateLimiterTokenBucket drains a bucket and checks it refills over time.
+func TestRateLimiterTokenBucket(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: fixedNow()}
+	limiter := NewRateLimiter(nil, clock.Now)
+	limit := RateLimit{Burst: 3, Period: 3 * time.Second}
+
+	for i := 2; i >= 0; i-- {
+		decision, err := limiter.Allow(ctx, "ip:10.0.0.1", limit)
+		if err != nil || !decision.Allowed || decision.Remaining != i {
+			t.Fatalf("expected request to pass with %d remaining, got %+v %v", i, decision, err)
+		}
+	}
+
+	decision, _ := limiter.Allow(ctx, "ip:10.0.0.1", limit)
+	if decision.Allowed {
+		t.Fatalf("expected empty bucket to reject")
+	}
+	if decision.RetryAfter != time.Second || decision.Reset != 3*time.Second {
+		t.Errorf("unexpected wait %v reset %v", decision.RetryAfter, decision.Reset)
+	}
+
+	if other, _ := limiter.Allow(ctx, "ip:10.0.0.2", limit); !other.Allowed {
+		t.Errorf("expected other keys to have their own bucket")
+	}
+
+	clock.Advance(time.Second)
+	if decision, _ := limiter.Allow(ctx, "ip:10.0.0.1", limit); !decision.Allowed || decision.Remaining != 0 {
+		t.Errorf("expected one token after a second, got %+v", decision)
+	}
+
+	clock.Advance(time.Hour)
+	if decision, _ := limiter.Allow(ctx, "ip:10.0.0.1", limit); decision.Remaining != 2 {
+		t.Errorf("expected refill to be capped at the burst, got %+v", decision)
+	}
+}
+
+// TestRateLimiterDisabled lets every request through without touching the store.
+func TestRateLimiterDisabled(t *testing.T) {
+	limiter := NewRateLimiter(nil, nil)
+	for i := 0; i < 5; i++ {
+		if decision, err := limiter.Allow(context.Background(), "ip:10.0.0.1", RateLimit{}); err != nil || !decision.Allowed {
+			t.Fatalf("expected disabled limit to allow, got %+v %v", decision, err)
+		}
+	}
+}
+
+// TestMongoRateLimitStore covers the Mongo-backed store with mock responses.
+func TestMongoRateLimitStore(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock).CreateCollection(false))
+
+	mt.Run("take returns updated bucket", func(mt *mtest.T) {
+		now := fixedNow()
+		limiter := NewRateLimiter(NewMongoRateLimitStore(mt.Coll), func() time.Time { return now })
+		doc := bson.D{
+			{Key: "_id", Value: "auth:ip:10.0.0.1"},
+			{Key: "tokens", Value: 0.5},
+			{Key: "updatedAt", Value: now},
+			{Key: "expiresAt", Value: now.Add(time.Minute)},
+			{Key: "allowed", Value: false},
+		}
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: doc}))
+
+		decision, err := limiter.Allow(context.Background(), "auth:ip:10.0.0.1", RateLimit{Burst: 60, Period: time.Minute})
+		if err != nil {
+			mt.Fatalf("allow failed: %v", err)
+		}
+		if decision.Allowed || decision.Remaining != 0 || decision.RetryAfter != 500*time.Millisecond {
+			mt.Fatalf("unexpected decision: %+v", decision)
+		}
+	})
+
+	mt.Run("ensure indexes", func(mt *mtest.T) {
+		store := NewMongoRateLimitStore(mt.Coll)
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+
+		if err := store.EnsureIndexes(context.Background()); err != nil {
+			mt.Fatalf("ensure indexes failed: %v", err)
+		}
+	})
+}
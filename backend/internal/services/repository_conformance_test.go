@@ -0,0 +1,96 @@
+package services_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/services"
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/services/repotest"
+)
+
+// mongoTestURIEnv names the MongoDB server the Mongo repositories are checked
+// against; the check is skipped when it is not set.
+const mongoTestURIEnv = "MONGO_TEST_URI"
+
+func TestMemoryRepositoryConformance(t *testing.T) {
+	t.Run("Users", func(t *testing.T) {
+		repotest.RunUserRepository(t, func(*testing.T) services.UserRepository {
+			return services.NewMemoryUserRepository()
+		})
+	})
+	t.Run("Todos", func(t *testing.T) {
+		repotest.RunTodoRepository(t, func(*testing.T) services.TodoRepository {
+			return services.NewMemoryTodoRepository()
+		})
+	})
+}
+
+func TestBoltRepositoryConformance(t *testing.T) {
+	t.Run("Users", func(t *testing.T) {
+		repotest.RunUserRepository(t, func(t *testing.T) services.UserRepository {
+			return services.NewBoltUserRepository(openTestBolt(t))
+		})
+	})
+	t.Run("Todos", func(t *testing.T) {
+		repotest.RunTodoRepository(t, func(t *testing.T) services.TodoRepository {
+			return services.NewBoltTodoRepository(openTestBolt(t))
+		})
+	})
+}
+
+func TestMongoRepositoryConformance(t *testing.T) {
+	uri := os.Getenv(mongoTestURIEnv)
+	if uri == "" {
+		t.Skipf("%s is not set", mongoTestURIEnv)
+	}
+	client, err := services.ConnectMongo(context.Background(), uri)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Disconnect(context.Background()) })
+
+	t.Run("Users", func(t *testing.T) {
+		repotest.RunUserRepository(t, func(t *testing.T) services.UserRepository {
+			repo := services.NewMongoUserRepository(testDatabase(t, client).Collection("users"))
+			if err := repo.EnsureIndexes(context.Background()); err != nil {
+				t.Fatalf("indexes: %v", err)
+			}
+			return repo
+		})
+	})
+	t.Run("Todos", func(t *testing.T) {
+		repotest.RunTodoRepository(t, func(t *testing.T) services.TodoRepository {
+			repo := services.NewMongoTodoRepository(testDatabase(t, client).Collection("todos"))
+			if err := repo.EnsureIndexes(context.Background()); err != nil {
+				t.Fatalf("indexes: %v", err)
+			}
+			return repo
+		})
+	})
+}
+
+func openTestBolt(t *testing.T) *bolt.DB {
+	t.Helper()
+
+	db, err := services.OpenBolt(filepath.Join(t.TempDir(), "todo.db"))
+	if err != nil {
+		t.Fatalf("open bolt: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+// testDatabase returns a fresh database that is dropped when t ends.
+func testDatabase(t *testing.T, client *mongo.Client) *mongo.Database {
+	t.Helper()
+
+	db := client.Database("repotest_" + primitive.NewObjectID().Hex())
+	t.Cleanup(func() { _ = db.Drop(context.Background()) })
+	return db
+}
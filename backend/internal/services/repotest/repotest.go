@@ -0,0 +1,639 @@
+// Package repotest is the conformance suite every UserRepository and
+// TodoRepository implementation must pass. Backends call RunUserRepository
+// and RunTodoRepository from their own tests with a factory returning an
+// empty repository.
+package repotest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/services"
+)
+
+// concurrency is the number of goroutines racing in the concurrency checks.
+const concurrency = 20
+
+// UserRepositoryFactory returns an empty repository. It is called once per
+// subtest and should register any cleanup on t.
+type UserRepositoryFactory func(t *testing.T) services.UserRepository
+
+// TodoRepositoryFactory returns an empty repository. It is called once per
+// subtest and should register any cleanup on t.
+type TodoRepositoryFactory func(t *testing.T) services.TodoRepository
+
+// base is the creation time of the fixtures. Times are kept to millisecond
+// precision in UTC, which every backend round-trips.
+var base = time.Date(2025, time.January, 1, 10, 0, 0, 0, time.UTC)
+
+// RunUserRepository checks the UserRepository contract on repositories built
+// by newRepo.
+func RunUserRepository(t *testing.T, newRepo UserRepositoryFactory) {
+	t.Run("FindByEmailNotFound", func(t *testing.T) {
+		repo := newRepo(t)
+		if _, err := repo.FindByEmail(context.Background(), "missing@example.com"); !errors.Is(err, services.ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("InsertAndFind", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepo(t)
+		want := services.User{
+			Email:       "ana@example.com",
+			Password:    "hash",
+			DisplayName: "Ana",
+			TimeZone:    "Europe/Madrid",
+			Preferences: services.Preferences{DefaultSort: services.TodoSortDueAt},
+		}
+		insertUsers(t, repo, want)
+
+		got, err := repo.FindByEmail(ctx, want.Email)
+		if err != nil {
+			t.Fatalf("find: %v", err)
+		}
+		if got.Email != want.Email || got.Password != want.Password || got.DisplayName != want.DisplayName ||
+			got.TimeZone != want.TimeZone || got.Preferences != want.Preferences {
+			t.Errorf("expected %+v, got %+v", want, got)
+		}
+	})
+
+	t.Run("InsertDuplicate", func(t *testing.T) {
+		repo := newRepo(t)
+		insertUsers(t, repo, services.User{Email: "ana@example.com", Password: "first"})
+
+		err := repo.Insert(context.Background(), services.User{Email: "ana@example.com", Password: "second"})
+		if !errors.Is(err, services.ErrUserAlreadyExists) {
+			t.Errorf("expected ErrUserAlreadyExists, got %v", err)
+		}
+		if user := findUser(t, repo, "ana@example.com"); user.Password != "first" {
+			t.Errorf("expected the first user to be kept, got %+v", user)
+		}
+	})
+
+	t.Run("ListOrderedByEmail", func(t *testing.T) {
+		repo := newRepo(t)
+		insertUsers(t, repo,
+			services.User{Email: "carla@example.com"},
+			services.User{Email: "ana@example.com"},
+			services.User{Email: "bruno@example.com"},
+		)
+
+		users, err := repo.List(context.Background())
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		assertEmails(t, users, "ana@example.com", "bruno@example.com", "carla@example.com")
+	})
+
+	t.Run("UpdatesOnMissingUser", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepo(t)
+		const email = "missing@example.com"
+
+		if err := repo.UpdateProfile(ctx, email, services.Profile{DisplayName: "x"}); !errors.Is(err, services.ErrNotFound) {
+			t.Errorf("UpdateProfile: expected ErrNotFound, got %v", err)
+		}
+		if err := repo.UpdateTwoFactor(ctx, email, services.TwoFactor{Enabled: true}); !errors.Is(err, services.ErrNotFound) {
+			t.Errorf("UpdateTwoFactor: expected ErrNotFound, got %v", err)
+		}
+		if err := repo.SwapTwoFactor(ctx, email, services.TwoFactor{}, services.TwoFactor{Enabled: true}); !errors.Is(err, services.ErrNotFound) {
+			t.Errorf("SwapTwoFactor: expected ErrNotFound, got %v", err)
+		}
+		if err := repo.UpdatePassword(ctx, email, "new"); !errors.Is(err, services.ErrNotFound) {
+			t.Errorf("UpdatePassword: expected ErrNotFound, got %v", err)
+		}
+		if err := repo.SetDisabled(ctx, email, true); !errors.Is(err, services.ErrNotFound) {
+			t.Errorf("SetDisabled: expected ErrNotFound, got %v", err)
+		}
+		if err := repo.SetCalendarToken(ctx, email, "hash"); !errors.Is(err, services.ErrNotFound) {
+			t.Errorf("SetCalendarToken: expected ErrNotFound, got %v", err)
+		}
+		if err := repo.ScheduleDeletion(ctx, email, base); !errors.Is(err, services.ErrNotFound) {
+			t.Errorf("ScheduleDeletion: expected ErrNotFound, got %v", err)
+		}
+		if err := repo.Delete(ctx, email); !errors.Is(err, services.ErrNotFound) {
+			t.Errorf("Delete: expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("UpdateProfileKeepsCredentials", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepo(t)
+		twoFactor := services.TwoFactor{Enabled: true, Secret: "SECRET", RecoveryCodes: []string{"a", "b"}}
+		insertUsers(t, repo, services.User{Email: "ana@example.com", Password: "hash", TwoFactor: twoFactor})
+
+		profile := services.Profile{
+			DisplayName: "Ana",
+			Locale:      "es",
+			Preferences: services.Preferences{HideCompleted: true},
+		}
+		if err := repo.UpdateProfile(ctx, "ana@example.com", profile); err != nil {
+			t.Fatalf("update profile: %v", err)
+		}
+
+		user := findUser(t, repo, "ana@example.com")
+		if user.DisplayName != "Ana" || user.Locale != "es" || !user.Preferences.HideCompleted {
+			t.Errorf("expected the profile to be stored, got %+v", user)
+		}
+		if user.Password != "hash" || !user.TwoFactor.Enabled || user.TwoFactor.Secret != "SECRET" || len(user.TwoFactor.RecoveryCodes) != 2 {
+			t.Errorf("expected credentials to be kept, got %+v", user)
+		}
+	})
+
+	t.Run("UpdateTwoFactorKeepsProfile", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepo(t)
+		insertUsers(t, repo, services.User{Email: "ana@example.com", DisplayName: "Ana"})
+
+		if err := repo.UpdateTwoFactor(ctx, "ana@example.com", services.TwoFactor{Secret: "PENDING"}); err != nil {
+			t.Fatalf("update two factor: %v", err)
+		}
+		user := findUser(t, repo, "ana@example.com")
+		if user.TwoFactor.Secret != "PENDING" || user.TwoFactor.Enabled || user.DisplayName != "Ana" {
+			t.Errorf("unexpected user %+v", user)
+		}
+	})
+
+	t.Run("SwapTwoFactor", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepo(t)
+		insertUsers(t, repo, services.User{Email: "ana@example.com"})
+
+		// Stored without a step or codes, as the fields are then omitted.
+		enrolled := services.TwoFactor{Enabled: true, Secret: "SECRET", RecoveryCodes: []string{"a", "b"}}
+		if err := repo.SwapTwoFactor(ctx, "ana@example.com", services.TwoFactor{}, enrolled); err != nil {
+			t.Fatalf("swap from empty: %v", err)
+		}
+		spent := services.TwoFactor{Enabled: true, Secret: "SECRET", RecoveryCodes: []string{"b"}, LastUsedStep: 7}
+		if err := repo.SwapTwoFactor(ctx, "ana@example.com", enrolled, spent); err != nil {
+			t.Fatalf("swap: %v", err)
+		}
+
+		// A request that read the state before the swap must lose.
+		if err := repo.SwapTwoFactor(ctx, "ana@example.com", enrolled, services.TwoFactor{}); !errors.Is(err, services.ErrNotFound) {
+			t.Errorf("expected a stale swap to fail with ErrNotFound, got %v", err)
+		}
+		user := findUser(t, repo, "ana@example.com")
+		if user.TwoFactor.LastUsedStep != 7 || len(user.TwoFactor.RecoveryCodes) != 1 {
+			t.Errorf("expected the first swap to be kept, got %+v", user.TwoFactor)
+		}
+	})
+
+	t.Run("PasswordAndDisabled", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepo(t)
+		insertUsers(t, repo, services.User{Email: "ana@example.com", Password: "old", DisplayName: "Ana"})
+
+		if err := repo.UpdatePassword(ctx, "ana@example.com", "new"); err != nil {
+			t.Fatalf("update password: %v", err)
+		}
+		if err := repo.SetDisabled(ctx, "ana@example.com", true); err != nil {
+			t.Fatalf("disable: %v", err)
+		}
+		user := findUser(t, repo, "ana@example.com")
+		if user.Password != "new" || !user.Disabled || user.DisplayName != "Ana" {
+			t.Errorf("unexpected user %+v", user)
+		}
+
+		if err := repo.SetDisabled(ctx, "ana@example.com", false); err != nil {
+			t.Fatalf("enable: %v", err)
+		}
+		if user := findUser(t, repo, "ana@example.com"); user.Disabled {
+			t.Errorf("expected the user to be enabled, got %+v", user)
+		}
+	})
+
+	t.Run("CalendarToken", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepo(t)
+		insertUsers(t, repo,
+			services.User{Email: "ana@example.com", DisplayName: "Ana"},
+			services.User{Email: "bruno@example.com"},
+		)
+
+		for _, hash := range []string{"", "hash-a"} {
+			if _, err := repo.FindByCalendarToken(ctx, hash); !errors.Is(err, services.ErrNotFound) {
+				t.Errorf("%q: expected ErrNotFound before any token is set, got %v", hash, err)
+			}
+		}
+		if err := repo.SetCalendarToken(ctx, "ana@example.com", "hash-a"); err != nil {
+			t.Fatalf("set: %v", err)
+		}
+		user, err := repo.FindByCalendarToken(ctx, "hash-a")
+		if err != nil || user.Email != "ana@example.com" || user.DisplayName != "Ana" || user.CalendarToken != "hash-a" {
+			t.Errorf("unexpected user %+v (%v)", user, err)
+		}
+
+		// Users without a token must not collide on a unique token index.
+		if err := repo.SetCalendarToken(ctx, "ana@example.com", ""); err != nil {
+			t.Fatalf("remove: %v", err)
+		}
+		if err := repo.SetCalendarToken(ctx, "bruno@example.com", "hash-b"); err != nil {
+			t.Fatalf("set another: %v", err)
+		}
+		if _, err := repo.FindByCalendarToken(ctx, "hash-a"); !errors.Is(err, services.ErrNotFound) {
+			t.Errorf("expected the removed token to be unknown, got %v", err)
+		}
+		if user := findUser(t, repo, "ana@example.com"); user.CalendarToken != "" {
+			t.Errorf("expected no token, got %+v", user)
+		}
+	})
+
+	t.Run("ScheduledDeletion", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepo(t)
+		insertUsers(t, repo,
+			services.User{Email: "bruno@example.com"},
+			services.User{Email: "ana@example.com"},
+			services.User{Email: "carla@example.com"},
+		)
+		for email, at := range map[string]time.Time{
+			"bruno@example.com": base,
+			"ana@example.com":   base.Add(-time.Hour),
+			"carla@example.com": base.Add(time.Hour),
+		} {
+			if err := repo.ScheduleDeletion(ctx, email, at); err != nil {
+				t.Fatalf("schedule %s: %v", email, err)
+			}
+		}
+
+		due, err := repo.ListDueForDeletion(ctx, base)
+		if err != nil {
+			t.Fatalf("list due: %v", err)
+		}
+		assertEmails(t, due, "ana@example.com", "bruno@example.com")
+
+		if err := repo.ScheduleDeletion(ctx, "ana@example.com", time.Time{}); err != nil {
+			t.Fatalf("cancel: %v", err)
+		}
+		due, err = repo.ListDueForDeletion(ctx, base)
+		if err != nil {
+			t.Fatalf("list due: %v", err)
+		}
+		assertEmails(t, due, "bruno@example.com")
+		if user := findUser(t, repo, "ana@example.com"); !user.DeleteAfter.IsZero() {
+			t.Errorf("expected the cancelled deletion to be cleared, got %v", user.DeleteAfter)
+		}
+	})
+
+	t.Run("DeleteAndClear", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepo(t)
+		insertUsers(t, repo, services.User{Email: "ana@example.com"}, services.User{Email: "bruno@example.com"})
+
+		if err := repo.Delete(ctx, "ana@example.com"); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+		if _, err := repo.FindByEmail(ctx, "ana@example.com"); !errors.Is(err, services.ErrNotFound) {
+			t.Errorf("expected the deleted user to be gone, got %v", err)
+		}
+		if err := repo.Delete(ctx, "ana@example.com"); !errors.Is(err, services.ErrNotFound) {
+			t.Errorf("expected ErrNotFound deleting twice, got %v", err)
+		}
+
+		if err := repo.Clear(ctx); err != nil {
+			t.Fatalf("clear: %v", err)
+		}
+		if users, err := repo.List(ctx); err != nil || len(users) != 0 {
+			t.Errorf("expected no users after clear, got %+v (%v)", users, err)
+		}
+	})
+
+	t.Run("ConcurrentInsert", func(t *testing.T) {
+		repo := newRepo(t)
+
+		var wg sync.WaitGroup
+		errs := make(chan error, concurrency)
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs <- repo.Insert(context.Background(), services.User{Email: "ana@example.com", Password: fmt.Sprint(i)})
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+
+		inserted := 0
+		for err := range errs {
+			switch {
+			case err == nil:
+				inserted++
+			case !errors.Is(err, services.ErrUserAlreadyExists):
+				t.Errorf("unexpected error %v", err)
+			}
+		}
+		if inserted != 1 {
+			t.Errorf("expected exactly one insert to win, got %d", inserted)
+		}
+	})
+}
+
+// RunTodoRepository checks the TodoRepository contract on repositories built
+// by newRepo.
+func RunTodoRepository(t *testing.T, newRepo TodoRepositoryFactory) {
+	t.Run("CreateAssignsID", func(t *testing.T) {
+		repo := newRepo(t)
+		todo := createTodo(t, repo, services.Todo{Email: "ana@example.com", Title: "Buy milk", CreatedAt: base})
+		if todo.ID.IsZero() {
+			t.Errorf("expected an ID to be assigned")
+		}
+		if todo.Email != "ana@example.com" || todo.Title != "Buy milk" || !todo.CreatedAt.Equal(base) {
+			t.Errorf("unexpected todo %+v", todo)
+		}
+	})
+
+	t.Run("CreateKeepsGivenID", func(t *testing.T) {
+		repo := newRepo(t)
+		id := primitive.NewObjectID()
+		if todo := createTodo(t, repo, services.Todo{ID: id, Email: "ana@example.com", CreatedAt: base}); todo.ID != id {
+			t.Errorf("expected ID %s, got %s", id.Hex(), todo.ID.Hex())
+		}
+	})
+
+	t.Run("ListOrderedByCreation", func(t *testing.T) {
+		repo := newRepo(t)
+		second := createTodo(t, repo, services.Todo{Email: "ana@example.com", Title: "second", CreatedAt: base.Add(time.Minute)})
+		first := createTodo(t, repo, services.Todo{Email: "ana@example.com", Title: "first", CreatedAt: base})
+		third := createTodo(t, repo, services.Todo{Email: "ana@example.com", Title: "third", CreatedAt: base.Add(2 * time.Minute)})
+
+		todos := listTodos(t, repo, "ana@example.com")
+		assertIDs(t, todos, first.ID, second.ID, third.ID)
+		if !todos[0].CreatedAt.Equal(base) {
+			t.Errorf("expected createdAt %v, got %v", base, todos[0].CreatedAt)
+		}
+	})
+
+	t.Run("ListFiltersByEmail", func(t *testing.T) {
+		repo := newRepo(t)
+		ana := createTodo(t, repo, services.Todo{Email: "ana@example.com", CreatedAt: base})
+		bruno := createTodo(t, repo, services.Todo{Email: "bruno@example.com", CreatedAt: base.Add(-time.Minute)})
+
+		assertIDs(t, listTodos(t, repo, "ana@example.com"), ana.ID)
+		assertIDs(t, listTodos(t, repo, "bruno@example.com"), bruno.ID)
+		assertIDs(t, listTodos(t, repo, "nobody@example.com"))
+		assertIDs(t, listTodos(t, repo, ""), bruno.ID, ana.ID)
+	})
+
+	t.Run("Count", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepo(t)
+		createTodo(t, repo, services.Todo{Email: "ana@example.com", CreatedAt: base})
+		createTodo(t, repo, services.Todo{Email: "ana@example.com", CreatedAt: base})
+		createTodo(t, repo, services.Todo{Email: "bruno@example.com", CreatedAt: base})
+
+		if count, err := repo.Count(ctx, "ana@example.com"); err != nil || count != 2 {
+			t.Errorf("expected 2, got %d (%v)", count, err)
+		}
+		if count, err := repo.Count(ctx, "nobody@example.com"); err != nil || count != 0 {
+			t.Errorf("expected 0, got %d (%v)", count, err)
+		}
+	})
+
+	t.Run("TitleBytes", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepo(t)
+		created := createTodo(t, repo, services.Todo{Email: "ana@example.com", Title: "señal", CreatedAt: base})
+		createTodo(t, repo, services.Todo{Email: "ana@example.com", Title: "tea", CreatedAt: base})
+		createTodo(t, repo, services.Todo{Email: "bruno@example.com", Title: "bread", CreatedAt: base})
+
+		if total, err := repo.TitleBytes(ctx, "ana@example.com"); err != nil || total != 9 {
+			t.Errorf("expected 9, got %d (%v)", total, err)
+		}
+		if err := repo.Delete(ctx, created.ID); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+		if total, err := repo.TitleBytes(ctx, "ana@example.com"); err != nil || total != 3 {
+			t.Errorf("expected 3 after delete, got %d (%v)", total, err)
+		}
+		if total, err := repo.TitleBytes(ctx, "nobody@example.com"); err != nil || total != 0 {
+			t.Errorf("expected 0, got %d (%v)", total, err)
+		}
+	})
+
+	t.Run("PartialUpdates", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepo(t)
+		due := base.Add(24 * time.Hour)
+		todo := createTodo(t, repo, services.Todo{Email: "ana@example.com", Title: "Buy milk", CreatedAt: base, DueAt: &due})
+
+		title := "Buy bread"
+		updated, err := repo.Update(ctx, todo.ID, services.TodoUpdate{Title: &title})
+		if err != nil {
+			t.Fatalf("update title: %v", err)
+		}
+		if updated.Title != title || updated.Completed || updated.DueAt == nil || !updated.DueAt.Equal(due) {
+			t.Errorf("expected only the title to change, got %+v", updated)
+		}
+
+		completed := true
+		updated, err = repo.Update(ctx, todo.ID, services.TodoUpdate{Completed: &completed})
+		if err != nil {
+			t.Fatalf("update completed: %v", err)
+		}
+		if updated.Title != title || !updated.Completed {
+			t.Errorf("expected only completed to change, got %+v", updated)
+		}
+
+		later := due.Add(time.Hour)
+		updated, err = repo.Update(ctx, todo.ID, services.TodoUpdate{DueAt: &later})
+		if err != nil {
+			t.Fatalf("update due date: %v", err)
+		}
+		if updated.Title != title || !updated.Completed || updated.DueAt == nil || !updated.DueAt.Equal(later) {
+			t.Errorf("expected only the due date to change, got %+v", updated)
+		}
+		if updated.ID != todo.ID || updated.Email != todo.Email || !updated.CreatedAt.Equal(base) {
+			t.Errorf("expected identity fields to be kept, got %+v", updated)
+		}
+
+		stored := listTodos(t, repo, "ana@example.com")
+		if len(stored) != 1 || stored[0].Title != title || !stored[0].Completed || !stored[0].DueAt.Equal(later) {
+			t.Errorf("expected the update to be stored, got %+v", stored)
+		}
+
+		updated, err = repo.Update(ctx, todo.ID, services.TodoUpdate{DueAt: &later, ClearDueAt: true})
+		if err != nil {
+			t.Fatalf("clear due date: %v", err)
+		}
+		if updated.DueAt != nil || updated.Title != title || !updated.Completed {
+			t.Errorf("expected only the due date to be removed, got %+v", updated)
+		}
+		if stored := listTodos(t, repo, "ana@example.com"); len(stored) != 1 || stored[0].DueAt != nil {
+			t.Errorf("expected the removal to be stored, got %+v", stored)
+		}
+	})
+
+	t.Run("UpdateNotFound", func(t *testing.T) {
+		repo := newRepo(t)
+		completed := true
+		_, err := repo.Update(context.Background(), primitive.NewObjectID(), services.TodoUpdate{Completed: &completed})
+		if !errors.Is(err, services.ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepo(t)
+		kept := createTodo(t, repo, services.Todo{Email: "ana@example.com", CreatedAt: base})
+		deleted := createTodo(t, repo, services.Todo{Email: "ana@example.com", CreatedAt: base.Add(time.Minute)})
+
+		if err := repo.Delete(ctx, deleted.ID); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+		assertIDs(t, listTodos(t, repo, "ana@example.com"), kept.ID)
+		if count, _ := repo.Count(ctx, "ana@example.com"); count != 1 {
+			t.Errorf("expected count 1 after delete, got %d", count)
+		}
+		if err := repo.Delete(ctx, deleted.ID); !errors.Is(err, services.ErrNotFound) {
+			t.Errorf("expected ErrNotFound deleting twice, got %v", err)
+		}
+	})
+
+	t.Run("DeleteSubMillisecondCreation", func(t *testing.T) {
+		// Services stamp todos with time.Now, which is finer than what
+		// backends store; deleting must not depend on the lost precision.
+		ctx := context.Background()
+		repo := newRepo(t)
+		todo := createTodo(t, repo, services.Todo{Email: "ana@example.com", CreatedAt: base.Add(123456789 * time.Nanosecond)})
+
+		if err := repo.Delete(ctx, todo.ID); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+		assertIDs(t, listTodos(t, repo, "ana@example.com"))
+		if count, err := repo.Count(ctx, "ana@example.com"); err != nil || count != 0 {
+			t.Errorf("expected count 0 after delete, got %d (%v)", count, err)
+		}
+	})
+
+	t.Run("ClearFiltersByEmail", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepo(t)
+		createTodo(t, repo, services.Todo{Email: "ana@example.com", CreatedAt: base})
+		createTodo(t, repo, services.Todo{Email: "ana@example.com", CreatedAt: base})
+		bruno := createTodo(t, repo, services.Todo{Email: "bruno@example.com", CreatedAt: base})
+
+		if err := repo.Clear(ctx, "ana@example.com"); err != nil {
+			t.Fatalf("clear: %v", err)
+		}
+		assertIDs(t, listTodos(t, repo, "ana@example.com"))
+		assertIDs(t, listTodos(t, repo, ""), bruno.ID)
+
+		if err := repo.Clear(ctx, "nobody@example.com"); err != nil {
+			t.Errorf("expected clearing an unknown email to succeed, got %v", err)
+		}
+		if err := repo.Clear(ctx, ""); err != nil {
+			t.Fatalf("clear all: %v", err)
+		}
+		assertIDs(t, listTodos(t, repo, ""))
+	})
+
+	t.Run("ConcurrentWrites", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepo(t)
+		shared := createTodo(t, repo, services.Todo{Email: "ana@example.com", CreatedAt: base})
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 3*concurrency)
+		for i := 0; i < concurrency; i++ {
+			wg.Add(3)
+			go func(i int) {
+				defer wg.Done()
+				_, err := repo.Create(ctx, services.Todo{Email: "ana@example.com", Title: fmt.Sprint(i), CreatedAt: base.Add(time.Duration(i) * time.Second)})
+				errs <- err
+			}(i)
+			go func(i int) {
+				defer wg.Done()
+				completed := i%2 == 0
+				_, err := repo.Update(ctx, shared.ID, services.TodoUpdate{Completed: &completed})
+				errs <- err
+			}(i)
+			go func() {
+				defer wg.Done()
+				_, err := repo.List(ctx, "ana@example.com")
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			if err != nil {
+				t.Errorf("unexpected error %v", err)
+			}
+		}
+		if count, err := repo.Count(ctx, "ana@example.com"); err != nil || count != concurrency+1 {
+			t.Errorf("expected %d todos, got %d (%v)", concurrency+1, count, err)
+		}
+	})
+}
+
+func insertUsers(t *testing.T, repo services.UserRepository, users ...services.User) {
+	t.Helper()
+	for _, user := range users {
+		if err := repo.Insert(context.Background(), user); err != nil {
+			t.Fatalf("insert %s: %v", user.Email, err)
+		}
+	}
+}
+
+func findUser(t *testing.T, repo services.UserRepository, email string) services.User {
+	t.Helper()
+	user, err := repo.FindByEmail(context.Background(), email)
+	if err != nil {
+		t.Fatalf("find %s: %v", email, err)
+	}
+	return user
+}
+
+func assertEmails(t *testing.T, users []services.User, want ...string) {
+	t.Helper()
+	got := make([]string, len(users))
+	for i, user := range users {
+		got[i] = user.Email
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("expected users %v, got %v", want, got)
+	}
+}
+
+func createTodo(t *testing.T, repo services.TodoRepository, todo services.Todo) services.Todo {
+	t.Helper()
+	created, err := repo.Create(context.Background(), todo)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	return created
+}
+
+func listTodos(t *testing.T, repo services.TodoRepository, email string) []services.Todo {
+	t.Helper()
+	todos, err := repo.List(context.Background(), email)
+	if err != nil {
+		t.Fatalf("list %q: %v", email, err)
+	}
+	return todos
+}
+
+func assertIDs(t *testing.T, todos []services.Todo, want ...primitive.ObjectID) {
+	t.Helper()
+	got := make([]string, len(todos))
+	for i, todo := range todos {
+		got[i] = todo.ID.Hex()
+	}
+	wantHex := make([]string, len(want))
+	for i, id := range want {
+		wantHex[i] = id.Hex()
+	}
+	if fmt.Sprint(got) != fmt.Sprint(wantHex) {
+		t.Errorf("expected todos %v, got %v", wantHex, got)
+	}
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// namespaceNotFound is the MongoDB error code of collMod on a missing
+// collection.
+const namespaceNotFound = 26
+
+// CollectionSchema declares the indexes and document validator MongoDB
+// enforces for one collection.
+type CollectionSchema struct {
+	Collection string
+	// Indexes must all be named, so that CheckIndexes can find them.
+	Indexes []mongo.IndexModel
+	// Validator is a $jsonSchema document; nil leaves writes unvalidated.
+	Validator bson.M
+	// Conflicts explains why a unique index could not be built, e.g. by
+	// naming the duplicated values; it is only called when that happens.
+	Conflicts func(ctx context.Context, collection *mongo.Collection) error
+}
+
+// Index sets shared by the stores' EnsureIndexes methods and Schemas.
+var (
+	expiresAtTTLIndexes = []mongo.IndexModel{{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0).SetName("expiresAt_ttl"),
+	}}
+	sessionIndexes = []mongo.IndexModel{
+		expiresAtTTLIndexes[0],
+		{
+			Keys:    bson.D{{Key: "email", Value: 1}},
+			Options: options.Index().SetName("email"),
+		},
+	}
+	userIndexes = []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "email", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("email_unique"),
+		},
+		{
+			Keys:    bson.D{{Key: "calendarToken", Value: 1}},
+			Options: options.Index().SetUnique(true).SetSparse(true).SetName("calendarToken_unique"),
+		},
+	}
+	todoIndexes = []mongo.IndexModel{{
+		Keys:    bson.D{{Key: "email", Value: 1}, {Key: "createdAt", Value: 1}},
+		Options: options.Index().SetName("email_createdAt"),
+	}}
+)
+
+// Schemas lists every collection used by the Mongo stores. New indexes and
+// validators are added here and applied by EnsureSchema on the next start.
+var Schemas = []CollectionSchema{
+	{Collection: "users", Indexes: userIndexes, Validator: userValidator, Conflicts: duplicateEmailsConflict},
+	{Collection: "todos", Indexes: todoIndexes, Validator: todoValidator},
+	{Collection: "sessions", Indexes: sessionIndexes},
+	{Collection: "login_challenges", Indexes: expiresAtTTLIndexes},
+	{Collection: "login_attempts", Indexes: expiresAtTTLIndexes},
+	{Collection: "rate_limits", Indexes: expiresAtTTLIndexes},
+	{Collection: "idempotency_keys", Indexes: expiresAtTTLIndexes},
+	{Collection: "oidc_logins", Indexes: expiresAtTTLIndexes},
+}
+
+var userValidator = bson.M{"$jsonSchema": bson.M{
+	"bsonType": "object",
+	"required": bson.A{"email"},
+	"properties": bson.M{
+		"email":         bson.M{"bsonType": "string", "minLength": 1},
+		"password":      bson.M{"bsonType": "string"},
+		"displayName":   bson.M{"bsonType": "string"},
+		"timeZone":      bson.M{"bsonType": "string"},
+		"locale":        bson.M{"bsonType": "string"},
+		"preferences":   bson.M{"bsonType": "object"},
+		"twoFactor":     bson.M{"bsonType": "object"},
+		"deleteAfter":   bson.M{"bsonType": "date"},
+		"disabled":      bson.M{"bsonType": "bool"},
+		"calendarToken": bson.M{"bsonType": "string", "minLength": 1},
+	},
+}}
+
+var todoValidator = bson.M{"$jsonSchema": bson.M{
+	"bsonType": "object",
+	"required": bson.A{"email", "title", "completed", "createdAt"},
+	"properties": bson.M{
+		"email":     bson.M{"bsonType": "string", "minLength": 1},
+		"title":     bson.M{"bsonType": "string", "minLength": 1, "maxLength": MaxTitleLength},
+		"completed": bson.M{"bsonType": "bool"},
+		"createdAt": bson.M{"bsonType": "date"},
+		"dueAt":     bson.M{"bsonType": "date"},
+	},
+}}
+
+// RequiredIndexes lists, per collection, the index names declared in Schemas.
+var RequiredIndexes = indexNames(Schemas)
+
+// EnsureSchema creates the declared indexes of every collection in schemas
+// and installs their validators, creating collections as needed. It is safe
+// to run on every start: existing indexes are kept and validators replaced.
+//
+// Validators use the "moderate" level, so documents written before a rule
+// existed can still be updated until a migration fixes them.
+func EnsureSchema(ctx context.Context, db *mongo.Database, schemas []CollectionSchema) error {
+	for _, schema := range schemas {
+		if schema.Validator != nil {
+			if err := applyValidator(ctx, db, schema.Collection, schema.Validator); err != nil {
+				return fmt.Errorf("applying %s validator: %w", schema.Collection, err)
+			}
+		}
+		collection := db.Collection(schema.Collection)
+		if err := createIndexes(ctx, collection, schema.Indexes); err != nil {
+			if mongo.IsDuplicateKeyError(err) && schema.Conflicts != nil {
+				if conflict := schema.Conflicts(ctx, collection); conflict != nil {
+					err = conflict
+				}
+			}
+			return fmt.Errorf("creating %s indexes: %w", schema.Collection, err)
+		}
+	}
+	return nil
+}
+
+func applyValidator(ctx context.Context, db *mongo.Database, collection string, validator bson.M) error {
+	err := db.RunCommand(ctx, bson.D{
+		{Key: "collMod", Value: collection},
+		{Key: "validator", Value: validator},
+		{Key: "validationLevel", Value: "moderate"},
+	}).Err()
+	var cmdErr mongo.CommandError
+	if !errors.As(err, &cmdErr) || cmdErr.Code != namespaceNotFound {
+		return err
+	}
+	return db.CreateCollection(ctx, collection, options.CreateCollection().
+		SetValidator(validator).
+		SetValidationLevel("moderate"))
+}
+
+func createIndexes(ctx context.Context, collection *mongo.Collection, indexes []mongo.IndexModel) error {
+	if len(indexes) == 0 {
+		return nil
+	}
+	_, err := collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
+func indexNames(schemas []CollectionSchema) map[string][]string {
+	names := make(map[string][]string, len(schemas))
+	for _, schema := range schemas {
+		for _, index := range schema.Indexes {
+			names[schema.Collection] = append(names[schema.Collection], *index.Options.Name)
+		}
+	}
+	return names
+}
+
+// maxReportedDuplicates bounds the emails named by DuplicateEmailsError.
+const maxReportedDuplicates = 20
+
+// DuplicateEmailsError reports users that share an email, which the unique
+// email index forbids. They must be merged or deleted by hand, as only their
+// owners know which account to keep.
+type DuplicateEmailsError struct {
+	// Emails lists up to maxReportedDuplicates duplicated emails.
+	Emails []string
+}
+
+func (e *DuplicateEmailsError) Error() string {
+	return fmt.Sprintf("users share these emails: %s; merge or delete the duplicate users, then start again",
+		strings.Join(e.Emails, ", "))
+}
+
+// FindDuplicateEmails returns, sorted, up to maxReportedDuplicates emails
+// used by more than one document of the users collection.
+func FindDuplicateEmails(ctx context.Context, users *mongo.Collection) ([]string, error) {
+	cursor, err := users.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{"_id": "$email", "count": bson.M{"$sum": 1}}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+		{{Key: "$limit", Value: maxReportedDuplicates}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var groups []struct {
+		Email string `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+	emails := make([]string, 0, len(groups))
+	for _, group := range groups {
+		emails = append(emails, group.Email)
+	}
+	return emails, nil
+}
+
+// duplicateEmailsConflict returns a *DuplicateEmailsError when users share an
+// email, and nil otherwise.
+func duplicateEmailsConflict(ctx context.Context, users *mongo.Collection) error {
+	emails, err := FindDuplicateEmails(ctx, users)
+	if err != nil || len(emails) == 0 {
+		return err
+	}
+	return &DuplicateEmailsError{Emails: emails}
+}
@@ -0,0 +1,245 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// DefaultSessionTTL is how long a login session stays valid.
+const DefaultSessionTTL = 24 * time.Hour
+
+// ErrInvalidSession indicates a missing, unknown or expired session token.
+var ErrInvalidSession = errors.New("invalid session")
+
+// Session binds an opaque bearer token to a user. Only the SHA-256 hash of the
+// token is stored, so a leaked collection does not leak usable tokens.
+type Session struct {
+	ID        string    `bson:"_id"`
+	Email     string    `bson:"email"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
+
+// SessionStore persists sessions.
+type SessionStore interface {
+	Save(ctx context.Context, session Session) error
+	// Get returns the session or ErrNotFound when it is unknown or expired.
+	Get(ctx context.Context, id string) (Session, error)
+	Delete(ctx context.Context, id string) error
+	DeleteByEmail(ctx context.Context, email string) error
+}
+
+// SessionService issues and resolves login sessions.
+type SessionService struct {
+	store SessionStore
+	ttl   time.Duration
+	now   func() time.Time
+	users UserRepository
+}
+
+// SessionServiceOption customises a SessionService.
+type SessionServiceOption func(*SessionService)
+
+// WithSessionUsers makes Resolve reject the sessions of disabled users. They
+// are revoked when the user is disabled, but todoctl cannot reach sessions
+// kept in the memory of the server process.
+func WithSessionUsers(users UserRepository) SessionServiceOption {
+	return func(s *SessionService) {
+		s.users = users
+	}
+}
+
+// NewSessionService builds a SessionService. A nil store keeps sessions in
+// memory and a zero ttl uses DefaultSessionTTL.
+func NewSessionService(store SessionStore, ttl time.Duration, now func() time.Time, opts ...SessionServiceOption) *SessionService {
+	if now == nil {
+		now = time.Now
+	}
+	if store == nil {
+		store = NewMemorySessionStore(now)
+	}
+	if ttl <= 0 {
+		ttl = DefaultSessionTTL
+	}
+	s := &SessionService{store: store, ttl: ttl, now: now}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func hashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create starts a session for email and returns the bearer token.
+func (s *SessionService) Create(ctx context.Context, email string) (string, time.Time, error) {
+	email = NormalizeEmail(email)
+	if email == "" {
+		return "", time.Time{}, ErrInvalidUserInput
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expiresAt := s.now().Add(s.ttl)
+	if err := s.store.Save(ctx, Session{ID: hashSessionToken(token), Email: email, ExpiresAt: expiresAt}); err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// Resolve returns the email owning token, or ErrUserDisabled when that user
+// has been disabled and WithSessionUsers is set. Sessions of emails without
+// an account stay valid.
+func (s *SessionService) Resolve(ctx context.Context, token string) (string, error) {
+	token = NormalizeText(token)
+	if token == "" {
+		return "", ErrInvalidSession
+	}
+
+	session, err := s.store.Get(ctx, hashSessionToken(token))
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return "", ErrInvalidSession
+		}
+		return "", err
+	}
+	if s.users != nil {
+		user, err := s.users.FindByEmail(ctx, session.Email)
+		switch {
+		case err == nil && user.Disabled:
+			return "", ErrUserDisabled
+		case err != nil && !errors.Is(err, ErrNotFound):
+			return "", err
+		}
+	}
+	return session.Email, nil
+}
+
+// Revoke ends the session identified by token.
+func (s *SessionService) Revoke(ctx context.Context, token string) error {
+	return s.store.Delete(ctx, hashSessionToken(NormalizeText(token)))
+}
+
+// RevokeAll ends every session of email.
+func (s *SessionService) RevokeAll(ctx context.Context, email string) error {
+	email = NormalizeEmail(email)
+	if email == "" {
+		return ErrInvalidUserInput
+	}
+	return s.store.DeleteByEmail(ctx, email)
+}
+
+// MemorySessionStore keeps sessions in process memory.
+type MemorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]Session
+	now      func() time.Time
+}
+
+// NewMemorySessionStore creates an empty in-memory session store.
+func NewMemorySessionStore(now func() time.Time) *MemorySessionStore {
+	if now == nil {
+		now = time.Now
+	}
+	return &MemorySessionStore{sessions: make(map[string]Session), now: now}
+}
+
+// Save stores a session.
+func (m *MemorySessionStore) Save(_ context.Context, session Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sessions[session.ID] = session
+	return nil
+}
+
+// Get returns a non-expired session.
+func (m *MemorySessionStore) Get(_ context.Context, id string) (Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[id]
+	if !ok {
+		return Session{}, ErrNotFound
+	}
+	if !m.now().Before(session.ExpiresAt) {
+		delete(m.sessions, id)
+		return Session{}, ErrNotFound
+	}
+	return session, nil
+}
+
+// Delete removes a session.
+func (m *MemorySessionStore) Delete(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, id)
+	return nil
+}
+
+// DeleteByEmail removes every session of email.
+func (m *MemorySessionStore) DeleteByEmail(_ context.Context, email string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, session := range m.sessions {
+		if session.Email == email {
+			delete(m.sessions, id)
+		}
+	}
+	return nil
+}
+
+// MongoSessionStore persists sessions in MongoDB with a TTL index.
+type MongoSessionStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoSessionStore creates a new store wrapper around a Mongo collection.
+func NewMongoSessionStore(collection *mongo.Collection) *MongoSessionStore {
+	return &MongoSessionStore{collection: collection}
+}
+
+// EnsureIndexes creates the TTL index on expiresAt and the email lookup index.
+func (m *MongoSessionStore) EnsureIndexes(ctx context.Context) error {
+	return createIndexes(ctx, m.collection, sessionIndexes)
+}
+
+// Save stores a session.
+func (m *MongoSessionStore) Save(ctx context.Context, session Session) error {
+	_, err := m.collection.InsertOne(ctx, session)
+	return err
+}
+
+// Get returns a non-expired session.
+func (m *MongoSessionStore) Get(ctx context.Context, id string) (Session, error) {
+	var session Session
+	err := m.collection.FindOne(ctx, bson.M{"_id": id, "expiresAt": bson.M{"$gt": time.Now()}}).Decode(&session)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Session{}, ErrNotFound
+	}
+	return session, err
+}
+
+// Delete removes a session.
+func (m *MongoSessionStore) Delete(ctx context.Context, id string) error {
+	_, err := m.collection.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+// DeleteByEmail removes every session of email.
+func (m *MongoSessionStore) DeleteByEmail(ctx context.Context, email string) error {
+	_, err := m.collection.DeleteMany(ctx, bson.M{"email": email})
+	return err
+}
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// TestSessionServiceLifecycle covers creation, expiry and revocation.
+func TestSessionServiceLifecycle(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: fixedNow()}
+	store := NewMemorySessionStore(clock.Now)
+	sessions := NewSessionService(store, time.Hour, clock.Now)
+
+	token, expiresAt, err := sessions.Create(ctx, " User@Example.com ")
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if !expiresAt.Equal(clock.now.Add(time.Hour)) {
+		t.Fatalf("unexpected expiry %v", expiresAt)
+	}
+	if _, err := store.Get(ctx, token); err != ErrNotFound {
+		t.Fatalf("expected raw token not to be stored as id, got %v", err)
+	}
+
+	email, err := sessions.Resolve(ctx, token)
+	if err != nil || email != "user@example.com" {
+		t.Fatalf("expected session for user, got %q %v", email, err)
+	}
+
+	if err := sessions.Revoke(ctx, token); err != nil {
+		t.Fatalf("revoke failed: %v", err)
+	}
+	if _, err := sessions.Resolve(ctx, token); err != ErrInvalidSession {
+		t.Fatalf("expected ErrInvalidSession after revoke, got %v", err)
+	}
+
+	other, _, _ := sessions.Create(ctx, "user@example.com")
+	clock.Advance(time.Hour)
+	if _, err := sessions.Resolve(ctx, other); err != ErrInvalidSession {
+		t.Fatalf("expected expired session, got %v", err)
+	}
+	if _, err := sessions.Resolve(ctx, ""); err != ErrInvalidSession {
+		t.Fatalf("expected ErrInvalidSession for empty token, got %v", err)
+	}
+}
+
+// TestSessionServiceRevokeAll ensures all sessions of a user are ended.
+func TestSessionServiceRevokeAll(t *testing.T) {
+	ctx := context.Background()
+	sessions := NewSessionService(nil, 0, nil)
+
+	first, _, _ := sessions.Create(ctx, "user@example.com")
+	second, _, _ := sessions.Create(ctx, "user@example.com")
+	other, _, _ := sessions.Create(ctx, "other@example.com")
+
+	if err := sessions.RevokeAll(ctx, "USER@example.com"); err != nil {
+		t.Fatalf("revoke all failed: %v", err)
+	}
+	for _, token := range []string{first, second} {
+		if _, err := sessions.Resolve(ctx, token); err != ErrInvalidSession {
+			t.Fatalf("expected revoked session, got %v", err)
+		}
+	}
+	if _, err := sessions.Resolve(ctx, other); err != nil {
+		t.Fatalf("expected other user's session to survive, got %v", err)
+	}
+}
+
+// TestSessionServiceRejectsDisabledUsers ensures sessions that outlive the
+// disabling of their user are refused.
+func TestSessionServiceRejectsDisabledUsers(t *testing.T) {
+	ctx := context.Background()
+	users := NewMemoryUserRepository()
+	if err := users.Insert(ctx, User{Email: "user@example.com", Password: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	sessions := NewSessionService(nil, 0, nil, WithSessionUsers(users))
+
+	token, _, _ := sessions.Create(ctx, "user@example.com")
+	if _, err := sessions.Resolve(ctx, token); err != nil {
+		t.Fatalf("expected an active user's session to resolve, got %v", err)
+	}
+	if err := users.SetDisabled(ctx, "user@example.com", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sessions.Resolve(ctx, token); !errors.Is(err, ErrUserDisabled) {
+		t.Fatalf("expected ErrUserDisabled, got %v", err)
+	}
+
+	other, _, _ := sessions.Create(ctx, "nobody@example.com")
+	if email, err := sessions.Resolve(ctx, other); err != nil || email != "nobody@example.com" {
+		t.Fatalf("expected a session without an account to resolve, got %q %v", email, err)
+	}
+}
+
+// TestMongoSessionStore covers the Mongo-backed store with mock responses.
+func TestMongoSessionStore(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock).CreateCollection(false))
+
+	mt.Run("save and get session", func(mt *mtest.T) {
+		store := NewMongoSessionStore(mt.Coll)
+		expires := time.Now().Add(time.Hour)
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+
+		if err := store.Save(context.Background(), Session{ID: "abc", Email: "user@example.com", ExpiresAt: expires}); err != nil {
+			mt.Fatalf("save failed: %v", err)
+		}
+
+		doc := bson.D{
+			{Key: "_id", Value: "abc"},
+			{Key: "email", Value: "user@example.com"},
+			{Key: "expiresAt", Value: expires},
+		}
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, collectionNamespace(mt), mtest.FirstBatch, doc))
+
+		session, err := store.Get(context.Background(), "abc")
+		if err != nil || session.Email != "user@example.com" {
+			mt.Fatalf("unexpected session %+v err=%v", session, err)
+		}
+	})
+
+	mt.Run("get missing session", func(mt *mtest.T) {
+		store := NewMongoSessionStore(mt.Coll)
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, collectionNamespace(mt), mtest.FirstBatch))
+
+		if _, err := store.Get(context.Background(), "missing"); err != ErrNotFound {
+			mt.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	})
+
+	mt.Run("delete by email", func(mt *mtest.T) {
+		store := NewMongoSessionStore(mt.Coll)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 2}))
+
+		if err := store.DeleteByEmail(context.Background(), "user@example.com"); err != nil {
+			mt.Fatalf("delete by email failed: %v", err)
+		}
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"time"
+	"unicode/utf8"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -16,12 +17,38 @@ var (
 	ErrInvalidTodoInput = errors.New("invalid todo input")
 	// ErrInvalidTodoID indicates the todo ID could not be parsed.
 	ErrInvalidTodoID = errors.New("invalid todo id")
+	// ErrInvalidDueFilter indicates an unsupported due-date filter.
+	ErrInvalidDueFilter = errors.New("invalid due filter")
 )
 
+// MaxTitleLength is the maximum number of characters in a todo title.
+const MaxTitleLength = 200
+
 // TodoUpdate models the fields that can be updated on a Todo.
 type TodoUpdate struct {
 	Title     *string
 	Completed *bool
+	DueAt     *time.Time
+	// ClearDueAt removes the due date; DueAt is ignored when it is set.
+	ClearDueAt bool
+}
+
+// TodoInput models the data accepted when creating a Todo.
+type TodoInput struct {
+	Email string
+	Title string
+	DueAt *time.Time
+}
+
+// Due-date filters supported by TodoService.ListDue.
+const (
+	DueToday   = "today"
+	DueOverdue = "overdue"
+)
+
+// LocationResolver returns the time zone a user's dates should be computed in.
+type LocationResolver interface {
+	Location(ctx context.Context, email string) (*time.Location, error)
 }
 
 // TodoRepository is the storage contract required by the todo service.
@@ -31,6 +58,11 @@ type TodoRepository interface {
 	Update(ctx context.Context, id primitive.ObjectID, update TodoUpdate) (Todo, error)
 	Delete(ctx context.Context, id primitive.ObjectID) error
 	Clear(ctx context.Context, email string) error
+	// Count returns the number of todos owned by email.
+	Count(ctx context.Context, email string) (int64, error)
+	// TitleBytes returns the total UTF-8 length of the titles of the todos
+	// owned by email, the storage counted against TodoQuota.MaxBytes.
+	TitleBytes(ctx context.Context, email string) (int64, error)
 }
 
 // MongoTodoRepository implements TodoRepository backed by MongoDB.
@@ -43,14 +75,14 @@ func NewMongoTodoRepository(collection *mongo.Collection) *MongoTodoRepository {
 	return &MongoTodoRepository{collection: collection}
 }
 
-// List returns todos optionally filtered by email.
+// List returns todos optionally filtered by email, oldest first.
 func (m *MongoTodoRepository) List(ctx context.Context, email string) ([]Todo, error) {
 	filter := bson.M{}
 	if email != "" {
 		filter["email"] = email
 	}
 
-	cursor, err := m.collection.Find(ctx, filter, options.Find().SetSort(bson.M{"createdAt": 1}))
+	cursor, err := m.collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}))
 	if err != nil {
 		return nil, err
 	}
@@ -84,11 +116,20 @@ func (m *MongoTodoRepository) Update(ctx context.Context, id primitive.ObjectID,
 	if update.Completed != nil {
 		updateDoc["completed"] = *update.Completed
 	}
+	change := bson.M{}
+	if update.ClearDueAt {
+		change["$unset"] = bson.M{"dueAt": ""}
+	} else if update.DueAt != nil {
+		updateDoc["dueAt"] = *update.DueAt
+	}
+	if len(updateDoc) > 0 {
+		change["$set"] = updateDoc
+	}
 
 	res := m.collection.FindOneAndUpdate(
 		ctx,
 		bson.M{"_id": id},
-		bson.M{"$set": updateDoc},
+		change,
 		options.FindOneAndUpdate().SetReturnDocument(options.After),
 	)
 
@@ -124,22 +165,78 @@ func (m *MongoTodoRepository) Clear(ctx context.Context, email string) error {
 	return err
 }
 
+// Count returns the number of todos owned by email.
+func (m *MongoTodoRepository) Count(ctx context.Context, email string) (int64, error) {
+	return m.collection.CountDocuments(ctx, bson.M{"email": email})
+}
+
+// TitleBytes sums the title lengths of the todos owned by email on the
+// server.
+func (m *MongoTodoRepository) TitleBytes(ctx context.Context, email string) (int64, error) {
+	cursor, err := m.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"email": email}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   nil,
+			"bytes": bson.M{"$sum": bson.M{"$strLenBytes": "$title"}},
+		}}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var total struct {
+		Bytes int64 `bson:"bytes"`
+	}
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&total); err != nil {
+			return 0, err
+		}
+	}
+	return total.Bytes, cursor.Err()
+}
+
+// EnsureIndexes creates the index that serves per-user listing and counting.
+func (m *MongoTodoRepository) EnsureIndexes(ctx context.Context) error {
+	return createIndexes(ctx, m.collection, todoIndexes)
+}
+
 // TodoService encapsulates business logic for todo operations.
 type TodoService struct {
-	repo TodoRepository
-	now  func() time.Time
+	repo      TodoRepository
+	now       func() time.Time
+	locations LocationResolver
+	quota     TodoQuota
+}
+
+// TodoServiceOption customises a TodoService.
+type TodoServiceOption func(*TodoService)
+
+// WithLocationResolver makes date-based queries use each user's time zone
+// instead of the server's.
+func WithLocationResolver(resolver LocationResolver) TodoServiceOption {
+	return func(s *TodoService) {
+		s.locations = resolver
+	}
 }
 
 // NewTodoService builds a new TodoService instance.
-func NewTodoService(repo TodoRepository, now func() time.Time) *TodoService {
+func NewTodoService(repo TodoRepository, now func() time.Time, opts ...TodoServiceOption) *TodoService {
 	if now == nil {
 		now = time.Now
 	}
-	return &TodoService{repo: repo, now: now}
+	s := &TodoService{repo: repo, now: now}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // List returns todos optionally filtered by user email.
-func (s *TodoService) List(ctx context.Context, email string) ([]TodoResponse, error) {
+func (s *TodoService) List(ctx context.Context, email string) (_ []TodoResponse, err error) {
+	ctx, span := startSpan(ctx, "TodoService.List")
+	defer func() { endSpan(span, err) }()
+
 	email = NormalizeEmail(email)
 
 	todos, err := s.repo.List(ctx, email)
@@ -154,20 +251,101 @@ func (s *TodoService) List(ctx context.Context, email string) ([]TodoResponse, e
 	return responses, nil
 }
 
+// ListDue returns the todos of email matching a due-date filter: DueToday
+// selects todos due during the current day in the user's time zone and
+// DueOverdue selects incomplete todos whose due date has passed.
+func (s *TodoService) ListDue(ctx context.Context, email, filter string) (_ []TodoResponse, err error) {
+	ctx, span := startSpan(ctx, "TodoService.ListDue")
+	defer func() { endSpan(span, err) }()
+
+	email = NormalizeEmail(email)
+	if email == "" {
+		return nil, ErrInvalidTodoInput
+	}
+
+	now := s.now()
+	var match func(Todo) bool
+	switch filter {
+	case DueToday:
+		loc, err := s.location(ctx, email)
+		if err != nil {
+			return nil, err
+		}
+		local := now.In(loc)
+		start := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+		end := start.AddDate(0, 0, 1)
+		match = func(t Todo) bool {
+			return t.DueAt != nil && !t.DueAt.Before(start) && t.DueAt.Before(end)
+		}
+	case DueOverdue:
+		match = func(t Todo) bool {
+			return t.DueAt != nil && !t.Completed && t.DueAt.Before(now)
+		}
+	default:
+		return nil, ErrInvalidDueFilter
+	}
+
+	todos, err := s.repo.List(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]TodoResponse, 0, len(todos))
+	for _, todo := range todos {
+		if match(todo) {
+			responses = append(responses, todo.ToResponse())
+		}
+	}
+	return responses, nil
+}
+
+// location resolves the time zone of email, falling back to UTC. Todos may
+// be owned by an email without an account, which also gets UTC.
+func (s *TodoService) location(ctx context.Context, email string) (*time.Location, error) {
+	if s.locations == nil {
+		return time.UTC, nil
+	}
+	loc, err := s.locations.Location(ctx, email)
+	if errors.Is(err, ErrNotFound) {
+		return time.UTC, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if loc == nil {
+		return time.UTC, nil
+	}
+	return loc, nil
+}
+
 // Create validates input and stores a new todo.
 func (s *TodoService) Create(ctx context.Context, email, title string) (TodoResponse, error) {
-	email = NormalizeEmail(email)
-	title = NormalizeText(title)
+	return s.CreateFrom(ctx, TodoInput{Email: email, Title: title})
+}
 
-	if email == "" || title == "" {
+// CreateFrom validates input and stores a new todo with optional fields.
+func (s *TodoService) CreateFrom(ctx context.Context, input TodoInput) (_ TodoResponse, err error) {
+	ctx, span := startSpan(ctx, "TodoService.CreateFrom")
+	defer func() { endSpan(span, err) }()
+
+	email := NormalizeEmail(input.Email)
+	if email == "" {
 		return TodoResponse{}, ErrInvalidTodoInput
 	}
+	title, err := s.normalizeTitle(input.Title)
+	if err != nil {
+		return TodoResponse{}, err
+	}
+	if err := s.reserveTodos(ctx, email, 1, int64(len(title))); err != nil {
+		return TodoResponse{}, err
+	}
 
 	todo := Todo{
 		Email:     email,
 		Title:     title,
 		Completed: false,
 		CreatedAt: s.now(),
+		DueAt:     input.DueAt,
 	}
 
 	created, err := s.repo.Create(ctx, todo)
@@ -178,9 +356,26 @@ func (s *TodoService) Create(ctx context.Context, email, title string) (TodoResp
 	return created.ToResponse(), nil
 }
 
+// normalizeTitle cleans up title and checks it against MaxTitleLength and
+// the title quota.
+func (s *TodoService) normalizeTitle(title string) (string, error) {
+	title = NormalizeText(title)
+	length := utf8.RuneCountInString(title)
+	switch {
+	case title == "" || length > MaxTitleLength:
+		return "", ErrInvalidTodoInput
+	case length > s.quota.titleLimit():
+		return "", &QuotaError{Quota: QuotaTitleLength, Limit: s.quota.titleLimit()}
+	}
+	return title, nil
+}
+
 // Update applies the provided modification to a todo and returns the updated todo.
-func (s *TodoService) Update(ctx context.Context, id string, update TodoUpdate) (TodoResponse, error) {
-	if update.Title == nil && update.Completed == nil {
+func (s *TodoService) Update(ctx context.Context, id string, update TodoUpdate) (_ TodoResponse, err error) {
+	ctx, span := startSpan(ctx, "TodoService.Update")
+	defer func() { endSpan(span, err) }()
+
+	if update.Title == nil && update.Completed == nil && update.DueAt == nil && !update.ClearDueAt {
 		return TodoResponse{}, ErrInvalidTodoInput
 	}
 
@@ -190,9 +385,9 @@ func (s *TodoService) Update(ctx context.Context, id string, update TodoUpdate)
 	}
 
 	if update.Title != nil {
-		title := NormalizeText(*update.Title)
-		if title == "" {
-			return TodoResponse{}, ErrInvalidTodoInput
+		title, err := s.normalizeTitle(*update.Title)
+		if err != nil {
+			return TodoResponse{}, err
 		}
 		update.Title = &title
 	}
@@ -206,7 +401,10 @@ func (s *TodoService) Update(ctx context.Context, id string, update TodoUpdate)
 }
 
 // Delete removes a todo by ID.
-func (s *TodoService) Delete(ctx context.Context, id string) error {
+func (s *TodoService) Delete(ctx context.Context, id string) (err error) {
+	ctx, span := startSpan(ctx, "TodoService.Delete")
+	defer func() { endSpan(span, err) }()
+
 	objID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return ErrInvalidTodoID
@@ -215,7 +413,10 @@ func (s *TodoService) Delete(ctx context.Context, id string) error {
 }
 
 // Clear removes todos optionally filtered by email.
-func (s *TodoService) Clear(ctx context.Context, email string) error {
+func (s *TodoService) Clear(ctx context.Context, email string) (err error) {
+	ctx, span := startSpan(ctx, "TodoService.Clear")
+	defer func() { endSpan(span, err) }()
+
 	email = NormalizeEmail(email)
 	return s.repo.Clear(ctx, email)
 }
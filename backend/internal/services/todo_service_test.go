@@ -2,74 +2,12 @@ package services
 
 import (
 	"context"
-	"sort"
+	"errors"
+	"strings"
 	"testing"
 	"time"
-
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-type memoryTodoRepo struct {
-	todos map[primitive.ObjectID]Todo
-}
-
-func newMemoryTodoRepo() *memoryTodoRepo {
-	return &memoryTodoRepo{todos: make(map[primitive.ObjectID]Todo)}
-}
-
-func (m *memoryTodoRepo) List(_ context.Context, email string) ([]Todo, error) {
-	var result []Todo
-	for _, todo := range m.todos {
-		if email == "" || todo.Email == email {
-			result = append(result, todo)
-		}
-	}
-	sort.Slice(result, func(i, j int) bool {
-		return result[i].CreatedAt.Before(result[j].CreatedAt)
-	})
-	return result, nil
-}
-
-func (m *memoryTodoRepo) Create(_ context.Context, todo Todo) (Todo, error) {
-	if todo.ID.IsZero() {
-		todo.ID = primitive.NewObjectID()
-	}
-	m.todos[todo.ID] = todo
-	return todo, nil
-}
-
-func (m *memoryTodoRepo) Update(_ context.Context, id primitive.ObjectID, update TodoUpdate) (Todo, error) {
-	todo, ok := m.todos[id]
-	if !ok {
-		return Todo{}, ErrNotFound
-	}
-	if update.Title != nil {
-		todo.Title = *update.Title
-	}
-	if update.Completed != nil {
-		todo.Completed = *update.Completed
-	}
-	m.todos[id] = todo
-	return todo, nil
-}
-
-func (m *memoryTodoRepo) Delete(_ context.Context, id primitive.ObjectID) error {
-	if _, ok := m.todos[id]; !ok {
-		return ErrNotFound
-	}
-	delete(m.todos, id)
-	return nil
-}
-
-func (m *memoryTodoRepo) Clear(_ context.Context, email string) error {
-	for id, todo := range m.todos {
-		if email == "" || todo.Email == email {
-			delete(m.todos, id)
-		}
-	}
-	return nil
-}
-
 func fixedNow() time.Time {
 	return time.Date(2025, time.January, 1, 10, 0, 0, 0, time.UTC)
 }
@@ -77,7 +15,7 @@ func fixedNow() time.Time {
 // TestTodoServiceCreateNormalizesInput asserts Create sanitizes fields and stores todos.
 func TestTodoServiceCreateNormalizesInput(t *testing.T) {
 	ctx := context.Background()
-	repo := newMemoryTodoRepo()
+	repo := NewMemoryTodoRepository()
 	service := NewTodoService(repo, fixedNow)
 
 	resp, err := service.Create(ctx, " User@Example.com ", " Primera tarea ")
@@ -98,10 +36,23 @@ func TestTodoServiceCreateNormalizesInput(t *testing.T) {
 	}
 }
 
+// TestTodoServiceCreateRejectsLongTitles asserts titles are capped at MaxTitleLength characters.
+func TestTodoServiceCreateRejectsLongTitles(t *testing.T) {
+	ctx := context.Background()
+	service := NewTodoService(NewMemoryTodoRepository(), fixedNow)
+
+	if _, err := service.Create(ctx, "user@example.com", strings.Repeat("ñ", MaxTitleLength)); err != nil {
+		t.Fatalf("expected title at the limit to be accepted, got %v", err)
+	}
+	if _, err := service.Create(ctx, "user@example.com", strings.Repeat("a", MaxTitleLength+1)); !errors.Is(err, ErrInvalidTodoInput) {
+		t.Errorf("expected ErrInvalidTodoInput, got %v", err)
+	}
+}
+
 // TestTodoServiceListFiltersByEmail verifies List respects email filters.
 func TestTodoServiceListFiltersByEmail(t *testing.T) {
 	ctx := context.Background()
-	repo := newMemoryTodoRepo()
+	repo := NewMemoryTodoRepository()
 	service := NewTodoService(repo, fixedNow)
 
 	_, _ = service.Create(ctx, "alice@example.com", "Task A")
@@ -122,7 +73,7 @@ func TestTodoServiceListFiltersByEmail(t *testing.T) {
 // TestTodoServiceUpdateModifiesFields confirms Update validates data and persists changes.
 func TestTodoServiceUpdateModifiesFields(t *testing.T) {
 	ctx := context.Background()
-	repo := newMemoryTodoRepo()
+	repo := NewMemoryTodoRepository()
 	service := NewTodoService(repo, fixedNow)
 
 	created, err := service.Create(ctx, "alice@example.com", "Initial")
@@ -152,7 +103,7 @@ func TestTodoServiceUpdateModifiesFields(t *testing.T) {
 // TestTodoServiceDeleteAndClear validates Delete and Clear flows.
 func TestTodoServiceDeleteAndClear(t *testing.T) {
 	ctx := context.Background()
-	repo := newMemoryTodoRepo()
+	repo := NewMemoryTodoRepository()
 	service := NewTodoService(repo, fixedNow)
 
 	first, _ := service.Create(ctx, "alice@example.com", "First")
@@ -186,7 +137,7 @@ func TestTodoServiceDeleteAndClear(t *testing.T) {
 // TestTodoServiceValidateInput covers invalid IDs and payloads.
 func TestTodoServiceValidateInput(t *testing.T) {
 	ctx := context.Background()
-	service := NewTodoService(newMemoryTodoRepo(), fixedNow)
+	service := NewTodoService(NewMemoryTodoRepository(), fixedNow)
 
 	if _, err := service.Create(ctx, "", ""); err != ErrInvalidTodoInput {
 		t.Fatalf("expected ErrInvalidTodoInput for empty create, got %v", err)
@@ -204,3 +155,62 @@ func TestTodoServiceValidateInput(t *testing.T) {
 func strPtr(value string) *string {
 	return &value
 }
+
+// TestTodoServiceListDueUsesUserTimeZone checks "today" follows the user's
+// calendar day rather than the server's.
+func TestTodoServiceListDueUsesUserTimeZone(t *testing.T) {
+	ctx := context.Background()
+	users := NewMemoryUserRepository()
+	seedUsers(t, users, User{Email: "ana@example.com", TimeZone: "America/Argentina/Buenos_Aires"})
+	repo := NewMemoryTodoRepository()
+	// 02:00 UTC on Jan 2 is still Jan 1 in Buenos Aires (UTC-3).
+	now := func() time.Time { return time.Date(2025, time.January, 2, 2, 0, 0, 0, time.UTC) }
+	service := NewTodoService(repo, now, WithLocationResolver(NewUserService(users)))
+
+	due := func(v time.Time) *time.Time { return &v }
+	inputs := map[string]*time.Time{
+		"local today":   due(time.Date(2025, time.January, 1, 23, 0, 0, 0, time.UTC)),
+		"local evening": due(time.Date(2025, time.January, 2, 2, 30, 0, 0, time.UTC)),
+		"tomorrow":      due(time.Date(2025, time.January, 2, 4, 0, 0, 0, time.UTC)),
+		"yesterday":     due(time.Date(2024, time.December, 31, 12, 0, 0, 0, time.UTC)),
+		"no due date":   nil,
+	}
+	for title, dueAt := range inputs {
+		if _, err := service.CreateFrom(ctx, TodoInput{Email: "ana@example.com", Title: title, DueAt: dueAt}); err != nil {
+			t.Fatalf("create %q: %v", title, err)
+		}
+	}
+
+	today, err := service.ListDue(ctx, "ana@example.com", DueToday)
+	if err != nil {
+		t.Fatalf("list today: %v", err)
+	}
+	titles := map[string]bool{}
+	for _, todo := range today {
+		titles[todo.Title] = true
+	}
+	if len(today) != 2 || !titles["local today"] || !titles["local evening"] {
+		t.Errorf("unexpected todos due today: %+v", today)
+	}
+
+	overdue, err := service.ListDue(ctx, "ana@example.com", DueOverdue)
+	if err != nil {
+		t.Fatalf("list overdue: %v", err)
+	}
+	if len(overdue) != 2 {
+		t.Errorf("expected 2 overdue todos, got %+v", overdue)
+	}
+
+	if _, err := service.ListDue(ctx, "ana@example.com", "someday"); !errors.Is(err, ErrInvalidDueFilter) {
+		t.Errorf("expected ErrInvalidDueFilter, got %v", err)
+	}
+
+	// Owners without an account get UTC days.
+	if _, err := service.CreateFrom(ctx, TodoInput{Email: "guest@example.com", Title: "utc today", DueAt: inputs["local evening"]}); err != nil {
+		t.Fatalf("create for guest: %v", err)
+	}
+	guest, err := service.ListDue(ctx, "guest@example.com", DueToday)
+	if err != nil || len(guest) != 1 {
+		t.Errorf("expected the guest todo due today in UTC, got %+v %v", guest, err)
+	}
+}
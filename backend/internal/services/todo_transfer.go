@@ -0,0 +1,434 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/logging"
+)
+
+// Formats read and written by TodoService.Import and TodoService.Export.
+const (
+	TodoFormatJSON     = "json"
+	TodoFormatCSV      = "csv"
+	TodoFormatMarkdown = "md"
+	TodoFormatICS      = "ics"
+)
+
+var (
+	// ErrUnsupportedFormat is returned for an import or export format other
+	// than the TodoFormat* values.
+	ErrUnsupportedFormat = errors.New("unsupported format")
+	// ErrTodoNotStored rejects the rows of an import that were not stored
+	// because the repository failed; importing them again may succeed.
+	ErrTodoNotStored = errors.New("todo not stored")
+)
+
+// TodoRecord is one todo read from an import.
+type TodoRecord struct {
+	// Row is the position of the todo in the input: its element number in
+	// JSON, its VTODO number in iCalendar and its line number in CSV and
+	// Markdown.
+	Row       int
+	Title     string
+	Completed bool
+	// CreatedAt is kept when set; otherwise the import time is used.
+	CreatedAt time.Time
+	DueAt     *time.Time
+}
+
+// TodoImportError reports a rejected row of an import. Field names the
+// offending field, or is empty when the row as a whole was rejected.
+type TodoImportError struct {
+	Row   int
+	Field string
+	Err   error
+}
+
+func (e TodoImportError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("row %d: %v", e.Row, e.Err)
+	}
+	return fmt.Sprintf("row %d: %s: %v", e.Row, e.Field, e.Err)
+}
+
+func (e TodoImportError) Unwrap() error {
+	return e.Err
+}
+
+// TodoImport is the outcome of TodoService.Import. Todos lists the created
+// todos, or, in a dry run, the todos that would be created, without IDs.
+type TodoImport struct {
+	DryRun bool
+	Todos  []TodoResponse
+	Errors []TodoImportError
+}
+
+// ExportOption configures TodoService.Export.
+type ExportOption func(*exportOptions)
+
+// exportOptions is what writers need besides the todos: when the export is
+// generated and the domain of iCalendar UIDs.
+type exportOptions struct {
+	now    time.Time
+	domain string
+}
+
+// WithCalendarDomain sets the domain that makes the UIDs of iCalendar
+// exports globally unique, usually the host serving them. Empty domains are
+// ignored.
+func WithCalendarDomain(domain string) ExportOption {
+	return func(o *exportOptions) {
+		if domain != "" {
+			o.domain = domain
+		}
+	}
+}
+
+// Export writes the todos of email to w in format.
+func (s *TodoService) Export(ctx context.Context, email, format string, w io.Writer, opts ...ExportOption) (err error) {
+	ctx, span := startSpan(ctx, "TodoService.Export")
+	defer func() { endSpan(span, err) }()
+
+	write, ok := todoWriters[format]
+	if !ok {
+		return ErrUnsupportedFormat
+	}
+	if NormalizeEmail(email) == "" {
+		return ErrInvalidTodoInput
+	}
+	todos, err := s.List(ctx, email)
+	if err != nil {
+		return err
+	}
+	options := exportOptions{now: s.now(), domain: icsDefaultDomain}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return write(w, todos, options)
+}
+
+// Import creates todos for email from r in format. Every row is checked
+// with the rules of CreateFrom, including the quota, but keeps its
+// completed state and creation time. Valid rows are created even when
+// others are rejected; Errors reports the rejected ones. A dry run only
+// reports what would happen.
+func (s *TodoService) Import(ctx context.Context, email string, r io.Reader, format string, dryRun bool) (_ TodoImport, err error) {
+	ctx, span := startSpan(ctx, "TodoService.Import")
+	defer func() { endSpan(span, err) }()
+
+	parse, ok := todoParsers[format]
+	if !ok {
+		return TodoImport{}, ErrUnsupportedFormat
+	}
+	email = NormalizeEmail(email)
+	if email == "" {
+		return TodoImport{}, ErrInvalidTodoInput
+	}
+	records, rejected, err := parse(r)
+	if err != nil {
+		return TodoImport{}, err
+	}
+	return s.importRecords(ctx, email, records, rejected, dryRun)
+}
+
+// importRecords validates and stores records after rows already rejected
+// while parsing. Once storing a todo fails, the later rows are still
+// validated but rejected with ErrTodoNotStored, so the result reports
+// exactly which rows were imported.
+func (s *TodoService) importRecords(ctx context.Context, email string, records []TodoRecord, rejected []TodoImportError, dryRun bool) (TodoImport, error) {
+	// The quota is looked up once for the whole import rather than per row.
+	remaining, remainingBytes, err := s.remaining(ctx, email)
+	if err != nil {
+		return TodoImport{}, err
+	}
+
+	result := TodoImport{DryRun: dryRun, Todos: []TodoResponse{}, Errors: rejected}
+	var storeErr error
+	for _, record := range records {
+		title, err := s.normalizeTitle(record.Title)
+		if err != nil {
+			result.Errors = append(result.Errors, TodoImportError{Row: record.Row, Field: "title", Err: err})
+			continue
+		}
+		if remaining == 0 {
+			result.Errors = append(result.Errors, TodoImportError{
+				Row: record.Row,
+				Err: &QuotaError{Quota: QuotaTodos, Limit: s.quota.MaxTodos},
+			})
+			continue
+		}
+		if remainingBytes >= 0 && int64(len(title)) > remainingBytes {
+			result.Errors = append(result.Errors, TodoImportError{
+				Row: record.Row,
+				Err: &QuotaError{Quota: QuotaBytes, Limit: s.quota.MaxBytes},
+			})
+			continue
+		}
+
+		todo := Todo{
+			Email:     email,
+			Title:     title,
+			Completed: record.Completed,
+			CreatedAt: record.CreatedAt,
+			DueAt:     record.DueAt,
+		}
+		if todo.CreatedAt.IsZero() {
+			todo.CreatedAt = s.now()
+		}
+		if storeErr == nil && !dryRun {
+			todo, storeErr = s.repo.Create(ctx, todo)
+			if storeErr != nil {
+				logging.FromContext(ctx).Error("importing todos failed",
+					slog.Int("row", record.Row), slog.Any("error", storeErr))
+			}
+		}
+		if storeErr != nil {
+			result.Errors = append(result.Errors, TodoImportError{
+				Row: record.Row,
+				Err: fmt.Errorf("%w: %w", ErrTodoNotStored, storeErr),
+			})
+			continue
+		}
+		response := todo.ToResponse()
+		if dryRun {
+			response.ID = ""
+		}
+		result.Todos = append(result.Todos, response)
+		remaining--
+		remainingBytes -= int64(len(title))
+	}
+
+	sort.SliceStable(result.Errors, func(i, j int) bool { return result.Errors[i].Row < result.Errors[j].Row })
+	return result, nil
+}
+
+var todoWriters = map[string]func(io.Writer, []TodoResponse, exportOptions) error{
+	TodoFormatJSON:     writeTodosJSON,
+	TodoFormatCSV:      writeTodosCSV,
+	TodoFormatMarkdown: writeTodosMarkdown,
+	TodoFormatICS:      writeTodosICS,
+}
+
+// todoParsers read an import. Rows that cannot be read are returned as
+// errors; an input that cannot be read at all fails with ErrInvalidTodoInput.
+var todoParsers = map[string]func(io.Reader) ([]TodoRecord, []TodoImportError, error){
+	TodoFormatJSON:     parseTodosJSON,
+	TodoFormatCSV:      parseTodosCSV,
+	TodoFormatMarkdown: parseTodosMarkdown,
+	TodoFormatICS:      parseTodosICS,
+}
+
+func writeTodosJSON(w io.Writer, todos []TodoResponse, _ exportOptions) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(todos)
+}
+
+// todoCSVHeader is the header written by exports; imports find the columns
+// by name and only require title.
+var todoCSVHeader = []string{"id", "title", "completed", "createdAt", "dueAt"}
+
+func writeTodosCSV(w io.Writer, todos []TodoResponse, _ exportOptions) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(todoCSVHeader); err != nil {
+		return err
+	}
+	for _, todo := range todos {
+		dueAt := ""
+		if todo.DueAt != nil {
+			dueAt = todo.DueAt.UTC().Format(time.RFC3339)
+		}
+		record := []string{
+			todo.ID,
+			todo.Title,
+			strconv.FormatBool(todo.Completed),
+			todo.CreatedAt.UTC().Format(time.RFC3339),
+			dueAt,
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeTodosMarkdown writes a GitHub-style checklist. It only keeps titles
+// and completed states.
+func writeTodosMarkdown(w io.Writer, todos []TodoResponse, _ exportOptions) error {
+	bw := bufio.NewWriter(w)
+	for _, todo := range todos {
+		mark := " "
+		if todo.Completed {
+			mark = "x"
+		}
+		fmt.Fprintf(bw, "- [%s] %s\n", mark, strings.Join(strings.Fields(todo.Title), " "))
+	}
+	return bw.Flush()
+}
+
+// jsonTodo is a todo as exported in JSON; other fields are ignored.
+type jsonTodo struct {
+	Title     string     `json:"title"`
+	Completed bool       `json:"completed"`
+	CreatedAt *time.Time `json:"createdAt"`
+	DueAt     *time.Time `json:"dueAt"`
+}
+
+func parseTodosJSON(r io.Reader) ([]TodoRecord, []TodoImportError, error) {
+	var rows []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&rows); err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrInvalidTodoInput, err)
+	}
+
+	var records []TodoRecord
+	var rejected []TodoImportError
+	for i, raw := range rows {
+		var todo jsonTodo
+		if err := json.Unmarshal(raw, &todo); err != nil {
+			var typeErr *json.UnmarshalTypeError
+			field := ""
+			if errors.As(err, &typeErr) {
+				field = typeErr.Field
+			}
+			rejected = append(rejected, TodoImportError{Row: i + 1, Field: field, Err: fmt.Errorf("%w: %w", ErrInvalidTodoInput, err)})
+			continue
+		}
+		record := TodoRecord{Row: i + 1, Title: todo.Title, Completed: todo.Completed, DueAt: todo.DueAt}
+		if todo.CreatedAt != nil {
+			record.CreatedAt = *todo.CreatedAt
+		}
+		records = append(records, record)
+	}
+	return records, rejected, nil
+}
+
+func parseTodosCSV(r io.Reader) ([]TodoRecord, []TodoImportError, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: reading the csv header: %w", ErrInvalidTodoInput, err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["title"]; !ok {
+		return nil, nil, fmt.Errorf("%w: the csv header has no title column", ErrInvalidTodoInput)
+	}
+	// Column names are matched case-insensitively.
+	column := func(record []string, name string) string {
+		if i, ok := columns[strings.ToLower(name)]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var records []TodoRecord
+	var rejected []TodoImportError
+	for {
+		fields, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			rejected = append(rejected, TodoImportError{Row: parseErr.Line, Err: fmt.Errorf("%w: %w", ErrInvalidTodoInput, parseErr.Err)})
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		line, _ := cr.FieldPos(0)
+		record, field, err := csvRecord(line, func(name string) string { return column(fields, name) })
+		if err != nil {
+			rejected = append(rejected, TodoImportError{Row: line, Field: field, Err: err})
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, rejected, nil
+}
+
+// csvRecord builds the record of a CSV row; on error it names the field.
+func csvRecord(line int, get func(name string) string) (TodoRecord, string, error) {
+	record := TodoRecord{Row: line, Title: get("title")}
+	if v := get("completed"); v != "" {
+		completed, err := strconv.ParseBool(v)
+		if err != nil {
+			return TodoRecord{}, "completed", fmt.Errorf("%w: %q is not a boolean", ErrInvalidTodoInput, v)
+		}
+		record.Completed = completed
+	}
+	if v := get("createdAt"); v != "" {
+		createdAt, err := parseImportTime(v)
+		if err != nil {
+			return TodoRecord{}, "createdAt", err
+		}
+		record.CreatedAt = createdAt
+	}
+	if v := get("dueAt"); v != "" {
+		dueAt, err := parseImportTime(v)
+		if err != nil {
+			return TodoRecord{}, "dueAt", err
+		}
+		record.DueAt = &dueAt
+	}
+	return record, "", nil
+}
+
+// parseImportTime accepts RFC 3339 times and plain dates, read as UTC.
+func parseImportTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.DateOnly, v); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%w: %q is not an RFC 3339 time or a date", ErrInvalidTodoInput, v)
+}
+
+// checklistItem matches "- [ ] title" and "- [x] title" list items, with any
+// bullet or an ordered list number.
+var checklistItem = regexp.MustCompile(`^\s*(?:[-*+]|\d+[.)])\s+\[([ xX])\]\s*(.*)$`)
+
+// parseTodosMarkdown reads a checklist. Blank lines and headings are
+// skipped; any other line is reported as not being a checklist item.
+func parseTodosMarkdown(r io.Reader) ([]TodoRecord, []TodoImportError, error) {
+	var records []TodoRecord
+	var rejected []TodoImportError
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		match := checklistItem.FindStringSubmatch(text)
+		if match == nil {
+			rejected = append(rejected, TodoImportError{Row: line, Err: fmt.Errorf("%w: not a checklist item", ErrInvalidTodoInput)})
+			continue
+		}
+		records = append(records, TodoRecord{Row: line, Title: match[2], Completed: match[1] != " "})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	return records, rejected, nil
+}
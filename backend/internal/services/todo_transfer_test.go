@@ -0,0 +1,348 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestTodoServiceExportRoundTrips exports in every format and imports the
+// result for another user.
+func TestTodoServiceExportRoundTrips(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryTodoRepository()
+	service := NewTodoService(repo, fixedNow)
+
+	created := time.Date(2024, time.March, 5, 8, 30, 0, 0, time.UTC)
+	due := time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC)
+	for _, todo := range []Todo{
+		{Email: "ana@example.com", Title: "Buy milk", Completed: true, CreatedAt: created},
+		{Email: "ana@example.com", Title: "Call, \"mom\"", CreatedAt: created.Add(time.Hour), DueAt: &due},
+	} {
+		if _, err := repo.Create(ctx, todo); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, format := range []string{TodoFormatJSON, TodoFormatCSV, TodoFormatMarkdown, TodoFormatICS} {
+		var buf bytes.Buffer
+		if err := service.Export(ctx, "ana@example.com", format, &buf); err != nil {
+			t.Fatalf("%s: export: %v", format, err)
+		}
+
+		owner := format + "@example.com"
+		result, err := service.Import(ctx, owner, &buf, format, false)
+		if err != nil {
+			t.Fatalf("%s: import: %v", format, err)
+		}
+		if len(result.Errors) != 0 || len(result.Todos) != 2 {
+			t.Fatalf("%s: unexpected result %+v", format, result)
+		}
+
+		todos, _ := service.List(ctx, owner)
+		if todos[0].Title != "Buy milk" || !todos[0].Completed || todos[1].Title != `Call, "mom"` || todos[1].Completed {
+			t.Errorf("%s: unexpected todos %+v", format, todos)
+		}
+		if format == TodoFormatMarkdown {
+			// Markdown only carries titles and completed states.
+			if !todos[0].CreatedAt.Equal(fixedNow()) || todos[1].DueAt != nil {
+				t.Errorf("md: expected new creation times and no due dates, got %+v", todos)
+			}
+			continue
+		}
+		if !todos[0].CreatedAt.Equal(created) || todos[1].DueAt == nil || !todos[1].DueAt.Equal(due) {
+			t.Errorf("%s: expected dates to be kept, got %+v", format, todos)
+		}
+	}
+}
+
+// flakyTodoRepo fails every Create after the first limit.
+type flakyTodoRepo struct {
+	*MemoryTodoRepository
+	limit int
+}
+
+var errStoreDown = errors.New("store down")
+
+func (r *flakyTodoRepo) Create(ctx context.Context, todo Todo) (Todo, error) {
+	if r.limit == 0 {
+		return Todo{}, errStoreDown
+	}
+	r.limit--
+	return r.MemoryTodoRepository.Create(ctx, todo)
+}
+
+// TestTodoServiceImportReportsStoreFailures ensures a failing repository
+// rejects the rows it did not store instead of failing the whole import.
+func TestTodoServiceImportReportsStoreFailures(t *testing.T) {
+	ctx := context.Background()
+	repo := &flakyTodoRepo{MemoryTodoRepository: NewMemoryTodoRepository(), limit: 1}
+	service := NewTodoService(repo, fixedNow)
+
+	input := "title,completed\none,\ntwo,\n,\nthree,\n"
+	result, err := service.Import(ctx, "ana@example.com", strings.NewReader(input), TodoFormatCSV, false)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if len(result.Todos) != 1 || result.Todos[0].Title != "one" {
+		t.Errorf("expected only the first todo to be imported, got %+v", result.Todos)
+	}
+
+	want := []struct {
+		row int
+		err error
+	}{
+		{3, ErrTodoNotStored},
+		{4, ErrInvalidTodoInput},
+		{5, ErrTodoNotStored},
+	}
+	if len(result.Errors) != len(want) {
+		t.Fatalf("expected %d errors, got %+v", len(want), result.Errors)
+	}
+	for i, w := range want {
+		if got := result.Errors[i]; got.Row != w.row || !errors.Is(got, w.err) {
+			t.Errorf("error %d: expected row %d %v, got %v", i, w.row, w.err, got)
+		}
+	}
+	if !errors.Is(result.Errors[0], errStoreDown) {
+		t.Errorf("expected the repository error to be kept, got %v", result.Errors[0])
+	}
+}
+
+// TestTodoServiceImportReportsRows covers rejected rows, the quota and dry runs.
+func TestTodoServiceImportReportsRows(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryTodoRepository()
+	service := NewTodoService(repo, fixedNow, WithTodoQuota(TodoQuota{MaxTodos: 3}))
+	if _, err := service.Create(ctx, "ana@example.com", "existing"); err != nil {
+		t.Fatal(err)
+	}
+
+	input := strings.Join([]string{
+		"Title,Completed,DueAt",
+		"one,true,2025-02-01",
+		",false,",
+		"two,maybe,",
+		"three,,2025-13-01",
+		"four,false,",
+		"five,false,",
+	}, "\n")
+
+	preview, err := service.Import(ctx, "ana@example.com", strings.NewReader(input), TodoFormatCSV, true)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if !preview.DryRun || len(preview.Todos) != 2 || preview.Todos[0].ID != "" || preview.Todos[1].Title != "four" {
+		t.Errorf("unexpected preview %+v", preview)
+	}
+	if n := len(repo.todos); n != 1 {
+		t.Fatalf("expected a dry run to store nothing, got %d todos", n)
+	}
+
+	result, err := service.Import(ctx, "ana@example.com", strings.NewReader(input), TodoFormatCSV, false)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if len(result.Todos) != 2 || result.Todos[0].ID == "" || !result.Todos[0].Completed || result.Todos[0].DueAt == nil {
+		t.Errorf("unexpected todos %+v", result.Todos)
+	}
+
+	want := []struct {
+		row   int
+		field string
+		err   error
+	}{
+		{3, "title", ErrInvalidTodoInput},
+		{4, "completed", ErrInvalidTodoInput},
+		{5, "dueAt", ErrInvalidTodoInput},
+		{7, "", ErrQuotaExceeded},
+	}
+	if len(result.Errors) != len(want) {
+		t.Fatalf("expected %d errors, got %+v", len(want), result.Errors)
+	}
+	for i, w := range want {
+		got := result.Errors[i]
+		if got.Row != w.row || got.Field != w.field || !errors.Is(got, w.err) {
+			t.Errorf("error %d: expected row %d %q %v, got %v", i, w.row, w.field, w.err, got)
+		}
+	}
+}
+
+// TestTodoServiceImportEnforcesByteQuota rejects the rows whose title no
+// longer fits in MaxBytes, and keeps importing shorter ones.
+func TestTodoServiceImportEnforcesByteQuota(t *testing.T) {
+	ctx := context.Background()
+	service := NewTodoService(NewMemoryTodoRepository(), fixedNow, WithTodoQuota(TodoQuota{MaxBytes: 12}))
+	if _, err := service.Create(ctx, "ana@example.com", "milk"); err != nil {
+		t.Fatal(err)
+	}
+
+	input := "- [ ] bread\n- [ ] eggs\n- [ ] tea\n"
+	result, err := service.Import(ctx, "ana@example.com", strings.NewReader(input), TodoFormatMarkdown, false)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if len(result.Todos) != 2 || result.Todos[0].Title != "bread" || result.Todos[1].Title != "tea" {
+		t.Errorf("unexpected todos %+v", result.Todos)
+	}
+	var quota *QuotaError
+	if len(result.Errors) != 1 || result.Errors[0].Row != 2 || !errors.As(result.Errors[0], &quota) || quota.Quota != QuotaBytes {
+		t.Errorf("expected row 2 to exceed the bytes quota, got %+v", result.Errors)
+	}
+}
+
+func TestTodoServiceImportParsesMarkdownChecklists(t *testing.T) {
+	ctx := context.Background()
+	service := NewTodoService(NewMemoryTodoRepository(), fixedNow)
+
+	input := "# Groceries\n\n- [ ] milk\n* [X] bread\n1. [x] eggs\nsome prose\n"
+	result, err := service.Import(ctx, "ana@example.com", strings.NewReader(input), TodoFormatMarkdown, false)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if len(result.Todos) != 3 || result.Todos[0].Completed || !result.Todos[1].Completed || result.Todos[2].Title != "eggs" {
+		t.Errorf("unexpected todos %+v", result.Todos)
+	}
+	if len(result.Errors) != 1 || result.Errors[0].Row != 6 {
+		t.Errorf("expected line 6 to be rejected, got %+v", result.Errors)
+	}
+}
+
+func TestTodoServiceExportWritesICalendar(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryTodoRepository()
+	service := NewTodoService(repo, fixedNow)
+
+	created := time.Date(2024, time.March, 5, 8, 30, 0, 0, time.UTC)
+	due := time.Date(2024, time.April, 1, 9, 0, 0, 0, time.UTC)
+	title := "Pay rent; water, gas\\power " + strings.Repeat("ñ", 40)
+	todo, err := repo.Create(ctx, Todo{Email: "ana@example.com", Title: title, Completed: true, CreatedAt: created, DueAt: &due})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := service.Export(ctx, "ana@example.com", TodoFormatICS, &buf, WithCalendarDomain("todos.example.com")); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\nVERSION:2.0\r\n",
+		"BEGIN:VTODO\r\nUID:" + todo.ID.Hex() + "@todos.example.com\r\n",
+		// Todos keep no modification time, so the export is stamped.
+		"DTSTAMP:20250101T100000Z\r\nCREATED:20240305T083000Z\r\nLAST-MODIFIED:20250101T100000Z\r\n",
+		"STATUS:COMPLETED\r\n",
+		"DUE:20240401T090000Z\r\n",
+		"END:VTODO\r\nEND:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in\n%s", want, out)
+		}
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("expected lines to be folded at 75 octets, got %q", line)
+		}
+	}
+
+	lines, err := unfoldICS(strings.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `SUMMARY:Pay rent\; water\, gas\\power ` + strings.Repeat("ñ", 40)
+	if !slices.Contains(lines, want) {
+		t.Errorf("expected the summary to unfold to %q, got %q", want, lines)
+	}
+}
+
+func TestTodoServiceImportParsesICalendar(t *testing.T) {
+	ctx := context.Background()
+	service := NewTodoService(NewMemoryTodoRepository(), fixedNow)
+
+	input := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"BEGIN:VEVENT",
+		"SUMMARY:not a todo",
+		"END:VEVENT",
+		"BEGIN:VTODO",
+		"SUMMARY:Call\\, mom",
+		"DUE;TZID=America/Argentina/Buenos_Aires:20250301T090000",
+		"CREATED:20250102T030405Z",
+		"BEGIN:VALARM",
+		"SUMMARY:alarm",
+		"END:VALARM",
+		"END:VTODO",
+		"BEGIN:VTODO",
+		"SUMMARY:Renew pass",
+		" port",
+		"DUE;VALUE=DATE:20250401",
+		"COMPLETED:20250110T120000Z",
+		"END:VTODO",
+		"BEGIN:VTODO",
+		"SUMMARY:Bad date",
+		"DUE:tomorrow",
+		"END:VTODO",
+		"BEGIN:VTODO",
+		"STATUS:NEEDS-ACTION",
+		"END:VTODO",
+		"END:VCALENDAR",
+	}, "\r\n")
+	result, err := service.Import(ctx, "ana@example.com", strings.NewReader(input), TodoFormatICS, false)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if len(result.Todos) != 2 {
+		t.Fatalf("expected 2 todos, got %+v", result.Todos)
+	}
+
+	call, renew := result.Todos[0], result.Todos[1]
+	wantDue := time.Date(2025, time.March, 1, 12, 0, 0, 0, time.UTC)
+	if call.Title != "Call, mom" || call.Completed || call.DueAt == nil || !call.DueAt.Equal(wantDue) ||
+		!call.CreatedAt.Equal(time.Date(2025, time.January, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("unexpected todo %+v", call)
+	}
+	if renew.Title != "Renew passport" || !renew.Completed || renew.DueAt == nil || !renew.DueAt.Equal(time.Date(2025, time.April, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected todo %+v", renew)
+	}
+
+	if len(result.Errors) != 2 || result.Errors[0].Row != 3 || result.Errors[0].Field != "dueAt" ||
+		result.Errors[1].Row != 4 || result.Errors[1].Field != "title" {
+		t.Errorf("unexpected errors %+v", result.Errors)
+	}
+}
+
+func TestTodoServiceImportRejectsUnreadableInput(t *testing.T) {
+	ctx := context.Background()
+	service := NewTodoService(NewMemoryTodoRepository(), fixedNow)
+
+	cases := []struct {
+		email, format, input string
+		want                 error
+	}{
+		{"ana@example.com", "xml", "<todos/>", ErrUnsupportedFormat},
+		{"", TodoFormatJSON, "[]", ErrInvalidTodoInput},
+		{"ana@example.com", TodoFormatJSON, `{"title": "not an array"}`, ErrInvalidTodoInput},
+		{"ana@example.com", TodoFormatCSV, "name,done\nx,true", ErrInvalidTodoInput},
+		{"ana@example.com", TodoFormatICS, "BEGIN:VTODO\nEND:VTODO", ErrInvalidTodoInput},
+		{"ana@example.com", TodoFormatICS, "BEGIN:VCALENDAR\nBEGIN:VTODO\nEND:VCALENDAR", ErrInvalidTodoInput},
+	}
+	for _, c := range cases {
+		if _, err := service.Import(ctx, c.email, strings.NewReader(c.input), c.format, false); !errors.Is(err, c.want) {
+			t.Errorf("%s %q: expected %v, got %v", c.format, c.input, c.want, err)
+		}
+	}
+
+	result, err := service.Import(ctx, "ana@example.com", strings.NewReader(`[{"title": "ok"}, {"title": 5}]`), TodoFormatJSON, false)
+	if err != nil || len(result.Todos) != 1 || len(result.Errors) != 1 || result.Errors[0].Field != "title" {
+		t.Errorf("unexpected result %+v (%v)", result, err)
+	}
+
+	if err := service.Export(ctx, "ana@example.com", "xml", &bytes.Buffer{}); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("expected ErrUnsupportedFormat, got %v", err)
+	}
+}
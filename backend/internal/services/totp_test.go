@@ -0,0 +1,72 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 test key from RFC 6238, base32 encoded.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// TestTOTPCodeMatchesRFC6238Vectors checks codes against the RFC test vectors.
+func TestTOTPCodeMatchesRFC6238Vectors(t *testing.T) {
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, want := range vectors {
+		got, err := TOTPCode(rfc6238Secret, time.Unix(unix, 0))
+		if err != nil {
+			t.Fatalf("code failed: %v", err)
+		}
+		if got != want {
+			t.Errorf("TOTPCode(%d) = %s, want %s", unix, got, want)
+		}
+	}
+}
+
+// TestMatchTOTPToleratesSkewAndRejectsReplays covers drift and replay protection.
+func TestMatchTOTPToleratesSkewAndRejectsReplays(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	previous, _ := TOTPCode(rfc6238Secret, now.Add(-totpPeriod))
+
+	step, ok := matchTOTP(rfc6238Secret, previous, now, 0)
+	if !ok || step != totpStep(now)-1 {
+		t.Fatalf("expected previous step to match, got step=%d ok=%v", step, ok)
+	}
+	if _, ok := matchTOTP(rfc6238Secret, previous, now, step); ok {
+		t.Fatalf("expected replayed code to be rejected")
+	}
+
+	old, _ := TOTPCode(rfc6238Secret, now.Add(-3*totpPeriod))
+	if _, ok := matchTOTP(rfc6238Secret, old, now, 0); ok {
+		t.Fatalf("expected code outside the skew window to be rejected")
+	}
+}
+
+// TestGenerateTOTPSecretAndURI verifies secrets are usable and URIs well formed.
+func TestGenerateTOTPSecretAndURI(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	if len(secret) != 32 {
+		t.Fatalf("expected 32 base32 chars, got %q", secret)
+	}
+	if _, err := TOTPCode(secret, time.Now()); err != nil {
+		t.Fatalf("generated secret not decodable: %v", err)
+	}
+
+	uri := TOTPURI("TodoApp", "user@example.com", secret)
+	if !strings.HasPrefix(uri, "otpauth://totp/TodoApp:user@example.com?") {
+		t.Fatalf("unexpected uri: %s", uri)
+	}
+	for _, part := range []string{"secret=" + secret, "issuer=TodoApp", "digits=6", "period=30"} {
+		if !strings.Contains(uri, part) {
+			t.Errorf("expected uri to contain %q, got %s", part, uri)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer resolves against the global provider on every use, so spans follow
+// whatever provider is installed after package initialisation.
+var tracer = otel.Tracer("github.com/ignaciomagoia/tp8ingsoft3/backend/internal/services")
+
+func startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name)
+}
+
+// endSpan records err on span and ends it. A pending second factor is part of
+// the normal login flow and is not reported as a failure.
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, ErrTwoFactorRequired) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+
+	exporter := tracetest.NewInMemoryExporter()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return exporter
+}
+
+func TestServiceMethodsCreateSpans(t *testing.T) {
+	exporter := recordSpans(t)
+	ctx := context.Background()
+
+	todos := NewTodoService(NewMemoryTodoRepository(), fixedNow)
+	if _, err := todos.Create(ctx, "user@example.com", "Traced"); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	users := NewUserService(NewMemoryUserRepository())
+	if err := users.Login(ctx, "missing@example.com", "secret"); err == nil {
+		t.Fatalf("expected login to fail")
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	if spans[0].Name != "TodoService.CreateFrom" || spans[0].Status.Code == codes.Error {
+		t.Errorf("unexpected create span: %s %v", spans[0].Name, spans[0].Status)
+	}
+	if spans[1].Name != "UserService.Login" || spans[1].Status.Code != codes.Error {
+		t.Errorf("expected failed login span, got %s %v", spans[1].Name, spans[1].Status)
+	}
+}
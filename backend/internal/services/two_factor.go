@@ -0,0 +1,426 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/logging"
+)
+
+const (
+	// DefaultTOTPIssuer is the issuer label shown by authenticator apps.
+	DefaultTOTPIssuer = "TodoApp"
+	// ChallengeTTL is how long a two-factor login challenge stays valid.
+	ChallengeTTL = 5 * time.Minute
+	// recoveryCodeCount is the number of recovery codes issued on confirmation.
+	recoveryCodeCount = 10
+	// recoveryCodeBytes is the entropy of a recovery code: 80 bits, written
+	// as four groups of five hex digits.
+	recoveryCodeBytes = 10
+)
+
+var (
+	// ErrTwoFactorRequired is returned by Login when a second factor is needed.
+	ErrTwoFactorRequired = errors.New("two-factor authentication required")
+	// ErrInvalidChallenge indicates an unknown or expired login challenge.
+	ErrInvalidChallenge = errors.New("invalid or expired challenge")
+	// ErrInvalidTwoFactorCode indicates a wrong TOTP or recovery code.
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+	// ErrTwoFactorAlreadyEnabled is returned when enrolling an account that already uses 2FA.
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication already enabled")
+	// ErrTwoFactorNotEnrolled is returned when confirming without a pending enrolment.
+	ErrTwoFactorNotEnrolled = errors.New("two-factor enrolment not started")
+	// ErrTwoFactorNotEnabled is returned when disabling 2FA on an account without it.
+	ErrTwoFactorNotEnabled = errors.New("two-factor authentication not enabled")
+)
+
+// TwoFactorRequiredError is returned by Login when the password was correct but
+// the account requires a second factor. It matches ErrTwoFactorRequired.
+type TwoFactorRequiredError struct {
+	Challenge string
+	ExpiresAt time.Time
+}
+
+func (e *TwoFactorRequiredError) Error() string {
+	return ErrTwoFactorRequired.Error()
+}
+
+// Is reports whether target is ErrTwoFactorRequired.
+func (e *TwoFactorRequiredError) Is(target error) bool {
+	return target == ErrTwoFactorRequired
+}
+
+// TwoFactorEnrollment is returned when a user starts TOTP enrolment.
+type TwoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// Challenge is a pending two-factor login.
+type Challenge struct {
+	ID        string    `bson:"_id"`
+	Email     string    `bson:"email"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
+
+// ChallengeStore keeps pending two-factor login challenges.
+type ChallengeStore interface {
+	Save(ctx context.Context, challenge Challenge) error
+	// Get returns the challenge or ErrNotFound when it is unknown or expired.
+	Get(ctx context.Context, id string) (Challenge, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// MemoryChallengeStore keeps challenges in process memory.
+type MemoryChallengeStore struct {
+	mu         sync.Mutex
+	challenges map[string]Challenge
+	now        func() time.Time
+}
+
+// NewMemoryChallengeStore creates an empty in-memory challenge store.
+func NewMemoryChallengeStore(now func() time.Time) *MemoryChallengeStore {
+	if now == nil {
+		now = time.Now
+	}
+	return &MemoryChallengeStore{challenges: make(map[string]Challenge), now: now}
+}
+
+// Save stores a challenge.
+func (m *MemoryChallengeStore) Save(_ context.Context, challenge Challenge) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.challenges[challenge.ID] = challenge
+	return nil
+}
+
+// Get returns a non-expired challenge.
+func (m *MemoryChallengeStore) Get(_ context.Context, id string) (Challenge, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	challenge, ok := m.challenges[id]
+	if !ok {
+		return Challenge{}, ErrNotFound
+	}
+	if !m.now().Before(challenge.ExpiresAt) {
+		delete(m.challenges, id)
+		return Challenge{}, ErrNotFound
+	}
+	return challenge, nil
+}
+
+// Delete removes a challenge.
+func (m *MemoryChallengeStore) Delete(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.challenges, id)
+	return nil
+}
+
+// MongoChallengeStore persists challenges in MongoDB with a TTL index.
+type MongoChallengeStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoChallengeStore creates a new store wrapper around a Mongo collection.
+func NewMongoChallengeStore(collection *mongo.Collection) *MongoChallengeStore {
+	return &MongoChallengeStore{collection: collection}
+}
+
+// EnsureIndexes creates the TTL index that expires stale challenges.
+func (m *MongoChallengeStore) EnsureIndexes(ctx context.Context) error {
+	return createIndexes(ctx, m.collection, expiresAtTTLIndexes)
+}
+
+// Save stores a challenge.
+func (m *MongoChallengeStore) Save(ctx context.Context, challenge Challenge) error {
+	_, err := m.collection.InsertOne(ctx, challenge)
+	return err
+}
+
+// Get returns a non-expired challenge.
+func (m *MongoChallengeStore) Get(ctx context.Context, id string) (Challenge, error) {
+	var challenge Challenge
+	err := m.collection.FindOne(ctx, bson.M{"_id": id, "expiresAt": bson.M{"$gt": time.Now()}}).Decode(&challenge)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Challenge{}, ErrNotFound
+	}
+	return challenge, err
+}
+
+// Delete removes a challenge.
+func (m *MongoChallengeStore) Delete(ctx context.Context, id string) error {
+	_, err := m.collection.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+func randomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// hashRecoveryCode hashes code with HMAC-SHA-256 keyed by salt.
+func hashRecoveryCode(salt, code string) string {
+	mac := hmac.New(sha256.New, []byte(salt))
+	mac.Write([]byte(normalizeRecoveryCode(code)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// generateRecoveryCodes returns the plain codes to show once, and the salt
+// and hashes to store.
+func generateRecoveryCodes() (codes []string, salt string, hashes []string, err error) {
+	if salt, err = randomToken(16); err != nil {
+		return nil, "", nil, err
+	}
+	codes = make([]string, 0, recoveryCodeCount)
+	hashes = make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw, err := randomToken(recoveryCodeBytes)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		code := fmt.Sprintf("%s-%s-%s-%s", raw[:5], raw[5:10], raw[10:15], raw[15:])
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(salt, code))
+	}
+	return codes, salt, hashes, nil
+}
+
+// verifySecondFactor accepts either a TOTP code or an unused recovery code and
+// updates twoFactor so the code cannot be reused.
+func (s *UserService) verifySecondFactor(twoFactor *TwoFactor, code string) bool {
+	if step, ok := matchTOTP(twoFactor.Secret, code, s.now(), twoFactor.LastUsedStep); ok {
+		twoFactor.LastUsedStep = step
+		return true
+	}
+
+	if twoFactor.RecoverySalt == "" {
+		return false
+	}
+	hash := hashRecoveryCode(twoFactor.RecoverySalt, code)
+	for i, stored := range twoFactor.RecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(stored), []byte(hash)) == 1 {
+			remaining := make([]string, 0, len(twoFactor.RecoveryCodes)-1)
+			remaining = append(remaining, twoFactor.RecoveryCodes[:i]...)
+			remaining = append(remaining, twoFactor.RecoveryCodes[i+1:]...)
+			twoFactor.RecoveryCodes = remaining
+			return true
+		}
+	}
+	return false
+}
+
+// spendSecondFactor verifies code for user and stores the second-factor
+// state with the code spent, or next when given. The store only succeeds
+// while no other request spent a code since user was read, so a losing
+// concurrent request gets ErrInvalidTwoFactorCode like a reused code.
+func (s *UserService) spendSecondFactor(ctx context.Context, user User, code string, next *TwoFactor) error {
+	old := user.TwoFactor
+	if !s.verifySecondFactor(&user.TwoFactor, code) {
+		return ErrInvalidTwoFactorCode
+	}
+	if next == nil {
+		next = &user.TwoFactor
+	}
+	err := s.repo.SwapTwoFactor(ctx, user.Email, old, *next)
+	if errors.Is(err, ErrNotFound) {
+		return ErrInvalidTwoFactorCode
+	}
+	return err
+}
+
+func (s *UserService) issueChallenge(ctx context.Context, email string) error {
+	id, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+	challenge := Challenge{ID: id, Email: email, ExpiresAt: s.now().Add(ChallengeTTL)}
+	if err := s.challenges.Save(ctx, challenge); err != nil {
+		return err
+	}
+	return &TwoFactorRequiredError{Challenge: challenge.ID, ExpiresAt: challenge.ExpiresAt}
+}
+
+func (s *UserService) pendingChallenge(ctx context.Context, challengeID string) (Challenge, error) {
+	challengeID = NormalizeText(challengeID)
+	if challengeID == "" {
+		return Challenge{}, ErrInvalidChallenge
+	}
+
+	challenge, err := s.challenges.Get(ctx, challengeID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return Challenge{}, ErrInvalidChallenge
+		}
+		return Challenge{}, err
+	}
+	return challenge, nil
+}
+
+// ChallengeEmail returns the email a pending login challenge belongs to, so
+// callers can apply per-account throttling before verifying the code.
+func (s *UserService) ChallengeEmail(ctx context.Context, challengeID string) (_ string, err error) {
+	ctx, span := startSpan(ctx, "UserService.ChallengeEmail")
+	defer func() { endSpan(span, err) }()
+
+	challenge, err := s.pendingChallenge(ctx, challengeID)
+	if err != nil {
+		return "", err
+	}
+	return challenge.Email, nil
+}
+
+// CompleteTwoFactor finishes a two-step login with a TOTP or recovery code and
+// returns the authenticated email. The challenge survives wrong codes so the
+// user can retry until it expires.
+func (s *UserService) CompleteTwoFactor(ctx context.Context, challengeID, code string) (_ string, err error) {
+	ctx, span := startSpan(ctx, "UserService.CompleteTwoFactor")
+	defer func() { endSpan(span, err) }()
+
+	challenge, err := s.pendingChallenge(ctx, challengeID)
+	if err != nil {
+		return "", err
+	}
+
+	user, err := s.repo.FindByEmail(ctx, challenge.Email)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return "", ErrInvalidChallenge
+		}
+		return "", err
+	}
+	if !user.TwoFactor.Enabled {
+		return "", ErrInvalidChallenge
+	}
+
+	if err := s.spendSecondFactor(ctx, user, code, nil); err != nil {
+		return "", err
+	}
+	if err := s.challenges.Delete(ctx, challenge.ID); err != nil {
+		return "", err
+	}
+	if err := s.cancelPendingDeletion(ctx, user); err != nil {
+		return "", err
+	}
+	return user.Email, nil
+}
+
+// EnrollTwoFactor starts TOTP enrolment after re-checking the password. The
+// secret stays pending until ConfirmTwoFactor succeeds.
+func (s *UserService) EnrollTwoFactor(ctx context.Context, email, password string) (_ TwoFactorEnrollment, err error) {
+	ctx, span := startSpan(ctx, "UserService.EnrollTwoFactor")
+	defer func() { endSpan(span, err) }()
+
+	user, err := s.checkPassword(ctx, email, password)
+	if err != nil {
+		return TwoFactorEnrollment{}, err
+	}
+	if user.TwoFactor.Enabled {
+		return TwoFactorEnrollment{}, ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		return TwoFactorEnrollment{}, err
+	}
+	if err := s.repo.UpdateTwoFactor(ctx, user.Email, TwoFactor{Secret: secret}); err != nil {
+		return TwoFactorEnrollment{}, err
+	}
+
+	return TwoFactorEnrollment{
+		Secret: secret,
+		URI:    TOTPURI(s.issuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTwoFactor enables 2FA once the user proves the authenticator works
+// and returns the plain recovery codes. Only their hashes are stored.
+func (s *UserService) ConfirmTwoFactor(ctx context.Context, email, code string) (_ []string, err error) {
+	ctx, span := startSpan(ctx, "UserService.ConfirmTwoFactor")
+	defer func() { endSpan(span, err) }()
+
+	email = NormalizeEmail(email)
+	if email == "" {
+		return nil, ErrInvalidUserInput
+	}
+
+	user, err := s.repo.FindByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, ErrTwoFactorNotEnrolled
+		}
+		return nil, err
+	}
+	if user.TwoFactor.Enabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	if user.TwoFactor.Secret == "" {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+
+	step, ok := matchTOTP(user.TwoFactor.Secret, code, s.now(), 0)
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes, salt, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	twoFactor := TwoFactor{
+		Enabled:       true,
+		Secret:        user.TwoFactor.Secret,
+		RecoveryCodes: hashes,
+		RecoverySalt:  salt,
+		LastUsedStep:  step,
+	}
+	if err := s.repo.UpdateTwoFactor(ctx, user.Email, twoFactor); err != nil {
+		return nil, err
+	}
+	logging.FromContext(ctx).Info("two-factor authentication enabled", slog.String("email", user.Email))
+	return codes, nil
+}
+
+// DisableTwoFactor turns 2FA off after checking the password and a current
+// TOTP or recovery code.
+func (s *UserService) DisableTwoFactor(ctx context.Context, email, password, code string) (err error) {
+	ctx, span := startSpan(ctx, "UserService.DisableTwoFactor")
+	defer func() { endSpan(span, err) }()
+
+	user, err := s.checkPassword(ctx, email, password)
+	if err != nil {
+		return err
+	}
+	if !user.TwoFactor.Enabled {
+		return ErrTwoFactorNotEnabled
+	}
+	if err := s.spendSecondFactor(ctx, user, code, &TwoFactor{}); err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Info("two-factor authentication disabled", slog.String("email", user.Email))
+	return nil
+}
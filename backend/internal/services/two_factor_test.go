@@ -0,0 +1,225 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func enrollAndConfirm(t *testing.T, service *UserService, clock *fakeClock) (TwoFactorEnrollment, []string) {
+	t.Helper()
+	ctx := context.Background()
+
+	enrollment, err := service.EnrollTwoFactor(ctx, "admin@example.com", "secret")
+	if err != nil {
+		t.Fatalf("enroll failed: %v", err)
+	}
+
+	code, _ := TOTPCode(enrollment.Secret, clock.now)
+	recovery, err := service.ConfirmTwoFactor(ctx, "admin@example.com", code)
+	if err != nil {
+		t.Fatalf("confirm failed: %v", err)
+	}
+	return enrollment, recovery
+}
+
+// TestTwoFactorLoginRequiresChallenge walks through enrolment and a two-step login.
+func TestTwoFactorLoginRequiresChallenge(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: fixedNow()}
+	repo := NewMemoryUserRepository()
+	service := NewUserService(repo, WithUserClock(clock.Now))
+
+	if err := service.Register(ctx, User{Email: "admin@example.com", Password: "secret"}); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	if _, err := service.ConfirmTwoFactor(ctx, "admin@example.com", "000000"); err != ErrTwoFactorNotEnrolled {
+		t.Fatalf("expected ErrTwoFactorNotEnrolled, got %v", err)
+	}
+
+	enrollment, recovery := enrollAndConfirm(t, service, clock)
+	if len(recovery) != recoveryCodeCount {
+		t.Fatalf("expected %d recovery codes, got %d", recoveryCodeCount, len(recovery))
+	}
+	stored, _ := repo.FindByEmail(ctx, "admin@example.com")
+	for _, hash := range stored.TwoFactor.RecoveryCodes {
+		for _, code := range recovery {
+			if hash == code {
+				t.Fatalf("recovery codes must be stored hashed")
+			}
+		}
+	}
+
+	err := service.Login(ctx, "admin@example.com", "secret")
+	var required *TwoFactorRequiredError
+	if !errors.As(err, &required) || !errors.Is(err, ErrTwoFactorRequired) {
+		t.Fatalf("expected TwoFactorRequiredError, got %v", err)
+	}
+	if !required.ExpiresAt.Equal(clock.now.Add(ChallengeTTL)) {
+		t.Fatalf("unexpected challenge expiry %v", required.ExpiresAt)
+	}
+
+	if _, err := service.CompleteTwoFactor(ctx, required.Challenge, "000000"); err != ErrInvalidTwoFactorCode {
+		t.Fatalf("expected ErrInvalidTwoFactorCode, got %v", err)
+	}
+
+	clock.Advance(totpPeriod)
+	code, _ := TOTPCode(enrollment.Secret, clock.now)
+	email, err := service.CompleteTwoFactor(ctx, required.Challenge, code)
+	if err != nil || email != "admin@example.com" {
+		t.Fatalf("expected login to complete, got email=%q err=%v", email, err)
+	}
+	if _, err := service.CompleteTwoFactor(ctx, required.Challenge, code); err != ErrInvalidChallenge {
+		t.Fatalf("expected consumed challenge to be invalid, got %v", err)
+	}
+}
+
+// TestTwoFactorRecoveryCodesAreSingleUse ensures recovery codes work once.
+func TestTwoFactorRecoveryCodesAreSingleUse(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: fixedNow()}
+	service := NewUserService(NewMemoryUserRepository(), WithUserClock(clock.Now))
+	_ = service.Register(ctx, User{Email: "admin@example.com", Password: "secret"})
+	_, recovery := enrollAndConfirm(t, service, clock)
+
+	var required *TwoFactorRequiredError
+	errors.As(service.Login(ctx, "admin@example.com", "secret"), &required)
+	if _, err := service.CompleteTwoFactor(ctx, required.Challenge, " "+recovery[0]+" "); err != nil {
+		t.Fatalf("expected recovery code to be accepted, got %v", err)
+	}
+
+	errors.As(service.Login(ctx, "admin@example.com", "secret"), &required)
+	if _, err := service.CompleteTwoFactor(ctx, required.Challenge, recovery[0]); err != ErrInvalidTwoFactorCode {
+		t.Fatalf("expected reused recovery code to be rejected, got %v", err)
+	}
+}
+
+// TestTwoFactorCodesCannotBeSpentConcurrently races logins that present
+// the same recovery code; only one may succeed.
+func TestTwoFactorCodesCannotBeSpentConcurrently(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: fixedNow()}
+	service := NewUserService(NewMemoryUserRepository(), WithUserClock(clock.Now))
+	_ = service.Register(ctx, User{Email: "admin@example.com", Password: "secret"})
+	_, recovery := enrollAndConfirm(t, service, clock)
+
+	const attempts = 20
+	challenges := make([]string, attempts)
+	for i := range challenges {
+		var required *TwoFactorRequiredError
+		errors.As(service.Login(ctx, "admin@example.com", "secret"), &required)
+		challenges[i] = required.Challenge
+	}
+
+	var wg sync.WaitGroup
+	var accepted atomic.Int32
+	for _, challenge := range challenges {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := service.CompleteTwoFactor(ctx, challenge, recovery[0])
+			switch {
+			case err == nil:
+				accepted.Add(1)
+			case !errors.Is(err, ErrInvalidTwoFactorCode):
+				t.Errorf("unexpected error %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := accepted.Load(); n != 1 {
+		t.Fatalf("expected the code to be accepted once, got %d", n)
+	}
+}
+
+// TestTwoFactorRecoveryCodesAreSalted checks the strength and storage of
+// recovery codes.
+func TestTwoFactorRecoveryCodesAreSalted(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: fixedNow()}
+	repo := NewMemoryUserRepository()
+	service := NewUserService(repo, WithUserClock(clock.Now))
+	_ = service.Register(ctx, User{Email: "admin@example.com", Password: "secret"})
+	_, recovery := enrollAndConfirm(t, service, clock)
+
+	format := regexp.MustCompile(`^[0-9a-f]{5}(-[0-9a-f]{5}){3}$`)
+	for _, code := range recovery {
+		if !format.MatchString(code) {
+			t.Fatalf("expected 80-bit codes in four groups, got %q", code)
+		}
+	}
+	stored, _ := repo.FindByEmail(ctx, "admin@example.com")
+	salt := stored.TwoFactor.RecoverySalt
+	if salt == "" || stored.TwoFactor.RecoveryCodes[0] != hashRecoveryCode(salt, recovery[0]) {
+		t.Fatalf("expected salted hashes, got %+v", stored.TwoFactor)
+	}
+}
+
+// TestTwoFactorRequiredAfterExternalLogin ensures single sign-on does not
+// skip the second factor of an existing account.
+func TestTwoFactorRequiredAfterExternalLogin(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: fixedNow()}
+	service := NewUserService(NewMemoryUserRepository(), WithUserClock(clock.Now))
+	_ = service.Register(ctx, User{Email: "admin@example.com", Password: "secret"})
+	enrollment, _ := enrollAndConfirm(t, service, clock)
+
+	_, err := service.ProvisionExternalUser(ctx, "Admin@Example.com")
+	var required *TwoFactorRequiredError
+	if !errors.As(err, &required) {
+		t.Fatalf("expected a second-factor challenge, got %v", err)
+	}
+
+	clock.Advance(30 * time.Second)
+	code, _ := TOTPCode(enrollment.Secret, clock.now)
+	if _, err := service.CompleteTwoFactor(ctx, required.Challenge, code); err != nil {
+		t.Fatalf("complete failed: %v", err)
+	}
+}
+
+// TestTwoFactorChallengeExpires verifies challenges are short-lived.
+func TestTwoFactorChallengeExpires(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: fixedNow()}
+	service := NewUserService(NewMemoryUserRepository(), WithUserClock(clock.Now))
+	_ = service.Register(ctx, User{Email: "admin@example.com", Password: "secret"})
+	enrollment, _ := enrollAndConfirm(t, service, clock)
+
+	var required *TwoFactorRequiredError
+	errors.As(service.Login(ctx, "admin@example.com", "secret"), &required)
+
+	clock.Advance(ChallengeTTL + time.Second)
+	code, _ := TOTPCode(enrollment.Secret, clock.now)
+	if _, err := service.CompleteTwoFactor(ctx, required.Challenge, code); err != ErrInvalidChallenge {
+		t.Fatalf("expected expired challenge, got %v", err)
+	}
+}
+
+// TestDisableTwoFactorRestoresSingleStepLogin covers the disable flow.
+func TestDisableTwoFactorRestoresSingleStepLogin(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: fixedNow()}
+	service := NewUserService(NewMemoryUserRepository(), WithUserClock(clock.Now))
+	_ = service.Register(ctx, User{Email: "admin@example.com", Password: "secret"})
+	enrollment, _ := enrollAndConfirm(t, service, clock)
+
+	if _, err := service.EnrollTwoFactor(ctx, "admin@example.com", "secret"); err != ErrTwoFactorAlreadyEnabled {
+		t.Fatalf("expected ErrTwoFactorAlreadyEnabled, got %v", err)
+	}
+	if err := service.DisableTwoFactor(ctx, "admin@example.com", "wrong", "000000"); err != ErrInvalidCredentials {
+		t.Fatalf("expected ErrInvalidCredentials, got %v", err)
+	}
+
+	clock.Advance(totpPeriod)
+	code, _ := TOTPCode(enrollment.Secret, clock.now)
+	if err := service.DisableTwoFactor(ctx, "admin@example.com", "secret", code); err != nil {
+		t.Fatalf("disable failed: %v", err)
+	}
+	if err := service.Login(ctx, "admin@example.com", "secret"); err != nil {
+		t.Fatalf("expected single-step login, got %v", err)
+	}
+}
@@ -3,9 +3,14 @@ package services
 import (
 	"context"
 	"errors"
+	"log/slog"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/logging"
 )
 
 var (
@@ -17,6 +22,8 @@ var (
 	ErrUserAlreadyExists = errors.New("user already exists")
 	// ErrInvalidCredentials is returned when the email/password combination is wrong.
 	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrUserDisabled is returned when a disabled user authenticates.
+	ErrUserDisabled = errors.New("user disabled")
 )
 
 // UserRepository is the storage contract required by the user service.
@@ -25,6 +32,24 @@ type UserRepository interface {
 	Insert(ctx context.Context, user User) error
 	List(ctx context.Context) ([]User, error)
 	Clear(ctx context.Context) error
+	UpdateTwoFactor(ctx context.Context, email string, twoFactor TwoFactor) error
+	// SwapTwoFactor replaces the second-factor state of a user only while
+	// its LastUsedStep and number of RecoveryCodes still equal those of old,
+	// and returns ErrNotFound otherwise. Spending a code changes one of
+	// them, so concurrent logins cannot spend the same code twice.
+	SwapTwoFactor(ctx context.Context, email string, old, twoFactor TwoFactor) error
+	UpdateProfile(ctx context.Context, email string, profile Profile) error
+	UpdatePassword(ctx context.Context, email, password string) error
+	SetDisabled(ctx context.Context, email string, disabled bool) error
+	// SetCalendarToken stores the calendar token hash of a user; an empty
+	// hash removes it.
+	SetCalendarToken(ctx context.Context, email, hash string) error
+	// FindByCalendarToken returns the user with the calendar token hash or
+	// ErrNotFound.
+	FindByCalendarToken(ctx context.Context, hash string) (User, error)
+	Delete(ctx context.Context, email string) error
+	ScheduleDeletion(ctx context.Context, email string, at time.Time) error
+	ListDueForDeletion(ctx context.Context, before time.Time) ([]User, error)
 }
 
 // MongoUserRepository implements UserRepository backed by MongoDB.
@@ -47,15 +72,19 @@ func (m *MongoUserRepository) FindByEmail(ctx context.Context, email string) (Us
 	return user, err
 }
 
-// Insert stores the provided user in MongoDB.
+// Insert stores the provided user in MongoDB, or returns ErrUserAlreadyExists
+// when the unique email index rejects it.
 func (m *MongoUserRepository) Insert(ctx context.Context, user User) error {
 	_, err := m.collection.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrUserAlreadyExists
+	}
 	return err
 }
 
-// List retrieves all users.
+// List retrieves all users sorted by email.
 func (m *MongoUserRepository) List(ctx context.Context) ([]User, error) {
-	cursor, err := m.collection.Find(ctx, bson.M{})
+	cursor, err := m.collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"email": 1}))
 	if err != nil {
 		return nil, err
 	}
@@ -74,18 +103,205 @@ func (m *MongoUserRepository) Clear(ctx context.Context) error {
 	return err
 }
 
+// UpdateTwoFactor replaces the second-factor state of a user.
+func (m *MongoUserRepository) UpdateTwoFactor(ctx context.Context, email string, twoFactor TwoFactor) error {
+	res, err := m.collection.UpdateOne(ctx, bson.M{"email": email}, bson.M{"$set": bson.M{"twoFactor": twoFactor}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SwapTwoFactor replaces the second-factor state of a user if it still
+// matches old; see UserRepository.
+func (m *MongoUserRepository) SwapTwoFactor(ctx context.Context, email string, old, twoFactor TwoFactor) error {
+	// The fields are omitted from the document when empty, hence $ifNull.
+	filter := bson.M{
+		"email": email,
+		"$expr": bson.M{"$and": bson.A{
+			bson.M{"$eq": bson.A{bson.M{"$ifNull": bson.A{"$twoFactor.lastUsedStep", 0}}, old.LastUsedStep}},
+			bson.M{"$eq": bson.A{bson.M{"$size": bson.M{"$ifNull": bson.A{"$twoFactor.recoveryCodes", bson.A{}}}}, len(old.RecoveryCodes)}},
+		}},
+	}
+	res, err := m.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"twoFactor": twoFactor}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// UpdateProfile replaces the profile fields and preferences of a user.
+func (m *MongoUserRepository) UpdateProfile(ctx context.Context, email string, profile Profile) error {
+	res, err := m.collection.UpdateOne(ctx, bson.M{"email": email}, bson.M{"$set": bson.M{
+		"displayName": profile.DisplayName,
+		"timeZone":    profile.TimeZone,
+		"locale":      profile.Locale,
+		"preferences": profile.Preferences,
+	}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// UpdatePassword replaces the password of a user.
+func (m *MongoUserRepository) UpdatePassword(ctx context.Context, email, password string) error {
+	return m.set(ctx, email, bson.M{"password": password})
+}
+
+// SetDisabled blocks or unblocks logins of a user.
+func (m *MongoUserRepository) SetDisabled(ctx context.Context, email string, disabled bool) error {
+	return m.set(ctx, email, bson.M{"disabled": disabled})
+}
+
+// SetCalendarToken stores the calendar token hash of a user. The field is
+// unset rather than emptied, since its unique index is sparse.
+func (m *MongoUserRepository) SetCalendarToken(ctx context.Context, email, hash string) error {
+	if hash == "" {
+		return m.apply(ctx, email, bson.M{"$unset": bson.M{"calendarToken": ""}})
+	}
+	return m.set(ctx, email, bson.M{"calendarToken": hash})
+}
+
+// FindByCalendarToken retrieves the user with the calendar token hash or
+// returns ErrNotFound.
+func (m *MongoUserRepository) FindByCalendarToken(ctx context.Context, hash string) (User, error) {
+	if hash == "" {
+		return User{}, ErrNotFound
+	}
+	var user User
+	err := m.collection.FindOne(ctx, bson.M{"calendarToken": hash}).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return User{}, ErrNotFound
+	}
+	return user, err
+}
+
+func (m *MongoUserRepository) set(ctx context.Context, email string, fields bson.M) error {
+	return m.apply(ctx, email, bson.M{"$set": fields})
+}
+
+func (m *MongoUserRepository) apply(ctx context.Context, email string, update bson.M) error {
+	res, err := m.collection.UpdateOne(ctx, bson.M{"email": email}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Delete removes a user by email.
+func (m *MongoUserRepository) Delete(ctx context.Context, email string) error {
+	res, err := m.collection.DeleteOne(ctx, bson.M{"email": email})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ScheduleDeletion marks a user for deletion at the given time. A zero time
+// cancels a pending deletion.
+func (m *MongoUserRepository) ScheduleDeletion(ctx context.Context, email string, at time.Time) error {
+	update := bson.M{"$set": bson.M{"deleteAfter": at}}
+	if at.IsZero() {
+		update = bson.M{"$unset": bson.M{"deleteAfter": ""}}
+	}
+
+	res, err := m.collection.UpdateOne(ctx, bson.M{"email": email}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListDueForDeletion returns users whose scheduled deletion time is not after before.
+func (m *MongoUserRepository) ListDueForDeletion(ctx context.Context, before time.Time) ([]User, error) {
+	cursor, err := m.collection.Find(ctx, bson.M{"deleteAfter": bson.M{"$lte": before}}, options.Find().SetSort(bson.M{"email": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var users []User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// EnsureIndexes creates the unique email index, so concurrent registrations
+// of the same address cannot both succeed.
+func (m *MongoUserRepository) EnsureIndexes(ctx context.Context) error {
+	return createIndexes(ctx, m.collection, userIndexes)
+}
+
 // UserService encapsulates business logic for user operations.
 type UserService struct {
-	repo UserRepository
+	repo       UserRepository
+	challenges ChallengeStore
+	issuer     string
+	now        func() time.Time
+}
+
+// UserServiceOption customises a UserService.
+type UserServiceOption func(*UserService)
+
+// WithChallengeStore sets where pending two-factor login challenges are kept.
+func WithChallengeStore(store ChallengeStore) UserServiceOption {
+	return func(s *UserService) {
+		s.challenges = store
+	}
+}
+
+// WithTOTPIssuer sets the issuer shown by authenticator apps.
+func WithTOTPIssuer(issuer string) UserServiceOption {
+	return func(s *UserService) {
+		s.issuer = issuer
+	}
+}
+
+// WithUserClock overrides the clock used for TOTP validation and challenges.
+func WithUserClock(now func() time.Time) UserServiceOption {
+	return func(s *UserService) {
+		s.now = now
+	}
 }
 
-// NewUserService builds a new UserService instance.
-func NewUserService(repo UserRepository) *UserService {
-	return &UserService{repo: repo}
+// NewUserService builds a new UserService instance. Without options, challenges
+// are kept in memory and the real clock is used.
+func NewUserService(repo UserRepository, opts ...UserServiceOption) *UserService {
+	s := &UserService{repo: repo, issuer: DefaultTOTPIssuer, now: time.Now}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.challenges == nil {
+		s.challenges = NewMemoryChallengeStore(s.now)
+	}
+	return s
 }
 
 // Register validates and stores a user; returns high-level domain errors.
-func (s *UserService) Register(ctx context.Context, user User) error {
+func (s *UserService) Register(ctx context.Context, user User) (err error) {
+	ctx, span := startSpan(ctx, "UserService.Register")
+	defer func() { endSpan(span, err) }()
+
 	user.Email = NormalizeEmail(user.Email)
 	user.Password = NormalizeText(user.Password)
 
@@ -93,7 +309,7 @@ func (s *UserService) Register(ctx context.Context, user User) error {
 		return ErrInvalidUserInput
 	}
 
-	_, err := s.repo.FindByEmail(ctx, user.Email)
+	_, err = s.repo.FindByEmail(ctx, user.Email)
 	if err == nil {
 		return ErrUserAlreadyExists
 	}
@@ -101,33 +317,135 @@ func (s *UserService) Register(ctx context.Context, user User) error {
 		return err
 	}
 
-	return s.repo.Insert(ctx, user)
+	// The lookup above is only a fast path: a concurrent registration can
+	// still win the race, and the unique email index then rejects this one.
+	if err := s.repo.Insert(ctx, user); err != nil {
+		if isDuplicateUser(err) {
+			return ErrUserAlreadyExists
+		}
+		return err
+	}
+	logging.FromContext(ctx).Info("user registered", slog.String("email", user.Email))
+	return nil
 }
 
-// Login validates the provided credentials.
-func (s *UserService) Login(ctx context.Context, email, password string) error {
+// Login validates the provided credentials. When the user has two-factor
+// authentication enabled, a *TwoFactorRequiredError carrying a short-lived
+// challenge is returned instead of nil; see CompleteTwoFactor.
+func (s *UserService) Login(ctx context.Context, email, password string) (err error) {
+	ctx, span := startSpan(ctx, "UserService.Login")
+	defer func() { endSpan(span, err) }()
+
+	user, err := s.checkPassword(ctx, email, password)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCredentials) {
+			logging.FromContext(ctx).Info("login rejected", slog.String("email", NormalizeEmail(email)))
+		}
+		return err
+	}
+	if user.TwoFactor.Enabled {
+		return s.issueChallenge(ctx, user.Email)
+	}
+	return s.cancelPendingDeletion(ctx, user)
+}
+
+// cancelPendingDeletion keeps an account scheduled for deletion when its owner
+// logs in again during the grace period. It must only run once the login is
+// complete, i.e. after the second factor when one is required, so that a
+// leaked password alone cannot keep an account alive.
+func (s *UserService) cancelPendingDeletion(ctx context.Context, user User) error {
+	if user.DeleteAfter.IsZero() {
+		return nil
+	}
+	if err := s.repo.ScheduleDeletion(ctx, user.Email, time.Time{}); err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Info("account deletion cancelled", slog.String("email", user.Email))
+	return nil
+}
+
+func (s *UserService) checkPassword(ctx context.Context, email, password string) (User, error) {
 	email = NormalizeEmail(email)
 	password = NormalizeText(password)
 
 	if email == "" || password == "" {
-		return ErrInvalidCredentials
+		return User{}, ErrInvalidCredentials
 	}
 
 	user, err := s.repo.FindByEmail(ctx, email)
 	if err != nil {
 		if errors.Is(err, ErrNotFound) {
-			return ErrInvalidCredentials
+			return User{}, ErrInvalidCredentials
 		}
-		return err
+		return User{}, err
 	}
 	if user.Password != password {
-		return ErrInvalidCredentials
+		return User{}, ErrInvalidCredentials
 	}
-	return nil
+	// Checked after the password so that the state of an account is only
+	// revealed to whoever knows its password.
+	if user.Disabled {
+		return User{}, ErrUserDisabled
+	}
+	return user, nil
+}
+
+// ProvisionExternalUser returns the user authenticated by an external identity
+// provider, creating it on first login. Provisioned users have no local
+// password, so password login stays disabled for them. The provider only
+// stands in for the password: an existing account with two-factor
+// authentication gets a *TwoFactorRequiredError to complete with
+// CompleteTwoFactor, as after a password login.
+func (s *UserService) ProvisionExternalUser(ctx context.Context, email string) (_ PublicUser, err error) {
+	ctx, span := startSpan(ctx, "UserService.ProvisionExternalUser")
+	defer func() { endSpan(span, err) }()
+
+	email = NormalizeEmail(email)
+	if email == "" {
+		return PublicUser{}, ErrInvalidUserInput
+	}
+
+	user, err := s.repo.FindByEmail(ctx, email)
+	if err == nil {
+		if user.Disabled {
+			return PublicUser{}, ErrUserDisabled
+		}
+		if user.TwoFactor.Enabled {
+			return PublicUser{}, s.issueChallenge(ctx, user.Email)
+		}
+		if err := s.cancelPendingDeletion(ctx, user); err != nil {
+			return PublicUser{}, err
+		}
+		return user.ToPublic(), nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return PublicUser{}, err
+	}
+
+	user = User{Email: email}
+	if err := s.repo.Insert(ctx, user); err != nil {
+		if !isDuplicateUser(err) {
+			return PublicUser{}, err
+		}
+		// A concurrent first login provisioned the user already.
+		if user, err = s.repo.FindByEmail(ctx, email); err != nil {
+			return PublicUser{}, err
+		}
+	}
+	return user.ToPublic(), nil
+}
+
+// isDuplicateUser reports whether err means the email is already registered,
+// including duplicate-key errors from repositories that do not translate them.
+func isDuplicateUser(err error) bool {
+	return errors.Is(err, ErrUserAlreadyExists) || mongo.IsDuplicateKeyError(err)
 }
 
 // List returns all users in their public representation.
-func (s *UserService) List(ctx context.Context) ([]PublicUser, error) {
+func (s *UserService) List(ctx context.Context) (_ []PublicUser, err error) {
+	ctx, span := startSpan(ctx, "UserService.List")
+	defer func() { endSpan(span, err) }()
+
 	users, err := s.repo.List(ctx)
 	if err != nil {
 		return nil, err
@@ -140,7 +458,48 @@ func (s *UserService) List(ctx context.Context) ([]PublicUser, error) {
 	return public, nil
 }
 
+// ResetPassword replaces the password of an existing user.
+func (s *UserService) ResetPassword(ctx context.Context, email, password string) (err error) {
+	ctx, span := startSpan(ctx, "UserService.ResetPassword")
+	defer func() { endSpan(span, err) }()
+
+	email = NormalizeEmail(email)
+	password = NormalizeText(password)
+	if email == "" || password == "" {
+		return ErrInvalidUserInput
+	}
+	if err := s.repo.UpdatePassword(ctx, email, password); err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Info("password reset", slog.String("email", email))
+	return nil
+}
+
+// SetDisabled blocks or unblocks every login of a user. Sessions already
+// issued are not affected; revoke them with SessionService.RevokeAll.
+func (s *UserService) SetDisabled(ctx context.Context, email string, disabled bool) (err error) {
+	ctx, span := startSpan(ctx, "UserService.SetDisabled")
+	defer func() { endSpan(span, err) }()
+
+	email = NormalizeEmail(email)
+	if email == "" {
+		return ErrInvalidUserInput
+	}
+	if err := s.repo.SetDisabled(ctx, email, disabled); err != nil {
+		return err
+	}
+	msg := "user enabled"
+	if disabled {
+		msg = "user disabled"
+	}
+	logging.FromContext(ctx).Info(msg, slog.String("email", email))
+	return nil
+}
+
 // Clear removes all user records.
-func (s *UserService) Clear(ctx context.Context) error {
+func (s *UserService) Clear(ctx context.Context) (err error) {
+	ctx, span := startSpan(ctx, "UserService.Clear")
+	defer func() { endSpan(span, err) }()
+
 	return s.repo.Clear(ctx)
 }
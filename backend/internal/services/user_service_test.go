@@ -2,61 +2,26 @@ package services
 
 import (
 	"context"
-	"sync"
+	"errors"
 	"testing"
-)
-
-type memoryUserRepo struct {
-	mu    sync.Mutex
-	users map[string]User
-}
-
-func newMemoryUserRepo() *memoryUserRepo {
-	return &memoryUserRepo{users: make(map[string]User)}
-}
-
-func (m *memoryUserRepo) FindByEmail(_ context.Context, email string) (User, error) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	user, ok := m.users[email]
-	if !ok {
-		return User{}, ErrNotFound
-	}
-	return user, nil
-}
 
-func (m *memoryUserRepo) Insert(_ context.Context, user User) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	m.users[user.Email] = user
-	return nil
-}
-
-func (m *memoryUserRepo) List(_ context.Context) ([]User, error) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	"go.mongodb.org/mongo-driver/mongo"
+)
 
-	result := make([]User, 0, len(m.users))
-	for _, u := range m.users {
-		result = append(result, u)
+// seedUsers stores users directly in repo, bypassing the service rules.
+func seedUsers(t *testing.T, repo UserRepository, users ...User) {
+	t.Helper()
+	for _, user := range users {
+		if err := repo.Insert(context.Background(), user); err != nil {
+			t.Fatalf("seeding %s: %v", user.Email, err)
+		}
 	}
-	return result, nil
-}
-
-func (m *memoryUserRepo) Clear(_ context.Context) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	m.users = make(map[string]User)
-	return nil
 }
 
 // TestUserServiceRegisterStoresNormalizedUsers ensures Register persists sanitized data.
 func TestUserServiceRegisterStoresNormalizedUsers(t *testing.T) {
 	ctx := context.Background()
-	repo := newMemoryUserRepo()
+	repo := NewMemoryUserRepository()
 	service := NewUserService(repo)
 
 	err := service.Register(ctx, User{Email: " User@Example.com ", Password: " secret "})
@@ -79,7 +44,7 @@ func TestUserServiceRegisterStoresNormalizedUsers(t *testing.T) {
 // TestUserServiceRegisterRejectsDuplicates verifies duplicate emails fail.
 func TestUserServiceRegisterRejectsDuplicates(t *testing.T) {
 	ctx := context.Background()
-	service := NewUserService(newMemoryUserRepo())
+	service := NewUserService(NewMemoryUserRepository())
 
 	if err := service.Register(ctx, User{Email: "user@example.com", Password: "secret"}); err != nil {
 		t.Fatalf("first register failed: %v", err)
@@ -91,10 +56,35 @@ func TestUserServiceRegisterRejectsDuplicates(t *testing.T) {
 	}
 }
 
+// racingUserRepo simulates a registration that lost the race: the lookup
+// misses and the unique index rejects the insert.
+type racingUserRepo struct {
+	*MemoryUserRepository
+}
+
+func (racingUserRepo) FindByEmail(context.Context, string) (User, error) {
+	return User{}, ErrNotFound
+}
+
+func (racingUserRepo) Insert(context.Context, User) error {
+	return mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000, Message: "E11000 duplicate key error"}}}
+}
+
+// TestUserServiceRegisterMapsDuplicateKeyErrors covers concurrent
+// registrations that pass the existence check.
+func TestUserServiceRegisterMapsDuplicateKeyErrors(t *testing.T) {
+	service := NewUserService(racingUserRepo{NewMemoryUserRepository()})
+
+	err := service.Register(context.Background(), User{Email: "user@example.com", Password: "secret"})
+	if !errors.Is(err, ErrUserAlreadyExists) {
+		t.Fatalf("expected ErrUserAlreadyExists, got %v", err)
+	}
+}
+
 // TestUserServiceLoginValidatesCredentials exercises success and failure cases.
 func TestUserServiceLoginValidatesCredentials(t *testing.T) {
 	ctx := context.Background()
-	service := NewUserService(newMemoryUserRepo())
+	service := NewUserService(NewMemoryUserRepository())
 
 	if err := service.Register(ctx, User{Email: "user@example.com", Password: "secret"}); err != nil {
 		t.Fatalf("register failed: %v", err)
@@ -113,10 +103,56 @@ func TestUserServiceLoginValidatesCredentials(t *testing.T) {
 	}
 }
 
+// TestUserServiceResetPasswordAndDisable covers the administrative account
+// operations.
+func TestUserServiceResetPasswordAndDisable(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryUserRepository()
+	service := NewUserService(repo)
+	seedUsers(t, repo, User{Email: "user@example.com", Password: "old"})
+
+	if err := service.ResetPassword(ctx, " User@Example.com ", " new "); err != nil {
+		t.Fatalf("reset password: %v", err)
+	}
+	if err := service.Login(ctx, "user@example.com", "old"); err != ErrInvalidCredentials {
+		t.Fatalf("expected the old password to be rejected, got %v", err)
+	}
+	if err := service.Login(ctx, "user@example.com", "new"); err != nil {
+		t.Fatalf("expected the new password to work, got %v", err)
+	}
+
+	if err := service.SetDisabled(ctx, "user@example.com", true); err != nil {
+		t.Fatalf("disable: %v", err)
+	}
+	if err := service.Login(ctx, "user@example.com", "wrong"); err != ErrInvalidCredentials {
+		t.Fatalf("expected a wrong password to stay invalid, got %v", err)
+	}
+	if err := service.Login(ctx, "user@example.com", "new"); err != ErrUserDisabled {
+		t.Fatalf("expected ErrUserDisabled, got %v", err)
+	}
+	if users, _ := service.List(ctx); len(users) != 1 || !users[0].Disabled {
+		t.Fatalf("expected the user to be listed as disabled, got %+v", users)
+	}
+
+	if err := service.SetDisabled(ctx, "user@example.com", false); err != nil {
+		t.Fatalf("enable: %v", err)
+	}
+	if err := service.Login(ctx, "user@example.com", "new"); err != nil {
+		t.Fatalf("expected login after enabling, got %v", err)
+	}
+
+	if err := service.ResetPassword(ctx, "missing@example.com", "x"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if err := service.ResetPassword(ctx, "user@example.com", " "); err != ErrInvalidUserInput {
+		t.Fatalf("expected ErrInvalidUserInput, got %v", err)
+	}
+}
+
 // TestUserServiceListAndClear ensures List returns public data and Clear removes users.
 func TestUserServiceListAndClear(t *testing.T) {
 	ctx := context.Background()
-	repo := newMemoryUserRepo()
+	repo := NewMemoryUserRepository()
 	service := NewUserService(repo)
 
 	users := []User{
@@ -154,3 +190,39 @@ func TestUserServiceListAndClear(t *testing.T) {
 		t.Fatalf("expected 0 users after clear, got %d", len(remaining))
 	}
 }
+
+// TestUserServiceProvisionExternalUser verifies just-in-time provisioning by email.
+func TestUserServiceProvisionExternalUser(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryUserRepository()
+	service := NewUserService(repo)
+
+	user, err := service.ProvisionExternalUser(ctx, " SSO@Example.com ")
+	if err != nil {
+		t.Fatalf("provision failed: %v", err)
+	}
+	if user.Email != "sso@example.com" {
+		t.Fatalf("expected normalized email, got %q", user.Email)
+	}
+
+	if _, err := service.ProvisionExternalUser(ctx, "sso@example.com"); err != nil {
+		t.Fatalf("second provision failed: %v", err)
+	}
+	if users, _ := repo.List(ctx); len(users) != 1 {
+		t.Fatalf("expected a single provisioned user, got %d", len(users))
+	}
+
+	if err := service.Login(ctx, "sso@example.com", ""); err != ErrInvalidCredentials {
+		t.Fatalf("expected password login to be disabled, got %v", err)
+	}
+	if _, err := service.ProvisionExternalUser(ctx, ""); err != ErrInvalidUserInput {
+		t.Fatalf("expected ErrInvalidUserInput, got %v", err)
+	}
+
+	if err := service.SetDisabled(ctx, "sso@example.com", true); err != nil {
+		t.Fatalf("disable: %v", err)
+	}
+	if _, err := service.ProvisionExternalUser(ctx, "sso@example.com"); err != ErrUserDisabled {
+		t.Fatalf("expected ErrUserDisabled, got %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+// Package telemetry configures OpenTelemetry tracing for the server.
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/version"
+)
+
+// Supported span exporters.
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+// ServiceName identifies the API in traces.
+const ServiceName = "todo-api"
+
+// Setup installs a global tracer provider exporting spans with exporter and
+// the W3C trace-context propagator. The OTLP exporter is configured through
+// the standard OTEL_EXPORTER_OTLP_* variables. The returned function flushes
+// pending spans and must be called on shutdown. With ExporterNone nothing is
+// installed and spans are dropped.
+func Setup(ctx context.Context, exporter string) (func(context.Context) error, error) {
+	var spanExporter sdktrace.SpanExporter
+	switch exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			return nil, err
+		}
+		spanExporter = exp
+	case ExporterOTLP:
+		exp, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, err
+		}
+		spanExporter = exp
+	default:
+		return nil, fmt.Errorf("telemetry: unknown exporter %q", exporter)
+	}
+
+	provider := NewProvider(sdktrace.WithBatcher(spanExporter))
+	Install(provider)
+	return provider.Shutdown, nil
+}
+
+// NewProvider builds a tracer provider describing this service. Tests pass
+// sdktrace.WithSyncer with an in-memory exporter.
+func NewProvider(opts ...sdktrace.TracerProviderOption) *sdktrace.TracerProvider {
+	res := resource.NewSchemaless(
+		semconv.ServiceName(ServiceName),
+		semconv.ServiceVersion(version.Version),
+	)
+	return sdktrace.NewTracerProvider(append([]sdktrace.TracerProviderOption{sdktrace.WithResource(res)}, opts...)...)
+}
+
+// Install makes provider and the W3C trace-context and baggage propagators
+// the global defaults.
+func Install(provider *sdktrace.TracerProvider) {
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+}
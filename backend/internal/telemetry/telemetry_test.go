@@ -0,0 +1,20 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSetupSelectsExporter(t *testing.T) {
+	flush, err := Setup(context.Background(), ExporterNone)
+	if err != nil {
+		t.Fatalf("setup none: %v", err)
+	}
+	if err := flush(context.Background()); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+
+	if _, err := Setup(context.Background(), "zipkin"); err == nil {
+		t.Fatalf("expected unknown exporter to be rejected")
+	}
+}
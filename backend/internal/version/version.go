@@ -0,0 +1,12 @@
+// Package version exposes build information injected at link time:
+//
+//	go build -ldflags "-X github.com/ignaciomagoia/tp8ingsoft3/backend/internal/version.Version=v1.2.3 \
+//	  -X github.com/ignaciomagoia/tp8ingsoft3/backend/internal/version.Commit=$(git rev-parse --short HEAD)"
+package version
+
+var (
+	// Version is the released version of the binary.
+	Version = "dev"
+	// Commit is the VCS revision the binary was built from.
+	Commit = "unknown"
+)
@@ -2,126 +2,74 @@ package main
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"os"
-	"strings"
-	"time"
+	"os/signal"
+	"syscall"
 
-	"github.com/gin-contrib/cors"
-	"github.com/gin-gonic/gin"
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/config"
 	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/handlers"
-	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/services"
-)
-
-func getAllowedOrigins() []string {
-	defaultOrigins := []string{
-		"http://localhost:3000",
-		"http://localhost:5173",
-		"http://127.0.0.1:3000",
-		"http://127.0.0.1:5173",
-	}
-
-	env := os.Getenv("FRONT_ORIGINS")
-	log.Printf("[CORS] FRONT_ORIGINS desde env: %q", env)
-
-	out := make([]string, 0, len(defaultOrigins))
-	seen := make(map[string]struct{})
-
-	addOrigin := func(origin string) {
-		trimmed := strings.TrimSpace(origin)
-		if trimmed == "" {
-			return
-		}
-		if _, ok := seen[trimmed]; ok {
-			return
-		}
-		seen[trimmed] = struct{}{}
-		out = append(out, trimmed)
-		log.Printf("[CORS] Origen permitido agregado: %q", trimmed)
-	}
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/logging"
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/migrate"
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/server"
+	"github.com/ignaciomagoia/tp8ingsoft3/backend/internal/version"
 
-	for _, origin := range defaultOrigins {
-		addOrigin(origin)
-	}
+	// Embebe la base de zonas horarias para contenedores sin tzdata
+	_ "time/tzdata"
+)
 
-	if env != "" {
-		for _, o := range strings.Split(env, ",") {
-			addOrigin(o)
-		}
+func main() {
+	if err := run(); err != nil {
+		slog.Error("server stopped", slog.Any("error", err))
+		os.Exit(1)
 	}
-
-	return out
 }
 
-func main() {
-	ctx := context.Background()
-
-	mongoURI := os.Getenv("MONGO_URI")
-	if mongoURI == "" {
-		mongoURI = "mongodb://localhost:27017"
-	}
+// run returns instead of exiting so that every resource is released in order
+// before the process ends.
+func run() error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	dbName := os.Getenv("MONGO_DB")
-	if dbName == "" {
-		dbName = services.DefaultDatabaseName
+	cfg, err := config.FromEnv()
+	if err != nil {
+		return err
 	}
 
-	client, err := services.ConnectMongo(ctx, mongoURI)
+	logger, err := logging.New(os.Stdout, cfg.LogLevel, cfg.LogFormat)
 	if err != nil {
-		log.Fatalf("no se pudo conectar a MongoDB: %v", err)
+		return err
 	}
-	defer client.Disconnect(context.Background())
-
-	db := client.Database(dbName)
-
-	userRepo := services.NewMongoUserRepository(db.Collection("users"))
-	todoRepo := services.NewMongoTodoRepository(db.Collection("todos"))
-
-	userService := services.NewUserService(userRepo)
-	todoService := services.NewTodoService(todoRepo, time.Now)
+	slog.SetDefault(logger)
 
-	authHandler := handlers.NewAuthHandler(userService)
-	todoHandler := handlers.NewTodoHandler(todoService)
-
-	allowedOrigins := getAllowedOrigins()
-
-	corsCfg := cors.Config{
-		AllowOrigins:     allowedOrigins,
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-		MaxAge:           12 * time.Hour,
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		return runMigrate(ctx, cfg, os.Args[2:])
 	}
 
-	router := gin.Default()
-
-	// 💥 APLICAR CORS ANTES DEL ROUTER
-	router.Use(cors.New(corsCfg))
+	logger.Info("starting server",
+		slog.String("version", version.Version),
+		slog.String("commit", version.Commit),
+		slog.String("port", cfg.Port),
+		slog.Any("allowed_origins", cfg.AllowedOrigins),
+	)
 
-	// Endpoint de salud
-	router.GET("/healthz", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "ok"})
-	})
-
-	// APIs
-	router.POST("/register", authHandler.Register)
-	router.POST("/login", authHandler.Login)
-
-	router.GET("/todos", todoHandler.ListTodos)
-	router.POST("/todos", todoHandler.CreateTodo)
-	router.PUT("/todos/:id", todoHandler.UpdateTodo)
-	router.DELETE("/todos/:id", todoHandler.DeleteTodo)
-	router.DELETE("/todos", todoHandler.ClearTodos)
+	router, lifecycle, err := handlers.NewApp(ctx, cfg, handlers.WithLogger(logger))
+	if err != nil {
+		return err
+	}
+	lifecycle.Start()
 
 	// Importante: Render usa PORT
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
+	return server.Run(ctx, ":"+cfg.Port, router, cfg.ShutdownTimeout, lifecycle)
+}
 
-	log.Printf("[SERVER] Corriendo en puerto %s", port)
-	if err := router.Run(":" + port); err != nil {
-		log.Fatal(err)
+// runMigrate runs the "migrate" subcommand against the configured database.
+func runMigrate(ctx context.Context, cfg config.Config, args []string) error {
+	err := migrate.Run(ctx, cfg, args, os.Stdout)
+	if errors.Is(err, migrate.ErrUsage) {
+		fmt.Fprintln(os.Stderr, migrate.Usage)
 	}
+	return err
 }
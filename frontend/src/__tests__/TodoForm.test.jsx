@@ -50,7 +50,7 @@ describe("api service", () => {
   it("envía la petición correcta al crear una tarea", async () => {
     await createTodo({ email: "demo@example.com", title: "Test" });
 
-    expect(global.fetch).toHaveBeenCalledWith("http://localhost:8080/todos", {
+    expect(global.fetch).toHaveBeenCalledWith("http://localhost:8080/v1/todos", {
       method: "POST",
       headers: { "Content-Type": "application/json" },
       body: JSON.stringify({ email: "demo@example.com", title: "Test" }),
@@ -19,8 +19,9 @@ describe("api service", () => {
     global.fetch = originalFetch;
   });
 
-  const mockResponse = ({ ok = true, json = () => Promise.resolve({}), headers }) => ({
+  const mockResponse = ({ ok = true, status = 200, json = () => Promise.resolve({}), headers }) => ({
     ok,
+    status,
     json,
     headers: {
       get: () => (headers?.["Content-Type"] ?? "application/json"),
@@ -35,7 +36,7 @@ describe("api service", () => {
     const payload = { email: "user@example.com", password: "secret" };
     await registerUser(payload);
 
-    expect(global.fetch).toHaveBeenCalledWith("http://localhost:8080/register", {
+    expect(global.fetch).toHaveBeenCalledWith("http://localhost:8080/v1/register", {
       method: "POST",
       headers: { "Content-Type": "application/json" },
       body: JSON.stringify(payload),
@@ -50,7 +51,7 @@ describe("api service", () => {
     await getTodos("demo@example.com");
 
     expect(global.fetch).toHaveBeenCalledWith(
-      "http://localhost:8080/todos?email=demo%40example.com"
+      "http://localhost:8080/v1/todos?email=demo%40example.com"
     );
   });
 
@@ -67,6 +68,24 @@ describe("api service", () => {
     );
   });
 
+  it("expone el c\u00f3digo y los errores de campo del backend", async () => {
+    global.fetch.mockResolvedValue(
+      mockResponse({
+        ok: false,
+        status: 401,
+        json: () =>
+          Promise.resolve({ error: "credenciales invalidas", code: "INVALID_CREDENTIALS", status: 401 }),
+      })
+    );
+
+    await expect(loginUser({ email: "demo@example.com", password: "bad" })).rejects.toMatchObject({
+      message: "credenciales invalidas",
+      code: "INVALID_CREDENTIALS",
+      status: 401,
+      fields: [],
+    });
+  });
+
   it("usa un mensaje por defecto si la respuesta err\u00f3nea no es JSON", async () => {
     global.fetch.mockResolvedValue(
       mockResponse({
@@ -81,6 +100,24 @@ describe("api service", () => {
     );
   });
 
+  it("reintenta la creaci\u00f3n con el mismo Idempotency-Key si falla la red", async () => {
+    global.fetch
+      .mockRejectedValueOnce(new TypeError("Failed to fetch"))
+      .mockResolvedValueOnce(
+        mockResponse({ status: 201, json: () => Promise.resolve({ todo: { id: "1" } }) })
+      );
+
+    await expect(createTodo({ email: "demo@example.com", title: "Test" })).resolves.toEqual({
+      todo: { id: "1" },
+    });
+
+    expect(global.fetch).toHaveBeenCalledTimes(2);
+    const [, first] = global.fetch.mock.calls[0];
+    const [, retry] = global.fetch.mock.calls[1];
+    expect(first.headers["Idempotency-Key"]).toBeTruthy();
+    expect(retry.headers["Idempotency-Key"]).toBe(first.headers["Idempotency-Key"]);
+  });
+
   it("propaga correctamente las llamadas de actualizaci\u00f3n y eliminaci\u00f3n", async () => {
     global.fetch
       .mockResolvedValueOnce(
@@ -91,12 +128,12 @@ describe("api service", () => {
     await updateTodo("1", { completed: true });
     await deleteTodo("1");
 
-    expect(global.fetch).toHaveBeenNthCalledWith(1, "http://localhost:8080/todos/1", {
+    expect(global.fetch).toHaveBeenNthCalledWith(1, "http://localhost:8080/v1/todos/1", {
       method: "PUT",
       headers: { "Content-Type": "application/json" },
       body: JSON.stringify({ completed: true }),
     });
-    expect(global.fetch).toHaveBeenNthCalledWith(2, "http://localhost:8080/todos/1", {
+    expect(global.fetch).toHaveBeenNthCalledWith(2, "http://localhost:8080/v1/todos/1", {
       method: "DELETE",
     });
   });
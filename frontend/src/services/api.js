@@ -8,6 +8,9 @@ const API_URL =
   process.env.REACT_APP_API_URL ||
   "http://localhost:8080";
 
+// Las rutas sin version estan deprecadas y se eliminaran; usar siempre /v1.
+const API_BASE = `${API_URL}/v1`;
+
 async function handleResponse(response) {
   const contentType = response.headers.get("Content-Type") || "";
   const isJSON = contentType.includes("application/json");
@@ -15,14 +18,38 @@ async function handleResponse(response) {
 
   if (!response.ok) {
     const message = payload.error || "Error inesperado en el servidor";
-    throw new Error(message);
+    const error = new Error(message);
+    error.code = payload.code;
+    error.status = response.status;
+    error.fields = payload.fields || [];
+    throw error;
   }
 
   return payload;
 }
 
+function newIdempotencyKey() {
+  if (typeof crypto !== "undefined" && crypto.randomUUID) {
+    return crypto.randomUUID();
+  }
+  return `${Date.now()}-${Math.random().toString(36).slice(2)}`;
+}
+
+// Reintenta una vez si la red falla; el Idempotency-Key evita duplicados
+// cuando el servidor ya habia procesado la primera solicitud.
+async function fetchWithRetry(url, options, retries = 1) {
+  try {
+    return await fetch(url, options);
+  } catch (error) {
+    if (retries <= 0) {
+      throw error;
+    }
+    return fetchWithRetry(url, options, retries - 1);
+  }
+}
+
 export async function registerUser({ email, password }) {
-  const response = await fetch(`${API_URL}/register`, {
+  const response = await fetch(`${API_BASE}/register`, {
     method: "POST",
     headers: { "Content-Type": "application/json" },
     body: JSON.stringify({ email, password }),
@@ -31,7 +58,7 @@ export async function registerUser({ email, password }) {
 }
 
 export async function loginUser({ email, password }) {
-  const response = await fetch(`${API_URL}/login`, {
+  const response = await fetch(`${API_BASE}/login`, {
     method: "POST",
     headers: { "Content-Type": "application/json" },
     body: JSON.stringify({ email, password }),
@@ -40,7 +67,7 @@ export async function loginUser({ email, password }) {
 }
 
 export async function getTodos(email) {
-  const url = new URL(`${API_URL}/todos`);
+  const url = new URL(`${API_BASE}/todos`);
   if (email) {
     url.searchParams.append("email", email);
   }
@@ -49,16 +76,19 @@ export async function getTodos(email) {
 }
 
 export async function createTodo({ email, title }) {
-  const response = await fetch(`${API_URL}/todos`, {
+  const response = await fetchWithRetry(`${API_BASE}/todos`, {
     method: "POST",
-    headers: { "Content-Type": "application/json" },
+    headers: {
+      "Content-Type": "application/json",
+      "Idempotency-Key": newIdempotencyKey(),
+    },
     body: JSON.stringify({ email, title }),
   });
   return handleResponse(response);
 }
 
 export async function updateTodo(id, data) {
-  const response = await fetch(`${API_URL}/todos/${id}`, {
+  const response = await fetch(`${API_BASE}/todos/${id}`, {
     method: "PUT",
     headers: { "Content-Type": "application/json" },
     body: JSON.stringify(data),
@@ -67,7 +97,7 @@ export async function updateTodo(id, data) {
 }
 
 export async function deleteTodo(id) {
-  const response = await fetch(`${API_URL}/todos/${id}`, {
+  const response = await fetch(`${API_BASE}/todos/${id}`, {
     method: "DELETE",
   });
   return handleResponse(response);